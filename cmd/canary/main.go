@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cockroachdb/helm-charts/pkg/canary"
+)
+
+// rootCmd represents the canary command
+var rootCmd = &cobra.Command{
+	Use:   "canary",
+	Short: "canary continuously probes a CockroachDB cluster with a trivial read/write transaction",
+	Long: `canary executes a transaction upserting and reading back a row of its table every interval with the cockroach
+SQL client, as a client of the cluster would, and serves the availability and the latency of the cluster seen from the
+client side in the Prometheus text format on /metrics. It gives an end-to-end signal independent of the metrics of
+CockroachDB itself`,
+	RunE:          run,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var (
+	cockroach     string
+	host          string
+	certsDir      string
+	insecure      bool
+	table         string
+	id            string
+	interval      time.Duration
+	timeout       time.Duration
+	listenAddress string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&cockroach, "cockroach", "/usr/local/bin/cockroach", "path of the cockroach binary")
+	rootCmd.Flags().StringVar(&host, "host", "", "address of the CockroachDB cluster, e.g. its public Service")
+	rootCmd.Flags().StringVar(&certsDir, "certs-dir", "", "directory holding the CA and client certificates")
+	rootCmd.Flags().BoolVar(&insecure, "insecure", false, "connect to an insecure cluster")
+	rootCmd.Flags().StringVar(&table, "table", "defaultdb.public.helm_canary", "table the probes write to, created if it doesn't exist")
+	rootCmd.Flags().StringVar(&id, "id", "", "id of the row of the canary, defaults to the hostname")
+	rootCmd.Flags().DurationVar(&interval, "interval", 10*time.Second, "time between the probes")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 5*time.Second, "time limit of a probe")
+	rootCmd.Flags().StringVar(&listenAddress, "listen-address", ":9103", "address the metrics are served on")
+
+	_ = rootCmd.MarkFlagRequired("host")
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	if insecure == (certsDir != "") {
+		return errors.New("exactly one of --certs-dir and --insecure must be set")
+	}
+	if err := canary.ValidateTable(table); err != nil {
+		return err
+	}
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		id = hostname
+	}
+
+	prober := &canary.Prober{
+		Exec:    execSQL,
+		Table:   table,
+		ID:      id,
+		Timeout: timeout,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prober.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	go prober.Run(ctx, interval, log.Printf)
+
+	fmt.Printf("probing %s every %s, serving the metrics on %s\n", host, interval, listenAddress)
+	return http.ListenAndServe(listenAddress, mux)
+}
+
+// execSQL runs statements with the cockroach SQL client, which stops at the first failing statement, rolling back the
+// transaction of the probe.
+func execSQL(ctx context.Context, sql string) (string, error) {
+	sqlArgs := []string{"sql", "--host=" + host, "--set=errexit=true"}
+	if insecure {
+		sqlArgs = append(sqlArgs, "--insecure")
+	} else {
+		sqlArgs = append(sqlArgs, "--certs-dir="+certsDir)
+	}
+
+	c := exec.CommandContext(ctx, cockroach, sqlArgs...)
+	c.Stdin = strings.NewReader(sql)
+	out, err := c.CombinedOutput()
+
+	return string(out), err
+}
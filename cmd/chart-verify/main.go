@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/cockroachdb/helm-charts/pkg/verify"
+)
+
+// rootCmd represents the chart-verify command
+var rootCmd = &cobra.Command{
+	Use:   "chart-verify",
+	Short: "chart-verify checks that the rendered chart would be admitted by a cluster",
+	Long: `chart-verify renders the chart with the given values and applies every rendered object to the cluster of the
+given kubeconfig context with a server-side dry run, reporting the objects rejected by the admission chain (Pod
+Security Admission, policy engines such as Kyverno, resource quotas and limit ranges) before a real install.
+
+With --post-render, the manifests are read from the standard input and written back to the standard output when they
+are all admitted, so that the tool can be used as a Helm post-renderer to make 'helm install' and 'helm upgrade' fail
+before any object is created:
+
+  helm install crdb ./cockroachdb --post-renderer chart-verify --post-renderer-args --post-render`,
+	RunE: run,
+}
+
+var (
+	chart       string
+	release     string
+	namespace   string
+	valueFiles  []string
+	setValues   []string
+	kubeContext string
+	postRender  bool
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&chart, "chart", "cockroachdb", "path of the chart to render")
+	rootCmd.Flags().StringVar(&release, "release", "cockroachdb", "release name to render the chart with")
+	rootCmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "namespace the chart is installed in")
+	rootCmd.Flags().StringSliceVarP(&valueFiles, "values", "f", nil, "values files to render the chart with")
+	rootCmd.Flags().StringArrayVar(&setValues, "set", nil, "values to render the chart with (key=value)")
+	rootCmd.Flags().StringVar(&kubeContext, "kube-context", "", "kubeconfig context of the target cluster, defaults to the current context")
+	rootCmd.Flags().BoolVar(&postRender, "post-render", false, "verify the manifests of the standard input and write them to the standard output")
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	// Logs go to stderr, as stdout holds the manifests in post-render mode.
+	log.SetOutput(os.Stderr)
+
+	var manifests []byte
+	var err error
+	if postRender {
+		manifests, err = io.ReadAll(os.Stdin)
+	} else {
+		manifests, err = render()
+	}
+	if err != nil {
+		return err
+	}
+
+	objs, err := verify.ParseManifests(bytes.NewReader(manifests))
+	if err != nil {
+		return err
+	}
+
+	warnings := &verify.WarningRecorder{}
+	cl, err := newClient(warnings)
+	if err != nil {
+		return err
+	}
+
+	results := verify.DryRun(context.Background(), cl, warnings, namespace, objs)
+
+	failed := 0
+	for _, result := range results {
+		for _, warning := range result.Warnings {
+			log.Printf("WARN %s: %s", result.Object, warning)
+		}
+		if result.Failed() {
+			log.Printf("FAIL %s (%s): %s", result.Object, result.Reason, result.Err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects would be rejected by the cluster", failed, len(results))
+	}
+	log.Printf("All %d objects would be admitted by the cluster", len(results))
+
+	if postRender {
+		_, err = os.Stdout.Write(manifests)
+		return err
+	}
+
+	return nil
+}
+
+// render renders the chart with `helm template`, including the hooks.
+func render() ([]byte, error) {
+	helmArgs := []string{"template", release, chart, "--namespace", namespace}
+	for _, f := range valueFiles {
+		helmArgs = append(helmArgs, "--values", f)
+	}
+	for _, v := range setValues {
+		helmArgs = append(helmArgs, "--set", v)
+	}
+
+	var stderr bytes.Buffer
+	helm := exec.Command("helm", helmArgs...)
+	helm.Stderr = &stderr
+	out, err := helm.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render the chart: %w: %s", err, stderr.String())
+	}
+
+	return out, nil
+}
+
+func newClient(warnings *verify.WarningRecorder) (client.Client, error) {
+	cfg, err := config.GetConfigWithContext(kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the kubeconfig: %w", err)
+	}
+	cfg.WarningHandler = warnings
+
+	// The objects are applied as unstructured ones, so the client needs no scheme of its own.
+	cl, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the client: %w", err)
+	}
+
+	return cl, nil
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cockroachdb/helm-charts/pkg/e2e"
+)
+
+// rootCmd represents the e2e-runner command
+var rootCmd = &cobra.Command{
+	Use:   "e2e-runner",
+	Short: "e2e-runner runs the e2e test suites of the chart",
+	Long: `e2e-runner runs the selected e2e test suites against the cluster of the given kubeconfig context, retries
+the runs failing because of the test infrastructure and writes a JUnit report of the results.
+
+With --matrix, the suites are run once per Kubernetes version of the support matrix of the chart instead, each time
+against a k3d cluster created for that version. With --ip-family=ipv6 or dual, these clusters are IPv6-only or
+dual-stack; without --matrix, the flag describes the cluster of the kubeconfig context. The family is passed to the
+suites in the E2E_IP_FAMILY environment variable, enabling their IPv6 and dual-stack assertions.`,
+	RunE: run,
+}
+
+var (
+	suites      []string
+	kubeContext string
+	retries     int
+	timeout     time.Duration
+	junitReport string
+	matrix      bool
+	k3d         string
+	images      []string
+	ipFamily    string
+)
+
+func init() {
+	rootCmd.Flags().StringSliceVar(&suites, "suite", []string{"install", "rotate"}, "e2e test suites to run, from the tests/e2e directory")
+	rootCmd.Flags().StringVar(&kubeContext, "kube-context", "", "kubeconfig context of the cluster to test against, defaults to the current context")
+	rootCmd.Flags().IntVar(&retries, "retries", 1, "number of times a suite failing because of the test infrastructure is retried")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 60*time.Minute, "timeout of each suite run")
+	rootCmd.Flags().StringVar(&junitReport, "junit", "", "file the JUnit report is written to")
+	rootCmd.Flags().BoolVar(&matrix, "matrix", false, "run the suites against a k3d cluster for each Kubernetes version of the support matrix")
+	rootCmd.Flags().StringVar(&k3d, "k3d", "k3d", "k3d binary used to create the clusters of the matrix")
+	rootCmd.Flags().StringSliceVar(&images, "import-image", nil, "image imported into the clusters of the matrix")
+	rootCmd.Flags().StringVar(&ipFamily, "ip-family", "ipv4", "IP family of the clusters: ipv4, ipv6 or dual")
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	family, err := e2e.ParseIPFamily(ipFamily)
+	if err != nil {
+		return err
+	}
+
+	var results []e2e.JUnitTestSuite
+	failed := false
+	if matrix {
+		for _, version := range e2e.SupportMatrix {
+			versionResults, err := runMatrixVersion(version, family)
+			if err != nil {
+				log.Printf("Kubernetes %s failed: %s", version.Minor, err)
+				failed = true
+			}
+			results = append(results, versionResults...)
+		}
+	} else {
+		results, err = runSuites(kubeContext, family, "")
+		if err != nil {
+			failed = true
+		}
+	}
+
+	if junitReport != "" {
+		f, err := os.Create(junitReport)
+		if err != nil {
+			return fmt.Errorf("failed to create the JUnit report: %w", err)
+		}
+		defer f.Close()
+
+		if err := e2e.WriteJUnit(f, results); err != nil {
+			return fmt.Errorf("failed to write the JUnit report: %w", err)
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("some e2e suites failed")
+	}
+
+	return nil
+}
+
+// runMatrixVersion creates a k3d cluster of the given IP family running the given Kubernetes version, runs the suites
+// against it and deletes it. The suites are reported as <suite>@<version>, followed by /<family> for IPv6-only and
+// dual-stack clusters.
+func runMatrixVersion(version e2e.KubernetesVersion, family e2e.IPFamily) ([]e2e.JUnitTestSuite, error) {
+	cluster := "e2e-" + strings.ReplaceAll(version.Minor, ".", "-")
+	suffix := "@" + version.Minor
+	if family != e2e.IPv4 {
+		cluster += "-" + string(family)
+		suffix += "/" + string(family)
+	}
+
+	if networkArgs := family.DockerNetworkArgs(cluster); networkArgs != nil {
+		if err := runCommand("docker", networkArgs...); err != nil {
+			return nil, fmt.Errorf("failed to create the %s network of cluster %s: %w", family, cluster, err)
+		}
+		defer func() {
+			if err := runCommand("docker", "network", "rm", cluster); err != nil {
+				log.Printf("Failed to delete the network of cluster %s: %s", cluster, err)
+			}
+		}()
+	}
+
+	log.Printf("Creating %s cluster %s with Kubernetes %s", family, cluster, version.Minor)
+	createArgs := append([]string{"cluster", "create", cluster, "--image", version.K3sImage, "--wait"}, family.K3dArgs(cluster)...)
+	if err := runCommand(k3d, createArgs...); err != nil {
+		return nil, fmt.Errorf("failed to create cluster %s: %w", cluster, err)
+	}
+	defer func() {
+		if err := runCommand(k3d, "cluster", "delete", cluster); err != nil {
+			log.Printf("Failed to delete cluster %s: %s", cluster, err)
+		}
+	}()
+
+	if len(images) > 0 {
+		importArgs := append([]string{"image", "import", "-c", cluster}, images...)
+		if err := runCommand(k3d, importArgs...); err != nil {
+			return nil, fmt.Errorf("failed to import the images into cluster %s: %w", cluster, err)
+		}
+	}
+
+	return runSuites("k3d-"+cluster, family, suffix)
+}
+
+// runSuites runs the selected suites against the cluster of the given kubeconfig context and IP family, appending
+// suffix to the names of the reported suites.
+func runSuites(context string, family e2e.IPFamily, suffix string) ([]e2e.JUnitTestSuite, error) {
+	env := append(os.Environ(), e2e.IPFamilyEnv+"="+string(family))
+	if context != "" {
+		kubeconfig, err := contextKubeconfig(context)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(kubeconfig)
+
+		env = append(env, "KUBECONFIG="+kubeconfig)
+	}
+
+	var results []e2e.JUnitTestSuite
+	var failed error
+	for _, suite := range suites {
+		result, err := runSuite(suite, env)
+		if err != nil {
+			log.Printf("Suite %s%s failed: %s", suite, suffix, err)
+			failed = fmt.Errorf("some e2e suites failed")
+		}
+		result.Name += suffix
+		results = append(results, result)
+	}
+
+	return results, failed
+}
+
+// runCommand runs a command, printing its output.
+func runCommand(name string, args ...string) error {
+	c := exec.Command(name, args...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	return c.Run()
+}
+
+// runSuite runs the tests of a suite, retrying the runs failing because of the test infrastructure.
+func runSuite(suite string, env []string) (e2e.JUnitTestSuite, error) {
+	for attempt := 0; ; attempt++ {
+		log.Printf("Running suite %s (attempt %d)", suite, attempt+1)
+
+		var output bytes.Buffer
+		goTest := exec.Command("go", "test", "-json", "-timeout", timeout.String(), fmt.Sprintf("./tests/e2e/%s/...", suite))
+		goTest.Env = env
+		goTest.Stdout = io.MultiWriter(&output, newOutputPrinter(os.Stdout))
+		goTest.Stderr = os.Stderr
+		runErr := goTest.Run()
+
+		events, err := e2e.ParseTestEvents(&output)
+		if err != nil {
+			return e2e.JUnitTestSuite{Name: suite}, fmt.Errorf("failed to parse the test events: %w", err)
+		}
+		result := e2e.NewJUnitTestSuite(suite, events)
+
+		if runErr == nil {
+			return result, nil
+		}
+
+		if attempt >= retries || !e2e.IsInfraFlake(output.String()) {
+			return result, runErr
+		}
+
+		log.Printf("Suite %s failed because of the test infrastructure, retrying", suite)
+	}
+}
+
+// contextKubeconfig writes a kubeconfig holding only the given context, so that the suites don't depend on the
+// current context of the user kubeconfig.
+func contextKubeconfig(context string) (string, error) {
+	out, err := exec.Command("kubectl", "config", "view", "--minify", "--flatten", "--context", context).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read kubeconfig context %s: %w", context, err)
+	}
+
+	f, err := os.CreateTemp("", "e2e-kubeconfig-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(out); err != nil {
+		return "", err
+	}
+
+	return filepath.Abs(f.Name())
+}
+
+// outputPrinter prints the test output held by the `go test -json` events written to it.
+type outputPrinter struct {
+	w       io.Writer
+	pending []byte
+}
+
+func newOutputPrinter(w io.Writer) *outputPrinter {
+	return &outputPrinter{w: w}
+}
+
+func (p *outputPrinter) Write(b []byte) (int, error) {
+	p.pending = append(p.pending, b...)
+	for {
+		i := bytes.IndexByte(p.pending, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+
+		line := p.pending[:i+1]
+		p.pending = p.pending[i+1:]
+
+		events, _ := e2e.ParseTestEvents(bytes.NewReader(line))
+		if len(events) == 0 {
+			// Not an event, e.g. a build error.
+			fmt.Fprint(p.w, string(line))
+			continue
+		}
+		if events[0].Action == "output" {
+			fmt.Fprint(p.w, events[0].Output)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/kube"
+	"github.com/cockroachdb/helm-charts/pkg/provision"
+)
+
+// rootCmd represents the provisioner command
+var rootCmd = &cobra.Command{
+	Use:   "provisioner",
+	Short: "provisioner applies the provisioning SQL of the chart",
+	Long: `provisioner applies the provisioning steps rendered by the chart with the cockroach SQL client. The
+statements of a transactional step are applied in a single transaction, so that the step is applied all or nothing,
+and transaction contention and the unavailability of the cluster are retried. Progress is logged as JSON lines,
+followed by a summary of the steps, and the command fails on the first step that can't be applied. The outcome is also
+reported as an event on the StatefulSet given by --event-statefulset`,
+	RunE:          run,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var (
+	stepsFile     string
+	cockroach     string
+	host          string
+	certsDir      string
+	insecure      bool
+	retries       int
+	retryInterval time.Duration
+
+	eventStatefulSet string
+	eventNamespace   string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&stepsFile, "steps", "", "file holding the provisioning steps rendered by the chart")
+	rootCmd.Flags().StringVar(&cockroach, "cockroach", "/cockroach/cockroach", "path of the cockroach binary")
+	rootCmd.Flags().StringVar(&host, "host", "", "address of the CockroachDB node the statements are run against")
+	rootCmd.Flags().StringVar(&certsDir, "certs-dir", "", "directory holding the CA and root client certificates")
+	rootCmd.Flags().BoolVar(&insecure, "insecure", false, "connect to an insecure cluster")
+	rootCmd.Flags().IntVar(&retries, "retries", 60, "number of times a statement failing with a transient error is retried")
+	rootCmd.Flags().DurationVar(&retryInterval, "retry-interval", 5*time.Second, "time between the retries of a statement")
+	rootCmd.Flags().StringVar(&eventStatefulSet, "event-statefulset", "", "name of the StatefulSet the outcome is reported on as an event, if set")
+	rootCmd.Flags().StringVar(&eventNamespace, "event-namespace", "", "namespace of the StatefulSet given by --event-statefulset")
+
+	_ = rootCmd.MarkFlagRequired("steps")
+	_ = rootCmd.MarkFlagRequired("host")
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	if insecure == (certsDir != "") {
+		return errors.New("exactly one of --certs-dir and --insecure must be set")
+	}
+
+	f, err := os.Open(stepsFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	steps, err := provision.LoadSteps(f)
+	if err != nil {
+		return err
+	}
+
+	logger := provision.NewLogger(os.Stdout)
+	runner := provision.Runner{
+		Exec:          execSQL,
+		Lookup:        os.LookupEnv,
+		Retries:       retries,
+		RetryInterval: retryInterval,
+		Log:           logger,
+	}
+
+	results, err := runner.Run(cmd.Context(), steps)
+	logger.Summary(results, err)
+
+	if eventStatefulSet != "" {
+		if eErr := emitEvent(cmd.Context(), len(results), err); eErr != nil {
+			logger.Error("failed to emit event", provision.Fields{"statefulset": eventStatefulSet, "error": eErr.Error()})
+		}
+	}
+
+	return err
+}
+
+// emitEvent reports the outcome of the provisioning as an event on the StatefulSet, using the ServiceAccount of the
+// init Job.
+func emitEvent(ctx context.Context, applied int, provisioningErr error) error {
+	config, err := controllerruntime.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	cl, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	if provisioningErr != nil {
+		return kube.EmitStatefulSetEvent(ctx, cl, eventNamespace, eventStatefulSet, "provisioner", corev1.EventTypeWarning,
+			"ProvisioningFailed", fmt.Sprintf("provisioning failed: %s", provisioningErr))
+	}
+
+	return kube.EmitStatefulSetEvent(ctx, cl, eventNamespace, eventStatefulSet, "provisioner", corev1.EventTypeNormal,
+		"ProvisioningCompleted", fmt.Sprintf("provisioning completed, %d steps applied", applied))
+}
+
+// execSQL runs statements with the cockroach SQL client. The statements are passed on the standard input rather than
+// the command line, so that the passwords they hold don't show in the process list, and the client stops at the first
+// failing statement, which rolls back an open transaction.
+func execSQL(ctx context.Context, sql string) (string, error) {
+	sqlArgs := []string{"sql", "--host=" + host, "--set=errexit=true"}
+	if insecure {
+		sqlArgs = append(sqlArgs, "--insecure")
+	} else {
+		sqlArgs = append(sqlArgs, "--certs-dir="+certsDir)
+	}
+
+	c := exec.CommandContext(ctx, cockroach, sqlArgs...)
+	c.Stdin = strings.NewReader(sql)
+	out, err := c.CombinedOutput()
+
+	return string(out), err
+}
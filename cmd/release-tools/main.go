@@ -0,0 +1,227 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cockroachdb/helm-charts/pkg/release"
+)
+
+// rootCmd represents the release-tools command
+var rootCmd = &cobra.Command{
+	Use:   "release-tools",
+	Short: "release-tools signs the packaged chart and describes the images it references",
+	Long: `release-tools makes the chart releases consumable by supply-chain-strict users: it packages the chart with a
+Helm provenance file and a cosign signature, generates a CycloneDX SBOM of the images referenced in the values of
+the chart, and verifies that these images are published with the digests pinned in the values.`,
+	// The failures are the ones of the registries and of the signing tools, not of the usage.
+	SilenceUsage: true,
+}
+
+// signCmd represents the sign command
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "packages the chart with a Helm provenance file and signs the package with cosign",
+	Long: `sign packages the chart with 'helm package --sign', writing the <chart>-<version>.tgz.prov provenance file
+next to the package, verifies it with 'helm verify', and signs the package with 'cosign sign-blob', writing the
+<chart>-<version>.tgz.sig signature. Without --cosign-key, the package is signed keyless and the signing certificate
+is written to <chart>-<version>.tgz.pem.`,
+	RunE: sign,
+}
+
+// sbomCmd represents the sbom command
+var sbomCmd = &cobra.Command{
+	Use:   "sbom",
+	Short: "generates a CycloneDX SBOM of the images referenced in the values of the chart",
+	RunE:  generateSBOM,
+}
+
+// verifyImagesCmd represents the verify-images command
+var verifyImagesCmd = &cobra.Command{
+	Use:   "verify-images",
+	Short: "verifies that the images referenced in the values of the chart are published",
+	Long: `verify-images resolves the published digest of every image referenced in the values of the chart, and fails
+if an image isn't published or if the digest pinned in the values doesn't match the published one.`,
+	RunE: verifyImages,
+}
+
+var (
+	chart          string
+	destination    string
+	signingKey     string
+	keyring        string
+	cosignKey      string
+	output         string
+	resolveDigests bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&chart, "chart", "cockroachdb", "path of the chart")
+
+	signCmd.Flags().StringVar(&destination, "destination", "build/artifacts", "directory the signed package is written to")
+	signCmd.Flags().StringVar(&signingKey, "key", "", "name of the PGP key signing the provenance file")
+	signCmd.Flags().StringVar(&keyring, "keyring", "", "path of the PGP keyring holding the signing key")
+	signCmd.Flags().StringVar(&cosignKey, "cosign-key", "", "cosign private key signing the package, signs keyless if empty")
+	for _, flag := range []string{"key", "keyring"} {
+		if err := signCmd.MarkFlagRequired(flag); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	sbomCmd.Flags().StringVarP(&output, "output", "o", "", "path the SBOM is written to, defaults to the standard output")
+	sbomCmd.Flags().BoolVar(&resolveDigests, "resolve-digests", false, "record the published digests of the images not pinned in the values")
+
+	rootCmd.AddCommand(signCmd, sbomCmd, verifyImagesCmd)
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func sign(cmd *cobra.Command, args []string) error {
+	name, version, err := chartMetadata()
+	if err != nil {
+		return err
+	}
+	pkg := filepath.Join(destination, fmt.Sprintf("%s-%s.tgz", name, version))
+
+	if err := os.MkdirAll(destination, 0o755); err != nil {
+		return err
+	}
+	if err := runCommand("helm", "package", chart, "--destination", destination,
+		"--sign", "--key", signingKey, "--keyring", keyring); err != nil {
+		return err
+	}
+	if err := runCommand("helm", "verify", pkg, "--keyring", keyring); err != nil {
+		return err
+	}
+
+	cosignArgs := []string{"sign-blob", "--yes", "--output-signature", pkg + ".sig"}
+	if cosignKey != "" {
+		cosignArgs = append(cosignArgs, "--key", cosignKey)
+	} else {
+		cosignArgs = append(cosignArgs, "--output-certificate", pkg+".pem")
+	}
+	if err := runCommand("cosign", append(cosignArgs, pkg)...); err != nil {
+		return err
+	}
+
+	log.Printf("Signed %s", pkg)
+	return nil
+}
+
+func generateSBOM(cmd *cobra.Command, args []string) error {
+	name, version, err := chartMetadata()
+	if err != nil {
+		return err
+	}
+	images, err := chartImages()
+	if err != nil {
+		return err
+	}
+
+	if resolveDigests {
+		results := release.VerifyDigests(context.Background(), release.RegistryResolver{}, images)
+		for i, result := range results {
+			if result.Err != nil {
+				return fmt.Errorf("%s: %w", result.Image.Path, result.Err)
+			}
+			images[i].Digest = result.Digest
+		}
+	}
+
+	bom, err := release.SBOM(name, version, images, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(bom)
+		return err
+	}
+	return os.WriteFile(output, bom, 0o644)
+}
+
+func verifyImages(cmd *cobra.Command, args []string) error {
+	images, err := chartImages()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range release.VerifyDigests(context.Background(), release.RegistryResolver{}, images) {
+		if result.Err != nil {
+			log.Printf("FAIL %s (%s): %s", result.Image.Reference(), result.Image.Path, result.Err)
+			failed++
+			continue
+		}
+		log.Printf("OK   %s (%s): %s", result.Image.Reference(), result.Image.Path, result.Digest)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed the verification", failed, len(images))
+	}
+	return nil
+}
+
+// chartMetadata returns the name and the version of the chart.
+func chartMetadata() (string, string, error) {
+	out, err := os.ReadFile(filepath.Join(chart, "Chart.yaml"))
+	if err != nil {
+		return "", "", err
+	}
+
+	var metadata struct {
+		Name    string `yaml:"name"`
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(out, &metadata); err != nil {
+		return "", "", fmt.Errorf("failed to parse the Chart.yaml of %s: %w", chart, err)
+	}
+	return metadata.Name, metadata.Version, nil
+}
+
+// chartImages returns the images referenced in the values of the chart.
+func chartImages() ([]release.Image, error) {
+	values, err := os.ReadFile(filepath.Join(chart, "values.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	return release.ImagesFromValues(values)
+}
+
+func runCommand(name string, args ...string) error {
+	c := exec.Command(name, args...)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w", name, args[0], err)
+	}
+	return nil
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"github.com/cockroachdb/helm-charts/pkg/resource"
@@ -29,18 +30,35 @@ import (
 // cleanupCmd represents the cleanup command
 var cleanupCmd = &cobra.Command{
 	Use:   "cleanup",
-	Short: "cleanup cleans up the secrets generated using self-signer utility",
-	Long:  `cleanup sub-command cleans up the secrets i.e. node, client and CA secrets generated using self-signer utility`,
-	Run:   cleanup,
+	Short: "cleanup cleans up the resources left behind by the chart",
+	Long: `cleanup sub-command cleans up the secrets i.e. node, client and CA secrets generated using self-signer utility,
+and optionally the certificate signing requests of the nodes and the completed jobs of the release`,
+	Run: cleanup,
 }
 
-var namespace string
+var (
+	namespace          string
+	cleanSecrets       bool
+	cleanCSRs          bool
+	cleanStartOrdinal  int
+	cleanReplicas      int
+	cleanCompletedJobs bool
+	cleanJobSelector   string
+	cleanDryRun        bool
+)
 
 func init() {
 	cleanupCmd.Flags().StringVar(&namespace, "namespace", "", "namespace of the resources to be cleaned up")
 	if err := cleanupCmd.MarkFlagRequired("namespace"); err != nil {
 		log.Fatal(err)
 	}
+	cleanupCmd.Flags().BoolVar(&cleanSecrets, "secrets", true, "delete the secrets generated by the self-signer")
+	cleanupCmd.Flags().BoolVar(&cleanCSRs, "csrs", false, "delete the certificate signing requests of the nodes and the root client")
+	cleanupCmd.Flags().IntVar(&cleanStartOrdinal, "start-ordinal", 0, "ordinal of the first node the certificate signing requests are deleted for")
+	cleanupCmd.Flags().IntVar(&cleanReplicas, "replicas", 3, "number of nodes the certificate signing requests are deleted for")
+	cleanupCmd.Flags().BoolVar(&cleanCompletedJobs, "completed-jobs", false, "delete the completed jobs matching --job-selector")
+	cleanupCmd.Flags().StringVar(&cleanJobSelector, "job-selector", "", "label selector of the jobs deleted once completed")
+	cleanupCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "only log the resources that would be deleted")
 	rootCmd.AddCommand(cleanupCmd)
 }
 
@@ -51,5 +69,27 @@ func cleanup(cmd *cobra.Command, args []string) {
 		log.Fatal("Required STATEFULSET_NAME env not found")
 	}
 
-	resource.Clean(ctx, cl, namespace, stsName)
+	opts := resource.CleanOptions{
+		Secrets:       cleanSecrets,
+		CSRs:          cleanCSRs,
+		StartOrdinal:  cleanStartOrdinal,
+		Replicas:      cleanReplicas,
+		CompletedJobs: cleanCompletedJobs,
+		DryRun:        cleanDryRun,
+	}
+
+	if cleanCompletedJobs {
+		// an empty selector would match all the jobs of the namespace
+		if cleanJobSelector == "" {
+			log.Fatal("--job-selector is required with --completed-jobs")
+		}
+
+		selector, err := labels.Parse(cleanJobSelector)
+		if err != nil {
+			log.Fatalf("invalid --job-selector: %s", err)
+		}
+		opts.JobSelector = selector
+	}
+
+	resource.Clean(ctx, cl, namespace, stsName, opts)
 }
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package self_signer
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/cockroachdb/helm-charts/pkg/resource"
+)
+
+// collectCSRsCmd represents the collect-csrs command
+var collectCSRsCmd = &cobra.Command{
+	Use:   "collect-csrs",
+	Short: "deletes the stale certificate signing requests of the release",
+	Long: `collect-csrs sub-command deletes the certificate signing requests of the release which are issued, denied or
+failed and older than the TTL, e.g. the ones accumulated by reinstalls`,
+	Run: collectCSRs,
+}
+
+var (
+	collectCSRsNamespace string
+	collectCSRsSelector  string
+	collectCSRsTTL       time.Duration
+	collectCSRsDryRun    bool
+)
+
+func init() {
+	rootCmd.AddCommand(collectCSRsCmd)
+
+	collectCSRsCmd.Flags().StringVar(&collectCSRsNamespace, "namespace", "", "namespace of the release")
+	collectCSRsCmd.Flags().StringVar(&collectCSRsSelector, "selector", "", "label selector of the certificate signing requests of the release")
+	collectCSRsCmd.Flags().DurationVar(&collectCSRsTTL, "ttl", 168*time.Hour, "age after which a certificate signing request in a terminal state is deleted")
+	collectCSRsCmd.Flags().BoolVar(&collectCSRsDryRun, "dry-run", false, "only log the certificate signing requests that would be deleted")
+	if err := collectCSRsCmd.MarkFlagRequired("namespace"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func collectCSRs(cmd *cobra.Command, args []string) {
+	stsName, exists := os.LookupEnv("STATEFULSET_NAME")
+	if !exists {
+		log.Fatal("Required STATEFULSET_NAME env not found")
+	}
+
+	selector, err := labels.Parse(collectCSRsSelector)
+	if err != nil {
+		log.Fatalf("invalid --selector: %s", err)
+	}
+
+	opts := resource.CSRCollectOptions{
+		Selector: selector,
+		TTL:      collectCSRsTTL,
+		DryRun:   collectCSRsDryRun,
+	}
+
+	if err := resource.CollectCSRs(ctx, cl, collectCSRsNamespace, stsName, opts); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package self_signer
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cockroachdb/helm-charts/pkg/drift"
+)
+
+const driftComponent = "drift-detector"
+
+// detectDriftCmd represents the detect-drift command
+var detectDriftCmd = &cobra.Command{
+	Use:   "detect-drift",
+	Short: "detects the out-of-band edits of the objects of the release",
+	Long: `detect-drift sub-command compares the objects of the deployed revision of the Helm release, read from the
+release Secrets, with their live state, and reports the fields edited out of band, e.g. with kubectl edit, as a
+warning event on the StatefulSet and optionally as metrics pushed to a Prometheus Pushgateway`,
+	Run: detectDrift,
+}
+
+var (
+	driftNamespace      string
+	driftRelease        string
+	driftKinds          []string
+	driftPushgatewayURL string
+	driftFailOnDrift    bool
+)
+
+func init() {
+	rootCmd.AddCommand(detectDriftCmd)
+
+	detectDriftCmd.Flags().StringVar(&driftNamespace, "namespace", "", "namespace of the release")
+	detectDriftCmd.Flags().StringVar(&driftRelease, "release", "", "name of the release")
+	detectDriftCmd.Flags().StringSliceVar(&driftKinds, "kind", []string{"StatefulSet"}, "kinds of the release objects compared with their live state")
+	detectDriftCmd.Flags().StringVar(&driftPushgatewayURL, "pushgateway-url", "", "URL of the Prometheus Pushgateway the drift metrics are pushed to")
+	detectDriftCmd.Flags().BoolVar(&driftFailOnDrift, "fail-on-drift", false, "exit with an error when a drift is detected")
+	for _, flag := range []string{"namespace", "release"} {
+		if err := detectDriftCmd.MarkFlagRequired(flag); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func detectDrift(cmd *cobra.Command, args []string) {
+	release, err := drift.DeployedRelease(ctx, cl, driftNamespace, driftRelease)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	drifts, err := drift.Detect(ctx, cl, driftNamespace, release.Manifest, driftKinds)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if driftPushgatewayURL != "" {
+		httpClient := &http.Client{Timeout: 30 * time.Second}
+		if err := drift.PushMetrics(ctx, httpClient, driftPushgatewayURL, driftNamespace, driftRelease, drifts); err != nil {
+			log.Print(err)
+		}
+	}
+
+	if len(drifts) == 0 {
+		log.Printf("No drift from revision %d of release %s", release.Version, driftRelease)
+		return
+	}
+
+	var lines []string
+	for _, d := range drifts {
+		lines = append(lines, fmt.Sprintf("%s: %s", d.Object, strings.Join(d.Fields, ", ")))
+	}
+	message := fmt.Sprintf("%d objects drifted from revision %d of release %s:\n%s", len(drifts), release.Version,
+		driftRelease, strings.Join(lines, "\n"))
+	log.Print(message)
+	emitEvent(driftNamespace, driftComponent, corev1.EventTypeWarning, "DriftDetected", message)
+
+	if driftFailOnDrift {
+		log.Fatal("drift detected")
+	}
+}
@@ -37,6 +37,7 @@ var (
 	caExpiry, nodeExpiry, clientExpiry       string
 	caSecret                                 string
 	clientOnly                               bool
+	splitCA                                  bool
 )
 
 func init() {
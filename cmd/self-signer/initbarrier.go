@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package self_signer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/kube"
+)
+
+const (
+	initBarrierComponent = "init-barrier"
+
+	initStatusInitialized = "Initialized"
+	initStatusTimedOut    = "TimedOut"
+)
+
+// initBarrierCmd represents the init-barrier command
+var initBarrierCmd = &cobra.Command{
+	Use:   "init-barrier",
+	Short: "records the completion of the cluster init",
+	Long: `init-barrier sub-command waits for the cluster init container of the init job to complete and records
+the outcome in a ConfigMap. If the cluster init doesn't complete within the timeout, a warning event is emitted on
+every CockroachDB pod so that the reason pods are waiting for init is visible where it is looked for. The outcome is
+also reported as an event on the StatefulSet given by --event-statefulset`,
+	Run: initBarrier,
+}
+
+var (
+	initBarrierConfigMap   string
+	initBarrierContainer   string
+	initBarrierPodSelector string
+	initBarrierTimeout     time.Duration
+)
+
+func init() {
+	rootCmd.AddCommand(initBarrierCmd)
+
+	initBarrierCmd.Flags().StringVar(&initBarrierConfigMap, "configmap", "", "name of the ConfigMap the init status is written to")
+	initBarrierCmd.Flags().StringVar(&initBarrierContainer, "container", "cluster-init", "name of the container running the cluster init")
+	initBarrierCmd.Flags().StringVar(&initBarrierPodSelector, "pod-selector", "", "label selector of the CockroachDB pods events are emitted on")
+	initBarrierCmd.Flags().DurationVar(&initBarrierTimeout, "timeout", 10*time.Minute, "time to wait for the cluster init to complete")
+}
+
+func initBarrier(cmd *cobra.Command, args []string) {
+	podName, exists := os.LookupEnv("POD_NAME")
+	if !exists {
+		log.Panic("Required POD_NAME env not found")
+	}
+
+	namespace, exists := os.LookupEnv("POD_NAMESPACE")
+	if !exists {
+		log.Panic("Required POD_NAMESPACE env not found")
+	}
+
+	selector, err := labels.Parse(initBarrierPodSelector)
+	if err != nil {
+		log.Panicf("invalid pod selector %s: %s", initBarrierPodSelector, err)
+	}
+
+	deadline := time.Now().Add(initBarrierTimeout)
+	for {
+		var pod corev1.Pod
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: podName}, &pod); err != nil {
+			log.Panicf("failed to get pod %s: %s", podName, err)
+		}
+
+		if kube.ContainerSucceeded(&pod, initBarrierContainer) {
+			setInitStatus(namespace, initStatusInitialized, "cluster init completed successfully")
+			emitEvent(namespace, initBarrierComponent, corev1.EventTypeNormal, "ClusterInitialized", "cluster init completed successfully")
+			log.Print("Cluster init completed successfully")
+			return
+		}
+
+		if time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	message := fmt.Sprintf("cluster init has not completed within %s, check the logs of the %s container of pod %s",
+		initBarrierTimeout, initBarrierContainer, podName)
+
+	setInitStatus(namespace, initStatusTimedOut, message)
+	emitEvent(namespace, initBarrierComponent, corev1.EventTypeWarning, "ClusterInitNotCompleted", message)
+
+	var pods corev1.PodList
+	if err := cl.List(ctx, &pods, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.Panicf("failed to list the CockroachDB pods: %s", err)
+	}
+
+	for i := range pods.Items {
+		event := kube.NewWarningEvent(&pods.Items[i], initBarrierComponent, "ClusterInitNotCompleted", message)
+		if err := cl.Create(ctx, event); err != nil {
+			log.Printf("failed to emit event on pod %s: %s", pods.Items[i].Name, err)
+		}
+	}
+
+	// The termination message is shown in the status of the init job pod.
+	_ = os.WriteFile("/dev/termination-log", []byte(message), 0644)
+
+	log.Fatal(message)
+}
+
+// setInitStatus records the init status in the ConfigMap rendered by the chart.
+func setInitStatus(namespace, status, message string) {
+	var configMap corev1.ConfigMap
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: initBarrierConfigMap}, &configMap); err != nil {
+		log.Panicf("failed to get ConfigMap %s: %s", initBarrierConfigMap, err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data["status"] = status
+	configMap.Data["message"] = message
+	configMap.Data["updatedAt"] = time.Now().UTC().Format(time.RFC3339)
+
+	if err := cl.Update(ctx, &configMap); err != nil {
+		log.Panicf("failed to update ConfigMap %s: %s", initBarrierConfigMap, err)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package self_signer
+
+import (
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/kube"
+)
+
+// localityCmd represents the locality command
+var localityCmd = &cobra.Command{
+	Use:   "locality",
+	Short: "writes the CockroachDB locality derived from the node labels",
+	Long:  `locality sub-command reads the labels of the node the pod is scheduled on and writes the matching CockroachDB locality`,
+	Run:   locality,
+}
+
+var (
+	localityTiers  []string
+	localityOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(localityCmd)
+
+	localityCmd.Flags().StringSliceVar(&localityTiers, "tier",
+		[]string{"region=topology.kubernetes.io/region", "zone=topology.kubernetes.io/zone"},
+		"ordered locality tiers as key=label, the value of each tier is read from the node label")
+	localityCmd.Flags().StringVar(&localityOutput, "output", "/cockroach/locality/locality", "file the locality is written to")
+}
+
+func locality(cmd *cobra.Command, args []string) {
+	nodeName, exists := os.LookupEnv("NODE_NAME")
+	if !exists {
+		log.Panic("Required NODE_NAME env not found")
+	}
+
+	var node corev1.Node
+	if err := cl.Get(ctx, client.ObjectKey{Name: nodeName}, &node); err != nil {
+		log.Panicf("failed to get node %s: %s", nodeName, err)
+	}
+
+	loc, err := kube.LocalityFromNodeLabels(node.Labels, localityTiers)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if err := os.WriteFile(localityOutput, []byte(loc), 0644); err != nil {
+		log.Panicf("failed to write locality: %s", err)
+	}
+
+	log.Printf("Locality of node %s: %s", nodeName, loc)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package self_signer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/kube"
+)
+
+// resizeVolumesCmd represents the resize-volumes command
+var resizeVolumesCmd = &cobra.Command{
+	Use:   "resize-volumes",
+	Short: "resizes the data volumes of the CockroachDB pods",
+	Long: `resize-volumes sub-command expands the existing data volumes of the StatefulSet to their configured size,
+creates the volumes of the pods with a size override ahead of the StatefulSet and deletes the StatefulSet, leaving its
+pods running, when its volumeClaimTemplates have to change`,
+	Run: resizeVolumes,
+}
+
+var (
+	resizeStatefulSet  string
+	resizeVolumeNames  []string
+	resizeSize         string
+	resizeOverrides    []string
+	resizeStartOrdinal int
+	resizeReplicas     int
+	resizeStorageClass string
+	resizeVolumeLabels []string
+)
+
+func init() {
+	rootCmd.AddCommand(resizeVolumesCmd)
+
+	resizeVolumesCmd.Flags().StringVar(&resizeStatefulSet, "statefulset", "", "name of the CockroachDB StatefulSet")
+	resizeVolumesCmd.Flags().StringSliceVar(&resizeVolumeNames, "volume", []string{"datadir"}, "names of the volumeClaimTemplates of the data volumes")
+	resizeVolumesCmd.Flags().StringVar(&resizeSize, "size", "", "size of the data volumes")
+	resizeVolumesCmd.Flags().StringSliceVar(&resizeOverrides, "override", nil, "size of the data volumes of a pod as ordinal=size")
+	resizeVolumesCmd.Flags().IntVar(&resizeStartOrdinal, "start-ordinal", 0, "ordinal of the first pod of the StatefulSet")
+	resizeVolumesCmd.Flags().IntVar(&resizeReplicas, "replicas", 3, "number of pods of the StatefulSet")
+	resizeVolumesCmd.Flags().StringVar(&resizeStorageClass, "storage-class", "", "storage class of the created volumes, \"-\" for none")
+	resizeVolumesCmd.Flags().StringSliceVar(&resizeVolumeLabels, "label", nil, "labels of the created volumes as key=value")
+}
+
+func resizeVolumes(cmd *cobra.Command, args []string) {
+	namespace, exists := os.LookupEnv("POD_NAMESPACE")
+	if !exists {
+		log.Panic("Required POD_NAMESPACE env not found")
+	}
+
+	size, err := resource.ParseQuantity(resizeSize)
+	if err != nil {
+		log.Panicf("invalid volume size %s: %s", resizeSize, err)
+	}
+
+	overrides, err := kube.ParseOrdinalSizes(resizeOverrides)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	volumeLabels, err := labels.ConvertSelectorToLabelsMap(strings.Join(resizeVolumeLabels, ","))
+	if err != nil {
+		log.Panicf("invalid volume labels: %s", err)
+	}
+
+	for ordinal := resizeStartOrdinal; ordinal < resizeStartOrdinal+resizeReplicas; ordinal++ {
+		desired, overridden := overrides[ordinal]
+		if !overridden {
+			desired = size
+		}
+
+		for _, volume := range resizeVolumeNames {
+			name := fmt.Sprintf("%s-%s-%d", volume, resizeStatefulSet, ordinal)
+
+			var pvc corev1.PersistentVolumeClaim
+			err := cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &pvc)
+			if apierrors.IsNotFound(err) {
+				// Volumes without a size override are created by the StatefulSet.
+				if overridden {
+					createVolume(namespace, name, desired, volumeLabels)
+				}
+				continue
+			}
+			if err != nil {
+				log.Panicf("failed to get PersistentVolumeClaim %s: %s", name, err)
+			}
+
+			current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			switch desired.Cmp(current) {
+			case 1:
+				patch := client.MergeFrom(pvc.DeepCopy())
+				pvc.Spec.Resources.Requests[corev1.ResourceStorage] = desired
+				if err := cl.Patch(ctx, &pvc, patch); err != nil {
+					log.Panicf("failed to expand PersistentVolumeClaim %s, its StorageClass must allow volume expansion: %s", name, err)
+				}
+				log.Printf("Expanded PersistentVolumeClaim %s from %s to %s", name, current.String(), desired.String())
+			case -1:
+				log.Printf("PersistentVolumeClaim %s is larger than %s, volumes can't be shrunk", name, desired.String())
+			}
+		}
+	}
+
+	var sts appsv1.StatefulSet
+	err = cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: resizeStatefulSet}, &sts)
+	if apierrors.IsNotFound(err) {
+		return
+	}
+	if err != nil {
+		log.Panicf("failed to get StatefulSet %s: %s", resizeStatefulSet, err)
+	}
+
+	// The volumeClaimTemplates of a StatefulSet can't be updated. The StatefulSet is deleted without its pods, which
+	// are adopted by the StatefulSet the upgrade creates again.
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		current := template.Spec.Resources.Requests[corev1.ResourceStorage]
+		if !containsString(resizeVolumeNames, template.Name) || current.Cmp(size) == 0 {
+			continue
+		}
+
+		if err := cl.Delete(ctx, &sts, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil {
+			log.Panicf("failed to delete StatefulSet %s: %s", resizeStatefulSet, err)
+		}
+		log.Printf("Deleted StatefulSet %s, keeping its pods, to update its volumeClaimTemplates", resizeStatefulSet)
+		return
+	}
+}
+
+// createVolume creates the data volume of a pod with a size override, before the StatefulSet creates it.
+func createVolume(namespace, name string, size resource.Quantity, volumeLabels map[string]string) {
+	pvc := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    volumeLabels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+
+	if resizeStorageClass == "-" {
+		storageClass := ""
+		pvc.Spec.StorageClassName = &storageClass
+	} else if resizeStorageClass != "" {
+		pvc.Spec.StorageClassName = &resizeStorageClass
+	}
+
+	if err := cl.Create(ctx, &pvc); err != nil {
+		log.Panicf("failed to create PersistentVolumeClaim %s: %s", name, err)
+	}
+	log.Printf("Created PersistentVolumeClaim %s of %s", name, size.String())
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -30,11 +31,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/cockroachdb/helm-charts/pkg/generator"
+	"github.com/cockroachdb/helm-charts/pkg/kube"
+	"github.com/cockroachdb/helm-charts/pkg/vault"
 )
 
 var (
 	cl  client.Client
 	ctx context.Context
+
+	eventStatefulSet string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -56,6 +61,7 @@ func Execute() {
 func init() {
 	// all the common flags are attached to root command
 	rootCmd.PersistentFlags().StringVar(&caSecret, "ca-secret", "", "name of user provided CA secret")
+	rootCmd.PersistentFlags().BoolVar(&splitCA, "split-ca", false, "sign client certificates with a separate client CA")
 
 	rootCmd.PersistentFlags().StringVar(&caDuration, "ca-duration", "43800h", "duration of CA cert. Defaults to 43800h (5 years)")
 	rootCmd.PersistentFlags().StringVar(&caExpiry, "ca-expiry", "648h", "expiry window for CA cert. Defaults to 27 days")
@@ -66,6 +72,8 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&clientDuration, "client-duration", "672h", "duration of Client cert. Defaults to 28 days")
 	rootCmd.PersistentFlags().StringVar(&clientExpiry, "client-expiry", "48h", "expiry window for Client(root) cert. Defaults to 2 days")
 
+	rootCmd.PersistentFlags().StringVar(&eventStatefulSet, "event-statefulset", "", "name of the StatefulSet the milestones and failures are reported on as events, if set")
+
 	var err error
 	ctx = context.Background()
 	runtimeScheme := runtime.NewScheme()
@@ -106,13 +114,83 @@ func getInitialConfig(caDuration, caExpiry, nodeDuration, nodeExpiry, clientDura
 		}
 		genCert.PublicServiceName = stsName + "-public"
 		genCert.DiscoveryServiceName = stsName
+		// the follower reads Service is optional, and only set if it is enabled
+		genCert.FollowerReadsServiceName = os.Getenv("FOLLOWER_READS_SERVICE_NAME")
 
 		domain, exists := os.LookupEnv("CLUSTER_DOMAIN")
 		if !exists {
 			return genCert, errors.New("Required CLUSTER_DOMAIN env not found")
 		}
 		genCert.ClusterDomain = domain
+		genCert.SplitCA = splitCA
+
+		vaultConfig, err := getVaultConfig()
+		if err != nil {
+			return genCert, err
+		}
+		genCert.Vault = vaultConfig
 	}
 
 	return genCert, nil
 }
+
+// getVaultConfig returns the location of the CA in Vault when VAULT_ADDR is set, after logging in to Vault with the
+// Kubernetes auth method and the ServiceAccount token of the Pod.
+func getVaultConfig() (*generator.VaultConfig, error) {
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		return nil, nil
+	}
+
+	role := os.Getenv("VAULT_ROLE")
+	if role == "" {
+		return nil, errors.New("Required VAULT_ROLE env not found")
+	}
+
+	path := os.Getenv("VAULT_PATH")
+	if path == "" {
+		return nil, errors.New("Required VAULT_PATH env not found")
+	}
+
+	authMount := os.Getenv("VAULT_AUTH_MOUNT")
+	if authMount == "" {
+		authMount = "kubernetes"
+	}
+
+	kvMount := os.Getenv("VAULT_KV_MOUNT")
+	if kvMount == "" {
+		kvMount = "secret"
+	}
+
+	vaultClient, err := vault.NewClient(address, os.Getenv("VAULT_NAMESPACE"), os.Getenv("VAULT_CACERT"))
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := os.ReadFile(vault.ServiceAccountTokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ServiceAccount token: %w", err)
+	}
+
+	if err := vaultClient.LoginKubernetes(ctx, authMount, role, strings.TrimSpace(string(jwt))); err != nil {
+		return nil, err
+	}
+
+	return &generator.VaultConfig{
+		Client: vaultClient,
+		Mount:  kvMount,
+		Path:   path,
+	}, nil
+}
+
+// emitEvent reports a milestone or a failure as an event on the StatefulSet given by --event-statefulset, if any. A
+// failure to emit the event is only logged, so that it doesn't fail the command.
+func emitEvent(namespace, component, eventType, reason, message string) {
+	if eventStatefulSet == "" {
+		return
+	}
+
+	if err := kube.EmitStatefulSetEvent(ctx, cl, namespace, eventStatefulSet, component, eventType, reason, message); err != nil {
+		log.Printf("failed to emit event %s on StatefulSet %s: %s", reason, eventStatefulSet, err)
+	}
+}
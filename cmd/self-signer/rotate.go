@@ -17,13 +17,20 @@ limitations under the License.
 package self_signer
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cockroachdb/helm-charts/pkg/notification"
 )
 
+const rotateComponent = "cert-rotate"
+
 // rotateCmd represents the rotate command
 var rotateCmd = &cobra.Command{
 	Use:   "rotate",
@@ -35,8 +42,11 @@ var rotateCmd = &cobra.Command{
 var (
 	clientFlag, caFlag, nodeFlag bool
 	caCron, nodeAndClientCron    string
+	caOverlapWindow              string
+	webhookURL                   string
 	readinessWait                string
 	podUpdateTimeout             string
+	startOrdinal                 int32
 )
 
 func init() {
@@ -48,9 +58,13 @@ func init() {
 
 	rotateCmd.Flags().StringVar(&caCron, "ca-cron", "", "cron of the CA certificate rotation cron")
 	rotateCmd.Flags().StringVar(&nodeAndClientCron, "node-client-cron", "", "cron of the node and client certificate rotation cron")
+	rotateCmd.Flags().StringVar(&caOverlapWindow, "ca-overlap-window", "168h", "time for which the previous CA is kept trusted after a CA rotation")
 
 	rotateCmd.Flags().StringVar(&readinessWait, "readiness-wait", "30s", "readiness wait for each replica of crdb cluster")
 	rotateCmd.Flags().StringVar(&podUpdateTimeout, "pod-update-timeout", "2m", "time to wait for statefulset pod to restart and get to running state")
+	rotateCmd.Flags().Int32Var(&startOrdinal, "start-ordinal", 0, "ordinal of the first pod of the statefulset")
+	rotateCmd.Flags().StringVar(&webhookURL, "webhook-url", os.Getenv("NOTIFICATION_WEBHOOK_URL"),
+		"webhook (e.g. Slack incoming webhook) the rotation summary is posted to. Defaults to NOTIFICATION_WEBHOOK_URL env")
 }
 
 func rotate(cmd *cobra.Command, args []string) {
@@ -82,18 +96,47 @@ func rotate(cmd *cobra.Command, args []string) {
 		log.Panicf("failed to parse pod-update-timeout duration %s", err.Error())
 	}
 
+	overlapWindow, err := time.ParseDuration(caOverlapWindow)
+	if err != nil {
+		log.Panicf("failed to parse ca-overlap-window duration %s", err.Error())
+	}
+
 	genCert.ReadinessWait = timeout
 	genCert.PodUpdateTimeout = podTimeout
+	genCert.StartOrdinal = startOrdinal
 
 	genCert.CaSecret = caSecret
 	genCert.RotateCACert = caFlag
 	genCert.CACronSchedule = caCron
+	genCert.CAOverlapWindow = overlapWindow
 
 	genCert.RotateClientCert = clientFlag
 	genCert.RotateNodeCert = nodeFlag
 	genCert.NodeAndClientCronSchedule = nodeAndClientCron
 
-	if err := genCert.Do(ctx, namespace); err != nil {
+	err = genCert.Do(ctx, namespace)
+
+	if err != nil {
+		emitEvent(namespace, rotateComponent, corev1.EventTypeWarning, "CertificateRotationFailed",
+			fmt.Sprintf("certificate rotation failed: %s", err))
+	} else if len(genCert.Generated) > 0 {
+		var rotated []string
+		for _, cert := range genCert.Generated {
+			rotated = append(rotated, fmt.Sprintf("%s (valid until %s)", cert.Secret, cert.ValidUpto))
+		}
+		emitEvent(namespace, rotateComponent, corev1.EventTypeNormal, "CertificatesRotated",
+			fmt.Sprintf("certificates rotated: %s", strings.Join(rotated, ", ")))
+	}
+
+	// only notify when certificates were rotated or the rotation failed
+	if webhookURL != "" && (err != nil || len(genCert.Generated) > 0) {
+		summary := notification.NewSummary(namespace, genCert.Generated, err)
+		if nErr := notification.Send(webhookURL, summary); nErr != nil {
+			log.Printf("failed to send rotation summary to webhook: %s", nErr)
+		}
+	}
+
+	if err != nil {
 		log.Panic(err)
 	}
 
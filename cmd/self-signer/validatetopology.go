@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package self_signer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/kube"
+)
+
+// validateTopologyCmd represents the validate-topology command
+var validateTopologyCmd = &cobra.Command{
+	Use:   "validate-topology",
+	Short: "validates that the locality matches the topology labels of the nodes",
+	Long: `validate-topology sub-command compares the CockroachDB locality with the topology labels of the nodes the
+CockroachDB pods can be scheduled on, and fails with the mismatching nodes and tiers`,
+	Run: validateTopology,
+}
+
+var (
+	topologyLocality       string
+	topologyTiers          []string
+	topologyFromNodeLabels bool
+	topologyNodeSelector   string
+)
+
+func init() {
+	rootCmd.AddCommand(validateTopologyCmd)
+
+	validateTopologyCmd.Flags().StringVar(&topologyLocality, "locality", "", "locality of the CockroachDB nodes, as key=value tiers")
+	validateTopologyCmd.Flags().StringSliceVar(&topologyTiers, "tier",
+		[]string{"region=topology.kubernetes.io/region", "zone=topology.kubernetes.io/zone"},
+		"ordered locality tiers as key=label, mapping the locality keys to node labels")
+	validateTopologyCmd.Flags().BoolVar(&topologyFromNodeLabels, "from-node-labels", false, "the locality is derived from the node labels")
+	validateTopologyCmd.Flags().StringVar(&topologyNodeSelector, "node-selector", "", "label selector of the nodes the CockroachDB pods can be scheduled on")
+}
+
+func validateTopology(cmd *cobra.Command, args []string) {
+	selector, err := labels.Parse(topologyNodeSelector)
+	if err != nil {
+		log.Panicf("invalid node selector %s: %s", topologyNodeSelector, err)
+	}
+
+	var nodes corev1.NodeList
+	if err := cl.List(ctx, &nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.Panicf("failed to list the nodes: %s", err)
+	}
+
+	if len(nodes.Items) == 0 {
+		failTopologyValidation(fmt.Sprintf("no node matches the node selector %q of the CockroachDB pods", topologyNodeSelector))
+	}
+
+	mismatches, err := kube.TopologyMismatches(nodes.Items, topologyLocality, topologyTiers, topologyFromNodeLabels)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if len(mismatches) > 0 {
+		failTopologyValidation(fmt.Sprintf("the locality doesn't match the topology labels of the nodes:\n%s", strings.Join(mismatches, "\n")))
+	}
+
+	log.Printf("The locality matches the topology labels of the %d nodes", len(nodes.Items))
+}
+
+// failTopologyValidation reports the failure in the termination message, shown in the status of the pod, and exits.
+func failTopologyValidation(message string) {
+	_ = os.WriteFile("/dev/termination-log", []byte(message), 0644)
+
+	log.Fatal(message)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cockroachdb/helm-charts/pkg/diskusage"
+)
+
+// rootCmd represents the volume-exporter command
+var rootCmd = &cobra.Command{
+	Use:   "volume-exporter",
+	Short: "volume-exporter exports the disk usage of the volumes of a CockroachDB node",
+	Long: `volume-exporter serves the capacity, the available and used bytes and the inodes of the volumes mounted in
+the CockroachDB Pod, such as the logs and WAL failover volumes, in the Prometheus text format on /metrics`,
+	RunE:          run,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var (
+	volumes       []string
+	listenAddress string
+)
+
+func init() {
+	rootCmd.Flags().StringArrayVar(&volumes, "volume", nil, "volume to export, as name=path, can be repeated")
+	rootCmd.Flags().StringVar(&listenAddress, "listen-address", ":9102", "address the metrics are served on")
+
+	_ = rootCmd.MarkFlagRequired("volume")
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	paths := map[string]string{}
+	for _, volume := range volumes {
+		name, path, ok := strings.Cut(volume, "=")
+		if !ok || name == "" || path == "" {
+			return fmt.Errorf("invalid volume %q, expected name=path", volume)
+		}
+		paths[name] = path
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", diskusage.Handler(paths))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	fmt.Printf("serving the usage of %d volumes on %s\n", len(paths), listenAddress)
+	return http.ListenAndServe(listenAddress, mux)
+}
@@ -2,7 +2,7 @@
 Expand the name of the chart.
 */}}
 {{- define "cockroachdb.name" -}}
-{{- default .Chart.Name .Values.nameOverride | trunc 56 | trimSuffix "-" -}}
+{{- include "cockroachdb.labelValue" (default .Chart.Name .Values.nameOverride | trunc 56) -}}
 {{- end -}}
 
 {{/*
@@ -45,7 +45,34 @@ If release name contains chart name it will be used as a full name with release
 Create chart name and version as used by the chart label.
 */}}
 {{- define "cockroachdb.chart" -}}
-{{- printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 56 | trimSuffix "-" -}}
+{{- include "cockroachdb.labelValue" (printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 56) -}}
+{{- end -}}
+
+{{/*
+Sanitize a label value, so that values derived from the release or from the
+chart values don't fail the validation of the API server: characters other
+than alphanumerics, `-`, `_` and `.` are replaced by `-`, and the value is
+truncated to 63 characters and trimmed of non-alphanumeric characters at both
+ends.
+Usage: include "cockroachdb.labelValue" .Values.nameOverride
+*/}}
+{{- define "cockroachdb.labelValue" -}}
+{{- $value := regexReplaceAll "[^A-Za-z0-9._-]" (ternary "" (toString .) (kindIs "invalid" .)) "-" | trunc 63 -}}
+{{- regexReplaceAll "^[^A-Za-z0-9]+|[^A-Za-z0-9]+$" $value "" -}}
+{{- end -}}
+
+{{/*
+Render a map of labels with their values sanitized by "cockroachdb.labelValue".
+Usage: include "cockroachdb.labels" .Values.statefulset.labels
+*/}}
+{{- define "cockroachdb.labels" -}}
+{{- $labels := dict -}}
+{{- range $key, $value := . -}}
+  {{- $_ := set $labels $key (include "cockroachdb.labelValue" $value) -}}
+{{- end -}}
+{{- with $labels -}}
+{{- toYaml . -}}
+{{- end -}}
 {{- end -}}
 
 {{/*
@@ -59,6 +86,206 @@ Create the name of the ServiceAccount to use.
 {{- end -}}
 {{- end -}}
 
+{{/*
+Create the name of the public Service used by clients of the database.
+*/}}
+{{- define "cockroachdb.publicServiceName" -}}
+{{- printf "%s-public" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{/*
+Create the name of the Service the clients of the chart connect to: the public
+Service, or the discovery Service when it is disabled.
+*/}}
+{{- define "cockroachdb.clientServiceName" -}}
+{{- if .Values.service.public.enabled -}}
+{{- include "cockroachdb.publicServiceName" . -}}
+{{- else -}}
+{{- include "cockroachdb.fullname" . -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the public Service is enabled for the ingress and Gateway API
+routes pointing to it.
+*/}}
+{{- define "cockroachdb.service.public.validation" -}}
+{{- if not .Values.service.public.enabled -}}
+  {{- if .Values.ingress.enabled -}}
+    {{ fail "ingress.enabled requires service.public.enabled" }}
+  {{- end -}}
+  {{- if and .Values.gatewayApi.enabled (or .Values.gatewayApi.http.enabled .Values.gatewayApi.sql.enabled) -}}
+    {{ fail "gatewayApi.http and gatewayApi.sql require service.public.enabled" }}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Create the name of the Service meant for follower reads traffic.
+*/}}
+{{- define "cockroachdb.followerReadsServiceName" -}}
+{{- printf "%s-follower-reads" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{/*
+Labels applied to every resource: the chart-wide `labels` merged over
+`global.labels`.
+*/}}
+{{- define "cockroachdb.commonLabels" -}}
+{{- with merge (dict) (.Values.labels | default dict) (.Values.global.labels | default dict) }}
+{{- include "cockroachdb.labels" . }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Annotations applied to every resource: the resource specific annotations
+merged over `global.annotations`.
+Usage: include "cockroachdb.commonAnnotations" (dict "annotations" .Values.service.public.annotations "context" $)
+*/}}
+{{- define "cockroachdb.commonAnnotations" -}}
+{{- with merge (dict) (.annotations | default dict) (.context.Values.global.annotations | default dict) }}
+{{- toYaml . }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Reference of an image, given either as a map of an optional `registry`, a
+`repository` and a `tag`, or as a reference string. The registry of the image,
+if any, is replaced by `global.imageRegistry` when set, so that all the images
+are pulled from a mirror.
+Usage: include "cockroachdb.image" (dict "image" .Values.image "context" $)
+*/}}
+{{- define "cockroachdb.image" -}}
+{{- $registry := "" -}}
+{{- $repository := "" -}}
+{{- if kindIs "map" .image -}}
+  {{- $registry = .image.registry | default "" -}}
+  {{- $repository = .image.repository -}}
+  {{- if not (kindIs "invalid" .image.tag) -}}
+    {{- $repository = printf "%s:%v" $repository .image.tag -}}
+  {{- end -}}
+{{- else -}}
+  {{- $repository = .image -}}
+  {{- $host := splitList "/" .image | first -}}
+  {{- if and (contains "/" .image) (or (contains "." $host) (contains ":" $host) (eq "localhost" $host)) -}}
+    {{- $registry = $host -}}
+    {{- $repository = trimPrefix (printf "%s/" $host) .image -}}
+  {{- end -}}
+{{- end -}}
+{{- with .context.Values.global.imageRegistry -}}
+  {{- $registry = trimSuffix "/" . -}}
+{{- end -}}
+{{- if $registry -}}
+  {{- printf "%s/%s" $registry $repository -}}
+{{- else -}}
+  {{- $repository -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Pull policy of an image: its own one, defaulting to `global.imagePullPolicy`.
+Usage: include "cockroachdb.imagePullPolicy" (dict "pullPolicy" .Values.image.pullPolicy "context" $)
+*/}}
+{{- define "cockroachdb.imagePullPolicy" -}}
+{{- .pullPolicy | default .context.Values.global.imagePullPolicy -}}
+{{- end -}}
+
+{{/*
+Return "true" if the CockroachDB container runs with a read-only root filesystem,
+an empty string otherwise.
+*/}}
+{{- define "cockroachdb.readOnlyRootFilesystem" -}}
+{{- if and (eq (include "cockroachdb.securityContext.versionValidation" .) "true") .Values.statefulset.securityContext.enabled .Values.statefulset.securityContext.readOnlyRootFilesystem -}}
+true
+{{- end -}}
+{{- end -}}
+
+{{/*
+Create the name of the ConfigMap recording the status of the cluster init.
+*/}}
+{{- define "cockroachdb.initStatusConfigMapName" -}}
+{{- printf "%s-init-status" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{/*
+Return the ordinal of the first CockroachDB Pod.
+*/}}
+{{- define "cockroachdb.statefulset.startOrdinal" -}}
+{{- .Values.statefulset.ordinals.start | default 0 | int64 -}}
+{{- end -}}
+
+{{/*
+Create the address of the first CockroachDB Pod, which is used by the init Job to bootstrap and provision the cluster.
+*/}}
+{{- define "cockroachdb.init.host" -}}
+{{- if or .Values.init.network.clientLabel (and .Values.init.network.hostNetwork (not .Values.gkeAutopilot.enabled)) -}}
+{{- printf "%s-%s.%s.%s.svc.%s:%d" (include "cockroachdb.fullname" .) (include "cockroachdb.statefulset.startOrdinal" .) (include "cockroachdb.fullname" .) .Release.Namespace .Values.clusterDomain (.Values.service.ports.grpc.internal.port | int64) -}}
+{{- else -}}
+{{- printf "%s-%s.%s:%d" (include "cockroachdb.fullname" .) (include "cockroachdb.statefulset.startOrdinal" .) (include "cockroachdb.fullname" .) (.Values.service.ports.grpc.internal.port | int64) -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Create the names of the Secrets generated by the self-signer utility.
+These must match the names derived from STATEFULSET_NAME in pkg/generator.
+*/}}
+{{- define "cockroachdb.selfSigner.caSecret" -}}
+{{- printf "%s-ca-secret" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{- define "cockroachdb.selfSigner.nodeSecret" -}}
+{{- printf "%s-node-secret" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{- define "cockroachdb.selfSigner.clientSecret" -}}
+{{- printf "%s-client-secret" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{- define "cockroachdb.selfSigner.nodeClientSecret" -}}
+{{- printf "%s-node-client-secret" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{/*
+Create the names of the image pull Secrets rendered by secret.registry.yaml.
+*/}}
+{{- define "cockroachdb.db.registrySecret" -}}
+{{- printf "%s.db.registry" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{- define "cockroachdb.selfSigner.registrySecret" -}}
+{{- printf "%s.init-certs.registry" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{/*
+Render the affinity of a Pod running an image only published for some
+platforms: every required node selector term of the given affinity is split
+into a term per `os/arch` platform, so that the Pod is only scheduled on the
+nodes of these platforms. The affinity is returned as is without platforms.
+Usage: include "cockroachdb.platformAffinity" (dict "affinity" .Values.tls.selfSigner.affinity "platforms" .Values.tls.selfSigner.image.platforms)
+*/}}
+{{- define "cockroachdb.platformAffinity" -}}
+{{- $affinity := deepCopy (.affinity | default dict) -}}
+{{- if .platforms -}}
+  {{- $nodeAffinity := $affinity.nodeAffinity | default dict -}}
+  {{- $required := get $nodeAffinity "requiredDuringSchedulingIgnoredDuringExecution" | default dict -}}
+  {{- $terms := list -}}
+  {{- range $required.nodeSelectorTerms | default (list (dict)) -}}
+    {{- $term := . -}}
+    {{- range $.platforms -}}
+      {{- $platform := splitList "/" . -}}
+      {{- $expressions := list (dict "key" "kubernetes.io/os" "operator" "In" "values" (list (first $platform))) (dict "key" "kubernetes.io/arch" "operator" "In" "values" (list (last $platform))) -}}
+      {{- $terms = append $terms (merge (dict "matchExpressions" (concat ($term.matchExpressions | default list) $expressions)) (omit $term "matchExpressions")) -}}
+    {{- end -}}
+  {{- end -}}
+  {{- $_ := set $required "nodeSelectorTerms" $terms -}}
+  {{- $_ := set $nodeAffinity "requiredDuringSchedulingIgnoredDuringExecution" $required -}}
+  {{- $_ := set $affinity "nodeAffinity" $nodeAffinity -}}
+{{- end -}}
+{{- with $affinity -}}
+{{- toYaml . -}}
+{{- end -}}
+{{- end -}}
+
 {{/*
 Return the appropriate apiVersion for NetworkPolicy.
 */}}
@@ -70,6 +297,22 @@ Return the appropriate apiVersion for NetworkPolicy.
 {{- end -}}
 {{- end -}}
 
+{{/*
+Return the apiVersion of the CronJobs: global.cronJobApiVersion when set, batch/v1
+when the cluster serves it, batch/v1beta1 otherwise. batch/v1beta1 is no longer
+served from Kubernetes 1.25.
+*/}}
+{{- define "cockroachdb.cronJob.apiVersion" -}}
+{{- $apiVersion := .Values.global.cronJobApiVersion -}}
+{{- if not $apiVersion -}}
+  {{- $apiVersion = or (.Capabilities.APIVersions.Has "batch/v1/CronJob") (semverCompare ">=1.21-0" .Capabilities.KubeVersion.Version) | ternary "batch/v1" "batch/v1beta1" -}}
+{{- end -}}
+{{- if and (eq $apiVersion "batch/v1beta1") (semverCompare ">=1.25-0" .Capabilities.KubeVersion.Version) -}}
+  {{ fail (printf "batch/v1beta1 CronJobs are no longer served by Kubernetes %s, set global.cronJobApiVersion to batch/v1" .Capabilities.KubeVersion.Version) }}
+{{- end -}}
+{{- $apiVersion -}}
+{{- end -}}
+
 {{/*
 Return the appropriate apiVersion for StatefulSets
 */}}
@@ -81,12 +324,70 @@ Return the appropriate apiVersion for StatefulSets
 {{- end -}}
 {{- end -}}
 
+{{/*
+Presets of the sizing profiles. The presets of the large profile are the defaults of the chart.
+*/}}
+{{- define "cockroachdb.profile.presets" -}}
+small:
+  resources:
+    requests:
+      cpu: 500m
+      memory: 2Gi
+    limits:
+      memory: 2Gi
+  cache: 20%
+  maxSQLMemory: 20%
+  storeSize: 10Gi
+medium:
+  resources:
+    requests:
+      cpu: 2
+      memory: 8Gi
+    limits:
+      memory: 8Gi
+  cache: 25%
+  maxSQLMemory: 25%
+  storeSize: 50Gi
+large:
+  resources: {}
+  cache: 25%
+  maxSQLMemory: 25%
+  storeSize: 100Gi
+{{- end -}}
+
+{{/*
+Value of a setting curated by the sizing profile: the preset of the profile when the value is left at the default of
+the chart, the value otherwise. Strings are rendered as is, other values as YAML.
+Usage: include "cockroachdb.profile.value" (dict "key" "cache" "value" .Values.conf.cache "context" $)
+*/}}
+{{- define "cockroachdb.profile.value" -}}
+{{- $presets := include "cockroachdb.profile.presets" . | fromYaml -}}
+{{- $value := .value -}}
+{{- if eq (toJson $value) (toJson (index $presets "large" .key)) -}}
+  {{- $value = index $presets .context.Values.profile .key -}}
+{{- end -}}
+{{- if kindIs "string" $value -}}
+  {{- $value -}}
+{{- else -}}
+  {{- toYaml $value -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the small sizing profile isn't combined with heavyweight extras.
+*/}}
+{{- define "cockroachdb.profile.validation" -}}
+{{- if and (eq .Values.profile "small") (or .Values.serviceMonitor.enabled .Values.conf.log.persistentVolume.enabled) -}}
+  {{ fail "the small profile can't be used with serviceMonitor.enabled or conf.log.persistentVolume.enabled" }}
+{{- end -}}
+{{- end -}}
+
 {{/*
 Return CockroachDB store expression
 */}}
 {{- define "cockroachdb.conf.store" -}}
   {{- $isInMemory := eq (.Values.conf.store.type | toString) "mem" -}}
-  {{- $persistentSize := empty .Values.conf.store.size | ternary .Values.storage.persistentVolume.size .Values.conf.store.size -}}
+  {{- $persistentSize := empty .Values.conf.store.size | ternary (include "cockroachdb.profile.value" (dict "key" "storeSize" "value" .Values.storage.persistentVolume.size "context" .)) .Values.conf.store.size -}}
 
   {{- $store := dict -}}
   {{- $_ := set $store "type" ($isInMemory | ternary "type=mem" "") -}}
@@ -101,6 +402,168 @@ Return CockroachDB store expression
   {{- compact (values $store) | sortAlpha | join "," -}}
 {{- end -}}
 
+{{/*
+Render the start command of the CockroachDB container, one flag per line. The
+environment variables and the command substitutions are resolved by the shell
+of the container.
+*/}}
+{{- define "cockroachdb.statefulset.startCommand" -}}
+exec {{ with .Values.statefulset.entrypointOverride.configMap }}/cockroach/entrypoint/{{ $.Values.statefulset.entrypointOverride.key }} {{ end }}/cockroach/cockroach
+{{- if index .Values.conf `single-node` }}
+start-single-node
+{{- else }}
+start --join=
+  {{- if .Values.conf.join }}
+    {{- join `,` .Values.conf.join -}}
+  {{- else }}
+    {{- range $i, $_ := until 3 -}}
+      {{- if gt $i 0 -}},{{- end -}}
+${STATEFULSET_NAME}-{{ add $i (include "cockroachdb.statefulset.startOrdinal" $) }}.${STATEFULSET_FQDN}:{{ $.Values.service.ports.grpc.internal.port | int64 -}}
+    {{- end -}}
+  {{- end }}
+{{- with index .Values.conf `cluster-name` }}
+--cluster-name={{ . }}
+{{- if index $.Values.conf `disable-cluster-name-verification` }}
+--disable-cluster-name-verification
+{{- end }}
+{{- end }}
+{{- end }}
+--advertise-host=$(hostname).${STATEFULSET_FQDN}
+{{- if .Values.tls.enabled }}
+--certs-dir=/cockroach/cockroach-certs/
+{{- else }}
+--insecure
+{{- end }}
+{{- with .Values.conf.attrs }}
+--attrs={{ join `:` . }}
+{{- end }}
+{{- if index .Values.conf `http-port` }}
+--http-port={{ index .Values.conf `http-port` | int64 }}
+{{- else }}
+--http-port={{ index .Values.service.ports.http.port | int64 }}
+{{- end }}
+{{- if .Values.conf.port }}
+--port={{ .Values.conf.port | int64 }}
+{{- else }}
+--port={{ .Values.service.ports.grpc.internal.port | int64 }}
+{{- end }}
+{{- with .Values.conf.listen }}
+  {{- $grpcPort := $.Values.conf.port | default $.Values.service.ports.grpc.internal.port | int64 }}
+  {{- $httpPort := index $.Values.conf `http-port` | default $.Values.service.ports.http.port | int64 }}
+  {{- with .addr }}
+--listen-addr={{ include "cockroachdb.conf.listen.host" . }}:{{ $grpcPort }}
+  {{- end }}
+  {{- with .sqlAddr }}
+--sql-addr={{ include "cockroachdb.conf.listen.host" . }}:{{ $grpcPort }}
+  {{- end }}
+  {{- with .httpAddr }}
+--http-addr={{ include "cockroachdb.conf.listen.host" . }}:{{ $httpPort }}
+  {{- end }}
+  {{- with .advertiseHttpAddr }}
+--advertise-http-addr={{ include "cockroachdb.conf.listen.host" . }}
+  {{- end }}
+{{- end }}
+--cache={{ include "cockroachdb.profile.value" (dict "key" "cache" "value" .Values.conf.cache "context" $) }}
+{{- with index .Values.conf `max-disk-temp-storage` }}
+--max-disk-temp-storage={{ . }}
+{{- end }}
+{{- with index .Values.conf `temp-dir` }}
+{{- if or .emptyDir.enabled .persistentVolume.enabled }}
+--temp-dir=/cockroach/{{ .path }}/
+{{- end }}
+{{- end }}
+{{- with index .Values.conf `max-offset` }}
+--max-offset={{ . }}
+{{- end }}
+--max-sql-memory={{ include "cockroachdb.profile.value" (dict "key" "maxSQLMemory" "value" (index .Values.conf `max-sql-memory`) "context" $) }}
+{{- if include "cockroachdb.conf.max-go-memory.flag" . }}
+  {{- with include "cockroachdb.conf.max-go-memory" . }}
+--max-go-memory={{ . }}
+  {{- end }}
+{{- end }}
+{{- with index .Values.conf `max-tsdb-memory` }}
+--max-tsdb-memory={{ . }}
+{{- end }}
+{{- with include "cockroachdb.conf.localityFile" . }}
+--locality=$(cat {{ . }}){{ with $.Values.conf.locality }},{{ . }}{{ end }}
+{{- else }}
+{{- with .Values.conf.locality }}
+--locality={{ . }}
+{{- end }}
+{{- end }}
+{{- with index .Values.conf `sql-audit-dir` }}
+--sql-audit-dir={{ . }}
+{{- end }}
+{{- if .Values.conf.store.enabled }}
+  {{- range $idx := until (int .Values.conf.store.count) }}
+  {{- $_ := set $ "Args" (dict "idx" $idx) }}
+--store={{ include "cockroachdb.conf.store" $ }}
+  {{- end }}
+{{- end }}
+{{- with index .Values.conf `wal-failover` `value` }}
+  {{- template "cockroachdb.conf.wal-failover.validation" $ }}
+--wal-failover={{ . }}
+{{- end }}
+{{- if .Values.conf.log.enabled }}
+--log-config-file=/cockroach/log-config/log-config.yaml
+{{- else }}
+--logtostderr={{ .Values.conf.logtostderr }}
+{{- end }}
+{{- range .Values.statefulset.args }}
+{{ . }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Render a listener host of conf.listen, `podIP` being resolved by the shell from
+the POD_IP env of the cockroachdb container.
+*/}}
+{{- define "cockroachdb.conf.listen.host" -}}
+{{- if eq . "podIP" -}}
+${POD_IP}
+{{- else -}}
+{{ . }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Whether any listener of conf.listen is bound to the Pod IP.
+*/}}
+{{- define "cockroachdb.conf.listen.podIP" -}}
+{{- with .Values.conf.listen -}}
+{{- if has "podIP" (list .addr .sqlAddr .httpAddr .advertiseHttpAddr) -}}
+true
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Render the hook annotations of a hook resource. If argocdCompatibility is enabled,
+the Helm hook annotations are swapped for their Argo CD equivalent.
+Usage: include "cockroachdb.hookAnnotations" (dict "hook" "pre-install,pre-upgrade" "weight" 1 "deletePolicy" "hook-succeeded" "context" $)
+*/}}
+{{- define "cockroachdb.hookAnnotations" -}}
+{{- if .context.Values.argocdCompatibility.enabled -}}
+{{- $phases := dict "pre-install,pre-upgrade" "PreSync" "pre-install" "PreSync" "pre-upgrade" "PreSync" "post-install,post-upgrade" "PostSync" "pre-delete" "PreDelete" -}}
+{{- $policies := dict "hook-succeeded" "HookSucceeded" "hook-failed" "HookFailed" "before-hook-creation" "BeforeHookCreation" -}}
+argocd.argoproj.io/hook: {{ index $phases .hook }}
+argocd.argoproj.io/sync-wave: {{ .weight | quote }}
+{{- with .deletePolicy }}
+{{- $argocdPolicies := list }}
+{{- range splitList "," . }}
+{{- $argocdPolicies = append $argocdPolicies (get $policies (trim .) | default (trim .)) }}
+{{- end }}
+argocd.argoproj.io/hook-delete-policy: {{ join "," $argocdPolicies }}
+{{- end }}
+{{- else -}}
+helm.sh/hook: {{ .hook }}
+helm.sh/hook-weight: {{ .weight | quote }}
+{{- with .deletePolicy }}
+helm.sh/hook-delete-policy: {{ . }}
+{{- end }}
+{{- end -}}
+{{- end -}}
+
 {{/*
 Define the default values for the certificate selfSigner inputs
 */}}
@@ -108,10 +571,41 @@ Define the default values for the certificate selfSigner inputs
   {{- printf "%s-%s" (include "cockroachdb.fullname" .) "self-signer" | trunc 56 | trimSuffix "-" -}}
 {{- end -}}
 
+{{- define "resizevolumes.fullname" -}}
+  {{- printf "%s-%s" (include "cockroachdb.fullname" .) "resize-volumes" | trunc 56 | trimSuffix "-" -}}
+{{- end -}}
+
+{{- define "validatetopology.fullname" -}}
+  {{- printf "%s-%s" (include "cockroachdb.fullname" .) "validate-topology" | trunc 56 | trimSuffix "-" -}}
+{{- end -}}
+
 {{- define "rotatecerts.fullname" -}}
   {{- printf "%s-%s" (include "cockroachdb.fullname" .) "rotate-self-signer" | trunc 56 | trimSuffix "-" -}}
 {{- end -}}
 
+{{- define "csrcollector.fullname" -}}
+  {{- printf "%s-%s" (include "cockroachdb.fullname" .) "csr-collector" | trunc 56 | trimSuffix "-" -}}
+{{- end -}}
+
+{{- define "driftdetector.fullname" -}}
+  {{- printf "%s-%s" (include "cockroachdb.fullname" .) "drift-detector" | trunc 56 | trimSuffix "-" -}}
+{{- end -}}
+
+{{- define "cleaner.fullname" -}}
+  {{- printf "%s-%s" (include "cockroachdb.fullname" .) "self-signer-cleaner" | trunc 56 | trimSuffix "-" -}}
+{{- end -}}
+
+{{/*
+Render "true" if the cleaner Job is rendered, i.e. the self-signer is enabled and any resource is selected for pruning.
+*/}}
+{{- define "cockroachdb.cleaner.enabled" -}}
+{{- with .Values.tls.certs.selfSigner.cleaner -}}
+{{- if and $.Values.tls.enabled $.Values.tls.certs.selfSigner.enabled (or .secrets .csrs .completedJobs) -}}
+true
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
 {{- define "selfcerts.minimumCertDuration" -}}
   {{- if .Values.tls.certs.selfSigner.minimumCertDuration -}}
     {{- print (.Values.tls.certs.selfSigner.minimumCertDuration | trimSuffix "h") -}}
@@ -121,6 +615,24 @@ Define the default values for the certificate selfSigner inputs
   {{- end }}
 {{- end -}}
 
+{{/*
+Return the number of seconds of maintenanceWindow.duration, expressed in hours
+and minutes.
+*/}}
+{{- define "cockroachdb.maintenanceWindow.seconds" -}}
+{{- $duration := .Values.maintenanceWindow.duration | toString -}}
+{{- if not (regexMatch "^([0-9]+h)?([0-9]+m)?$" $duration) -}}
+  {{ fail "maintenanceWindow.duration must be expressed in hours and minutes, e.g. 2h30m" }}
+{{- end -}}
+{{- $hours := regexFind "[0-9]+h" $duration | trimSuffix "h" | default "0" | int64 -}}
+{{- $minutes := regexFind "[0-9]+m" $duration | trimSuffix "m" | default "0" | int64 -}}
+{{- $seconds := add (mul $hours 3600) (mul $minutes 60) -}}
+{{- if eq (int64 $seconds) 0 -}}
+  {{ fail "maintenanceWindow.duration must be longer than zero" }}
+{{- end -}}
+{{- print $seconds -}}
+{{- end -}}
+
 {{/*
 Define the cron schedules for certificate rotate jobs and converting from hours to valid cron string.
 We assume that each month has 31 days, hence the cron job may run few days earlier in a year. In a cron schedule,
@@ -254,70 +766,1447 @@ Validate that nodeCertDuration must not be empty and nodeCertDuration minus node
 {{- end -}}
 
 {{/*
-Validate that if user enabled tls, then either self-signed certificates or certificate manager is enabled
+Validate that the node labels can be read when the locality is derived from them.
 */}}
-{{- define "cockroachdb.tlsValidation" -}}
-{{- if .Values.tls.enabled -}}
-{{- if and .Values.tls.certs.selfSigner.enabled .Values.tls.certs.certManager -}}
-    {{ fail "Can not enable the self signed certificates and certificate manager at the same time" }}
-{{- end -}}
-{{- if and (not .Values.tls.certs.selfSigner.enabled) (not .Values.tls.certs.certManager) -}}
-    {{- if not .Values.tls.certs.provided -}}
-        {{ fail "You have to enable either self signed certificates or certificate manager, if you have enabled tls" }}
-    {{- end -}}
+{{- define "cockroachdb.conf.localityFromNodeLabels.validation" -}}
+{{- if .Values.conf.localityFromNodeLabels.enabled -}}
+{{- if not .Values.rbac.clusterScoped -}}
+  {{ fail "conf.localityFromNodeLabels requires rbac.clusterScoped to be enabled to read the node labels" }}
 {{- end -}}
+{{- if empty .Values.conf.localityFromNodeLabels.tiers -}}
+  {{ fail "conf.localityFromNodeLabels.tiers can't be empty if conf.localityFromNodeLabels.enabled is set to true" }}
 {{- end -}}
 {{- end -}}
-
-
-{{- define "cockroachdb.tls.certs.selfSigner.validation" -}}
-{{ include "cockroachdb.tls.certs.selfSigner.caProvidedValidation" . }}
-{{ include "cockroachdb.tls.certs.selfSigner.caCertValidation" . }}
-{{ include "cockroachdb.tls.certs.selfSigner.clientCertValidation" . }}
-{{ include "cockroachdb.tls.certs.selfSigner.nodeCertValidation" . }}
 {{- end -}}
 
-{{- define "cockroachdb.securityContext.versionValidation" }}
-{{- /* Allow using `securityContext` for custom images. */}}
-{{- if ne "cockroachdb/cockroach" .Values.image.repository -}}
-    {{ print true }}
-{{- else -}}
-{{- if semverCompare ">=22.1.2" .Values.image.tag -}}
-    {{ print true }}
-{{- else -}}
-{{- if semverCompare ">=21.2.13, <22.1.0" .Values.image.tag -}}
-    {{ print true }}
+{{/*
+Path of the file the locality is read from when the CockroachDB instance
+starts: the one written by the `locality` init container when the locality is
+derived from the node or Pod labels, or conf.localityFile.
+*/}}
+{{- define "cockroachdb.conf.localityFile" -}}
+{{- if or .Values.conf.localityFromNodeLabels.enabled .Values.conf.localityFromPodLabels.enabled -}}
+/cockroach/locality/locality
 {{- else -}}
-    {{ print false }}
-{{- end }}
-{{- end }}
-{{- end }}
-{{- end }}
+{{- .Values.conf.localityFile -}}
+{{- end -}}
+{{- end -}}
 
 {{/*
-Validate the log configuration.
+Validate that the locality is read from a single file, and that the Pod labels
+of its tiers are valid.
 */}}
-{{- define "cockroachdb.conf.log.validation" -}}
-{{- if and (not .Values.conf.log.enabled) .Values.conf.log.persistentVolume.enabled -}}
-    {{ fail "Persistent volume for logs can only be enabled if logging is enabled" }}
+{{- define "cockroachdb.conf.localityFile.validation" -}}
+{{- $sources := list -}}
+{{- range $source := list "localityFromNodeLabels" "localityFromPodLabels" -}}
+  {{- if (index $.Values.conf $source).enabled -}}
+    {{- $sources = append $sources (printf "conf.%s" $source) -}}
+  {{- end -}}
 {{- end -}}
-{{- if and .Values.conf.log.persistentVolume.enabled (dig "file-defaults" "dir" "" .Values.conf.log.config) -}}
-{{- if not (hasPrefix (printf "/cockroach/%s" .Values.conf.log.persistentVolume.path) (dig "file-defaults" "dir" "" .Values.conf.log.config)) }}
-    {{ fail "Log configuration should use the persistent volume if enabled" }}
+{{- if .Values.conf.localityFile -}}
+  {{- $sources = append $sources "conf.localityFile" -}}
 {{- end -}}
+{{- if gt (len $sources) 1 -}}
+  {{ fail (printf "only one of %s can be set" (join ", " $sources)) }}
 {{- end -}}
+{{- if and .Values.conf.localityFile (not (isAbs .Values.conf.localityFile)) -}}
+  {{ fail (printf "conf.localityFile must be an absolute path, got %s" .Values.conf.localityFile) }}
 {{- end -}}
-
-{{- define "cockroachdb.storage.hostPath.computation" -}}
-{{- if hasSuffix "/" .Values.storage.hostPath -}}
-    {{- printf "%s-%d/" (dir .Values.storage.hostPath) (add1 .Args.idx) | quote -}}
-{{- else -}}
-    {{- printf "%s-%d" .Values.storage.hostPath (add1 .Args.idx) | quote -}}
+{{- if .Values.conf.localityFromPodLabels.enabled -}}
+  {{- if empty .Values.conf.localityFromPodLabels.tiers -}}
+    {{ fail "conf.localityFromPodLabels.tiers can't be empty if conf.localityFromPodLabels.enabled is set to true" }}
+  {{- end -}}
+  {{- range .Values.conf.localityFromPodLabels.tiers -}}
+    {{- if not (regexMatch "^[A-Za-z0-9_.-]+=([a-z0-9.-]+/)?[A-Za-z0-9_.-]+$" .) -}}
+      {{ fail (printf "conf.localityFromPodLabels.tiers must be key=label pairs, got %s" .) }}
+    {{- end -}}
+  {{- end -}}
 {{- end -}}
 {{- end -}}
 
 {{/*
-Validate the store count configuration.
+Secrets of the per-node certificates of tls.certs.perNode, one per ordinal of
+the StatefulSet, rendered as JSON.
+*/}}
+{{- define "cockroachdb.tls.certs.perNode.secrets" -}}
+{{- $start := include "cockroachdb.statefulset.startOrdinal" . | int -}}
+{{- $secrets := list -}}
+{{- range $i := until (.Values.statefulset.replicas | int) -}}
+  {{- $ordinal := add $start $i -}}
+  {{- $name := printf $.Values.tls.certs.perNode.nodeSecretPattern $ordinal -}}
+  {{- with $.Values.tls.certs.perNode.nodeSecrets -}}
+    {{- $name = index . $i -}}
+  {{- end -}}
+  {{- $secrets = append $secrets (dict "ordinal" $ordinal "name" $name) -}}
+{{- end -}}
+{{- dict "secrets" $secrets | toJson -}}
+{{- end -}}
+
+{{/*
+Validate that the per-node certificates are provided, with a Secret for every
+replica.
+*/}}
+{{- define "cockroachdb.tls.certs.perNode.validation" -}}
+{{- with .Values.tls.certs.perNode -}}
+{{- if .enabled -}}
+  {{- if not (and $.Values.tls.enabled $.Values.tls.certs.provided) -}}
+    {{ fail "tls.certs.perNode requires tls.enabled and tls.certs.provided" }}
+  {{- end -}}
+  {{- if or $.Values.tls.certs.selfSigner.enabled $.Values.tls.certs.certManager -}}
+    {{ fail "tls.certs.perNode can't be combined with tls.certs.selfSigner or tls.certs.certManager" }}
+  {{- end -}}
+  {{- if .nodeSecrets -}}
+    {{- if ne (len .nodeSecrets) ($.Values.statefulset.replicas | int) -}}
+      {{ fail (printf "tls.certs.perNode.nodeSecrets has %d Secrets for %d replicas" (len .nodeSecrets) ($.Values.statefulset.replicas | int)) }}
+    {{- end -}}
+  {{- else if not (regexMatch "^[^%]*%d[^%]*$" .nodeSecretPattern) -}}
+    {{ fail (printf "tls.certs.perNode.nodeSecretPattern %s must contain %%d once" .nodeSecretPattern) }}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the DB Console certificate is mounted in the certs directory of a
+secure cluster, and that cert-manager knows the names to issue it for.
+*/}}
+{{- define "cockroachdb.tls.certs.ui.validation" -}}
+{{- with .Values.tls.certs.ui -}}
+{{- if and .secretName (not $.Values.tls.enabled) -}}
+  {{ fail "tls.certs.ui.secretName requires tls.enabled" }}
+{{- end -}}
+{{- if and .issuer.name (not .secretName) -}}
+  {{ fail "tls.certs.ui.issuer requires tls.certs.ui.secretName to store the certificate in" }}
+{{- end -}}
+{{- if and .issuer.name (empty .dnsNames) -}}
+  {{ fail "tls.certs.ui.issuer requires tls.certs.ui.dnsNames" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Value of a Kubernetes quantity in base units, bytes or cores, e.g. 8589934592
+for `8Gi` or 0.5 for `500m`. Empty quantities are 0. The value is rendered as a
+decimal number, converted back with `float64`, or `float64 | int64`.
+*/}}
+{{- define "cockroachdb.quantity.bytes" -}}
+{{- $multipliers := dict "" 1 "m" 0.001 "k" 1e3 "M" 1e6 "G" 1e9 "T" 1e12 "P" 1e15 "Ki" 1024 "Mi" 1048576 "Gi" 1073741824 "Ti" 1099511627776 "Pi" 1125899906842624 -}}
+{{- $quantity := . | default 0 -}}
+{{- if and (kindIs "float64" $quantity) (eq (floor $quantity) $quantity) -}}
+  {{- $quantity = int64 $quantity -}}
+{{- end -}}
+{{- $quantity = toString $quantity -}}
+{{- $pattern := "^([0-9]+(?:\\.[0-9]+)?)(m|k|M|G|T|P|Ki|Mi|Gi|Ti|Pi)?$" -}}
+{{- if not (regexMatch $pattern $quantity) -}}
+  {{ fail (printf "can't parse the quantity %s" $quantity) }}
+{{- end -}}
+{{- $number := regexReplaceAll $pattern $quantity "${1}" -}}
+{{- $suffix := regexReplaceAll $pattern $quantity "${2}" -}}
+{{- printf "%f" (mulf (float64 $number) (index $multipliers $suffix)) -}}
+{{- end -}}
+
+{{/*
+Failure threshold of the startup probe of statefulset.startupProbe, allowing
+the expected startup duration of a node plus the duration per TiB of its store.
+*/}}
+{{- define "cockroachdb.statefulset.startupProbe.failureThreshold" -}}
+{{- with .Values.statefulset.startupProbe -}}
+{{- $size := .storeSize -}}
+{{- if and (not $size) $.Values.storage.persistentVolume.enabled -}}
+  {{- $size = $.Values.storage.persistentVolume.size -}}
+{{- end -}}
+{{- $tib := divf (include "cockroachdb.quantity.bytes" $size) 1099511627776 -}}
+{{- $seconds := addf .expectedStartupSeconds (mulf .perTiBSeconds $tib) -}}
+{{- max 1 (divf $seconds .periodSeconds | ceil | int64) -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Soft memory limit of the Go runtime of conf.max-go-memory, a percentage of the
+memory limit of the CockroachDB container being rendered in bytes.
+*/}}
+{{- define "cockroachdb.conf.max-go-memory" -}}
+{{- with index .Values.conf `max-go-memory` | toString -}}
+{{- if hasSuffix "%" . -}}
+  {{- $resources := include "cockroachdb.statefulset.resources" $ | fromYaml -}}
+  {{- $limit := include "cockroachdb.quantity.bytes" (dig "limits" "memory" "" $resources) -}}
+  {{- divf (mulf $limit (trimSuffix "%" . | float64)) 100 | floor | int64 -}}
+{{- else -}}
+  {{- . -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Whether the image supports the --max-go-memory flag, added in CockroachDB v23.2.
+The soft memory limit is passed as the GOMEMLIMIT env var otherwise.
+*/}}
+{{- define "cockroachdb.conf.max-go-memory.flag" -}}
+{{- $tag := toString .Values.image.tag -}}
+{{- if and (eq .Values.image.repository "cockroachdb/cockroach") (regexMatch "^v?[0-9]+\\.[0-9]+\\.[0-9]+" $tag) -}}
+{{- if semverCompare ">=23.2.0-0" $tag -}}
+true
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that a percentage of conf.max-go-memory has a memory limit to be
+derived from, and isn't overridden by statefulset.env.
+*/}}
+{{- define "cockroachdb.conf.max-go-memory.validation" -}}
+{{- with index .Values.conf `max-go-memory` | toString -}}
+{{- if hasSuffix "%" . -}}
+  {{- $resources := include "cockroachdb.statefulset.resources" $ | fromYaml -}}
+  {{- if not (dig "limits" "memory" "" $resources) -}}
+    {{ fail "conf.max-go-memory set to a percentage requires a memory limit in statefulset.resources.limits.memory" }}
+  {{- end -}}
+  {{- if not (regexMatch "^[0-9]+(\\.[0-9]+)?%$" .) -}}
+    {{ fail (printf "conf.max-go-memory: invalid percentage %s" .) }}
+  {{- end -}}
+{{- end -}}
+{{- range $.Values.statefulset.env -}}
+  {{- if eq .name "GOMEMLIMIT" -}}
+    {{ fail "conf.max-go-memory can't be combined with a GOMEMLIMIT env var in statefulset.env" }}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that a separate SQL listener doesn't collide with the RPC listener,
+both using the gRPC port.
+*/}}
+{{- define "cockroachdb.conf.listen.validation" -}}
+{{- with .Values.conf.listen -}}
+{{- if and .sqlAddr (or (not .addr) (eq .addr .sqlAddr)) -}}
+  {{ fail "conf.listen.sqlAddr requires conf.listen.addr to be set to another host, as both listeners use the gRPC port" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the locality validation can read the nodes and has a locality to
+validate.
+*/}}
+{{- define "cockroachdb.conf.localityValidation.validation" -}}
+{{- if .Values.conf.localityValidation.enabled -}}
+{{- if not .Values.rbac.clusterScoped -}}
+  {{ fail "conf.localityValidation requires rbac.clusterScoped to be enabled to read the node labels" }}
+{{- end -}}
+{{- if not (or .Values.conf.locality .Values.conf.localityFromNodeLabels.enabled) -}}
+  {{ fail "conf.localityValidation requires conf.locality or conf.localityFromNodeLabels to be set" }}
+{{- end -}}
+{{- if empty .Values.conf.localityFromNodeLabels.tiers -}}
+  {{ fail "conf.localityValidation maps the locality to node labels with conf.localityFromNodeLabels.tiers, which can't be empty" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the sysctls of the StatefulSet Pods are safe, unless unsafe ones
+are explicitly allowed.
+https://kubernetes.io/docs/tasks/administer-cluster/sysctl-cluster/#safe-and-unsafe-sysctls
+*/}}
+{{- define "cockroachdb.statefulset.podSysctls.validation" -}}
+{{- $safe := list "kernel.shm_rmid_forced" "net.ipv4.ip_local_port_range" "net.ipv4.ip_unprivileged_port_start" "net.ipv4.ip_local_reserved_ports" "net.ipv4.ping_group_range" "net.ipv4.tcp_syncookies" "net.ipv4.tcp_keepalive_time" "net.ipv4.tcp_fin_timeout" "net.ipv4.tcp_keepalive_intvl" "net.ipv4.tcp_keepalive_probes" -}}
+{{- if not .Values.statefulset.allowUnsafeSysctls -}}
+{{- range .Values.statefulset.podSysctls -}}
+{{- if not (has .name $safe) -}}
+  {{ fail (printf "sysctl %s is not safe, set statefulset.allowUnsafeSysctls to true once it is allowed on the kubelets" .name) }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Resources of a container of the CockroachDB Pods next to the CockroachDB one:
+its own, or gkeAutopilot.sidecarResources on Autopilot when there are none.
+Usage: include "cockroachdb.statefulset.sidecarResources" (dict "resources" .Values.volumeExporter.resources "context" $)
+*/}}
+{{- define "cockroachdb.statefulset.sidecarResources" -}}
+{{- $resources := .resources -}}
+{{- if and .context.Values.gkeAutopilot.enabled (not $resources) -}}
+  {{- $resources = .context.Values.gkeAutopilot.sidecarResources -}}
+{{- end -}}
+{{- with $resources -}}
+{{- toYaml . -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that nothing the chart can't drop on GKE Autopilot uses host
+resources or kernel features Autopilot rejects.
+*/}}
+{{- define "cockroachdb.gkeAutopilot.validation" -}}
+{{- if .Values.gkeAutopilot.enabled -}}
+{{- if and .Values.storage.hostPath (not .Values.storage.persistentVolume.enabled) -}}
+  {{ fail "gkeAutopilot.enabled can't be combined with storage.hostPath, as Autopilot rejects hostPath volumes" }}
+{{- end -}}
+{{- if .Values.statefulset.allowUnsafeSysctls -}}
+  {{ fail "gkeAutopilot.enabled can't be combined with statefulset.allowUnsafeSysctls, as Autopilot only allows safe sysctls" }}
+{{- end -}}
+{{- if or .Values.statefulset.performance.hugepages.amount .Values.statefulset.performance.runtimeClassName -}}
+  {{ fail "gkeAutopilot.enabled can't be combined with the huge pages or the RuntimeClass of statefulset.performance" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Resources of the CockroachDB container: the ones of the sizing profile, or of
+gkeAutopilot.resources on Autopilot when there are none, with the huge pages of
+statefulset.performance.hugepages requested and limited.
+*/}}
+{{- define "cockroachdb.statefulset.resources" -}}
+{{- $resources := include "cockroachdb.profile.value" (dict "key" "resources" "value" .Values.statefulset.resources "context" $) | fromYaml -}}
+{{- if and .Values.gkeAutopilot.enabled (not $resources) -}}
+  {{- $resources = deepCopy .Values.gkeAutopilot.resources -}}
+{{- end -}}
+{{- with .Values.statefulset.performance.hugepages -}}
+{{- if .amount -}}
+  {{- $hugepages := dict (printf "hugepages-%s" .size) .amount -}}
+  {{- $_ := set $resources "requests" (merge (dig "requests" (dict) $resources) $hugepages) -}}
+  {{- $_ := set $resources "limits" (merge (dig "limits" (dict) $resources) $hugepages) -}}
+{{- end -}}
+{{- end -}}
+{{- with $resources -}}
+{{- toYaml . -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the huge pages and the CPU pinning of statefulset.performance. The
+kubelets only pin the CPUs of Pods of the Guaranteed QoS class, whose
+containers all have CPU and memory requests equal to their limits.
+*/}}
+{{- define "cockroachdb.statefulset.performance.validation" -}}
+{{- $resources := include "cockroachdb.profile.value" (dict "key" "resources" "value" .Values.statefulset.resources "context" $) | fromYaml -}}
+{{- if and .Values.gkeAutopilot.enabled (not $resources) -}}
+  {{- $resources = .Values.gkeAutopilot.resources -}}
+{{- end -}}
+{{- with .Values.statefulset.performance.hugepages -}}
+{{- if .amount -}}
+  {{- $size := include "cockroachdb.quantity.bytes" .size | float64 | int64 -}}
+  {{- $amount := include "cockroachdb.quantity.bytes" .amount | float64 | int64 -}}
+  {{- if or (eq $amount 0) (ne (mod $amount $size | int64) 0) -}}
+    {{ fail (printf "statefulset.performance.hugepages.amount %s must be a multiple of the size %s" (toString .amount) .size) }}
+  {{- end -}}
+  {{- if not (or $resources.requests $resources.limits) -}}
+    {{ fail "statefulset.performance.hugepages requires CPU or memory resources in statefulset.resources" }}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- if .Values.statefulset.performance.cpuPinning -}}
+  {{- if not (regexMatch "^[1-9][0-9]*$" (dig "limits" "cpu" "" $resources | toString)) -}}
+    {{ fail "statefulset.performance.cpuPinning requires a CPU limit of a whole number of cores in statefulset.resources.limits.cpu" }}
+  {{- end -}}
+  {{- $containers := dict .Values.statefulset.containerName $resources -}}
+  {{- if .Values.tls.enabled -}}
+    {{- $_ := set $containers "copy-certs" (include "cockroachdb.statefulset.sidecarResources" (dict "resources" .Values.tls.copyCerts.resources "context" $) | fromYaml) -}}
+  {{- end -}}
+  {{- if .Values.conf.localityFromNodeLabels.enabled -}}
+    {{- $_ := set $containers "locality" (include "cockroachdb.statefulset.sidecarResources" (dict "resources" .Values.conf.localityFromNodeLabels.resources "context" $) | fromYaml) -}}
+  {{- else if .Values.conf.localityFromPodLabels.enabled -}}
+    {{- $_ := set $containers "locality" (include "cockroachdb.statefulset.sidecarResources" (dict "resources" .Values.conf.localityFromPodLabels.resources "context" $) | fromYaml) -}}
+  {{- end -}}
+  {{- if .Values.volumeExporter.enabled -}}
+    {{- $_ := set $containers "volume-exporter" (include "cockroachdb.statefulset.sidecarResources" (dict "resources" .Values.volumeExporter.resources "context" $) | fromYaml) -}}
+  {{- end -}}
+  {{- range $container, $resources := $containers -}}
+    {{- range $resource := list "cpu" "memory" -}}
+      {{- $limit := dig "limits" $resource "" $resources -}}
+      {{- if not $limit -}}
+        {{ fail (printf "statefulset.performance.cpuPinning requires a %s limit on the %s container" $resource $container) }}
+      {{- end -}}
+      {{- $request := dig "requests" $resource $limit $resources -}}
+      {{- if ne (include "cockroachdb.quantity.bytes" $request) (include "cockroachdb.quantity.bytes" $limit) -}}
+        {{ fail (printf "statefulset.performance.cpuPinning requires the %s request of the %s container to be equal to its limit" $resource $container) }}
+      {{- end -}}
+    {{- end -}}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the data volume size overrides of the StatefulSet Pods.
+*/}}
+{{- define "cockroachdb.storage.persistentVolume.perNodeOverrides.validation" -}}
+{{- if and .Values.storage.persistentVolume.perNodeOverrides (not .Values.storage.persistentVolume.expansion.enabled) -}}
+  {{ fail "storage.persistentVolume.perNodeOverrides requires storage.persistentVolume.expansion.enabled to be set to true" }}
+{{- end -}}
+{{- range .Values.storage.persistentVolume.perNodeOverrides -}}
+{{- if or (not (hasKey . "ordinal")) (not .size) -}}
+  {{ fail "storage.persistentVolume.perNodeOverrides entries require an ordinal and a size" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the single-node settings: a `start-single-node` StatefulSet with
+several replicas runs standalone nodes which never form a cluster.
+*/}}
+{{- define "cockroachdb.conf.singleNode.validation" -}}
+{{- if and (index .Values.conf `single-node`) (gt (int64 .Values.statefulset.replicas) 1) -}}
+  {{ fail "conf.single-node can't be set to true if statefulset.replicas is greater than 1" }}
+{{- end -}}
+{{- if .Values.init.singleNodeConversion.enabled -}}
+{{- if index .Values.conf `single-node` -}}
+  {{ fail "init.singleNodeConversion requires conf.single-node to be set to false" }}
+{{- end -}}
+{{- if lt (int64 .Values.statefulset.replicas) 3 -}}
+  {{ fail "init.singleNodeConversion requires statefulset.replicas to be at least 3" }}
+{{- end -}}
+{{- if .Values.conf.join -}}
+  {{ fail "init.singleNodeConversion can't be used with conf.join" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the Vault settings of the self-signer.
+*/}}
+{{- define "cockroachdb.tls.certs.selfSigner.vault.validation" -}}
+{{- with .Values.tls.certs.selfSigner.vault -}}
+{{- if .enabled -}}
+{{- if $.Values.tls.certs.selfSigner.caProvided -}}
+  {{ fail "tls.certs.selfSigner.vault can't be used with tls.certs.selfSigner.caProvided" }}
+{{- end -}}
+{{- if or (not .address) (not .role) -}}
+  {{ fail "tls.certs.selfSigner.vault requires an address and a role" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the split client CA is only used with a CA generated by the self-signer in a Kubernetes Secret.
+*/}}
+{{- define "cockroachdb.tls.certs.selfSigner.splitCA.validation" -}}
+{{- if and .Values.tls.certs.selfSigner.enabled .Values.tls.certs.selfSigner.splitCA -}}
+{{- if .Values.tls.certs.selfSigner.caProvided -}}
+  {{ fail "tls.certs.selfSigner.splitCA can't be used with tls.certs.selfSigner.caProvided" }}
+{{- end -}}
+{{- if .Values.tls.certs.selfSigner.vault.enabled -}}
+  {{ fail "tls.certs.selfSigner.splitCA can't be used with tls.certs.selfSigner.vault" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Environment variables locating the CA in Vault, for the self-signer containers.
+*/}}
+{{- define "cockroachdb.tls.certs.selfSigner.vault.env" -}}
+{{- with .Values.tls.certs.selfSigner.vault -}}
+- name: VAULT_ADDR
+  value: {{ .address | quote }}
+- name: VAULT_AUTH_MOUNT
+  value: {{ .authMount | quote }}
+- name: VAULT_ROLE
+  value: {{ .role | quote }}
+- name: VAULT_KV_MOUNT
+  value: {{ .kvMount | quote }}
+- name: VAULT_PATH
+  value: {{ .path | default (printf "cockroachdb/%s/%s" $.Release.Namespace (include "cockroachdb.fullname" $)) | quote }}
+{{- with .namespace }}
+- name: VAULT_NAMESPACE
+  value: {{ . | quote }}
+{{- end }}
+{{- if .caCertSecret }}
+- name: VAULT_CACERT
+  value: /vault/tls/ca.crt
+{{- end }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Destinations never sent through the egress proxy: the loopback addresses, the
+cluster Services (including the API server, which the self-signer reaches by
+its ClusterIP) and the Services and Pods of the chart, followed by the
+user-provided proxy.noProxy.
+*/}}
+{{- define "cockroachdb.proxy.noProxy" -}}
+{{- $fullname := include "cockroachdb.fullname" . -}}
+{{- $svcDomain := printf "svc.%s" .Values.clusterDomain -}}
+{{- $noProxy := list "localhost" "127.0.0.1" "::1" -}}
+{{- if .Values.proxy.serviceCIDR -}}
+  {{- $noProxy = append $noProxy .Values.proxy.serviceCIDR -}}
+{{- else -}}
+  {{- with lookup "v1" "Service" "default" "kubernetes" -}}
+    {{- $noProxy = append $noProxy .spec.clusterIP -}}
+  {{- end -}}
+{{- end -}}
+{{- $noProxy = concat $noProxy (list "kubernetes.default" (printf "kubernetes.default.%s" $svcDomain) ".svc" (printf ".%s" $svcDomain)) -}}
+{{- $noProxy = concat $noProxy (list $fullname (include "cockroachdb.publicServiceName" .) (printf ".%s.%s.%s" $fullname .Release.Namespace $svcDomain)) -}}
+{{- concat $noProxy .Values.proxy.noProxy | uniq | join "," -}}
+{{- end -}}
+
+{{/*
+Egress proxy env of the containers of the chart.
+*/}}
+{{- define "cockroachdb.proxy.env" -}}
+- name: NO_PROXY
+  value: {{ include "cockroachdb.proxy.noProxy" . | quote }}
+{{- with .Values.proxy.httpProxy }}
+- name: HTTP_PROXY
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.proxy.httpsProxy }}
+- name: HTTPS_PROXY
+  value: {{ . | quote }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Validate the backend of the sensitive Secrets of the chart.
+*/}}
+{{- define "cockroachdb.secretsBackend.validation" -}}
+{{- if and (eq .Values.secretsBackend "external") (not .Values.externalSecrets.secretStoreRef.name) -}}
+  {{ fail "externalSecrets.secretStoreRef.name must be set if secretsBackend is set to external" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Render a sensitive Secret of the chart as a SealedSecret or an ExternalSecret,
+according to secretsBackend. The data are the sealed values or the keys of the
+values in the external store, by key of the Secret.
+Usage: include "cockroachdb.secretsBackend.secret" (dict "name" $name "data" $data "context" $)
+*/}}
+{{- define "cockroachdb.secretsBackend.secret" -}}
+{{- $ctx := .context -}}
+{{- if eq $ctx.Values.secretsBackend "sealed" -}}
+kind: SealedSecret
+apiVersion: bitnami.com/v1alpha1
+{{- else -}}
+kind: ExternalSecret
+apiVersion: external-secrets.io/v1beta1
+{{- end }}
+metadata:
+  name: {{ .name }}
+  namespace: {{ $ctx.Release.Namespace | quote }}
+  labels:
+    {{- include "cockroachdb.secretsBackend.labels" $ctx | nindent 4 }}
+  {{- with include "cockroachdb.commonAnnotations" (dict "context" $ctx) }}
+  annotations:
+    {{- . | nindent 4 }}
+  {{- end }}
+spec:
+{{- if eq $ctx.Values.secretsBackend "sealed" }}
+  encryptedData:
+  {{- range $key, $value := .data }}
+    {{ $key }}: {{ $value | quote }}
+  {{- end }}
+  template:
+    type: Opaque
+    metadata:
+      labels:
+        {{- include "cockroachdb.secretsBackend.labels" $ctx | nindent 8 }}
+{{- else }}
+  refreshInterval: {{ $ctx.Values.externalSecrets.refreshInterval | quote }}
+  secretStoreRef:
+    name: {{ $ctx.Values.externalSecrets.secretStoreRef.name }}
+    kind: {{ $ctx.Values.externalSecrets.secretStoreRef.kind }}
+  target:
+    name: {{ .name }}
+    creationPolicy: Owner
+    template:
+      type: Opaque
+      metadata:
+        labels:
+          {{- include "cockroachdb.secretsBackend.labels" $ctx | nindent 10 }}
+  data:
+  {{- range $key, $value := .data }}
+    - secretKey: {{ $key }}
+      remoteRef:
+        key: {{ $value | quote }}
+  {{- end }}
+{{- end }}
+{{- end -}}
+
+{{- define "cockroachdb.secretsBackend.labels" -}}
+helm.sh/chart: {{ template "cockroachdb.chart" . }}
+app.kubernetes.io/name: {{ template "cockroachdb.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name | quote }}
+app.kubernetes.io/managed-by: {{ .Release.Service | quote }}
+{{- with include "cockroachdb.commonLabels" . }}
+{{ . }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Validate that the pre-flight Job has join addresses to check.
+*/}}
+{{- define "cockroachdb.preflight.validation" -}}
+{{- if and .Values.preflight.enabled (not .Values.conf.join) -}}
+  {{ fail "preflight.enabled checks the addresses of conf.join and requires conf.join to be set" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the developer access, which serves SQL without certificates, is
+only enabled in insecure clusters.
+*/}}
+{{- define "cockroachdb.devAccess.validation" -}}
+{{- if and .Values.devAccess.enabled .Values.tls.enabled -}}
+  {{ fail "devAccess.enabled is meant for insecure development clusters only and requires tls.enabled to be false" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the table and durations of the canary, passed to its flags.
+*/}}
+{{- define "cockroachdb.canary.validation" -}}
+{{- with .Values.canary -}}
+{{- if not (regexMatch "^[A-Za-z_][A-Za-z0-9_]*(\\.[A-Za-z_][A-Za-z0-9_]*){0,2}$" .table) -}}
+  {{ fail (printf "canary.table must be a [database.][schema.]table name, got %s" .table) }}
+{{- end -}}
+{{- range $key := list "interval" "timeout" -}}
+  {{- if not (regexMatch "^([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+$" (toString (get $.Values.canary $key))) -}}
+    {{ fail (printf "canary.%s must be a duration, e.g. 10s, got %v" $key (get $.Values.canary $key)) }}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the timeseries retention settings, applied by the provisioning job.
+*/}}
+{{- define "cockroachdb.timeseries.validation" -}}
+{{- if and (or .Values.timeseries.resolution10sTTL .Values.timeseries.resolution30mTTL) (not .Values.init.provisioning.enabled) -}}
+  {{ fail "timeseries.resolution10sTTL and timeseries.resolution30mTTL are applied by the provisioning job and require init.provisioning.enabled" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the changefeed sinks, registered as external connections by the provisioning job.
+*/}}
+{{- define "cockroachdb.changefeed.validation" -}}
+{{- with .Values.changefeed.sinks -}}
+{{- if not $.Values.init.provisioning.enabled -}}
+  {{ fail "changefeed.sinks are registered by the provisioning job and require init.provisioning.enabled" }}
+{{- end -}}
+{{- range $sink := . -}}
+{{- if not (regexMatch "^[a-z_][a-z0-9_]*$" ($sink.name | default "")) -}}
+  {{ fail (printf "changefeed.sinks[].name %q must only contain lowercase letters, digits and underscores" ($sink.name | default "")) }}
+{{- end -}}
+{{- if or (not $sink.uri) (contains "'" $sink.uri) -}}
+  {{ fail (printf "changefeed.sinks[%s].uri must be set and can't contain single quotes" $sink.name) }}
+{{- end -}}
+{{- if not $sink.secret -}}
+  {{ fail (printf "changefeed.sinks[%s].secret can't be empty" $sink.name) }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Items of the Secret of a changefeed sink, mounted under /cockroach/changefeed-sinks/<name>/. The keys default to the
+ones of a kubernetes.io/tls Secret, an empty key leaves the item out.
+*/}}
+{{- define "cockroachdb.changefeed.sinkItems" -}}
+{{- $defaults := dict "caCertKey" "ca.crt" "clientCertKey" "tls.crt" "clientKeyKey" "tls.key" }}
+{{- range $key, $path := dict "caCertKey" "ca.crt" "clientCertKey" "client.crt" "clientKeyKey" "client.key" }}
+{{- with ternary (index $ $key) (index $defaults $key) (hasKey $ $key) }}
+- key: {{ . | quote }}
+  path: {{ $path }}
+{{- end }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Validate that the cluster-scoped permissions required to prune the CertificateSigningRequests can be created.
+*/}}
+{{- define "cockroachdb.cleaner.validation" -}}
+{{- if and .Values.tls.certs.selfSigner.cleaner.csrs (not .Values.rbac.clusterScoped) -}}
+  {{ fail "tls.certs.selfSigner.cleaner.csrs requires rbac.clusterScoped" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the CSR collector can list and delete the CertificateSigningRequests.
+*/}}
+{{- define "cockroachdb.csrCollector.validation" -}}
+{{- if and .Values.tls.certs.selfSigner.csrCollector.enabled (not .Values.rbac.clusterScoped) -}}
+  {{ fail "tls.certs.selfSigner.csrCollector requires rbac.clusterScoped" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+API group and resource of the kinds of objects the drift detector can compare,
+rendered as JSON.
+*/}}
+{{- define "cockroachdb.driftDetection.resources" -}}
+{{- $known := dict "StatefulSet" (list "apps" "statefulsets") "Service" (list "" "services") "ConfigMap" (list "" "configmaps") "ServiceAccount" (list "" "serviceaccounts") "PodDisruptionBudget" (list "policy" "poddisruptionbudgets") -}}
+{{- $resources := list -}}
+{{- range $kind := .Values.driftDetection.kinds -}}
+  {{- if not (hasKey $known $kind) -}}
+    {{ fail (printf "driftDetection.kinds: unsupported kind %s" $kind) }}
+  {{- end -}}
+  {{- $resources = append $resources (index $known $kind) -}}
+{{- end -}}
+{{- dict "resources" $resources | toJson -}}
+{{- end -}}
+
+{{/*
+Validate that the volume exporter has a logs or WAL failover volume to export.
+*/}}
+{{- define "cockroachdb.volumeExporter.validation" -}}
+{{- if and .Values.volumeExporter.enabled (not (or .Values.conf.log.persistentVolume.enabled (index .Values.conf `wal-failover` `persistentVolume` `enabled`))) -}}
+  {{ fail "volumeExporter.enabled requires conf.log.persistentVolume.enabled or conf.wal-failover.persistentVolume.enabled" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the diagnostics settings, which are only applied behind the
+diagnostics.dangerZone gate.
+*/}}
+{{- define "cockroachdb.diagnostics.validation" -}}
+{{- with .Values.diagnostics -}}
+{{- if or .profiling.enabled .tracing.enabled -}}
+{{- if not .dangerZone -}}
+  {{ fail "diagnostics.profiling and diagnostics.tracing require diagnostics.dangerZone to be set to true" }}
+{{- end -}}
+{{- if not $.Values.tls.enabled -}}
+  {{ fail "diagnostics.profiling and diagnostics.tracing require tls.enabled, as the debug endpoints of an insecure cluster are unauthenticated" }}
+{{- end -}}
+{{- if and (or .tracing.enabled .profiling.cpuUsageThreshold) (not $.Values.init.provisioning.enabled) -}}
+  {{ fail "the diagnostics cluster settings are applied by the provisioning job and require init.provisioning.enabled" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that the statement diagnostics bundle Job has a single statement to
+diagnose and a container to upload the bundle with.
+*/}}
+{{- define "cockroachdb.diagnostics.statementBundle.validation" -}}
+{{- with .Values.diagnostics.statementBundle -}}
+{{- if not $.Values.diagnostics.dangerZone -}}
+  {{ fail "diagnostics.statementBundle requires diagnostics.dangerZone to be set to true" }}
+{{- end -}}
+{{- if eq (empty .fingerprint) (empty .statement) -}}
+  {{ fail "diagnostics.statementBundle requires either a fingerprint or a statement" }}
+{{- end -}}
+{{- if or (not .upload.image) (empty .upload.command) -}}
+  {{ fail "diagnostics.statementBundle requires upload.image and upload.command to upload the bundle" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the Kerberos (GSSAPI) authentication settings.
+*/}}
+{{- define "cockroachdb.kerberos.validation" -}}
+{{- if .Values.kerberos.enabled -}}
+{{- if not .Values.tls.enabled -}}
+  {{ fail "kerberos requires tls.enabled to be set to true" }}
+{{- end -}}
+{{- if not .Values.kerberos.keytabSecret -}}
+  {{ fail "kerberos.keytabSecret can't be empty if kerberos.enabled is set to true" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Cluster settings provisioned by the init Job, as a JSON list of settings with
+either an inline `value` or a `valueFrom.secretKeyRef`. The value of a
+secret-backed setting is read from the `<name>_CLUSTER_SETTING` environment
+variable of the init Job, so that it never appears in the rendered manifests.
+The deprecated map of setting names to values is still accepted: its values
+are stored in the `<fullname>-init` Secret and referenced the same way.
+*/}}
+{{- define "cockroachdb.init.provisioning.clusterSettings" -}}
+{{- $settings := list -}}
+{{- $clusterSettings := .Values.init.provisioning.clusterSettings -}}
+{{- if kindIs "map" $clusterSettings -}}
+  {{- $secretName := printf "%s-init" (include "cockroachdb.fullname" .) -}}
+  {{- range $name, $value := $clusterSettings -}}
+    {{- if $value -}}
+      {{- $settings = append $settings (dict "name" $name "valueFrom" (dict "secretKeyRef" (dict "name" $secretName "key" (printf "%s-cluster-setting" ($name | replace "." "-"))))) -}}
+    {{- else -}}
+      {{- $settings = append $settings (dict "name" $name "value" "") -}}
+    {{- end -}}
+  {{- end -}}
+{{- else -}}
+  {{- range $setting := $clusterSettings -}}
+    {{- $name := toString ($setting.name | default "") -}}
+    {{- if not (regexMatch "^[a-z0-9_.]+$" $name) -}}
+      {{- fail (printf "init.provisioning.clusterSettings name %q must be a cluster setting name" $name) -}}
+    {{- end -}}
+    {{- $secretKeyRef := ($setting.valueFrom | default dict).secretKeyRef -}}
+    {{- $hasValue := not (kindIs "invalid" $setting.value) -}}
+    {{- if eq $hasValue (not (empty $secretKeyRef)) -}}
+      {{- fail (printf "init.provisioning.clusterSettings %s must have either a value or a valueFrom.secretKeyRef" $name) -}}
+    {{- end -}}
+    {{- if $hasValue -}}
+      {{- $value := toString $setting.value -}}
+      {{- if and (kindIs "float64" $setting.value) (eq $setting.value (floor $setting.value)) -}}
+        {{- $value = $setting.value | int64 | toString -}}
+      {{- end -}}
+      {{- if regexMatch "[$`]" $value -}}
+        {{- fail (printf "init.provisioning.clusterSettings value of %s can't contain $ or `, set it with valueFrom.secretKeyRef instead" $name) -}}
+      {{- end -}}
+      {{- $settings = append $settings (dict "name" $name "value" $value) -}}
+    {{- else -}}
+      {{- if not (and $secretKeyRef.name $secretKeyRef.key) -}}
+        {{- fail (printf "init.provisioning.clusterSettings valueFrom.secretKeyRef of %s requires a name and a key" $name) -}}
+      {{- end -}}
+      {{- $settings = append $settings (dict "name" $name "valueFrom" (dict "secretKeyRef" (pick $secretKeyRef "name" "key"))) -}}
+    {{- end -}}
+  {{- end -}}
+{{- end -}}
+{{- dict "settings" $settings | toJson -}}
+{{- end -}}
+
+{{/*
+Provisioning statements, grouped in steps applied in order: the cluster
+settings, which can't be changed within a transaction, then the users,
+databases and grants, applied in a single transaction by the provisioner, then
+the zone configurations and the backup schedules. Without
+`init.provisioning.transactional`, the statements are kept in a single step,
+in the order applied by the shell of the init Job: the settings, the users,
+then each database with its grants and backup schedules. Rendered as JSON.
+*/}}
+{{- define "cockroachdb.init.provisioning.steps" -}}
+{{- $settings := list -}}
+{{- range $setting := (include "cockroachdb.init.provisioning.clusterSettings" . | fromJson).settings -}}
+  {{- if $setting.valueFrom -}}
+    {{- $settings = append $settings (printf "SET CLUSTER SETTING %s = '$%s_CLUSTER_SETTING'" $setting.name ($setting.name | replace "." "_")) -}}
+  {{- else -}}
+    {{- $settings = append $settings (printf "SET CLUSTER SETTING %s = '%s'" $setting.name ($setting.value | replace "'" "''")) -}}
+  {{- end -}}
+{{- end -}}
+{{- $serverSettings := list -}}
+{{- if .Values.diagnostics.dangerZone -}}
+{{- with .Values.diagnostics.profiling -}}
+{{- if and .enabled .cpuUsageThreshold -}}
+  {{- $serverSettings = append $serverSettings (printf "SET CLUSTER SETTING server.cpu_profile.cpu_usage_combined_threshold = %d" (.cpuUsageThreshold | int64)) -}}
+{{- end -}}
+{{- end -}}
+{{- with .Values.diagnostics.tracing -}}
+{{- if .enabled -}}
+{{- with .txnThreshold -}}
+  {{- $serverSettings = append $serverSettings (printf "SET CLUSTER SETTING sql.trace.txn.enable_threshold = '%s'" .) -}}
+{{- end -}}
+{{- with .stmtThreshold -}}
+  {{- $serverSettings = append $serverSettings (printf "SET CLUSTER SETTING sql.trace.stmt.enable_threshold = '%s'" .) -}}
+{{- end -}}
+  {{- $serverSettings = append $serverSettings (printf "SET CLUSTER SETTING sql.trace.log_statement_execute = %t" .logStatementExecute) -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- with .Values.timeseries.resolution10sTTL -}}
+  {{- $serverSettings = append $serverSettings (printf "SET CLUSTER SETTING timeseries.storage.resolution_10s.ttl = '%s'" .) -}}
+{{- end -}}
+{{- with .Values.timeseries.resolution30mTTL -}}
+  {{- $serverSettings = append $serverSettings (printf "SET CLUSTER SETTING timeseries.storage.resolution_30m.ttl = '%s'" .) -}}
+{{- end -}}
+{{- if and .Values.kerberos.enabled .Values.kerberos.hbaConfiguration -}}
+  {{- $serverSettings = append $serverSettings (printf "SET CLUSTER SETTING server.host_based_authentication.configuration = e'%s'" (.Values.kerberos.hbaConfiguration | trim | replace "\n" "\\n")) -}}
+{{- end -}}
+{{- $timezone := list -}}
+{{- with .Values.timezone.sqlDefault -}}
+  {{- $timezone = append $timezone (printf "ALTER ROLE ALL SET timezone = '%s'" .) -}}
+{{- end -}}
+{{- $users := list -}}
+{{- range $user := .Values.init.provisioning.users -}}
+  {{- $password := ternary (printf "'$%s_PASSWORD'" $user.name) "null" (not (empty $user.password)) -}}
+  {{- $users = append $users (printf "CREATE USER IF NOT EXISTS %s WITH PASSWORD %s %s" $user.name $password (join " " $user.options) | trim) -}}
+{{- end -}}
+{{- $databases := list -}}
+{{- range $database := .Values.init.provisioning.databases -}}
+  {{- $statements := list (printf "CREATE DATABASE IF NOT EXISTS %s %s" $database.name (join " " $database.options) | trim) -}}
+  {{- range $owner := $database.owners -}}
+    {{- $statements = append $statements (printf "GRANT ALL ON DATABASE %s TO %s" $database.name $owner) -}}
+  {{- end -}}
+  {{- range $owner := $database.owners_with_grant_option -}}
+    {{- $statements = append $statements (printf "GRANT ALL ON DATABASE %s TO %s WITH GRANT OPTION" $database.name $owner) -}}
+  {{- end -}}
+  {{- $databases = append $databases (dict "name" $database.name "statements" $statements) -}}
+{{- end -}}
+{{- $zones := list -}}
+{{- range $zone := .Values.init.provisioning.zoneConfigs -}}
+  {{- $variables := list -}}
+  {{- with $zone.num_replicas -}}
+    {{- $variables = append $variables (printf "num_replicas = %d" (. | int64)) -}}
+  {{- end -}}
+  {{- with index $zone "gc.ttlseconds" -}}
+    {{- $variables = append $variables (printf "gc.ttlseconds = %d" (. | int64)) -}}
+  {{- end -}}
+  {{- with $zone.constraints -}}
+    {{- $variables = append $variables (printf "constraints = '%s'" .) -}}
+  {{- end -}}
+  {{- $variables = concat $variables ($zone.options | default list) -}}
+  {{- $zones = append $zones (printf "ALTER %s CONFIGURE ZONE USING %s" $zone.target (join ", " $variables)) -}}
+{{- end -}}
+{{- $schedules := (include "cockroachdb.init.provisioning.backupSchedules" . | fromJson).schedules -}}
+{{- $steps := list -}}
+{{- if .Values.init.provisioning.transactional -}}
+  {{- $schema := concat $timezone $users -}}
+  {{- range $database := $databases -}}
+    {{- $schema = concat $schema $database.statements -}}
+  {{- end -}}
+  {{- $backups := list -}}
+  {{- range $schedule := $schedules -}}
+    {{- $backups = append $backups (include "cockroachdb.init.provisioning.backupSchedule" $schedule | trimSuffix ";" | trim) -}}
+  {{- end -}}
+  {{- $steps = list (dict "name" "cluster settings" "statements" (concat $settings $serverSettings)) (dict "name" "users and databases" "transactional" true "statements" $schema) (dict "name" "zone configurations" "statements" $zones) (dict "name" "backup schedules" "statements" $backups) -}}
+{{- else -}}
+  {{- $statements := concat $settings $timezone $serverSettings $users -}}
+  {{- range $database := $databases -}}
+    {{- $statements = concat $statements $database.statements -}}
+    {{- range $schedule := $schedules -}}
+      {{- if eq $schedule.database $database.name -}}
+        {{- $statements = append $statements (include "cockroachdb.init.provisioning.backupSchedule" $schedule | trimSuffix ";" | trim) -}}
+      {{- end -}}
+    {{- end -}}
+  {{- end -}}
+  {{- $steps = list (dict "name" "provisioning" "statements" (concat $statements $zones)) -}}
+{{- end -}}
+{{- dict "steps" $steps | toJson -}}
+{{- end -}}
+
+{{/*
+Validate the example data loaded by the init Job, which must be acknowledged
+as not meant for production clusters.
+*/}}
+{{- define "cockroachdb.init.sampleData.validation" -}}
+{{- with .Values.init.sampleData -}}
+{{- if not (has .workload (list "movr" "kv" "none")) -}}
+  {{ fail (printf "init.sampleData.workload must be one of movr, kv or none, got %v" .workload) }}
+{{- end -}}
+{{- if and (ne .workload "none") (not .acknowledgeNonProduction) -}}
+  {{ fail (printf "init.sampleData.workload %s loads example data, which isn't meant for production clusters, and requires init.sampleData.acknowledgeNonProduction to be set to true" .workload) }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Format a number of cores as a CPU quantity, in whole cores when possible,
+in millicores otherwise.
+*/}}
+{{- define "cockroachdb.quantity.format.cpu" -}}
+{{- $milli := mulf (float64 .) 1000 | ceil | int64 -}}
+{{- if eq (mod $milli 1000 | int64) 0 -}}
+{{ div $milli 1000 }}
+{{- else -}}
+{{ $milli }}m
+{{- end -}}
+{{- end -}}
+
+{{/*
+Format a number of bytes as a memory or storage quantity, in the largest
+binary unit dividing it.
+*/}}
+{{- define "cockroachdb.quantity.format.bytes" -}}
+{{- $bytes := float64 . | ceil | int64 -}}
+{{- $formatted := toString $bytes -}}
+{{- range $unit := list (list "Ki" 1024) (list "Mi" 1048576) (list "Gi" 1073741824) (list "Ti" 1099511627776) -}}
+  {{- $size := index $unit 1 | int64 -}}
+  {{- if and (ge $bytes $size) (eq (mod $bytes $size | int64) 0) -}}
+    {{- $formatted = printf "%d%s" (div $bytes $size) (index $unit 0) -}}
+  {{- end -}}
+{{- end -}}
+{{- $formatted -}}
+{{- end -}}
+
+{{/*
+Resource requirements of the CockroachDB Pods, for the namespace of a region
+and for all the regions of `capacityPlanning.regions`, keyed like the
+resources of a ResourceQuota. Rendered as JSON.
+*/}}
+{{- define "cockroachdb.capacityPlanning" -}}
+{{- $replicas := .Values.statefulset.replicas | int64 -}}
+{{- $regions := .Values.capacityPlanning.regions | int64 -}}
+{{- $resources := include "cockroachdb.statefulset.resources" . | fromYaml -}}
+{{- $storage := 0.0 -}}
+{{- $claims := 0 -}}
+{{- if .Values.storage.persistentVolume.enabled -}}
+  {{- $storeSize := include "cockroachdb.profile.value" (dict "key" "storeSize" "value" .Values.storage.persistentVolume.size "context" $) -}}
+  {{- $storage = addf $storage (mulf (include "cockroachdb.quantity.bytes" $storeSize | float64) (.Values.conf.store.count | int64)) -}}
+  {{- $claims = add $claims (.Values.conf.store.count | int64) -}}
+{{- end -}}
+{{- range $volume := list (index .Values.conf `wal-failover` `persistentVolume`) .Values.conf.log.persistentVolume (index .Values.conf `temp-dir` `persistentVolume`) -}}
+  {{- if $volume.enabled -}}
+    {{- $storage = addf $storage (include "cockroachdb.quantity.bytes" $volume.size | float64) -}}
+    {{- $claims = add $claims 1 -}}
+  {{- end -}}
+{{- end -}}
+{{- $region := dict "persistentvolumeclaims" (mul $claims $replicas) "requests.storage" (include "cockroachdb.quantity.format.bytes" (mulf $storage $replicas)) -}}
+{{- $total := dict "persistentvolumeclaims" (mul $claims $replicas $regions) "requests.storage" (include "cockroachdb.quantity.format.bytes" (mulf $storage $replicas $regions)) -}}
+{{- range $kind := list "requests" "limits" -}}
+  {{- $cpu := include "cockroachdb.quantity.bytes" (dig $kind "cpu" "" $resources) | float64 -}}
+  {{- $memory := include "cockroachdb.quantity.bytes" (dig $kind "memory" "" $resources) | float64 -}}
+  {{- $_ := set $region (printf "%s.cpu" $kind) (include "cockroachdb.quantity.format.cpu" (mulf $cpu $replicas)) -}}
+  {{- $_ := set $region (printf "%s.memory" $kind) (include "cockroachdb.quantity.format.bytes" (mulf $memory $replicas)) -}}
+  {{- $_ := set $total (printf "%s.cpu" $kind) (include "cockroachdb.quantity.format.cpu" (mulf $cpu $replicas $regions)) -}}
+  {{- $_ := set $total (printf "%s.memory" $kind) (include "cockroachdb.quantity.format.bytes" (mulf $memory $replicas $regions)) -}}
+{{- end -}}
+{{- dict "replicas" $replicas "regions" $regions "region" $region "total" $total | toJson -}}
+{{- end -}}
+
+{{/*
+Validate the tables whose statistics are refreshed, which are given to ANALYZE
+as they are.
+*/}}
+{{- define "cockroachdb.statistics.validation" -}}
+{{- with .Values.statistics.refresh -}}
+{{- if and .enabled (empty .tables) -}}
+  {{ fail "statistics.refresh.tables can't be empty if statistics.refresh.enabled is set to true" }}
+{{- end -}}
+{{- range $table := .tables -}}
+{{- if not (regexMatch "^[A-Za-z_][A-Za-z0-9_]*(\\.[A-Za-z_][A-Za-z0-9_]*){1,2}$" (toString $table)) -}}
+  {{ fail (printf "statistics.refresh.tables %q must be <database>.<table> or <database>.<schema>.<table>" (toString $table)) }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that every zone configuration has a target and variables to set.
+*/}}
+{{- define "cockroachdb.init.provisioning.zoneConfigs.validation" -}}
+{{- range $zone := .Values.init.provisioning.zoneConfigs -}}
+{{- if not (regexMatch "^(RANGE|DATABASE|TABLE|INDEX|PARTITION) " ($zone.target | default "")) -}}
+  {{ fail (printf "init.provisioning.zoneConfigs target %q must be a RANGE, DATABASE, TABLE, INDEX or PARTITION" ($zone.target | default "")) }}
+{{- end -}}
+{{- if not (or $zone.num_replicas (index $zone "gc.ttlseconds") $zone.constraints $zone.options) -}}
+  {{ fail (printf "init.provisioning.zoneConfigs of %s sets no variable" $zone.target) }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Name of the ConfigMap holding the provisioning steps applied by the
+provisioner.
+*/}}
+{{- define "cockroachdb.init.provisioning.configMapName" -}}
+{{- printf "%s-provisioning" (include "cockroachdb.fullname" .) -}}
+{{- end -}}
+
+{{/*
+Backup schedules of the provisioned databases: the `backup` of each database,
+named `<database>_scheduled_backup`, and its additional `backups`, named
+`<database>_<name>_scheduled_backup`. Rendered as JSON.
+*/}}
+{{- define "cockroachdb.init.provisioning.backupSchedules" -}}
+{{- $schedules := list -}}
+{{- range $database := .Values.init.provisioning.databases -}}
+  {{- if $database.backup -}}
+    {{- $schedules = append $schedules (dict "name" (printf "%s_scheduled_backup" $database.name) "database" $database.name "backup" $database.backup) -}}
+  {{- end -}}
+  {{- range $backup := $database.backups -}}
+    {{- if not $backup.name -}}
+      {{- fail (printf "init.provisioning.databases[%s].backups[].name can't be empty" $database.name) -}}
+    {{- end -}}
+    {{- $schedules = append $schedules (dict "name" (printf "%s_%s_scheduled_backup" $database.name $backup.name) "database" $database.name "backup" $backup) -}}
+  {{- end -}}
+{{- end -}}
+{{- dict "schedules" $schedules | toJson -}}
+{{- end -}}
+
+{{/*
+Render the option of a BACKUP statement encrypting the backup with the KMS URI
+or the passphrase of the `encryption` settings, referenced by the
+`<env>_KMS_URI` and `<env>_PASSPHRASE` environment variables respectively.
+Usage: include "cockroachdb.backup.encryptionOption" (dict "encryption" $backup.encryption "env" "BACKUP")
+*/}}
+{{- define "cockroachdb.backup.encryptionOption" -}}
+{{- with .encryption -}}
+{{- if and .kmsUri .passphraseSecret -}}
+  {{ fail "encryption.kmsUri and encryption.passphraseSecret of a backup can't be both set" }}
+{{- else if .kmsUri -}}
+kms = '${{ $.env }}_KMS_URI'
+{{- else if .passphraseSecret -}}
+encryption_passphrase = '${{ $.env }}_PASSPHRASE'
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Render the statement creating a backup schedule of a provisioned database.
+Usage: include "cockroachdb.init.provisioning.backupSchedule" (dict "name" "db_scheduled_backup" "database" "db" "backup" $backup)
+*/}}
+{{- define "cockroachdb.init.provisioning.backupSchedule" -}}
+{{- $options := .backup.options | default list -}}
+{{- with include "cockroachdb.backup.encryptionOption" (dict "encryption" .backup.encryption "env" .name) -}}
+  {{- $options = append $options . -}}
+{{- end -}}
+CREATE SCHEDULE IF NOT EXISTS {{ .name }}
+  FOR BACKUP DATABASE {{ .database }} INTO '{{ .backup.into }}'
+{{- if $options }}
+  WITH {{ join "," $options }}
+{{- end }}
+  RECURRING '{{ .backup.recurring }}'
+{{- if .backup.fullBackup }}
+  FULL BACKUP '{{ .backup.fullBackup }}'
+{{- else }}
+  FULL BACKUP ALWAYS
+{{- end }}
+{{- if and .backup.schedule .backup.schedule.options }}
+  WITH SCHEDULE OPTIONS {{ join "," .backup.schedule.options }}
+{{- end }}
+;
+{{- end -}}
+
+{{/*
+Validate the pre-upgrade backup settings.
+*/}}
+{{- define "cockroachdb.upgrade.backupFirst.validation" -}}
+{{- if and (not .Values.upgrade.backupFirst.destination) (not .Values.upgrade.backupFirst.destinationSecret) -}}
+  {{ fail "upgrade.backupFirst.destination or upgrade.backupFirst.destinationSecret must be set if upgrade.backupFirst.enabled is set to true" }}
+{{- end -}}
+{{- if .Values.argocdCompatibility.enabled -}}
+  {{ fail "upgrade.backupFirst is not supported with argocdCompatibility, as Argo CD doesn't distinguish installs from upgrades" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate that cluster virtualization is applied by the init Job, to a
+CockroachDB version supporting it. The versions of custom images and tags
+can't be told, and are assumed to support it.
+*/}}
+{{- define "cockroachdb.virtualization.validation" -}}
+{{- if .Values.virtualization.enabled -}}
+{{- if or (index .Values.conf `single-node`) .Values.conf.join .Values.init.singleNodeConversion.enabled -}}
+  {{ fail "virtualization.enabled requires the cluster to be initialized by the init Job, without conf.single-node, conf.join and init.singleNodeConversion" }}
+{{- end -}}
+{{- if .Values.init.pcr.enabled -}}
+  {{ fail "virtualization.enabled can't be combined with init.pcr.enabled, which virtualizes the cluster itself" }}
+{{- end -}}
+{{- if or (eq .Values.virtualization.name "system") (not (regexMatch "^[a-z0-9]([a-z0-9-]{0,98}[a-z0-9])?$" .Values.virtualization.name)) -}}
+  {{ fail (printf "virtualization.name: invalid virtual cluster name %s" .Values.virtualization.name) }}
+{{- end -}}
+{{- $tag := toString .Values.image.tag -}}
+{{- if and (eq .Values.image.repository "cockroachdb/cockroach") (regexMatch "^v?[0-9]+\\.[0-9]+\\.[0-9]+" $tag) -}}
+{{- if not (semverCompare ">=24.1.0-0" $tag) -}}
+  {{ fail (printf "virtualization.enabled requires CockroachDB v24.1 or later, got %s" $tag) }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{- define "cockroachdb.upgrade.finalize.validation" -}}
+{{- if .Values.argocdCompatibility.enabled -}}
+  {{ fail "upgrade.finalize is not supported with argocdCompatibility, as Argo CD doesn't distinguish installs from upgrades" }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Script reporting whether the finalization of a major version upgrade is
+pending, setting the VERSION, BINARY_VERSION and PRESERVED variables. The SQL
+client reads the address and the certificates of the cluster from the
+COCKROACH_HOST and COCKROACH_CERTS_DIR or COCKROACH_INSECURE env vars.
+*/}}
+{{- define "cockroachdb.upgrade.finalize.statusScript" -}}
+sql() {
+  /cockroach/cockroach sql --format=tsv --execute="$1" | tail -n +2;
+};
+VERSION=$(sql "SHOW CLUSTER SETTING version");
+BINARY_VERSION=$(sql "SELECT crdb_internal.node_executable_version()");
+PRESERVED=$(sql "SHOW CLUSTER SETTING cluster.preserve_downgrade_option");
+if [[ "${VERSION}" != "${BINARY_VERSION}" ]]; then
+  echo "Finalization pending: the cluster version is ${VERSION}, the version of the nodes ${BINARY_VERSION}";
+else
+  echo "Finalized: the cluster version is ${VERSION}";
+fi;
+if [[ -n "${PRESERVED}" ]]; then
+  echo "Upgrades are not finalized automatically: cluster.preserve_downgrade_option is set to ${PRESERVED}";
+fi;
+{{- end -}}
+
+{{/*
+Env vars of the SQL clients of the rebalance Job, holding the address and the
+certificates of the cluster.
+*/}}
+{{- define "cockroachdb.rebalance.env" -}}
+- name: COCKROACH_HOST
+  value: {{ template "cockroachdb.clientServiceName" . }}:{{ .Values.service.ports.grpc.external.port | int64 }}
+{{- if .Values.tls.enabled }}
+- name: COCKROACH_CERTS_DIR
+  value: /cockroach-certs/
+{{- else }}
+- name: COCKROACH_INSECURE
+  value: "true"
+{{- end }}
+{{- end -}}
+
+{{- define "cockroachdb.ingress.tlsTermination.validation" -}}
+{{- with .Values.ingress.tlsTermination -}}
+{{- if and .controller (not (has .controller (list "nginx" "alb" "gce"))) -}}
+  {{ fail (printf "ingress.tlsTermination.controller must be one of nginx, alb or gce, got %s" .controller) }}
+{{- end -}}
+{{- if not (has .mode (list "reencrypt" "passthrough" "edge")) -}}
+  {{ fail (printf "ingress.tlsTermination.mode must be one of reencrypt, passthrough or edge, got %s" .mode) }}
+{{- end -}}
+{{- if and (ne .mode "edge") (not $.Values.tls.enabled) -}}
+  {{ fail (printf "ingress.tlsTermination.mode %s requires tls.enabled, as the DB Console is served over plain HTTP otherwise" .mode) }}
+{{- end -}}
+{{- if and (eq .mode "edge") $.Values.tls.enabled -}}
+  {{ fail "ingress.tlsTermination.mode edge requires tls.enabled to be false, as the DB Console is served over HTTPS otherwise" }}
+{{- end -}}
+{{- if and (eq .mode "passthrough") (has .controller (list "alb" "gce")) -}}
+  {{ fail (printf "ingress.tlsTermination.mode passthrough is not supported by the %s Ingress controller" .controller) }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Annotations of the Ingress terminating the TLS of the DB Console clients as
+configured by `ingress.tlsTermination`, for its Ingress controller.
+*/}}
+{{- define "cockroachdb.ingress.tlsTermination.annotations" -}}
+{{- $annotations := dict -}}
+{{- with .Values.ingress.tlsTermination -}}
+{{- $backendProtocol := eq .mode "edge" | ternary "HTTP" "HTTPS" -}}
+{{- if eq .controller "nginx" -}}
+  {{- $_ := set $annotations "nginx.ingress.kubernetes.io/backend-protocol" $backendProtocol -}}
+  {{- if eq .mode "passthrough" -}}
+    {{- $_ := set $annotations "nginx.ingress.kubernetes.io/ssl-passthrough" "true" -}}
+  {{- else if and (eq .mode "reencrypt") .backendCASecret -}}
+    {{- $serverName := printf "%s.%s.svc.%s" (include "cockroachdb.publicServiceName" $) $.Release.Namespace $.Values.clusterDomain -}}
+    {{- with $.Values.tls.certs.ui.dnsNames -}}
+      {{- $serverName = first . -}}
+    {{- end -}}
+    {{- $_ := set $annotations "nginx.ingress.kubernetes.io/proxy-ssl-secret" (contains "/" .backendCASecret | ternary .backendCASecret (printf "%s/%s" $.Release.Namespace .backendCASecret)) -}}
+    {{- $_ := set $annotations "nginx.ingress.kubernetes.io/proxy-ssl-verify" "on" -}}
+    {{- $_ := set $annotations "nginx.ingress.kubernetes.io/proxy-ssl-name" $serverName -}}
+  {{- end -}}
+{{- else if eq .controller "alb" -}}
+  {{- $_ := set $annotations "alb.ingress.kubernetes.io/backend-protocol" $backendProtocol -}}
+  {{- $_ := set $annotations "alb.ingress.kubernetes.io/healthcheck-protocol" $backendProtocol -}}
+  {{- $_ := set $annotations "alb.ingress.kubernetes.io/healthcheck-path" "/health" -}}
+  {{- $_ := set $annotations "alb.ingress.kubernetes.io/listen-ports" "[{\"HTTPS\":443}]" -}}
+{{- else if eq .controller "gce" -}}
+  {{- if and (or .secretName $.Values.ingress.tls) (not $.Values.iap.enabled) -}}
+    {{- $_ := set $annotations "kubernetes.io/ingress.allow-http" "false" -}}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- with $annotations -}}
+{{- toYaml . -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the egress targets of the NetworkPolicy: a target must be reachable
+by CIDR unless an FQDN provider enforces its FQDNs.
+*/}}
+{{- define "cockroachdb.networkPolicy.egress.validation" -}}
+{{- with .Values.networkPolicy.egress -}}
+{{- if .enabled -}}
+{{- if not $.Values.networkPolicy.enabled -}}
+  {{ fail "networkPolicy.egress.enabled requires networkPolicy.enabled" }}
+{{- end -}}
+{{- if and .fqdnProvider (not (has .fqdnProvider (list "cilium" "calico"))) -}}
+  {{ fail (printf "networkPolicy.egress.fqdnProvider must be one of cilium or calico, got %s" .fqdnProvider) }}
+{{- end -}}
+{{- $fqdnProvider := .fqdnProvider -}}
+{{- $names := list -}}
+{{- range .targets -}}
+  {{- if not .name -}}
+    {{ fail "networkPolicy.egress.targets must all have a name" }}
+  {{- end -}}
+  {{- if has .name $names -}}
+    {{ fail (printf "networkPolicy.egress.targets has several targets named %s" .name) }}
+  {{- end -}}
+  {{- $names = append $names .name -}}
+  {{- $type := .type | default "" -}}
+  {{- if and $type (not (has $type (list "s3" "gcs" "azureBlob" "awsKms" "gcpKms" "azureKeyVault" "oidc"))) -}}
+    {{ fail (printf "networkPolicy.egress.targets[%s].type must be one of s3, gcs, azureBlob, awsKms, gcpKms, azureKeyVault or oidc, got %s" .name $type) }}
+  {{- end -}}
+  {{- if and (has $type (list "s3" "awsKms")) (not .region) -}}
+    {{ fail (printf "networkPolicy.egress.targets[%s] of type %s requires a region" .name $type) }}
+  {{- end -}}
+  {{- if and (has $type (list "azureBlob" "azureKeyVault")) (not .account) -}}
+    {{ fail (printf "networkPolicy.egress.targets[%s] of type %s requires an account" .name $type) }}
+  {{- end -}}
+  {{- if and (eq $type "oidc") (not .issuerUrl) -}}
+    {{ fail (printf "networkPolicy.egress.targets[%s] of type oidc requires an issuerUrl" .name) }}
+  {{- end -}}
+  {{- if not (or $type .fqdns .cidrs) -}}
+    {{ fail (printf "networkPolicy.egress.targets[%s] must have a type, fqdns or cidrs" .name) }}
+  {{- end -}}
+  {{- if not (or $fqdnProvider .cidrs) -}}
+    {{ fail (printf "networkPolicy.egress.targets[%s] is only reachable by FQDN, which requires networkPolicy.egress.fqdnProvider, or must have cidrs" .name) }}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+FQDNs of an egress target of the NetworkPolicy, one per line: the endpoints
+of the service of its type, followed by its own FQDNs.
+*/}}
+{{- define "cockroachdb.networkPolicy.egress.fqdns" -}}
+{{- $type := .type | default "" -}}
+{{- $fqdns := list -}}
+{{- if eq $type "s3" -}}
+  {{- $fqdns = list (printf "s3.%s.amazonaws.com" .region) (printf "*.s3.%s.amazonaws.com" .region) (printf "sts.%s.amazonaws.com" .region) -}}
+{{- else if eq $type "awsKms" -}}
+  {{- $fqdns = list (printf "kms.%s.amazonaws.com" .region) (printf "sts.%s.amazonaws.com" .region) -}}
+{{- else if eq $type "gcs" -}}
+  {{- $fqdns = list "storage.googleapis.com" "oauth2.googleapis.com" -}}
+{{- else if eq $type "gcpKms" -}}
+  {{- $fqdns = list "cloudkms.googleapis.com" "oauth2.googleapis.com" -}}
+{{- else if eq $type "azureBlob" -}}
+  {{- $fqdns = list (printf "%s.blob.core.windows.net" .account) "login.microsoftonline.com" -}}
+{{- else if eq $type "azureKeyVault" -}}
+  {{- $fqdns = list (printf "%s.vault.azure.net" .account) "login.microsoftonline.com" -}}
+{{- else if eq $type "oidc" -}}
+  {{- $fqdns = list (splitList ":" (urlParse .issuerUrl).host | first) -}}
+{{- end -}}
+{{- concat $fqdns (.fqdns | default list) | uniq | join "\n" -}}
+{{- end -}}
+
+{{/*
+Ports of an egress target of the NetworkPolicy, one per line: its own ports,
+or the port of the issuer of an `oidc` target, or 443.
+*/}}
+{{- define "cockroachdb.networkPolicy.egress.ports" -}}
+{{- $ports := list 443 -}}
+{{- if .ports -}}
+  {{- $ports = .ports -}}
+{{- else if eq (.type | default "") "oidc" -}}
+  {{- $host := splitList ":" (urlParse .issuerUrl).host -}}
+  {{- if gt (len $host) 1 -}}
+    {{- $ports = list (last $host) -}}
+  {{- end -}}
+{{- end -}}
+{{- $ports | join "\n" -}}
+{{- end -}}
+
+{{/*
+Validate that if user enabled tls, then either self-signed certificates or certificate manager is enabled
+*/}}
+{{- define "cockroachdb.tlsValidation" -}}
+{{- if .Values.tls.enabled -}}
+{{- if and .Values.tls.certs.selfSigner.enabled .Values.tls.certs.certManager -}}
+    {{ fail "Can not enable the self signed certificates and certificate manager at the same time" }}
+{{- end -}}
+{{- if and (not .Values.tls.certs.selfSigner.enabled) (not .Values.tls.certs.certManager) -}}
+    {{- if not .Values.tls.certs.provided -}}
+        {{ fail "You have to enable either self signed certificates or certificate manager, if you have enabled tls" }}
+    {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+
+{{- define "cockroachdb.tls.certs.selfSigner.validation" -}}
+{{ include "cockroachdb.tls.certs.selfSigner.vault.validation" . }}
+{{ include "cockroachdb.tls.certs.selfSigner.splitCA.validation" . }}
+{{ include "cockroachdb.tls.certs.selfSigner.caProvidedValidation" . }}
+{{ include "cockroachdb.tls.certs.selfSigner.caCertValidation" . }}
+{{ include "cockroachdb.tls.certs.selfSigner.clientCertValidation" . }}
+{{ include "cockroachdb.tls.certs.selfSigner.nodeCertValidation" . }}
+{{- end -}}
+
+{{/*
+SELinux context and AppArmor profile of securityProfiles in the Pod security
+context, the AppArmor profile only from Kubernetes v1.30.
+*/}}
+{{- define "cockroachdb.securityProfiles.podSecurityContext" -}}
+{{- $securityContext := dict -}}
+{{- with .Values.securityProfiles.seLinuxOptions -}}
+  {{- $_ := set $securityContext "seLinuxOptions" . -}}
+{{- end -}}
+{{- with .Values.securityProfiles.appArmor -}}
+{{- if and .type (semverCompare ">=1.30-0" $.Capabilities.KubeVersion.Version) -}}
+  {{- $profile := dict "type" .type -}}
+  {{- if eq .type "Localhost" -}}
+    {{- $_ := set $profile "localhostProfile" .localhostProfile -}}
+  {{- end -}}
+  {{- $_ := set $securityContext "appArmorProfile" $profile -}}
+{{- end -}}
+{{- end -}}
+{{- with $securityContext -}}
+{{ toYaml . }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+AppArmor annotations of the containers of a Pod, the form of the AppArmor
+profile of securityProfiles before Kubernetes v1.30.
+Usage: include "cockroachdb.securityProfiles.annotations" (dict "containers" (list "cluster-init") "context" $)
+*/}}
+{{- define "cockroachdb.securityProfiles.annotations" -}}
+{{- $annotations := dict -}}
+{{- with .context.Values.securityProfiles.appArmor -}}
+{{- if and .type (semverCompare "<1.30-0" $.context.Capabilities.KubeVersion.Version) -}}
+  {{- $profile := printf "localhost/%s" .localhostProfile -}}
+  {{- if eq .type "RuntimeDefault" -}}
+    {{- $profile = "runtime/default" -}}
+  {{- else if eq .type "Unconfined" -}}
+    {{- $profile = "unconfined" -}}
+  {{- end -}}
+  {{- range $.containers -}}
+    {{- $_ := set $annotations (printf "container.apparmor.security.beta.kubernetes.io/%s" .) $profile -}}
+  {{- end -}}
+{{- end -}}
+{{- end -}}
+{{- with $annotations -}}
+{{ toYaml . }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the AppArmor profile of securityProfiles.
+*/}}
+{{- define "cockroachdb.securityProfiles.validation" -}}
+{{- with .Values.securityProfiles.appArmor -}}
+{{- if and .type (not (has .type (list "RuntimeDefault" "Localhost" "Unconfined"))) -}}
+  {{ fail (printf "securityProfiles.appArmor.type must be RuntimeDefault, Localhost or Unconfined, not %s" .type) }}
+{{- end -}}
+{{- if ne (eq .type "Localhost") (not (empty .localhostProfile)) -}}
+  {{ fail "securityProfiles.appArmor.localhostProfile must be set if and only if securityProfiles.appArmor.type is Localhost" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{- define "cockroachdb.securityContext.versionValidation" }}
+{{- /* Allow using `securityContext` for custom images. */}}
+{{- if ne "cockroachdb/cockroach" .Values.image.repository -}}
+    {{ print true }}
+{{- else -}}
+{{- if semverCompare ">=22.1.2" .Values.image.tag -}}
+    {{ print true }}
+{{- else -}}
+{{- if semverCompare ">=21.2.13, <22.1.0" .Values.image.tag -}}
+    {{ print true }}
+{{- else -}}
+    {{ print false }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+Validate the log configuration.
+*/}}
+{{- define "cockroachdb.conf.log.validation" -}}
+{{- if and (not .Values.conf.log.enabled) .Values.conf.log.persistentVolume.enabled -}}
+    {{ fail "Persistent volume for logs can only be enabled if logging is enabled" }}
+{{- end -}}
+{{- $logDir := dig "file-defaults" "dir" "" (.Values.conf.log.config | default dict) -}}
+{{- if and .Values.conf.log.persistentVolume.enabled $logDir -}}
+{{- if not (hasPrefix (printf "/cockroach/%s" .Values.conf.log.persistentVolume.path) $logDir) }}
+    {{ fail "Log configuration should use the persistent volume if enabled" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{- define "cockroachdb.storage.hostPath.computation" -}}
+{{- if hasSuffix "/" .Values.storage.hostPath -}}
+    {{- printf "%s-%d/" (dir .Values.storage.hostPath) (add1 .Args.idx) | quote -}}
+{{- else -}}
+    {{- printf "%s-%d" .Values.storage.hostPath (add1 .Args.idx) | quote -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Validate the store count configuration.
 */}}
 {{- define "cockroachdb.conf.store.validation" -}}
   {{- if and (not .Values.conf.store.enabled) (ne (int .Values.conf.store.count) 1) -}}
@@ -328,6 +2217,26 @@ Validate the store count configuration.
 {{/*
 Validate the WAL failover configuration.
 */}}
+{{/*
+Validate the volume of the temporary files of the SQL queries spilling to disk.
+*/}}
+{{- define "cockroachdb.conf.temp-dir.validation" -}}
+{{- with index .Values.conf `temp-dir` -}}
+{{- if and .emptyDir.enabled .persistentVolume.enabled -}}
+  {{ fail "conf.temp-dir.emptyDir.enabled and conf.temp-dir.persistentVolume.enabled are mutually exclusive" }}
+{{- end -}}
+{{- if or .emptyDir.enabled .persistentVolume.enabled -}}
+  {{- $maxDiskTempStorage := index $.Values.conf `max-disk-temp-storage` | default "" | toString -}}
+  {{- if or (not $maxDiskTempStorage) (hasSuffix "%" $maxDiskTempStorage) -}}
+    {{ fail "conf.temp-dir requires conf.max-disk-temp-storage to be set as a size, a percentage is relative to the first store" }}
+  {{- end -}}
+{{- end -}}
+{{- if and .emptyDir.enabled (not .emptyDir.sizeLimit) -}}
+  {{ fail "conf.temp-dir.emptyDir.enabled requires conf.temp-dir.emptyDir.sizeLimit" }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
 {{- define "cockroachdb.conf.wal-failover.validation" -}}
   {{- with index .Values.conf `wal-failover` -}}
     {{- if not (mustHas .value (list "" "disabled" "among-stores")) -}}
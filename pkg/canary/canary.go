@@ -0,0 +1,204 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package canary
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExecFunc runs SQL statements against the cluster and returns their output.
+type ExecFunc func(ctx context.Context, sql string) (string, error)
+
+// DefaultBuckets are the upper bounds in seconds of the buckets of the probe duration histogram.
+var DefaultBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*){0,2}$`)
+
+// Prober continuously executes a trivial read/write transaction against the cluster, as a client would, and records
+// the availability and the latency of the cluster seen from the client side.
+type Prober struct {
+	Exec ExecFunc
+	// Table is the table the probes write to, created by the first probe.
+	Table string
+	// ID identifies the rows written by the prober, so that several probers can share the table.
+	ID      string
+	Timeout time.Duration
+	Buckets []float64
+
+	mu           sync.Mutex
+	tableCreated bool
+	up           bool
+	successes    uint64
+	failures     uint64
+	lastSuccess  time.Time
+	counts       []uint64
+	sum          float64
+}
+
+// ValidateTable returns an error unless the table is a plain, optionally qualified, table name.
+func ValidateTable(table string) error {
+	if !tableName.MatchString(table) {
+		return fmt.Errorf("invalid table %q, expected [database.][schema.]table", table)
+	}
+	return nil
+}
+
+// Statement returns the transaction of a probe, upserting the row of the prober and reading it back.
+func (p *Prober) Statement() string {
+	id := strings.ReplaceAll(p.ID, "'", "''")
+	return fmt.Sprintf("BEGIN;\nUPSERT INTO %s (id, probed_at) VALUES ('%s', now());\nSELECT probed_at FROM %s WHERE id = '%s';\nCOMMIT;\n",
+		p.Table, id, p.Table, id)
+}
+
+// Probe executes the transaction once, creating the table first if needed, and records its outcome. Only the
+// duration of the transaction is recorded.
+func (p *Prober) Probe(ctx context.Context) error {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	p.mu.Lock()
+	tableCreated := p.tableCreated
+	p.mu.Unlock()
+	if !tableCreated {
+		if out, err := p.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id STRING PRIMARY KEY, probed_at TIMESTAMPTZ NOT NULL);\n", p.Table)); err != nil {
+			p.record(false, 0)
+			return fmt.Errorf("failed to create the table %s: %w: %s", p.Table, err, strings.TrimSpace(out))
+		}
+		p.mu.Lock()
+		p.tableCreated = true
+		p.mu.Unlock()
+	}
+
+	start := time.Now()
+	out, err := p.Exec(ctx, p.Statement())
+	duration := time.Since(start)
+	if err != nil {
+		p.record(false, duration)
+		return fmt.Errorf("probe failed after %s: %w: %s", duration, err, strings.TrimSpace(out))
+	}
+
+	p.record(true, duration)
+	return nil
+}
+
+// Run probes the cluster every interval until the context is done, logging the failed probes.
+func (p *Prober) Run(ctx context.Context, interval time.Duration, logf func(format string, args ...interface{})) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Probe(ctx); err != nil && ctx.Err() == nil {
+			logf("%s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Prober) record(success bool, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.up = success
+	if !success {
+		p.failures++
+		return
+	}
+
+	p.successes++
+	p.lastSuccess = time.Now()
+	if p.counts == nil {
+		p.counts = make([]uint64, len(p.buckets()))
+	}
+	seconds := duration.Seconds()
+	for i, bound := range p.buckets() {
+		if seconds <= bound {
+			p.counts[i]++
+		}
+	}
+	p.sum += seconds
+}
+
+func (p *Prober) buckets() []float64 {
+	if p.Buckets != nil {
+		return p.Buckets
+	}
+	return DefaultBuckets
+}
+
+// WriteMetrics writes the metrics of the prober in the Prometheus text exposition format. The duration histogram
+// only counts the successful probes.
+func (p *Prober) WriteMetrics(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	up := 0
+	if p.up {
+		up = 1
+	}
+	fmt.Fprint(&b, "# HELP cockroachdb_canary_up Whether the last probe succeeded.\n# TYPE cockroachdb_canary_up gauge\n")
+	fmt.Fprintf(&b, "cockroachdb_canary_up %d\n", up)
+
+	fmt.Fprint(&b, "# HELP cockroachdb_canary_probes_total Probes executed, by result.\n# TYPE cockroachdb_canary_probes_total counter\n")
+	fmt.Fprintf(&b, "cockroachdb_canary_probes_total{result=\"success\"} %d\n", p.successes)
+	fmt.Fprintf(&b, "cockroachdb_canary_probes_total{result=\"failure\"} %d\n", p.failures)
+
+	fmt.Fprint(&b, "# HELP cockroachdb_canary_last_success_timestamp_seconds Time of the last successful probe.\n# TYPE cockroachdb_canary_last_success_timestamp_seconds gauge\n")
+	lastSuccess := 0.0
+	if !p.lastSuccess.IsZero() {
+		lastSuccess = float64(p.lastSuccess.UnixNano()) / 1e9
+	}
+	fmt.Fprintf(&b, "cockroachdb_canary_last_success_timestamp_seconds %g\n", lastSuccess)
+
+	fmt.Fprint(&b, "# HELP cockroachdb_canary_probe_duration_seconds Duration of the successful probes.\n# TYPE cockroachdb_canary_probe_duration_seconds histogram\n")
+	for i, bound := range p.buckets() {
+		var count uint64
+		if p.counts != nil {
+			count = p.counts[i]
+		}
+		fmt.Fprintf(&b, "cockroachdb_canary_probe_duration_seconds_bucket{le=\"%g\"} %d\n", bound, count)
+	}
+	fmt.Fprintf(&b, "cockroachdb_canary_probe_duration_seconds_bucket{le=\"+Inf\"} %d\n", p.successes)
+	fmt.Fprintf(&b, "cockroachdb_canary_probe_duration_seconds_sum %g\n", p.sum)
+	fmt.Fprintf(&b, "cockroachdb_canary_probe_duration_seconds_count %d\n", p.successes)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the metrics of the prober.
+func (p *Prober) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = p.WriteMetrics(w)
+	})
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package canary_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/canary"
+)
+
+func TestValidateTable(t *testing.T) {
+	require.NoError(t, canary.ValidateTable("helm_canary"))
+	require.NoError(t, canary.ValidateTable("defaultdb.public.helm_canary"))
+	require.Error(t, canary.ValidateTable("defaultdb.helm_canary; DROP TABLE users"))
+	require.Error(t, canary.ValidateTable("a.b.c.d"))
+}
+
+func TestStatement(t *testing.T) {
+	prober := &canary.Prober{Table: "defaultdb.public.helm_canary", ID: "canary-0'"}
+	require.Equal(t, `BEGIN;
+UPSERT INTO defaultdb.public.helm_canary (id, probed_at) VALUES ('canary-0''', now());
+SELECT probed_at FROM defaultdb.public.helm_canary WHERE id = 'canary-0''';
+COMMIT;
+`, prober.Statement())
+}
+
+func TestProbe(t *testing.T) {
+	var executed []string
+	fail := false
+	prober := &canary.Prober{
+		Exec: func(ctx context.Context, sql string) (string, error) {
+			executed = append(executed, sql)
+			if fail {
+				return "ERROR: cannot dial server", errors.New("exit status 1")
+			}
+			return "", nil
+		},
+		Table:   "helm_canary",
+		ID:      "canary-0",
+		Buckets: []float64{0.1, 1000},
+	}
+
+	require.NoError(t, prober.Probe(context.Background()))
+	require.NoError(t, prober.Probe(context.Background()))
+	// The table is only created by the first probe.
+	require.Len(t, executed, 3)
+	require.True(t, strings.HasPrefix(executed[0], "CREATE TABLE IF NOT EXISTS helm_canary "))
+
+	fail = true
+	err := prober.Probe(context.Background())
+	require.ErrorContains(t, err, "ERROR: cannot dial server")
+
+	recorder := httptest.NewRecorder()
+	prober.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	require.Contains(t, body, "cockroachdb_canary_up 0\n")
+	require.Contains(t, body, "cockroachdb_canary_probes_total{result=\"success\"} 2\n")
+	require.Contains(t, body, "cockroachdb_canary_probes_total{result=\"failure\"} 1\n")
+	require.Contains(t, body, "# TYPE cockroachdb_canary_probe_duration_seconds histogram\n")
+	require.Contains(t, body, "cockroachdb_canary_probe_duration_seconds_bucket{le=\"1000\"} 2\n")
+	require.Contains(t, body, "cockroachdb_canary_probe_duration_seconds_bucket{le=\"+Inf\"} 2\n")
+	require.Contains(t, body, "cockroachdb_canary_probe_duration_seconds_count 2\n")
+	require.NotContains(t, body, "cockroachdb_canary_last_success_timestamp_seconds 0\n")
+}
+
+func TestProbeTableCreationFailure(t *testing.T) {
+	prober := &canary.Prober{
+		Exec: func(ctx context.Context, sql string) (string, error) {
+			return "ERROR: user root does not have CREATE privilege", errors.New("exit status 1")
+		},
+		Table: "helm_canary",
+		ID:    "canary-0",
+	}
+
+	err := prober.Probe(context.Background())
+	require.ErrorContains(t, err, "failed to create the table helm_canary")
+
+	recorder := httptest.NewRecorder()
+	prober.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	require.Contains(t, recorder.Body.String(), "cockroachdb_canary_probes_total{result=\"failure\"} 1\n")
+	require.Contains(t, recorder.Body.String(), "cockroachdb_canary_last_success_timestamp_seconds 0\n")
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TLSMode is the way the certificates of the cluster are provisioned.
+type TLSMode string
+
+const (
+	// TLSSelfSigner generates the CA and the certificates with the self-signer utility of the chart.
+	TLSSelfSigner TLSMode = "self-signer"
+	// TLSSelfSignerProvidedCA generates the certificates with the self-signer utility, signed by a user provided CA.
+	TLSSelfSignerProvidedCA TLSMode = "self-signer-provided-ca"
+	// TLSProvided uses user provided node and client certificates.
+	TLSProvided TLSMode = "provided"
+	// TLSCertManager issues the certificates with cert-manager.
+	TLSCertManager TLSMode = "cert-manager"
+	// TLSInsecure runs the cluster without TLS.
+	TLSInsecure TLSMode = "insecure"
+)
+
+// TLS configures the certificates of the cluster.
+type TLS struct {
+	// Mode defaults to TLSSelfSigner.
+	Mode TLSMode
+	// CASecret is the Secret holding the CA certificate and key, for TLSSelfSignerProvidedCA.
+	CASecret string
+	// NodeSecret and ClientRootSecret are the Secrets holding the node and root client certificates, for
+	// TLSProvided.
+	NodeSecret       string
+	ClientRootSecret string
+	// IssuerKind and IssuerName reference the cert-manager issuer, for TLSCertManager.
+	IssuerKind string
+	IssuerName string
+}
+
+// WALFailoverMode is the target the WAL fails over to.
+type WALFailoverMode string
+
+const (
+	// WALFailoverSideDisk fails over to a volume dedicated to WAL failover.
+	WALFailoverSideDisk WALFailoverMode = "side-disk"
+	// WALFailoverAmongStores fails over to another store of the node.
+	WALFailoverAmongStores WALFailoverMode = "among-stores"
+)
+
+// WALFailover configures the WAL failover of the nodes, disabled when Mode is empty.
+type WALFailover struct {
+	Mode WALFailoverMode
+	// SideDiskSize is the size of the side disk volume, for WALFailoverSideDisk.
+	SideDiskSize string
+	// StoreCount is the number of stores per node, at least 2 for WALFailoverAmongStores.
+	StoreCount int
+}
+
+// Options describes a release of the chart.
+type Options struct {
+	ChartPath   string
+	ReleaseName string
+	Namespace   string
+	// KubeContext is the kubeconfig context of the cluster, defaults to the current context.
+	KubeContext string
+
+	// Replicas is the number of CockroachDB nodes, the default of the chart when zero.
+	Replicas int
+	// StorageSize is the size of the data volume of the nodes, the default of the chart when empty.
+	StorageSize string
+	ClusterName string
+	TLS         TLS
+	WALFailover WALFailover
+	// Values are additional chart values, as passed to `helm --set`. They take precedence over the values set
+	// from the typed options.
+	Values map[string]string
+
+	// Timeout of the helm operations, the default of helm when zero.
+	Timeout time.Duration
+	// Helm is the path of the helm binary, defaults to helm.
+	Helm string
+	// Stdout and Stderr receive the output of helm, discarded when nil.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// SetValues returns the chart values of the options.
+func (o Options) SetValues() (map[string]string, error) {
+	values := map[string]string{}
+
+	if o.Replicas > 0 {
+		values["statefulset.replicas"] = strconv.Itoa(o.Replicas)
+	}
+	if o.StorageSize != "" {
+		values["storage.persistentVolume.size"] = o.StorageSize
+	}
+	if o.ClusterName != "" {
+		values["conf.cluster-name"] = o.ClusterName
+	}
+
+	switch o.TLS.Mode {
+	case "", TLSSelfSigner:
+	case TLSSelfSignerProvidedCA:
+		if o.TLS.CASecret == "" {
+			return nil, errors.New("the CA Secret is required with a provided CA")
+		}
+		values["tls.certs.selfSigner.caProvided"] = "true"
+		values["tls.certs.selfSigner.caSecret"] = o.TLS.CASecret
+	case TLSProvided:
+		if o.TLS.NodeSecret == "" || o.TLS.ClientRootSecret == "" {
+			return nil, errors.New("the node and root client Secrets are required with provided certificates")
+		}
+		values["tls.certs.provided"] = "true"
+		values["tls.certs.selfSigner.enabled"] = "false"
+		values["tls.certs.nodeSecret"] = o.TLS.NodeSecret
+		values["tls.certs.clientRootSecret"] = o.TLS.ClientRootSecret
+	case TLSCertManager:
+		if o.TLS.IssuerKind == "" || o.TLS.IssuerName == "" {
+			return nil, errors.New("the issuer kind and name are required with cert-manager")
+		}
+		values["tls.certs.selfSigner.enabled"] = "false"
+		values["tls.certs.certManager"] = "true"
+		values["tls.certs.certManagerIssuer.kind"] = o.TLS.IssuerKind
+		values["tls.certs.certManagerIssuer.name"] = o.TLS.IssuerName
+	case TLSInsecure:
+		values["tls.enabled"] = "false"
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q", o.TLS.Mode)
+	}
+
+	switch o.WALFailover.Mode {
+	case "":
+	case WALFailoverSideDisk:
+		values["conf.wal-failover.value"] = "path=cockroach-failover"
+		values["conf.wal-failover.persistentVolume.enabled"] = "true"
+		if o.WALFailover.SideDiskSize != "" {
+			values["conf.wal-failover.persistentVolume.size"] = o.WALFailover.SideDiskSize
+		}
+	case WALFailoverAmongStores:
+		if o.WALFailover.StoreCount < 2 {
+			return nil, errors.New("WAL failover among stores requires at least 2 stores")
+		}
+		values["conf.wal-failover.value"] = "among-stores"
+		values["conf.store.enabled"] = "true"
+		values["conf.store.count"] = strconv.Itoa(o.WALFailover.StoreCount)
+	default:
+		return nil, fmt.Errorf("unknown WAL failover mode %q", o.WALFailover.Mode)
+	}
+
+	for k, v := range o.Values {
+		values[k] = v
+	}
+
+	return values, nil
+}
+
+// Action is a helm operation on a release.
+type Action string
+
+const (
+	ActionInstall   Action = "install"
+	ActionUpgrade   Action = "upgrade"
+	ActionUninstall Action = "uninstall"
+)
+
+// Command returns the helm command running the action on the release.
+func (o Options) Command(ctx context.Context, action Action) (*exec.Cmd, error) {
+	if o.ReleaseName == "" || o.Namespace == "" {
+		return nil, errors.New("the release name and namespace are required")
+	}
+
+	args := []string{string(action), o.ReleaseName}
+	switch action {
+	case ActionInstall, ActionUpgrade:
+		if o.ChartPath == "" {
+			return nil, errors.New("the chart path is required")
+		}
+		args = append(args, o.ChartPath)
+
+		values, err := o.SetValues()
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, "--set", fmt.Sprintf("%s=%s", k, values[k]))
+		}
+	case ActionUninstall:
+		args = append(args, "--wait")
+	default:
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+
+	args = append(args, "--namespace", o.Namespace)
+	if o.KubeContext != "" {
+		args = append(args, "--kube-context", o.KubeContext)
+	}
+	if o.Timeout > 0 {
+		args = append(args, "--timeout", o.Timeout.String())
+	}
+
+	helm := o.Helm
+	if helm == "" {
+		helm = "helm"
+	}
+	cmd := exec.CommandContext(ctx, helm, args...)
+	cmd.Stdout = o.Stdout
+	cmd.Stderr = o.Stderr
+
+	return cmd, nil
+}
+
+// Install installs the release.
+func Install(ctx context.Context, o Options) error {
+	return run(ctx, o, ActionInstall)
+}
+
+// Upgrade upgrades the release with the options.
+func Upgrade(ctx context.Context, o Options) error {
+	return run(ctx, o, ActionUpgrade)
+}
+
+// Uninstall uninstalls the release and waits for its resources to be deleted.
+func Uninstall(ctx context.Context, o Options) error {
+	return run(ctx, o, ActionUninstall)
+}
+
+func run(ctx context.Context, o Options, action Action) error {
+	cmd, err := o.Command(ctx, action)
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to %s release %s: %w", action, o.ReleaseName, err)
+	}
+
+	return nil
+}
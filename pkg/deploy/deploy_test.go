@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/deploy"
+)
+
+func TestSetValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		options deploy.Options
+		values  map[string]string
+		err     string
+	}{
+		{
+			name:    "defaults",
+			options: deploy.Options{},
+			values:  map[string]string{},
+		},
+		{
+			name: "self-signer with a provided CA",
+			options: deploy.Options{
+				Replicas:    3,
+				StorageSize: "1Gi",
+				TLS:         deploy.TLS{Mode: deploy.TLSSelfSignerProvidedCA, CASecret: "custom-ca-secret"},
+			},
+			values: map[string]string{
+				"statefulset.replicas":            "3",
+				"storage.persistentVolume.size":   "1Gi",
+				"tls.certs.selfSigner.caProvided": "true",
+				"tls.certs.selfSigner.caSecret":   "custom-ca-secret",
+			},
+		},
+		{
+			name:    "self-signer with a provided CA without a Secret",
+			options: deploy.Options{TLS: deploy.TLS{Mode: deploy.TLSSelfSignerProvidedCA}},
+			err:     "the CA Secret is required with a provided CA",
+		},
+		{
+			name: "provided certificates",
+			options: deploy.Options{
+				TLS: deploy.TLS{Mode: deploy.TLSProvided, NodeSecret: "node", ClientRootSecret: "root"},
+			},
+			values: map[string]string{
+				"tls.certs.provided":           "true",
+				"tls.certs.selfSigner.enabled": "false",
+				"tls.certs.nodeSecret":         "node",
+				"tls.certs.clientRootSecret":   "root",
+			},
+		},
+		{
+			name: "cert-manager",
+			options: deploy.Options{
+				TLS: deploy.TLS{Mode: deploy.TLSCertManager, IssuerKind: "Issuer", IssuerName: "cockroachdb"},
+			},
+			values: map[string]string{
+				"tls.certs.selfSigner.enabled":     "false",
+				"tls.certs.certManager":            "true",
+				"tls.certs.certManagerIssuer.kind": "Issuer",
+				"tls.certs.certManagerIssuer.name": "cockroachdb",
+			},
+		},
+		{
+			name:    "insecure",
+			options: deploy.Options{TLS: deploy.TLS{Mode: deploy.TLSInsecure}},
+			values:  map[string]string{"tls.enabled": "false"},
+		},
+		{
+			name:    "unknown TLS mode",
+			options: deploy.Options{TLS: deploy.TLS{Mode: "vault"}},
+			err:     `unknown TLS mode "vault"`,
+		},
+		{
+			name: "WAL failover to a side disk",
+			options: deploy.Options{
+				WALFailover: deploy.WALFailover{Mode: deploy.WALFailoverSideDisk, SideDiskSize: "1Gi"},
+			},
+			values: map[string]string{
+				"conf.wal-failover.value":                    "path=cockroach-failover",
+				"conf.wal-failover.persistentVolume.enabled": "true",
+				"conf.wal-failover.persistentVolume.size":    "1Gi",
+			},
+		},
+		{
+			name: "WAL failover among stores",
+			options: deploy.Options{
+				WALFailover: deploy.WALFailover{Mode: deploy.WALFailoverAmongStores, StoreCount: 2},
+			},
+			values: map[string]string{
+				"conf.wal-failover.value": "among-stores",
+				"conf.store.enabled":      "true",
+				"conf.store.count":        "2",
+			},
+		},
+		{
+			name:    "WAL failover among a single store",
+			options: deploy.Options{WALFailover: deploy.WALFailover{Mode: deploy.WALFailoverAmongStores, StoreCount: 1}},
+			err:     "WAL failover among stores requires at least 2 stores",
+		},
+		{
+			name: "additional values take precedence",
+			options: deploy.Options{
+				Replicas: 3,
+				Values:   map[string]string{"statefulset.replicas": "5", "conf.cache": "10%"},
+			},
+			values: map[string]string{
+				"statefulset.replicas": "5",
+				"conf.cache":           "10%",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := tt.options.SetValues()
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.values, values)
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	options := deploy.Options{
+		ChartPath:   "./cockroachdb",
+		ReleaseName: "crdb",
+		Namespace:   "db",
+		KubeContext: "k3d-test",
+		ClusterName: "test",
+		TLS:         deploy.TLS{Mode: deploy.TLSInsecure},
+		Timeout:     10 * time.Minute,
+		Helm:        "/usr/local/bin/helm",
+	}
+
+	cmd, err := options.Command(context.Background(), deploy.ActionInstall)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/usr/local/bin/helm", "install", "crdb", "./cockroachdb",
+		"--set", "conf.cluster-name=test",
+		"--set", "tls.enabled=false",
+		"--namespace", "db", "--kube-context", "k3d-test", "--timeout", "10m0s",
+	}, cmd.Args)
+
+	cmd, err = options.Command(context.Background(), deploy.ActionUninstall)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/usr/local/bin/helm", "uninstall", "crdb", "--wait",
+		"--namespace", "db", "--kube-context", "k3d-test", "--timeout", "10m0s",
+	}, cmd.Args)
+
+	options.Namespace = ""
+	_, err = options.Command(context.Background(), deploy.ActionUpgrade)
+	require.EqualError(t, err, "the release name and namespace are required")
+}
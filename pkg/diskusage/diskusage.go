@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskusage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Usage is the usage of the filesystem of a volume.
+type Usage struct {
+	Volume         string
+	CapacityBytes  uint64
+	AvailableBytes uint64
+	UsedBytes      uint64
+	Inodes         uint64
+	InodesFree     uint64
+}
+
+// Stat returns the usage of the filesystem mounted at path.
+func Stat(volume, path string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Usage{}, fmt.Errorf("failed to stat volume %s at %s: %w", volume, path, err)
+	}
+
+	blockSize := uint64(st.Bsize)
+	return Usage{
+		Volume:         volume,
+		CapacityBytes:  st.Blocks * blockSize,
+		AvailableBytes: st.Bavail * blockSize,
+		UsedBytes:      (st.Blocks - st.Bfree) * blockSize,
+		Inodes:         st.Files,
+		InodesFree:     st.Ffree,
+	}, nil
+}
+
+type metric struct {
+	name  string
+	help  string
+	value func(Usage) uint64
+}
+
+var metrics = []metric{
+	{"cockroachdb_volume_capacity_bytes", "Capacity of the volume in bytes.", func(u Usage) uint64 { return u.CapacityBytes }},
+	{"cockroachdb_volume_available_bytes", "Bytes of the volume available to the CockroachDB process.", func(u Usage) uint64 { return u.AvailableBytes }},
+	{"cockroachdb_volume_used_bytes", "Bytes used on the volume.", func(u Usage) uint64 { return u.UsedBytes }},
+	{"cockroachdb_volume_inodes", "Inodes of the volume.", func(u Usage) uint64 { return u.Inodes }},
+	{"cockroachdb_volume_inodes_free", "Free inodes of the volume.", func(u Usage) uint64 { return u.InodesFree }},
+}
+
+// WriteMetrics writes the usages in the Prometheus text exposition format.
+func WriteMetrics(w io.Writer, usages []Usage) error {
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, u := range usages {
+			fmt.Fprintf(&b, "%s{volume=%q} %d\n", m.name, u.Volume, m.value(u))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the usage of the given volumes, keyed by name, on every request. Volumes that can't be read are
+// reported by the cockroachdb_volume_up metric rather than failing the whole scrape.
+func Handler(volumes map[string]string) http.Handler {
+	names := make([]string, 0, len(volumes))
+	for name := range volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var usages []Usage
+		up := map[string]bool{}
+		for _, name := range names {
+			usage, err := Stat(name, volumes[name])
+			up[name] = err == nil
+			if err == nil {
+				usages = append(usages, usage)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, "# HELP cockroachdb_volume_up Whether the usage of the volume could be read.\n# TYPE cockroachdb_volume_up gauge\n")
+		for _, name := range names {
+			value := 0
+			if up[name] {
+				value = 1
+			}
+			fmt.Fprintf(w, "cockroachdb_volume_up{volume=%q} %d\n", name, value)
+		}
+		_ = WriteMetrics(w, usages)
+	})
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskusage_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/diskusage"
+)
+
+func TestStat(t *testing.T) {
+	usage, err := diskusage.Stat("tmp", t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, "tmp", usage.Volume)
+	require.NotZero(t, usage.CapacityBytes)
+	require.LessOrEqual(t, usage.UsedBytes, usage.CapacityBytes)
+
+	_, err = diskusage.Stat("missing", "/does/not/exist")
+	require.Error(t, err)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, diskusage.WriteMetrics(&b, []diskusage.Usage{
+		{Volume: "logsdir", CapacityBytes: 100, AvailableBytes: 40, UsedBytes: 60, Inodes: 10, InodesFree: 5},
+	}))
+
+	require.Contains(t, b.String(), "# TYPE cockroachdb_volume_capacity_bytes gauge\n")
+	require.Contains(t, b.String(), "cockroachdb_volume_capacity_bytes{volume=\"logsdir\"} 100\n")
+	require.Contains(t, b.String(), "cockroachdb_volume_used_bytes{volume=\"logsdir\"} 60\n")
+	require.Contains(t, b.String(), "cockroachdb_volume_inodes_free{volume=\"logsdir\"} 5\n")
+}
+
+func TestHandler(t *testing.T) {
+	handler := diskusage.Handler(map[string]string{"logsdir": t.TempDir(), "failoverdir": "/does/not/exist"})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	require.Contains(t, body, "cockroachdb_volume_up{volume=\"failoverdir\"} 0\n")
+	require.Contains(t, body, "cockroachdb_volume_up{volume=\"logsdir\"} 1\n")
+	require.Contains(t, body, "cockroachdb_volume_capacity_bytes{volume=\"logsdir\"}")
+	require.NotContains(t, body, "cockroachdb_volume_capacity_bytes{volume=\"failoverdir\"}")
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/verify"
+)
+
+// Release is the part of a Helm release, as stored by the Secret storage driver of Helm, the drift is detected from.
+type Release struct {
+	Name     string `json:"name"`
+	Version  int    `json:"version"`
+	Manifest string `json:"manifest"`
+}
+
+// Drift is the set of fields of a release object whose live value differs from the one of the release manifest.
+type Drift struct {
+	Object string
+	Fields []string
+}
+
+// DecodeRelease decodes the `release` key of a Helm release Secret: a base64 encoded, gzipped JSON document.
+func DecodeRelease(data []byte) (*Release, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the release: %w", err)
+	}
+
+	// Helm only compresses the releases since v3.1, the older ones being plain JSON.
+	if bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress the release: %w", err)
+		}
+		defer r.Close()
+
+		if raw, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("failed to decompress the release: %w", err)
+		}
+	}
+
+	var release Release
+	if err := json.Unmarshal(raw, &release); err != nil {
+		return nil, fmt.Errorf("failed to parse the release: %w", err)
+	}
+	return &release, nil
+}
+
+// DeployedRelease returns the deployed revision of a Helm release from its Secrets in the namespace.
+func DeployedRelease(ctx context.Context, cl client.Client, namespace, name string) (*Release, error) {
+	var secrets corev1.SecretList
+	if err := cl.List(ctx, &secrets, client.InNamespace(namespace),
+		client.MatchingLabels{"owner": "helm", "name": name, "status": "deployed"}); err != nil {
+		return nil, fmt.Errorf("failed to list the Secrets of release %s: %w", name, err)
+	}
+
+	var latest *corev1.Secret
+	latestVersion := 0
+	for i := range secrets.Items {
+		version, err := strconv.Atoi(secrets.Items[i].Labels["version"])
+		if err != nil {
+			continue
+		}
+		if version > latestVersion {
+			latest, latestVersion = &secrets.Items[i], version
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("release %s has no deployed revision in namespace %s", name, namespace)
+	}
+
+	return DecodeRelease(latest.Data["release"])
+}
+
+// Detect compares the objects of the release manifest of the given kinds with their live state, and returns the
+// drift of every object which was edited out of band or deleted.
+func Detect(ctx context.Context, cl client.Client, namespace, manifest string, kinds []string) ([]Drift, error) {
+	objs, err := verify.ParseManifests(strings.NewReader(manifest))
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, desired := range objs {
+		if !contains(kinds, desired.GetKind()) {
+			continue
+		}
+		if desired.GetNamespace() == "" {
+			desired.SetNamespace(namespace)
+		}
+		name := fmt.Sprintf("%s/%s", desired.GetKind(), desired.GetName())
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(desired.GroupVersionKind())
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+			if apierrors.IsNotFound(err) {
+				drifts = append(drifts, Drift{Object: name, Fields: []string{"<deleted>"}})
+				continue
+			}
+			return nil, fmt.Errorf("failed to get %s: %w", name, err)
+		}
+
+		if fields := Diff(desired.Object, live.Object); len(fields) > 0 {
+			drifts = append(drifts, Drift{Object: name, Fields: fields})
+		}
+	}
+
+	return drifts, nil
+}
+
+// Diff returns the paths of the fields set in desired whose value differs in live. The fields only set in live, such
+// as the defaulted ones and the status, are ignored, while the lists must have the same length.
+func Diff(desired, live interface{}) []string {
+	var fields []string
+	diff("", desired, live, &fields)
+	sort.Strings(fields)
+	return fields
+}
+
+func diff(path string, desired, live interface{}, fields *[]string) {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			*fields = append(*fields, path)
+			return
+		}
+		for key, value := range d {
+			diff(path+"."+key, value, l[key], fields)
+		}
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			*fields = append(*fields, path)
+			return
+		}
+		for i := range d {
+			diff(fmt.Sprintf("%s[%d]", path, i), d[i], l[i], fields)
+		}
+	default:
+		if !equalValues(desired, live) {
+			*fields = append(*fields, path)
+		}
+	}
+}
+
+// equalValues compares scalar values, the quantities being compared by value as the kube-apiserver stores them in
+// their canonical form, e.g. `0.5` as `500m`.
+func equalValues(desired, live interface{}) bool {
+	if desired == nil {
+		return live == nil || reflect.ValueOf(live).IsZero()
+	}
+	if reflect.DeepEqual(desired, live) {
+		return true
+	}
+	if fmt.Sprint(desired) == fmt.Sprint(live) {
+		return true
+	}
+
+	d, err := resource.ParseQuantity(fmt.Sprint(desired))
+	if err != nil {
+		return false
+	}
+	l, err := resource.ParseQuantity(fmt.Sprint(live))
+	if err != nil {
+		return false
+	}
+	return d.Cmp(l) == 0
+}
+
+// PushMetrics pushes the drift metrics of a release to a Prometheus Pushgateway.
+func PushMetrics(ctx context.Context, httpClient *http.Client, pushgatewayURL, namespace, release string, drifts []Drift) error {
+	fields := 0
+	for _, d := range drifts {
+		fields += len(d.Fields)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintln(&body, "# TYPE cockroachdb_release_drifted_objects gauge")
+	fmt.Fprintf(&body, "cockroachdb_release_drifted_objects %d\n", len(drifts))
+	fmt.Fprintln(&body, "# TYPE cockroachdb_release_drifted_fields gauge")
+	fmt.Fprintf(&body, "cockroachdb_release_drifted_fields %d\n", fields)
+
+	url := fmt.Sprintf("%s/metrics/job/cockroachdb-drift/namespace/%s/release/%s", strings.TrimSuffix(pushgatewayURL, "/"), namespace, release)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push the drift metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to push the drift metrics: %s", resp.Status)
+	}
+	return nil
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
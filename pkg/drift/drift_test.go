@@ -0,0 +1,218 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cockroachdb/helm-charts/pkg/drift"
+)
+
+const manifest = `---
+# Source: cockroachdb/templates/serviceaccount.yaml
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: crdb-cockroachdb
+---
+# Source: cockroachdb/templates/statefulset.yaml
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: crdb-cockroachdb
+  labels:
+    app.kubernetes.io/name: cockroachdb
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: db
+          image: cockroachdb/cockroach:v24.3.3
+          resources:
+            requests:
+              cpu: "0.5"
+              memory: 1Gi
+`
+
+func encodeRelease(t *testing.T, release drift.Release) []byte {
+	raw, err := json.Marshal(release)
+	require.NoError(t, err)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err = w.Write(raw)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return []byte(base64.StdEncoding.EncodeToString(gz.Bytes()))
+}
+
+func liveStatefulSet(replicas int32, image string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "crdb-cockroachdb",
+			Namespace: "db",
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "cockroachdb",
+				"app.kubernetes.io/managed-by": "Helm",
+			},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: pointer.Int32(replicas),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            "db",
+						Image:           image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("500m"),
+								corev1.ResourceMemory: resource.MustParse("1Gi"),
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func TestDecodeRelease(t *testing.T) {
+	release, err := drift.DecodeRelease(encodeRelease(t, drift.Release{Name: "crdb", Version: 2, Manifest: manifest}))
+	require.NoError(t, err)
+	require.Equal(t, "crdb", release.Name)
+	require.Equal(t, 2, release.Version)
+	require.Equal(t, manifest, release.Manifest)
+
+	// Releases stored by Helm before v3.1 aren't compressed.
+	plain := base64.StdEncoding.EncodeToString([]byte(`{"name": "crdb", "version": 1}`))
+	release, err = drift.DecodeRelease([]byte(plain))
+	require.NoError(t, err)
+	require.Equal(t, 1, release.Version)
+
+	_, err = drift.DecodeRelease([]byte("not base64!"))
+	require.Error(t, err)
+}
+
+func TestDeployedRelease(t *testing.T) {
+	secret := func(version string, release []byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sh.helm.release.v1.crdb.v" + version,
+				Namespace: "db",
+				Labels:    map[string]string{"owner": "helm", "name": "crdb", "status": "deployed", "version": version},
+			},
+			Data: map[string][]byte{"release": release},
+		}
+	}
+
+	cl := fake.NewClientBuilder().WithObjects(
+		secret("2", encodeRelease(t, drift.Release{Name: "crdb", Version: 2})),
+		secret("10", encodeRelease(t, drift.Release{Name: "crdb", Version: 10})),
+	).Build()
+
+	release, err := drift.DeployedRelease(context.Background(), cl, "db", "crdb")
+	require.NoError(t, err)
+	require.Equal(t, 10, release.Version)
+
+	_, err = drift.DeployedRelease(context.Background(), cl, "db", "other")
+	require.EqualError(t, err, "release other has no deployed revision in namespace db")
+}
+
+func TestDiff(t *testing.T) {
+	desired := map[string]interface{}{
+		"replicas": int64(3),
+		"args":     []interface{}{"start", "--cache=25%"},
+		"cpu":      "0.5",
+		"labels":   map[string]interface{}{"app": "crdb"},
+	}
+
+	require.Empty(t, drift.Diff(desired, map[string]interface{}{
+		"replicas": float64(3),
+		"args":     []interface{}{"start", "--cache=25%"},
+		"cpu":      "500m",
+		"labels":   map[string]interface{}{"app": "crdb", "extra": "ignored"},
+		"status":   map[string]interface{}{"ready": true},
+	}))
+
+	require.Equal(t, []string{".args", ".cpu", ".labels", ".replicas"}, drift.Diff(desired, map[string]interface{}{
+		"replicas": int64(5),
+		"args":     []interface{}{"start", "--cache=25%", "--max-offset=1s"},
+		"cpu":      "1",
+	}))
+}
+
+func TestDetect(t *testing.T) {
+	ctx := context.Background()
+
+	cl := fake.NewClientBuilder().WithObjects(liveStatefulSet(3, "cockroachdb/cockroach:v24.3.3")).Build()
+	drifts, err := drift.Detect(ctx, cl, "db", manifest, []string{"StatefulSet"})
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+
+	cl = fake.NewClientBuilder().WithObjects(liveStatefulSet(5, "cockroachdb/cockroach:v24.3.4")).Build()
+	drifts, err = drift.Detect(ctx, cl, "db", manifest, []string{"StatefulSet"})
+	require.NoError(t, err)
+	require.Equal(t, []drift.Drift{{
+		Object: "StatefulSet/crdb-cockroachdb",
+		Fields: []string{".spec.replicas", ".spec.template.spec.containers[0].image"},
+	}}, drifts)
+
+	cl = fake.NewClientBuilder().Build()
+	drifts, err = drift.Detect(ctx, cl, "db", manifest, []string{"StatefulSet", "ServiceAccount"})
+	require.NoError(t, err)
+	require.Equal(t, []drift.Drift{
+		{Object: "ServiceAccount/crdb-cockroachdb", Fields: []string{"<deleted>"}},
+		{Object: "StatefulSet/crdb-cockroachdb", Fields: []string{"<deleted>"}},
+	}, drifts)
+}
+
+func TestPushMetrics(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		path, body = r.URL.Path, string(raw)
+	}))
+	defer server.Close()
+
+	drifts := []drift.Drift{{Object: "StatefulSet/crdb-cockroachdb", Fields: []string{".spec.replicas", ".spec.template"}}}
+	require.NoError(t, drift.PushMetrics(context.Background(), server.Client(), server.URL+"/", "db", "crdb", drifts))
+
+	require.Equal(t, "/metrics/job/cockroachdb-drift/namespace/db/release/crdb", path)
+	require.Contains(t, body, "cockroachdb_release_drifted_objects 1\n")
+	require.Contains(t, body, "cockroachdb_release_drifted_fields 2\n")
+}
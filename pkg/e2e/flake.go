@@ -0,0 +1,45 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import "strings"
+
+// infraFlakePatterns are error messages caused by the test infrastructure (cluster API, image registry, network)
+// rather than by the chart under test.
+var infraFlakePatterns = []string{
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"etcdserver: request timed out",
+	"the server is currently unable to handle the request",
+	"ErrImagePull",
+	"ImagePullBackOff",
+	"no such host",
+}
+
+// IsInfraFlake returns whether the output of a failed test run shows an infrastructure failure, in which case the
+// run is worth retrying.
+func IsInfraFlake(output string) bool {
+	for _, pattern := range infraFlakePatterns {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import "fmt"
+
+// IPFamilyEnv is the environment variable the IP family of the cluster the suites are run against is passed in.
+const IPFamilyEnv = "E2E_IP_FAMILY"
+
+// IPFamily is the IP family of the Pods and Services of the cluster the e2e suites are run against.
+type IPFamily string
+
+const (
+	IPv4      IPFamily = "ipv4"
+	IPv6      IPFamily = "ipv6"
+	DualStack IPFamily = "dual"
+)
+
+// ParseIPFamily parses an IP family, IPv4 when empty.
+func ParseIPFamily(s string) (IPFamily, error) {
+	switch f := IPFamily(s); f {
+	case "":
+		return IPv4, nil
+	case IPv4, IPv6, DualStack:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown IP family %q, expected ipv4, ipv6 or dual", s)
+	}
+}
+
+// ServiceIPFamilies returns the IP families of the ClusterIPs of the Services of a cluster of the family, the primary
+// one first.
+func (f IPFamily) ServiceIPFamilies() []string {
+	switch f {
+	case IPv6:
+		return []string{"IPv6"}
+	case DualStack:
+		return []string{"IPv4", "IPv6"}
+	default:
+		return []string{"IPv4"}
+	}
+}
+
+// DockerNetworkArgs returns the arguments of `docker network create` creating the network of the nodes of a k3d
+// cluster of the family, nil for IPv4, whose network is created by k3d. The IPv6-only network requires Docker 27 or
+// later.
+func (f IPFamily) DockerNetworkArgs(network string) []string {
+	switch f {
+	case IPv6:
+		return []string{"network", "create", "--ipv4=false", "--ipv6", "--subnet=fd00:e2e:6::/64", network}
+	case DualStack:
+		return []string{"network", "create", "--ipv6", "--subnet=fd00:e2e:d::/64", network}
+	default:
+		return nil
+	}
+}
+
+// K3dArgs returns the additional arguments of `k3d cluster create` for a cluster of the family, attached to the
+// network created with DockerNetworkArgs.
+func (f IPFamily) K3dArgs(network string) []string {
+	var clusterCIDR, serviceCIDR string
+	switch f {
+	case IPv6:
+		clusterCIDR, serviceCIDR = "fd00:42::/56", "fd00:43::/112"
+	case DualStack:
+		clusterCIDR, serviceCIDR = "10.42.0.0/16,fd00:42::/56", "10.43.0.0/16,fd00:43::/112"
+	default:
+		return nil
+	}
+
+	return []string{
+		"--network", network,
+		"--k3s-arg", fmt.Sprintf("--cluster-cidr=%s@server:*", clusterCIDR),
+		"--k3s-arg", fmt.Sprintf("--service-cidr=%s@server:*", serviceCIDR),
+		"--k3s-arg", "--flannel-ipv6-masq@server:*",
+	}
+}
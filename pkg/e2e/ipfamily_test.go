@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/e2e"
+)
+
+func TestParseIPFamily(t *testing.T) {
+	for s, family := range map[string]e2e.IPFamily{"": e2e.IPv4, "ipv4": e2e.IPv4, "ipv6": e2e.IPv6, "dual": e2e.DualStack} {
+		f, err := e2e.ParseIPFamily(s)
+		require.NoError(t, err)
+		require.Equal(t, family, f, s)
+	}
+
+	_, err := e2e.ParseIPFamily("IPv6")
+	require.Error(t, err)
+}
+
+func TestIPFamilyClusterArgs(t *testing.T) {
+	require.Nil(t, e2e.IPv4.DockerNetworkArgs("e2e"))
+	require.Nil(t, e2e.IPv4.K3dArgs("e2e"))
+
+	require.Equal(t, []string{"network", "create", "--ipv4=false", "--ipv6", "--subnet=fd00:e2e:6::/64", "e2e"},
+		e2e.IPv6.DockerNetworkArgs("e2e"))
+	require.Equal(t, []string{
+		"--network", "e2e",
+		"--k3s-arg", "--cluster-cidr=10.42.0.0/16,fd00:42::/56@server:*",
+		"--k3s-arg", "--service-cidr=10.43.0.0/16,fd00:43::/112@server:*",
+		"--k3s-arg", "--flannel-ipv6-masq@server:*",
+	}, e2e.DualStack.K3dArgs("e2e"))
+
+	require.Equal(t, []string{"IPv6"}, e2e.IPv6.ServiceIPFamilies())
+	require.Equal(t, []string{"IPv4", "IPv6"}, e2e.DualStack.ServiceIPFamilies())
+}
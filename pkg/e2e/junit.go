@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// TestEvent is an event emitted by `go test -json`.
+type TestEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// JUnitTestSuites is the root element of a JUnit report.
+type JUnitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite holds the results of the tests of a suite.
+type JUnitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitTestCase holds the result of a single test.
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+}
+
+// JUnitFailure holds the output of a failed test.
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// JUnitSkipped marks a skipped test.
+type JUnitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// ParseTestEvents reads the events written by `go test -json`. Lines which aren't events, such as build errors, are
+// ignored.
+func ParseTestEvents(r io.Reader) ([]TestEvent, error) {
+	var events []TestEvent
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var event TestEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+// NewJUnitTestSuite builds the JUnit test suite of the given name from the events of its tests.
+func NewJUnitTestSuite(name string, events []TestEvent) JUnitTestSuite {
+	suite := JUnitTestSuite{Name: name}
+
+	output := map[string]*strings.Builder{}
+	var elapsed float64
+	for _, event := range events {
+		if event.Test == "" {
+			if event.Action == "pass" || event.Action == "fail" {
+				elapsed += event.Elapsed
+			}
+			continue
+		}
+
+		if _, ok := output[event.Test]; !ok {
+			output[event.Test] = &strings.Builder{}
+		}
+
+		switch event.Action {
+		case "output":
+			output[event.Test].WriteString(event.Output)
+		case "pass", "fail", "skip":
+			testCase := JUnitTestCase{
+				Name:      event.Test,
+				ClassName: event.Package,
+				Time:      formatSeconds(event.Elapsed),
+			}
+
+			if event.Action == "fail" {
+				testCase.Failure = &JUnitFailure{Message: "Failed", Output: output[event.Test].String()}
+				suite.Failures++
+			} else if event.Action == "skip" {
+				testCase.Skipped = &JUnitSkipped{Message: strings.TrimSpace(output[event.Test].String())}
+				suite.Skipped++
+			}
+
+			suite.TestCases = append(suite.TestCases, testCase)
+			suite.Tests++
+		}
+	}
+	suite.Time = formatSeconds(elapsed)
+
+	return suite
+}
+
+// WriteJUnit writes the JUnit report of the given suites.
+func WriteJUnit(w io.Writer, suites []JUnitTestSuite) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(JUnitTestSuites{Suites: suites}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
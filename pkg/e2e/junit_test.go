@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/e2e"
+)
+
+const testOutput = `# github.com/cockroachdb/helm-charts/tests/e2e/install
+{"Action":"run","Package":"install","Test":"TestInstall"}
+{"Action":"output","Package":"install","Test":"TestInstall","Output":"installing\n"}
+{"Action":"pass","Package":"install","Test":"TestInstall","Elapsed":12.5}
+{"Action":"run","Package":"install","Test":"TestUpgrade"}
+{"Action":"output","Package":"install","Test":"TestUpgrade","Output":"upgrade failed\n"}
+{"Action":"fail","Package":"install","Test":"TestUpgrade","Elapsed":3}
+{"Action":"run","Package":"install","Test":"TestSkipped"}
+{"Action":"output","Package":"install","Test":"TestSkipped","Output":"not supported\n"}
+{"Action":"skip","Package":"install","Test":"TestSkipped","Elapsed":0}
+{"Action":"fail","Package":"install","Elapsed":15.5}
+`
+
+func TestNewJUnitTestSuite(t *testing.T) {
+	events, err := e2e.ParseTestEvents(strings.NewReader(testOutput))
+	require.NoError(t, err)
+	require.Len(t, events, 10)
+
+	suite := e2e.NewJUnitTestSuite("install", events)
+
+	require.Equal(t, "install", suite.Name)
+	require.Equal(t, 3, suite.Tests)
+	require.Equal(t, 1, suite.Failures)
+	require.Equal(t, 1, suite.Skipped)
+	require.Equal(t, "15.500", suite.Time)
+
+	require.Equal(t, e2e.JUnitTestCase{Name: "TestInstall", ClassName: "install", Time: "12.500"}, suite.TestCases[0])
+	require.Equal(t, &e2e.JUnitFailure{Message: "Failed", Output: "upgrade failed\n"}, suite.TestCases[1].Failure)
+	require.Equal(t, &e2e.JUnitSkipped{Message: "not supported"}, suite.TestCases[2].Skipped)
+
+	var report bytes.Buffer
+	require.NoError(t, e2e.WriteJUnit(&report, []e2e.JUnitTestSuite{suite}))
+	require.Contains(t, report.String(), `<testsuite name="install" tests="3" failures="1" skipped="1" time="15.500">`)
+	require.Contains(t, report.String(), `<failure message="Failed">upgrade failed&#xA;</failure>`)
+}
+
+func TestIsInfraFlake(t *testing.T) {
+	require.True(t, e2e.IsInfraFlake("dial tcp 10.0.0.1:6443: connect: connection refused"))
+	require.True(t, e2e.IsInfraFlake(`pod "crdb-0" is waiting: ImagePullBackOff`))
+	require.False(t, e2e.IsInfraFlake("expected 3 nodes, got 2"))
+}
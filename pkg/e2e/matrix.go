@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// KubernetesVersion is a Kubernetes minor version of the support matrix of the chart, with the k3s image the e2e
+// suites are run against for it.
+type KubernetesVersion struct {
+	Minor    string
+	K3sImage string
+}
+
+// SupportMatrix lists the minimum and the maximum Kubernetes versions supported by the chart, in this order. Both are
+// covered by the e2e suites run with `e2e-runner --matrix`.
+var SupportMatrix = []KubernetesVersion{
+	{Minor: "1.24", K3sImage: "rancher/k3s:v1.24.17-k3s1"},
+	{Minor: "1.31", K3sImage: "rancher/k3s:v1.31.1-k3s1"},
+}
+
+// IsSupportedVersion returns whether a Kubernetes server version, as reported by the version endpoint of the
+// kube-apiserver (e.g. v1.27.3+k3s1), is within the support matrix.
+func IsSupportedVersion(gitVersion string) (bool, error) {
+	v, err := semver.NewVersion(gitVersion)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse Kubernetes version %s: %w", gitVersion, err)
+	}
+
+	minimum, err := semver.NewVersion(SupportMatrix[0].Minor)
+	if err != nil {
+		return false, err
+	}
+	maximum, err := semver.NewVersion(SupportMatrix[len(SupportMatrix)-1].Minor)
+	if err != nil {
+		return false, err
+	}
+
+	// Only the minor version matters: patches, prereleases and build metadata of the server versions are irrelevant
+	// to the support matrix.
+	minor := semver.New(v.Major(), v.Minor(), 0, "", "")
+
+	return !minor.LessThan(minimum) && !minor.GreaterThan(maximum), nil
+}
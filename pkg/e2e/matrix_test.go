@@ -0,0 +1,48 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/e2e"
+)
+
+func TestIsSupportedVersion(t *testing.T) {
+	testCases := []struct {
+		version   string
+		supported bool
+	}{
+		{"v1.23.17+k3s1", false},
+		{"v1.24.0", true},
+		{"v1.24.17+k3s1", true},
+		{"v1.28.3-gke.1286000", true},
+		{"v1.31.1+k3s1", true},
+		{"v1.32.0", false},
+	}
+
+	for _, testCase := range testCases {
+		supported, err := e2e.IsSupportedVersion(testCase.version)
+		require.NoError(t, err)
+		require.Equal(t, testCase.supported, supported, testCase.version)
+	}
+
+	_, err := e2e.IsSupportedVersion("latest")
+	require.Error(t, err)
+}
@@ -29,9 +29,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/cockroachdb/helm-charts/pkg/kube"
+	"github.com/cockroachdb/helm-charts/pkg/notification"
 	"github.com/cockroachdb/helm-charts/pkg/resource"
 	"github.com/cockroachdb/helm-charts/pkg/security"
 	util "github.com/cockroachdb/helm-charts/pkg/utils"
+	"github.com/cockroachdb/helm-charts/pkg/vault"
 )
 
 const defaultKeySize = 2048
@@ -55,9 +57,11 @@ type GenerateCert struct {
 	CertsDir                  string
 	CaSecret                  string
 	CAKey                     string
+	ClientCAKey               string
 	CaCertConfig              *certConfig
 	RotateCACert              bool
 	CACronSchedule            string
+	CAOverlapWindow           time.Duration
 	NodeCertConfig            *certConfig
 	RotateNodeCert            bool
 	ClientCertConfig          *certConfig
@@ -68,6 +72,27 @@ type GenerateCert struct {
 	ClusterDomain             string
 	ReadinessWait             time.Duration
 	PodUpdateTimeout          time.Duration
+	// StartOrdinal is the ordinal of the first pod of the StatefulSet, restarted first by the rolling updates.
+	StartOrdinal int32
+	// FollowerReadsServiceName, when set, is the name of the follower reads Service added to the node certificates.
+	FollowerReadsServiceName string
+	// SplitCA, when set, signs the client certificates with a separate client CA instead of the CA signing the
+	// node certificates. The nodes are also given a client certificate of the node user signed by the client CA.
+	SplitCA bool
+	// Vault, when set, stores the generated CA in Vault instead of a Kubernetes Secret.
+	Vault *VaultConfig
+	// Generated lists the certificates generated during the run, in order.
+	Generated []notification.CertInfo
+
+	// rollPods is set when a certificate mounted by the pods is rotated without rotating the node certificate.
+	rollPods bool
+}
+
+// VaultConfig locates the CA in the KV version 2 engine of Vault.
+type VaultConfig struct {
+	Client *vault.Client
+	Mount  string
+	Path   string
 }
 
 type certConfig struct {
@@ -116,6 +141,7 @@ func (rc *GenerateCert) Do(ctx context.Context, namespace string) error {
 	caDir, cleanupCADir := util.CreateTempDir("caDir")
 	defer cleanupCADir()
 	rc.CAKey = filepath.Join(caDir, "ca.key")
+	rc.ClientCAKey = filepath.Join(caDir, "ca-client.key")
 
 	// generate the base CA cert and key
 	if err := rc.generateCA(ctx, rc.getCASecretName(), namespace); err != nil {
@@ -124,6 +150,15 @@ func (rc *GenerateCert) Do(ctx context.Context, namespace string) error {
 		return errors.Wrap(err, msg)
 	}
 
+	// generate the client CA cert and key, used to sign the client certificates
+	if rc.SplitCA {
+		if err := rc.generateClientCA(ctx, rc.getClientCASecretName(), namespace); err != nil {
+			msg := " error Generating Client CA"
+			logrus.Error(err, msg)
+			return errors.Wrap(err, msg)
+		}
+	}
+
 	// In the case of rotate CA, skip node and client certificate rotation
 	if rc.RotateCACert {
 		return nil
@@ -136,6 +171,15 @@ func (rc *GenerateCert) Do(ctx context.Context, namespace string) error {
 		return errors.Wrap(err, msg)
 	}
 
+	// generate the client certificate of the node user, used by the nodes to connect to each other
+	if rc.SplitCA {
+		if err := rc.generateNodeClientCert(ctx, rc.getNodeClientSecretName(), namespace); err != nil {
+			msg := " error Generating Node Client Certificate"
+			logrus.Error(err, msg)
+			return errors.Wrap(err, msg)
+		}
+	}
+
 	// generate the node certificate for the database to use
 	if err := rc.generateNodeCert(ctx, rc.getNodeSecretName(), namespace); err != nil {
 		msg := " error Generating Node Certificate"
@@ -143,6 +187,23 @@ func (rc *GenerateCert) Do(ctx context.Context, namespace string) error {
 		return errors.Wrap(err, msg)
 	}
 
+	// once node and client certificates are signed by the new CA, the previous CA can be dropped
+	if rc.RotateNodeCert && rc.RotateClientCert {
+		if err := rc.dropPreviousCA(ctx, namespace); err != nil {
+			msg := " error Dropping previous CA Certificate"
+			logrus.Error(err, msg)
+			return errors.Wrap(err, msg)
+		}
+
+		if rc.SplitCA {
+			if err := rc.dropPreviousClientCA(ctx, namespace); err != nil {
+				msg := " error Dropping previous Client CA Certificate"
+				logrus.Error(err, msg)
+				return errors.Wrap(err, msg)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -180,6 +241,21 @@ func (rc *GenerateCert) ClientCertGenerate(ctx context.Context, namespace string
 	return nil
 }
 
+// caPair describes a CA generated by the self-signer and the secret it is stored in.
+type caPair struct {
+	// name is used in the logs and errors, e.g. "CA" or "client CA".
+	name string
+	// keyPath is the path of the CA key, and certFile the name of the CA certificate in the certs directory.
+	keyPath    string
+	certFile   string
+	secretName string
+	// create generates the CA key and certificate.
+	create func(certsDir, caKeyPath string, keySize int, lifetime time.Duration, allowKeyReuse bool, overwrite bool) error
+	// updateNew distributes a rotated CA to the certificates trusting it.
+	updateNew func(ctx context.Context, namespace string) error
+	res       resource.Resource
+}
+
 // generateCA generates the CA key and certificate if not given by the user and stores them in a secret.
 func (rc *GenerateCert) generateCA(ctx context.Context, CASecretName string, namespace string) error {
 
@@ -190,38 +266,68 @@ func (rc *GenerateCert) generateCA(ctx context.Context, CASecretName string, nam
 		return rc.LoadCASecret(ctx, namespace)
 	}
 
-	secret, err := resource.LoadTLSSecret(CASecretName, resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
+	return rc.generateCAPair(ctx, namespace, caPair{
+		name:       "CA",
+		keyPath:    rc.CAKey,
+		certFile:   resource.CaCert,
+		secretName: CASecretName,
+		create:     security.CreateCAPair,
+		updateNew:  rc.UpdateNewCA,
+		res:        rc.caResource(ctx, namespace),
+	})
+}
+
+// generateClientCA generates the client CA key and certificate and stores them in a secret. The client CA
+// certificate is written to ca-client.crt, so that the client certificates are signed by the client CA.
+func (rc *GenerateCert) generateClientCA(ctx context.Context, CASecretName string, namespace string) error {
+	return rc.generateCAPair(ctx, namespace, caPair{
+		name:       "client CA",
+		keyPath:    rc.ClientCAKey,
+		certFile:   resource.ClientCaCert,
+		secretName: CASecretName,
+		create:     security.CreateClientCAPair,
+		updateNew:  rc.UpdateNewClientCA,
+		res:        resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister),
+	})
+}
+
+// generateCAPair loads the CA from its secret, or generates it and stores it in the secret if the secret isn't ready
+// or the CA is due for rotation. Either way, the CA key and certificate are written to the certs directory, to sign
+// the certificates generated next.
+func (rc *GenerateCert) generateCAPair(ctx context.Context, namespace string, pair caPair) error {
+
+	secret, err := resource.LoadTLSSecret(pair.secretName, pair.res)
 	if client.IgnoreNotFound(err) != nil {
-		return errors.Wrap(err, "failed to get CA secret")
+		return errors.Wrapf(err, "failed to get %s secret", pair.name)
 	}
 
 	// inline func used to generate CA cert and key
-	generate := func(rc *GenerateCert, CASecretName, namespace string) error {
-		logrus.Info("Generating CA")
+	generate := func() error {
+		logrus.Infof("Generating %s", pair.name)
 
 		// create the CA Pair certificates
-		if err = errors.Wrap(
-			security.CreateCAPair(
+		if err = errors.Wrapf(
+			pair.create(
 				rc.CertsDir,
-				rc.CAKey,
+				pair.keyPath,
 				keySize,
 				rc.CaCertConfig.Duration,
 				allowCAKeyReuse,
 				overwriteFiles),
-			"failed to generate CA cert and key"); err != nil {
+			"failed to generate %s cert and key", pair.name); err != nil {
 			return err
 		}
 
 		// Read the ca key into memory
-		cakey, err := os.ReadFile(rc.CAKey)
+		cakey, err := os.ReadFile(pair.keyPath)
 		if err != nil {
-			return errors.Wrap(err, "unable to read ca.key")
+			return errors.Wrapf(err, "unable to read %s", filepath.Base(pair.keyPath))
 		}
 
 		// Read the ca cert into memory
-		caCert, err := os.ReadFile(filepath.Join(rc.CertsDir, resource.CaCert))
+		caCert, err := os.ReadFile(filepath.Join(rc.CertsDir, pair.certFile))
 		if err != nil {
-			return errors.Wrap(err, "unable to read ca.crt")
+			return errors.Wrapf(err, "unable to read %s", pair.certFile)
 		}
 
 		validFrom, validUpto, err := rc.getCertLife(caCert)
@@ -230,56 +336,51 @@ func (rc *GenerateCert) generateCA(ctx context.Context, CASecretName string, nam
 		}
 
 		// create and save the TLS certificates into a secret
-		secret = resource.CreateTLSSecret(CASecretName, corev1.SecretTypeOpaque,
-			resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
+		secret = resource.CreateTLSSecret(pair.secretName, corev1.SecretTypeOpaque, pair.res)
 
 		// add certificate info in the secret annotations
 		annotations := resource.GetSecretAnnotations(validFrom, validUpto, rc.CaCertConfig.Duration.String())
 
 		if err = secret.UpdateCASecret(cakey, caCert, annotations); err != nil {
-			return errors.Wrap(err, "failed to update ca key secret ")
+			return errors.Wrapf(err, "failed to update %s key secret", pair.name)
 		}
 
-		logrus.Infof("Generated and saved CA key and certificate in secret [%s]", CASecretName)
+		rc.Generated = append(rc.Generated, notification.CertInfo{Secret: pair.secretName, ValidUpto: validUpto})
+		logrus.Infof("Generated and saved %s key and certificate in secret [%s]", pair.name, pair.secretName)
 		return nil
 	}
 
 	// check if the existing secret is ready to be consumed. If found ready, skip cert generation
 	if secret.ReadyCA() && secret.ValidateAnnotations() {
 
+		// writing the existing cert file, so that a rotated CA is a bundle of both old and new CA cert
+		if err := os.WriteFile(filepath.Join(rc.CertsDir, pair.certFile), secret.CA(), security.CertFileMode); err != nil {
+			return errors.Wrapf(err, "failed to write %s cert", pair.name)
+		}
+
 		if rc.RotateCACert {
 			isRequired, reason := secret.IsRotationRequired(rc.CaCertConfig.Duration, rc.CACronSchedule)
 			if isRequired {
-				logrus.Infof("CA Certificate: %s", reason)
-
-				// writing old cert file so that the new CA is a bundle of both old and new CA cert
-				if err := os.WriteFile(filepath.Join(rc.CertsDir, resource.CaCert), secret.CA(), security.CertFileMode); err != nil {
-					return errors.Wrap(err, "failed to write CA cert")
-				}
+				logrus.Infof("%s Certificate: %s", pair.name, reason)
 
-				if err := generate(rc, CASecretName, namespace); err != nil {
+				if err := generate(); err != nil {
 					return err
 				}
 
-				return rc.UpdateNewCA(ctx, namespace)
-
+				return pair.updateNew(ctx, namespace)
 			}
 		}
 
-		logrus.Infof("CA secret [%s] is found in ready state, skipping CA generation", CASecretName)
-
-		if err := os.WriteFile(filepath.Join(rc.CertsDir, resource.CaCert), secret.CA(), security.CertFileMode); err != nil {
-			return errors.Wrap(err, "failed to write CA cert")
-		}
+		logrus.Infof("%s secret [%s] is found in ready state, skipping %s generation", pair.name, pair.secretName, pair.name)
 
-		if err := os.WriteFile(rc.CAKey, secret.CAKey(), security.KeyFileMode); err != nil {
-			return errors.Wrap(err, "failed to write CA key")
+		if err := os.WriteFile(pair.keyPath, secret.CAKey(), security.KeyFileMode); err != nil {
+			return errors.Wrapf(err, "failed to write %s key", pair.name)
 		}
 		return nil
 	}
 
 	// generate new certificate
-	return generate(rc, CASecretName, namespace)
+	return generate()
 }
 
 // generateNodeCert generates the Node key and certificate and stores them in a secret.
@@ -306,6 +407,13 @@ func (rc *GenerateCert) generateNodeCert(ctx context.Context, nodeSecretName str
 			fmt.Sprintf("*.%s.%s", rc.DiscoveryServiceName, namespace),
 			fmt.Sprintf("*.%s.%s.svc.%s", rc.DiscoveryServiceName, namespace, rc.ClusterDomain),
 		}
+		if rc.FollowerReadsServiceName != "" {
+			hosts = append(hosts,
+				rc.FollowerReadsServiceName,
+				fmt.Sprintf("%s.%s", rc.FollowerReadsServiceName, namespace),
+				fmt.Sprintf("%s.%s.svc.%s", rc.FollowerReadsServiceName, namespace, rc.ClusterDomain),
+			)
+		}
 
 		// create the Node Pair certificates
 		if err = errors.Wrap(
@@ -354,6 +462,7 @@ func (rc *GenerateCert) generateNodeCert(ctx context.Context, nodeSecretName str
 			return errors.Wrap(err, "failed to update node TLS secret certs")
 		}
 
+		rc.Generated = append(rc.Generated, notification.CertInfo{Secret: nodeSecretName, ValidUpto: validUpto})
 		logrus.Infof("Generated and saved node key and certificate in secret [%s]", nodeSecretName)
 
 		return nil
@@ -363,6 +472,9 @@ func (rc *GenerateCert) generateNodeCert(ctx context.Context, nodeSecretName str
 
 		if rc.RotateNodeCert {
 			isRequired, reason := secret.IsRotationRequired(rc.NodeCertConfig.Duration, rc.NodeAndClientCronSchedule)
+			if !isRequired && !rc.isSignedByCurrentCA(secret.TLSCert(), resource.CaCert) {
+				isRequired, reason = true, "Certificate not signed by the current CA, rotating certificate"
+			}
 			if isRequired {
 				logrus.Infof("Node Certificate: %s", reason)
 
@@ -370,7 +482,7 @@ func (rc *GenerateCert) generateNodeCert(ctx context.Context, nodeSecretName str
 					return err
 				}
 
-				if err = kube.RollingUpdate(ctx, rc.client, rc.DiscoveryServiceName, namespace, rc.ReadinessWait, rc.PodUpdateTimeout); err != nil {
+				if err = kube.RollingUpdate(ctx, rc.client, rc.DiscoveryServiceName, namespace, rc.StartOrdinal, rc.ReadinessWait, rc.PodUpdateTimeout); err != nil {
 					return
 				}
 				return nil
@@ -378,6 +490,10 @@ func (rc *GenerateCert) generateNodeCert(ctx context.Context, nodeSecretName str
 		}
 
 		logrus.Infof("Node secret [%s] is found in ready state, skipping Node cert generation", nodeSecretName)
+
+		if rc.rollPods {
+			return kube.RollingUpdate(ctx, rc.client, rc.DiscoveryServiceName, namespace, rc.StartOrdinal, rc.ReadinessWait, rc.PodUpdateTimeout)
+		}
 		return nil
 	}
 
@@ -385,6 +501,24 @@ func (rc *GenerateCert) generateNodeCert(ctx context.Context, nodeSecretName str
 
 }
 
+// clientPair describes a client certificate generated by the self-signer and the secret it is stored in.
+type clientPair struct {
+	// name is used in the logs and errors, e.g. "client" or "node client".
+	name string
+	user string
+	// signingKey is the key of the CA signing the certificate, and caFile the name of its certificate in the certs
+	// directory, which the existing certificate is checked against.
+	signingKey string
+	caFile     string
+	// secretCAFile is the name of the CA certificate stored in the secret along with the client certificate.
+	secretCAFile string
+	secretName   string
+	config       *certConfig
+	rotate       bool
+	// rollPods restarts the pods once the node certificate is handled, if the certificate is rotated.
+	rollPods bool
+}
+
 // generateClientCert generates the Client key and certificate and stores them in a secret.
 func (rc *GenerateCert) generateClientCert(ctx context.Context, clientSecretName string, namespace string) error {
 
@@ -395,42 +529,69 @@ func (rc *GenerateCert) generateClientCert(ctx context.Context, clientSecretName
 		clientSecretName = fmt.Sprintf("%s-client-secret", user)
 	}
 
-	secret, err := resource.LoadTLSSecret(clientSecretName, resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
+	return rc.generateClientPair(ctx, namespace, clientPair{
+		name:         "client",
+		user:         user,
+		signingKey:   rc.clientSigningKey(),
+		caFile:       rc.clientCAFile(),
+		secretCAFile: resource.CaCert,
+		secretName:   clientSecretName,
+		config:       rc.ClientCertConfig,
+		rotate:       rc.RotateClientCert,
+	})
+}
+
+// generateNodeClientCert generates the client key and certificate of the node user, signed by the client CA, and
+// stores them in a secret along with the client CA certificate.
+func (rc *GenerateCert) generateNodeClientCert(ctx context.Context, secretName string, namespace string) error {
+	return rc.generateClientPair(ctx, namespace, clientPair{
+		name:         "node client",
+		user:         security.NodeUser,
+		signingKey:   rc.ClientCAKey,
+		caFile:       resource.ClientCaCert,
+		secretCAFile: resource.ClientCaCert,
+		secretName:   secretName,
+		config:       rc.NodeCertConfig,
+		rotate:       rc.RotateNodeCert,
+		rollPods:     true,
+	})
+}
+
+// generateClientPair generates the client key and certificate and stores them in a secret, unless the secret is
+// ready and the certificate isn't due for rotation.
+func (rc *GenerateCert) generateClientPair(ctx context.Context, namespace string, pair clientPair) error {
+
+	secret, err := resource.LoadTLSSecret(pair.secretName, resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
 	if client.IgnoreNotFound(err) != nil {
-		return errors.Wrap(err, "failed to get client secret")
+		return errors.Wrapf(err, "failed to get %s secret", pair.name)
 	}
 
 	// inline func used to generate client cert and key
-	generate := func(rc *GenerateCert, clientSecretName, namespace string) error {
-		logrus.Info("Generating client certificate")
-
-		// Create the user for the certificate
-		u := &security.SQLUsername{
-			U: user,
-		}
+	generate := func() error {
+		logrus.Infof("Generating %s certificate", pair.name)
 
 		// Create the client certificates
-		if err = errors.Wrap(
+		if err = errors.Wrapf(
 			security.CreateClientPair(
 				rc.CertsDir,
-				rc.CAKey,
+				pair.signingKey,
 				keySize,
-				rc.ClientCertConfig.Duration,
+				pair.config.Duration,
 				overwriteFiles,
-				*u,
+				security.SQLUsername{U: pair.user},
 				generatePKCS8Key),
-			"failed to generate client certificate and key"); err != nil {
+			"failed to generate %s certificate and key", pair.name); err != nil {
 			return err
 		}
 
 		// Load the CA certificate into memory
-		ca, err := os.ReadFile(filepath.Join(rc.CertsDir, resource.CaCert))
+		ca, err := os.ReadFile(filepath.Join(rc.CertsDir, pair.secretCAFile))
 		if err != nil {
-			return errors.Wrap(err, "unable to read ca.crt")
+			return errors.Wrapf(err, "unable to read %s", pair.secretCAFile)
 		}
 
 		// Load the client user certificate into memory
-		userCertFile := fmt.Sprintf("client.%s.crt", user)
+		userCertFile := fmt.Sprintf("client.%s.crt", pair.user)
 		pemCert, err := os.ReadFile(filepath.Join(rc.CertsDir, userCertFile))
 		if err != nil {
 			return errors.Wrap(err, fmt.Sprintf("unable to read %s", userCertFile))
@@ -442,44 +603,62 @@ func (rc *GenerateCert) generateClientCert(ctx context.Context, clientSecretName
 
 		}
 
-		// Load the client root key into memory
-		userKeyFile := fmt.Sprintf("client.%s.key", user)
+		// Load the client user key into memory
+		userKeyFile := fmt.Sprintf("client.%s.key", pair.user)
 		pemKey, err := os.ReadFile(filepath.Join(rc.CertsDir, userKeyFile))
 		if err != nil {
 			return errors.Wrap(err, fmt.Sprintf("unable to read %s", userKeyFile))
 		}
 
 		// add certificate info in the secret annotations
-		annotations := resource.GetSecretAnnotations(validFrom, validUpto, rc.ClientCertConfig.Duration.String())
+		annotations := resource.GetSecretAnnotations(validFrom, validUpto, pair.config.Duration.String())
 
 		// create and save the TLS certificates into a secret
-		secret = resource.CreateTLSSecret(clientSecretName, corev1.SecretTypeTLS,
+		secret = resource.CreateTLSSecret(pair.secretName, corev1.SecretTypeTLS,
 			resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
 
 		if err = secret.UpdateTLSSecret(pemCert, pemKey, ca, annotations); err != nil {
-			return errors.Wrap(err, "failed to update client TLS secret certs")
+			return errors.Wrapf(err, "failed to update %s TLS secret certs", pair.name)
 		}
 
-		logrus.Infof("Generated and saved client key and certificate in secret [%s]", clientSecretName)
+		rc.Generated = append(rc.Generated, notification.CertInfo{Secret: pair.secretName, ValidUpto: validUpto})
+		logrus.Infof("Generated and saved %s key and certificate in secret [%s]", pair.name, pair.secretName)
 		return nil
 	}
 
 	// check if the existing is ready to be consumed. If found ready, skip cert generation
 	if secret.Ready() && secret.ValidateAnnotations() {
 
-		if rc.RotateClientCert {
-			isRequired, reason := secret.IsRotationRequired(rc.ClientCertConfig.Duration, rc.NodeAndClientCronSchedule)
+		if pair.rotate {
+			isRequired, reason := secret.IsRotationRequired(pair.config.Duration, rc.NodeAndClientCronSchedule)
+			if !isRequired && !rc.isSignedByCurrentCA(secret.TLSCert(), pair.caFile) {
+				isRequired, reason = true, "Certificate not signed by the current CA, rotating certificate"
+			}
 			if isRequired {
-				logrus.Infof("Client Certificate: %s", reason)
-				return generate(rc, clientSecretName, namespace)
+				logrus.Infof("%s Certificate: %s", pair.name, reason)
+
+				// the pods are restarted once the node certificate is handled
+				if pair.rollPods {
+					rc.rollPods = true
+				}
+				return generate()
 			}
 		}
 
-		logrus.Infof("Client secret [%s] is found in ready state, skipping Client cert generation", clientSecretName)
+		logrus.Infof("%s secret [%s] is found in ready state, skipping %s cert generation", pair.name, pair.secretName, pair.name)
 		return nil
 	}
 
-	return generate(rc, clientSecretName, namespace)
+	return generate()
+}
+
+// caResource returns the resource the generated CA is stored in: Vault when configured, a Kubernetes Secret otherwise.
+func (rc *GenerateCert) caResource(ctx context.Context, namespace string) resource.Resource {
+	if rc.Vault != nil {
+		return resource.NewVaultResource(ctx, rc.Vault.Client, rc.Vault.Mount, rc.Vault.Path)
+	}
+
+	return resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister)
 }
 
 func (rc *GenerateCert) getCASecretName() string {
@@ -494,6 +673,32 @@ func (rc *GenerateCert) getClientSecretName() string {
 	return rc.DiscoveryServiceName + "-client-secret"
 }
 
+func (rc *GenerateCert) getClientCASecretName() string {
+	return rc.DiscoveryServiceName + "-client-ca-secret"
+}
+
+func (rc *GenerateCert) getNodeClientSecretName() string {
+	return rc.DiscoveryServiceName + "-node-client-secret"
+}
+
+// clientSigningKey returns the path of the key signing the client certificates.
+func (rc *GenerateCert) clientSigningKey() string {
+	if rc.SplitCA {
+		return rc.ClientCAKey
+	}
+
+	return rc.CAKey
+}
+
+// clientCAFile returns the name of the CA certificate file the client certificates are signed by.
+func (rc *GenerateCert) clientCAFile() string {
+	if rc.SplitCA {
+		return resource.ClientCaCert
+	}
+
+	return resource.CaCert
+}
+
 // getCertLife return the certificate starting and expiration date
 func (rc *GenerateCert) getCertLife(pemCert []byte) (validFrom string, validUpto string, err error) {
 	cert, err := security.GetCertObj(pemCert)
@@ -538,12 +743,141 @@ func (rc *GenerateCert) UpdateNewCA(ctx context.Context, namespace string) error
 
 	logrus.Info("Updating new CA in client secret")
 
-	if err := kube.RollingUpdate(ctx, rc.client, rc.DiscoveryServiceName, namespace, rc.ReadinessWait, rc.PodUpdateTimeout); err != nil {
+	if err := kube.RollingUpdate(ctx, rc.client, rc.DiscoveryServiceName, namespace, rc.StartOrdinal, rc.ReadinessWait, rc.PodUpdateTimeout); err != nil {
 		return err
 	}
 	return nil
 }
 
+// UpdateNewClientCA updates the client CA bundle in the node client secret and restarts the pods, so that the
+// nodes trust the client certificates signed by both the new and the previous client CA.
+func (rc *GenerateCert) UpdateNewClientCA(ctx context.Context, namespace string) error {
+	ca, err := os.ReadFile(filepath.Join(rc.CertsDir, resource.ClientCaCert))
+	if err != nil {
+		return errors.Wrap(err, "unable to read ca-client.crt")
+	}
+
+	logrus.Info("Updating new client CA in node client secret")
+	secret, err := resource.LoadTLSSecret(rc.getNodeClientSecretName(), resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
+	if err != nil {
+		return errors.Wrap(err, "failed to get node client secret")
+	}
+
+	if err = secret.UpdateTLSSecret(secret.TLSCert(), secret.TLSPrivateKey(), ca,
+		secret.Secret().Annotations); err != nil {
+		return errors.Wrap(err, "failed to update node client TLS secret certs")
+	}
+
+	logrus.Info("Updated new client CA in node client secret")
+
+	return kube.RollingUpdate(ctx, rc.client, rc.DiscoveryServiceName, namespace, rc.StartOrdinal, rc.ReadinessWait, rc.PodUpdateTimeout)
+}
+
+// isSignedByCurrentCA checks if the certificate is signed by the current CA, i.e. the first certificate of the
+// CA bundle caFile in the certs directory. After a CA rotation, the bundle contains both the new and the previous CA.
+func (rc *GenerateCert) isSignedByCurrentCA(pemCert []byte, caFile string) bool {
+	ca, err := os.ReadFile(filepath.Join(rc.CertsDir, caFile))
+	if err != nil {
+		logrus.Warnf("unable to read %s: %s", caFile, err)
+		return true
+	}
+
+	signed, err := security.IsSignedBy(pemCert, ca)
+	if err != nil {
+		logrus.Warnf("unable to verify the certificate issuer: %s", err)
+		return true
+	}
+
+	return signed
+}
+
+// dropPreviousCA removes the previous CA certificates from the CA bundle, once the CA overlap window has elapsed
+// since the current CA was issued and both node and client certificates are signed by the current CA. The node and
+// client secrets are then updated with the trimmed CA bundle.
+func (rc *GenerateCert) dropPreviousCA(ctx context.Context, namespace string) error {
+	// the user provided CA secret is never modified
+	if rc.CaSecret != "" {
+		return nil
+	}
+
+	caSecret, err := resource.LoadTLSSecret(rc.getCASecretName(), rc.caResource(ctx, namespace))
+	if err != nil {
+		return errors.Wrap(err, "failed to get CA secret")
+	}
+
+	// with a split CA, the client certificate is signed by the client CA
+	signedSecrets := []string{rc.getNodeSecretName(), rc.getClientSecretName()}
+	if rc.SplitCA {
+		signedSecrets = []string{rc.getNodeSecretName()}
+	}
+
+	return rc.dropPrevious(ctx, namespace, caSecret, resource.CaCert, signedSecrets, rc.UpdateNewCA)
+}
+
+// dropPreviousClientCA removes the previous client CA certificates from the client CA bundle, once the CA overlap
+// window has elapsed and both the client and node client certificates are signed by the current client CA.
+func (rc *GenerateCert) dropPreviousClientCA(ctx context.Context, namespace string) error {
+	caSecret, err := resource.LoadTLSSecret(rc.getClientCASecretName(), resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
+	if err != nil {
+		return errors.Wrap(err, "failed to get client CA secret")
+	}
+
+	signedSecrets := []string{rc.getClientSecretName(), rc.getNodeClientSecretName()}
+
+	return rc.dropPrevious(ctx, namespace, caSecret, resource.ClientCaCert, signedSecrets, rc.UpdateNewClientCA)
+}
+
+// dropPrevious trims the CA bundle of caSecret to its current CA, writes it to caFile in the certs directory and
+// calls update to propagate it, unless the overlap window is still running or any of signedSecrets is not signed
+// by the current CA yet.
+func (rc *GenerateCert) dropPrevious(ctx context.Context, namespace string, caSecret *resource.TLSSecret, caFile string,
+	signedSecrets []string, update func(context.Context, string) error) error {
+	caCerts, err := security.GetCertObjs(caSecret.CA())
+	if err != nil {
+		return errors.Wrap(err, "failed to decode CA bundle")
+	}
+
+	if len(caCerts) < 2 {
+		return nil
+	}
+
+	name := caSecret.Secret().Name
+	if time.Now().Before(caCerts[0].NotBefore.Add(rc.CAOverlapWindow)) {
+		logrus.Infof("CA overlap window has not elapsed yet, keeping the previous CA in secret [%s]", name)
+		return nil
+	}
+
+	for _, secretName := range signedSecrets {
+		secret, err := resource.LoadTLSSecret(secretName, resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
+		if err != nil {
+			return errors.Wrapf(err, "failed to get secret [%s]", secretName)
+		}
+
+		signed, err := security.IsSignedBy(secret.TLSCert(), caSecret.CA())
+		if err != nil {
+			return errors.Wrapf(err, "failed to verify certificate of secret [%s]", secretName)
+		}
+
+		if !signed {
+			logrus.Infof("Secret [%s] is not signed by the current CA yet, keeping the previous CA", secretName)
+			return nil
+		}
+	}
+
+	logrus.Infof("Dropping previous CA from secret [%s]", name)
+
+	ca := security.EncodeCertObj(caCerts[0])
+	if err := caSecret.UpdateCASecret(caSecret.CAKey(), ca, caSecret.Secret().Annotations); err != nil {
+		return errors.Wrap(err, "failed to update ca key secret")
+	}
+
+	if err := os.WriteFile(filepath.Join(rc.CertsDir, caFile), ca, security.CertFileMode); err != nil {
+		return errors.Wrap(err, "failed to write CA cert")
+	}
+
+	return update(ctx, namespace)
+}
+
 // LoadCASecret loads the CA secret and write the CA certificate and key to the CA cert directory.
 func (rc *GenerateCert) LoadCASecret(ctx context.Context, namespace string) error {
 	secret, err := resource.LoadTLSSecret(rc.CaSecret, resource.NewKubeResource(ctx, rc.client, namespace, kube.DefaultPersister))
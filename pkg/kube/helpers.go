@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -27,6 +28,7 @@ import (
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -115,15 +117,23 @@ func WaitUntilAllStsPodsAreReady(ctx context.Context, cl client.Client, stsName,
 	return backoff.Retry(f, b)
 }
 
-func RollingUpdate(ctx context.Context, cl client.Client, stsName, namespace string, readinessWait, podUpdateTimeout time.Duration) error {
+// ReplicaNames returns the names of the pods of the StatefulSet, whose ordinals start at startOrdinal.
+func ReplicaNames(stsName string, startOrdinal, replicas int32) []string {
+	var names []string
+	for i := startOrdinal; i < startOrdinal+replicas; i++ {
+		names = append(names, stsName+"-"+strconv.Itoa(int(i)))
+	}
+	return names
+}
+
+func RollingUpdate(ctx context.Context, cl client.Client, stsName, namespace string, startOrdinal int32, readinessWait, podUpdateTimeout time.Duration) error {
 	var sts v1.StatefulSet
 	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: stsName}, &sts); err != nil {
 		return err
 	}
 
 	logrus.Info("Performing rolling update after certificate rotation")
-	for i := int32(0); i < sts.Status.Replicas; i++ {
-		replicaName := stsName + "-" + strconv.Itoa(int(i))
+	for _, replicaName := range ReplicaNames(stsName, startOrdinal, sts.Status.Replicas) {
 		replica := &corev1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      replicaName,
@@ -174,3 +184,176 @@ func WaitForPodReady(ctx context.Context, cl client.Client, name, namespace stri
 	b.MaxInterval = podMaxPollingInterval
 	return backoff.Retry(f, b)
 }
+
+// LocalityFromNodeLabels builds the CockroachDB locality of a node from its labels. The tiers are given in order, from
+// the least to the most specific, as `key=label`. Tiers whose label isn't set on the node are skipped, and an error is
+// returned when none of them is set, since cockroach would otherwise be started with an empty `--locality`.
+func LocalityFromNodeLabels(labels map[string]string, tiers []string) (string, error) {
+	var locality []string
+	for _, tier := range tiers {
+		parts := strings.SplitN(tier, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return "", fmt.Errorf("invalid locality tier %q, expected key=label", tier)
+		}
+
+		value, ok := labels[parts[1]]
+		if !ok || value == "" {
+			logrus.Warnf("label %s is not set on the node, skipping locality tier %s", parts[1], parts[0])
+			continue
+		}
+
+		locality = append(locality, fmt.Sprintf("%s=%s", parts[0], value))
+	}
+
+	if len(locality) == 0 {
+		return "", fmt.Errorf("none of the labels of the locality tiers %s is set on the node", strings.Join(tiers, ","))
+	}
+
+	return strings.Join(locality, ","), nil
+}
+
+// TopologyMismatches compares the locality of CockroachDB with the topology labels of the nodes its pods can be
+// scheduled on. The tiers map the locality keys to node labels, as `key=label`. When fromNodeLabels is set, the
+// locality is derived from the node labels, and every node must carry the label of every tier, since the tiers must be
+// the same on all CockroachDB nodes. Otherwise, every tier of the given locality mapped to a label must match the label
+// of every node. The mismatches are returned as `-expected +actual` diffs, one per node and tier.
+func TopologyMismatches(nodes []corev1.Node, locality string, tiers []string, fromNodeLabels bool) ([]string, error) {
+	labelOf := map[string]string{}
+	var keys []string
+	for _, tier := range tiers {
+		parts := strings.SplitN(tier, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid locality tier %q, expected key=label", tier)
+		}
+
+		labelOf[parts[0]] = parts[1]
+		keys = append(keys, parts[0])
+	}
+
+	expected := map[string]string{}
+	if !fromNodeLabels {
+		keys = nil
+		for _, tier := range strings.Split(locality, ",") {
+			parts := strings.SplitN(tier, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("invalid locality %q, expected key=value tiers", locality)
+			}
+
+			if _, ok := labelOf[parts[0]]; ok {
+				expected[parts[0]] = parts[1]
+				keys = append(keys, parts[0])
+			}
+		}
+	}
+
+	var mismatches []string
+	for _, node := range nodes {
+		for _, key := range keys {
+			label := labelOf[key]
+			value, ok := node.Labels[label]
+			switch {
+			case (!ok || value == "") && fromNodeLabels:
+				mismatches = append(mismatches, fmt.Sprintf("node %s: label %s of tier %s is not set", node.Name, label, key))
+			case !ok || value == "":
+				mismatches = append(mismatches, fmt.Sprintf("node %s: -%s=%s +label %s not set", node.Name, key, expected[key], label))
+			case !fromNodeLabels && value != expected[key]:
+				mismatches = append(mismatches, fmt.Sprintf("node %s: -%s=%s +%s=%s (label %s)", node.Name, key, expected[key], key, value, label))
+			}
+		}
+	}
+
+	return mismatches, nil
+}
+
+// ContainerSucceeded returns whether the named container of the pod has terminated with a zero exit code.
+func ContainerSucceeded(pod *corev1.Pod, name string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == name {
+			return status.State.Terminated != nil && status.State.Terminated.ExitCode == 0
+		}
+	}
+
+	return false
+}
+
+// NewWarningEvent builds a Warning event about the given pod, reported by the given component.
+func NewWarningEvent(pod *corev1.Pod, component, reason, message string) *corev1.Event {
+	return NewEvent(corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		Namespace:  pod.Namespace,
+		UID:        pod.UID,
+	}, component, corev1.EventTypeWarning, reason, message)
+}
+
+// maxEventMessageLength is the maximum length of the message of an event accepted by the API server.
+const maxEventMessageLength = 1024
+
+// NewEvent builds an event of the given type about the given object, reported by the given component. Messages
+// longer than accepted by the API server are truncated.
+func NewEvent(object corev1.ObjectReference, component, eventType, reason, message string) *corev1.Event {
+	now := metav1.Now()
+
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-3] + "..."
+	}
+
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: object.Name + ".",
+			Namespace:    object.Namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: component},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+}
+
+// EmitStatefulSetEvent emits an event on the given StatefulSet, so that the milestones and failures of the Jobs of
+// the chart are shown by `kubectl describe` of the StatefulSet next to its own events.
+func EmitStatefulSetEvent(ctx context.Context, cl client.Client, namespace, stsName, component, eventType, reason,
+	message string) error {
+	var sts v1.StatefulSet
+	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: stsName}, &sts); err != nil {
+		return err
+	}
+
+	return cl.Create(ctx, NewEvent(corev1.ObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "StatefulSet",
+		Name:       sts.Name,
+		Namespace:  sts.Namespace,
+		UID:        sts.UID,
+	}, component, eventType, reason, message))
+}
+
+// ParseOrdinalSizes parses volume sizes given as `ordinal=size` into sizes keyed by StatefulSet Pod ordinal.
+func ParseOrdinalSizes(overrides []string) (map[int]resource.Quantity, error) {
+	sizes := map[int]resource.Quantity{}
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid volume size override %q, expected ordinal=size", override)
+		}
+
+		ordinal, err := strconv.Atoi(parts[0])
+		if err != nil || ordinal < 0 {
+			return nil, fmt.Errorf("invalid ordinal in volume size override %q", override)
+		}
+
+		size, err := resource.ParseQuantity(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in volume size override %q: %w", override, err)
+		}
+
+		sizes[ordinal] = size
+	}
+
+	return sizes, nil
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cockroachdb/helm-charts/pkg/kube"
+)
+
+func TestLocalityFromNodeLabels(t *testing.T) {
+	labels := map[string]string{
+		"topology.kubernetes.io/region": "us-east1",
+		"topology.kubernetes.io/zone":   "us-east1-b",
+	}
+
+	tests := []struct {
+		name     string
+		tiers    []string
+		locality string
+		wantErr  string
+	}{
+		{
+			name:     "region and zone",
+			tiers:    []string{"region=topology.kubernetes.io/region", "zone=topology.kubernetes.io/zone"},
+			locality: "region=us-east1,zone=us-east1-b",
+		},
+		{
+			name:     "missing label is skipped",
+			tiers:    []string{"region=topology.kubernetes.io/region", "rack=example.com/rack"},
+			locality: "region=us-east1",
+		},
+		{
+			name:    "no label is set",
+			tiers:   []string{"rack=example.com/rack"},
+			wantErr: "none of the labels of the locality tiers rack=example.com/rack is set on the node",
+		},
+		{
+			name:    "invalid tier",
+			tiers:   []string{"topology.kubernetes.io/region"},
+			wantErr: `invalid locality tier "topology.kubernetes.io/region", expected key=label`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locality, err := kube.LocalityFromNodeLabels(labels, tt.tiers)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.locality, locality)
+		})
+	}
+}
+
+func TestTopologyMismatches(t *testing.T) {
+	tiers := []string{"region=topology.kubernetes.io/region", "zone=topology.kubernetes.io/zone"}
+	nodes := []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{
+			"topology.kubernetes.io/region": "us-east1",
+			"topology.kubernetes.io/zone":   "us-east1-b",
+		}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{
+			"topology.kubernetes.io/region": "us-east1",
+			"topology.kubernetes.io/zone":   "us-east1-c",
+		}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-c", Labels: map[string]string{
+			"topology.kubernetes.io/region": "us-east1",
+		}}},
+	}
+
+	tests := []struct {
+		name           string
+		locality       string
+		fromNodeLabels bool
+		mismatches     []string
+		wantErr        string
+	}{
+		{
+			name:     "matching region",
+			locality: "cloud=gce,region=us-east1",
+		},
+		{
+			name:     "mismatching region and zone",
+			locality: "region=us-west1,zone=us-east1-b",
+			mismatches: []string{
+				"node node-a: -region=us-west1 +region=us-east1 (label topology.kubernetes.io/region)",
+				"node node-b: -region=us-west1 +region=us-east1 (label topology.kubernetes.io/region)",
+				"node node-b: -zone=us-east1-b +zone=us-east1-c (label topology.kubernetes.io/zone)",
+				"node node-c: -region=us-west1 +region=us-east1 (label topology.kubernetes.io/region)",
+				"node node-c: -zone=us-east1-b +label topology.kubernetes.io/zone not set",
+			},
+		},
+		{
+			name:           "missing label of a tier derived from the node labels",
+			fromNodeLabels: true,
+			mismatches:     []string{"node node-c: label topology.kubernetes.io/zone of tier zone is not set"},
+		},
+		{
+			name:     "invalid locality",
+			locality: "us-east1",
+			wantErr:  `invalid locality "us-east1", expected key=value tiers`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatches, err := kube.TopologyMismatches(nodes, tt.locality, tiers, tt.fromNodeLabels)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.mismatches, mismatches)
+		})
+	}
+}
+
+func TestContainerSucceeded(t *testing.T) {
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:  "cluster-init",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+				},
+				{
+					Name:  "failed",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+				},
+				{
+					Name:  "running",
+					State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				},
+			},
+		},
+	}
+
+	require.True(t, kube.ContainerSucceeded(pod, "cluster-init"))
+	require.False(t, kube.ContainerSucceeded(pod, "failed"))
+	require.False(t, kube.ContainerSucceeded(pod, "running"))
+	require.False(t, kube.ContainerSucceeded(pod, "missing"))
+}
+
+func TestNewWarningEvent(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "crdb-0", Namespace: "db", UID: "uid"},
+	}
+
+	event := kube.NewWarningEvent(pod, "init-barrier", "ClusterInitNotCompleted", "not initialized")
+
+	require.Equal(t, "crdb-0.", event.GenerateName)
+	require.Equal(t, "db", event.Namespace)
+	require.Equal(t, corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Name: "crdb-0", Namespace: "db", UID: "uid"}, event.InvolvedObject)
+	require.Equal(t, corev1.EventTypeWarning, event.Type)
+	require.Equal(t, "ClusterInitNotCompleted", event.Reason)
+	require.Equal(t, "not initialized", event.Message)
+	require.Equal(t, "init-barrier", event.Source.Component)
+}
+
+func TestEmitStatefulSetEvent(t *testing.T) {
+	ctx := context.Background()
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "db", UID: "uid"},
+	}
+	cl := fake.NewClientBuilder().WithObjects(sts).Build()
+
+	err := kube.EmitStatefulSetEvent(ctx, cl, "db", "crdb", "provisioner", corev1.EventTypeWarning,
+		"ProvisioningFailed", strings.Repeat("x", 2000))
+	require.NoError(t, err)
+
+	var events corev1.EventList
+	require.NoError(t, cl.List(ctx, &events))
+	require.Len(t, events.Items, 1)
+
+	event := events.Items[0]
+	require.Equal(t, corev1.ObjectReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "crdb", Namespace: "db", UID: "uid"}, event.InvolvedObject)
+	require.Equal(t, corev1.EventTypeWarning, event.Type)
+	require.Equal(t, "ProvisioningFailed", event.Reason)
+	require.Equal(t, "provisioner", event.Source.Component)
+	require.Len(t, event.Message, 1024)
+	require.True(t, strings.HasSuffix(event.Message, "..."))
+
+	err = kube.EmitStatefulSetEvent(ctx, cl, "db", "missing", "provisioner", corev1.EventTypeNormal, "ProvisioningCompleted", "")
+	require.Error(t, err)
+}
+
+func TestParseOrdinalSizes(t *testing.T) {
+	sizes, err := kube.ParseOrdinalSizes([]string{"0=200Gi", "3=1Ti"})
+	require.NoError(t, err)
+	require.Equal(t, map[int]resource.Quantity{
+		0: resource.MustParse("200Gi"),
+		3: resource.MustParse("1Ti"),
+	}, sizes)
+
+	_, err = kube.ParseOrdinalSizes([]string{"200Gi"})
+	require.EqualError(t, err, `invalid volume size override "200Gi", expected ordinal=size`)
+
+	_, err = kube.ParseOrdinalSizes([]string{"-1=200Gi"})
+	require.EqualError(t, err, `invalid ordinal in volume size override "-1=200Gi"`)
+
+	_, err = kube.ParseOrdinalSizes([]string{"1=big"})
+	require.ErrorContains(t, err, `invalid size in volume size override "1=big"`)
+}
+
+func TestReplicaNames(t *testing.T) {
+	require.Equal(t, []string{"crdb-0", "crdb-1", "crdb-2"}, kube.ReplicaNames("crdb", 0, 3))
+	require.Equal(t, []string{"crdb-5", "crdb-6", "crdb-7"}, kube.ReplicaNames("crdb", 5, 3))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CertInfo describes a certificate generated by the self-signer.
+type CertInfo struct {
+	Secret    string `json:"secret"`
+	ValidUpto string `json:"validUpto"`
+}
+
+// Summary is the payload posted to the webhook after a certificate rotation run. The `text` field makes it
+// directly usable with Slack incoming webhooks, while the other fields are meant for generic webhooks.
+type Summary struct {
+	Text      string     `json:"text"`
+	Namespace string     `json:"namespace"`
+	Rotated   []CertInfo `json:"rotated"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// NewSummary creates the summary of a certificate rotation run.
+func NewSummary(namespace string, rotated []CertInfo, err error) Summary {
+	s := Summary{
+		Namespace: namespace,
+		Rotated:   rotated,
+	}
+
+	var text strings.Builder
+	if err != nil {
+		s.Error = err.Error()
+		fmt.Fprintf(&text, "CockroachDB certificate rotation failed in namespace %s: %s", namespace, err)
+	} else {
+		fmt.Fprintf(&text, "CockroachDB certificates rotated in namespace %s", namespace)
+	}
+
+	for _, cert := range rotated {
+		fmt.Fprintf(&text, "\n- %s, valid until %s", cert.Secret, cert.ValidUpto)
+	}
+	s.Text = text.String()
+
+	return s
+}
+
+// Send posts the summary as JSON to the webhook URL.
+func Send(url string, summary Summary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+
+	return nil
+}
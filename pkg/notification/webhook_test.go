@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notification_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/notification"
+)
+
+func TestNewSummary(t *testing.T) {
+	rotated := []notification.CertInfo{{Secret: "crdb-node-secret", ValidUpto: "2027-01-01T00:00:00Z"}}
+
+	summary := notification.NewSummary("crdb", rotated, nil)
+	require.Empty(t, summary.Error)
+	require.Equal(t, "CockroachDB certificates rotated in namespace crdb\n- crdb-node-secret, valid until 2027-01-01T00:00:00Z", summary.Text)
+
+	summary = notification.NewSummary("crdb", nil, errors.New("boom"))
+	require.Equal(t, "boom", summary.Error)
+	require.Equal(t, "CockroachDB certificate rotation failed in namespace crdb: boom", summary.Text)
+}
+
+func TestSend(t *testing.T) {
+	var received notification.Summary
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	summary := notification.NewSummary("crdb", []notification.CertInfo{{Secret: "crdb-client-secret", ValidUpto: "2027-01-01T00:00:00Z"}}, nil)
+	require.NoError(t, notification.Send(server.URL, summary))
+	require.Equal(t, summary, received)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	require.EqualError(t, notification.Send(failing.URL, summary), "webhook responded with status 500 Internal Server Error")
+}
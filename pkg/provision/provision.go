@@ -0,0 +1,256 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Step is a group of provisioning statements. The statements of a transactional step are applied all or nothing in
+// a single transaction, the others one by one, e.g. cluster settings, which can't be changed within a transaction.
+type Step struct {
+	Name          string   `json:"name"`
+	Transactional bool     `json:"transactional"`
+	Statements    []string `json:"statements"`
+}
+
+// LoadSteps reads the provisioning steps rendered by the chart.
+func LoadSteps(r io.Reader) ([]Step, error) {
+	var plan struct {
+		Steps []Step `json:"steps"`
+	}
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("failed to decode the provisioning steps: %w", err)
+	}
+
+	return plan.Steps, nil
+}
+
+var envReference = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// ExpandEnv replaces the $NAME references of a statement, e.g. the passwords of the provisioned users, by the values
+// of the environment variables, as the shell running the statements of the chart does.
+func ExpandEnv(statement string, lookup func(string) (string, bool)) string {
+	return envReference.ReplaceAllStringFunc(statement, func(reference string) string {
+		value, _ := lookup(reference[1:])
+		return value
+	})
+}
+
+// Retryable errors are transaction contention, reported with SQLSTATE 40001, and the unavailability of the cluster,
+// e.g. while it is being initialized.
+var retryableErrors = []string{
+	"SQLSTATE: 40001",
+	"restart transaction",
+	"cannot dial server",
+	"connection refused",
+	"server is not accepting clients",
+	"node is waiting for cluster initialization",
+	"no such host",
+	"i/o timeout",
+}
+
+// IsRetryable returns whether the output of a failed SQL execution reports a transient error.
+func IsRetryable(output string) bool {
+	for _, e := range retryableErrors {
+		if strings.Contains(output, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Executor runs SQL against the cluster and returns its combined output.
+type Executor func(ctx context.Context, sql string) (string, error)
+
+// StepResult is the outcome of a provisioning step.
+type StepResult struct {
+	Name       string
+	Statements int
+	Attempts   int
+	Duration   time.Duration
+	Error      string
+}
+
+// Runner applies provisioning steps in order and stops at the first failing one.
+type Runner struct {
+	Exec          Executor
+	Lookup        func(string) (string, bool)
+	Retries       int
+	RetryInterval time.Duration
+	Log           *Logger
+}
+
+// Run applies the steps and returns the result of every attempted step.
+func (r *Runner) Run(ctx context.Context, steps []Step) ([]StepResult, error) {
+	var results []StepResult
+	for _, step := range steps {
+		if len(step.Statements) == 0 {
+			continue
+		}
+
+		result, err := r.runStep(ctx, step)
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("step %s failed: %w", step.Name, err)
+		}
+	}
+
+	return results, nil
+}
+
+func (r *Runner) runStep(ctx context.Context, step Step) (StepResult, error) {
+	start := time.Now()
+	result := StepResult{Name: step.Name, Statements: len(step.Statements)}
+
+	statements := make([]string, 0, len(step.Statements))
+	for _, s := range step.Statements {
+		statements = append(statements, ExpandEnv(s, r.Lookup))
+	}
+
+	var batches []string
+	if step.Transactional {
+		batches = []string{"BEGIN;\n" + strings.Join(statements, ";\n") + ";\nCOMMIT;"}
+	} else {
+		for _, s := range statements {
+			batches = append(batches, s+";")
+		}
+	}
+
+	var err error
+	for i, batch := range batches {
+		var attempts int
+		attempts, err = r.execWithRetries(ctx, step.Name, batch)
+		result.Attempts += attempts
+		if err != nil {
+			if !step.Transactional {
+				err = fmt.Errorf("statement %d: %w", i+1, err)
+			}
+			result.Error = err.Error()
+			break
+		}
+	}
+
+	result.Duration = time.Since(start)
+	if err == nil {
+		r.Log.Info("step applied", Fields{"step": step.Name, "statements": result.Statements, "attempts": result.Attempts, "duration": result.Duration.String()})
+	}
+
+	return result, err
+}
+
+// execWithRetries runs a batch of statements, retrying transient errors, and returns the number of attempts.
+func (r *Runner) execWithRetries(ctx context.Context, step, batch string) (int, error) {
+	for attempt := 1; ; attempt++ {
+		output, err := r.Exec(ctx, batch)
+		if err == nil {
+			return attempt, nil
+		}
+
+		output = strings.TrimSpace(output)
+		if !IsRetryable(output) {
+			r.Log.Error("statements failed", Fields{"step": step, "attempt": attempt, "output": output})
+			return attempt, fmt.Errorf("%w: %s", err, output)
+		}
+		if attempt > r.Retries {
+			r.Log.Error("statements failed, no retries left", Fields{"step": step, "attempt": attempt, "output": output})
+			return attempt, fmt.Errorf("%w after %d attempts: %s", err, attempt, output)
+		}
+
+		r.Log.Info("transient error, retrying", Fields{"step": step, "attempt": attempt, "output": output, "retryIn": r.RetryInterval.String()})
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(r.RetryInterval):
+		}
+	}
+}
+
+// Fields are the structured fields of a log line.
+type Fields map[string]interface{}
+
+// Logger writes structured log lines, one JSON object per line.
+type Logger struct {
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewLogger returns a Logger writing to w, or to stderr when w is nil.
+func NewLogger(w io.Writer) *Logger {
+	if w == nil {
+		w = os.Stderr
+	}
+
+	return &Logger{w: w, now: time.Now}
+}
+
+// Info writes an info log line.
+func (l *Logger) Info(msg string, fields Fields) {
+	l.write("info", msg, fields)
+}
+
+// Error writes an error log line.
+func (l *Logger) Error(msg string, fields Fields) {
+	l.write("error", msg, fields)
+}
+
+// Summary writes the results of the provisioning steps as a single log line.
+func (l *Logger) Summary(results []StepResult, err error) {
+	steps := make([]Fields, 0, len(results))
+	for _, result := range results {
+		step := Fields{"name": result.Name, "statements": result.Statements, "attempts": result.Attempts, "duration": result.Duration.String()}
+		if result.Error != "" {
+			step["error"] = result.Error
+		}
+		steps = append(steps, step)
+	}
+
+	fields := Fields{"steps": steps}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	if err != nil {
+		l.Error("provisioning failed", fields)
+		return
+	}
+
+	l.Info("provisioning completed", fields)
+}
+
+func (l *Logger) write(level, msg string, fields Fields) {
+	line := Fields{"time": l.now().UTC().Format(time.RFC3339), "level": level, "msg": msg}
+	for k, v := range fields {
+		line[k] = v
+	}
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		fmt.Fprintf(l.w, "%s: %s %v\n", level, msg, fields)
+		return
+	}
+
+	fmt.Fprintln(l.w, string(b))
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provision_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/provision"
+)
+
+func TestLoadSteps(t *testing.T) {
+	steps, err := provision.LoadSteps(strings.NewReader(`{"steps": [
+		{"name": "settings", "statements": ["SET CLUSTER SETTING a = 1"]},
+		{"name": "schema", "transactional": true, "statements": ["CREATE DATABASE a", "CREATE DATABASE b"]}
+	]}`))
+	require.NoError(t, err)
+	require.Equal(t, []provision.Step{
+		{Name: "settings", Statements: []string{"SET CLUSTER SETTING a = 1"}},
+		{Name: "schema", Transactional: true, Statements: []string{"CREATE DATABASE a", "CREATE DATABASE b"}},
+	}, steps)
+
+	_, err = provision.LoadSteps(strings.NewReader("not json"))
+	require.Error(t, err)
+}
+
+func TestExpandEnv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "app_PASSWORD" {
+			return "s3cr3t", true
+		}
+		return "", false
+	}
+
+	require.Equal(t, "CREATE USER app WITH PASSWORD 's3cr3t'",
+		provision.ExpandEnv("CREATE USER app WITH PASSWORD '$app_PASSWORD'", lookup))
+	require.Equal(t, "SET CLUSTER SETTING a = ''",
+		provision.ExpandEnv("SET CLUSTER SETTING a = '$a_CLUSTER_SETTING'", lookup))
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, provision.IsRetryable("ERROR: restart transaction: TransactionRetryWithProtoRefreshError\nSQLSTATE: 40001"))
+	require.True(t, provision.IsRetryable("ERROR: cannot dial server.\nIs the server running?"))
+	require.False(t, provision.IsRetryable("ERROR: at or near \"databse\": syntax error\nSQLSTATE: 42601"))
+}
+
+func TestRunner(t *testing.T) {
+	steps := []provision.Step{
+		{Name: "settings", Statements: []string{"SET CLUSTER SETTING a = 1", "SET CLUSTER SETTING b = 2"}},
+		{Name: "schema", Transactional: true, Statements: []string{"CREATE USER app", "CREATE DATABASE app"}},
+	}
+
+	t.Run("applies the steps, retrying contention", func(t *testing.T) {
+		var executed []string
+		contended := false
+		runner := provision.Runner{
+			Exec: func(ctx context.Context, sql string) (string, error) {
+				if strings.HasPrefix(sql, "BEGIN;") && !contended {
+					contended = true
+					return "ERROR: restart transaction\nSQLSTATE: 40001", errors.New("exit status 1")
+				}
+				executed = append(executed, sql)
+				return "", nil
+			},
+			Lookup:  func(string) (string, bool) { return "", false },
+			Retries: 3,
+			Log:     provision.NewLogger(&bytes.Buffer{}),
+		}
+
+		results, err := runner.Run(context.Background(), steps)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"SET CLUSTER SETTING a = 1;",
+			"SET CLUSTER SETTING b = 2;",
+			"BEGIN;\nCREATE USER app;\nCREATE DATABASE app;\nCOMMIT;",
+		}, executed)
+		require.Len(t, results, 2)
+		require.Equal(t, 2, results[0].Attempts)
+		require.Equal(t, 2, results[1].Attempts)
+	})
+
+	t.Run("fails on the first non-retryable error", func(t *testing.T) {
+		var logs bytes.Buffer
+		runner := provision.Runner{
+			Exec: func(ctx context.Context, sql string) (string, error) {
+				if strings.Contains(sql, "b = 2") {
+					return "ERROR: unknown cluster setting \"b\"\nSQLSTATE: 42704", errors.New("exit status 1")
+				}
+				return "", nil
+			},
+			Lookup:        func(string) (string, bool) { return "", false },
+			Retries:       3,
+			RetryInterval: time.Millisecond,
+			Log:           provision.NewLogger(&logs),
+		}
+
+		results, err := runner.Run(context.Background(), steps)
+		require.ErrorContains(t, err, "step settings failed: statement 2")
+		require.Len(t, results, 1)
+		require.Contains(t, results[0].Error, "unknown cluster setting")
+
+		runner.Log.Summary(results, err)
+		require.Contains(t, logs.String(), `"msg":"provisioning failed"`)
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		attempts := 0
+		runner := provision.Runner{
+			Exec: func(ctx context.Context, sql string) (string, error) {
+				attempts++
+				return "ERROR: cannot dial server", errors.New("exit status 1")
+			},
+			Lookup:        func(string) (string, bool) { return "", false },
+			Retries:       2,
+			RetryInterval: time.Millisecond,
+			Log:           provision.NewLogger(&bytes.Buffer{}),
+		}
+
+		_, err := runner.Run(context.Background(), steps)
+		require.ErrorContains(t, err, "after 3 attempts")
+		require.Equal(t, 3, attempts)
+	})
+}
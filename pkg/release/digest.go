@@ -0,0 +1,213 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// manifestMediaTypes are the media types of the manifests the registries are asked for, the multi-platform
+// ones first so that the digest is the one of the index the images are pulled by.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// DigestResolver resolves the published digest of an image.
+type DigestResolver interface {
+	Digest(ctx context.Context, image Image) (string, error)
+}
+
+// RegistryResolver resolves the digests with the Docker Registry HTTP API V2, authenticating anonymously
+// with the token service of the registry when challenged.
+type RegistryResolver struct {
+	Client *http.Client
+	// PlainHTTP talks to the registries over HTTP instead of HTTPS.
+	PlainHTTP bool
+}
+
+// Digest returns the digest of the manifest of the tag of the image.
+func (r RegistryResolver) Digest(ctx context.Context, image Image) (string, error) {
+	host, repository := image.Registry, image.Repository
+	if host == DefaultRegistry {
+		host = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+
+	reference := image.Tag
+	if reference == "" {
+		reference = "latest"
+	}
+
+	scheme := "https"
+	if r.PlainHTTP {
+		scheme = "http"
+	}
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, host, repository, reference)
+
+	resp, err := r.headManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := r.token(ctx, resp.Header.Get("WWW-Authenticate"), repository)
+		if err != nil {
+			return "", err
+		}
+		if resp, err = r.headManifest(ctx, manifestURL, token); err != nil {
+			return "", err
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%s is not published", image.Reference())
+	default:
+		return "", fmt.Errorf("failed to get the manifest of %s: %s", image.Reference(), resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("the registry returned no digest for %s", image.Reference())
+	}
+	return digest, nil
+}
+
+func (r RegistryResolver) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return http.DefaultClient
+}
+
+func (r RegistryResolver) headManifest(ctx context.Context, manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// token requests an anonymous pull token from the token service of a Bearer challenge.
+func (r RegistryResolver) token(ctx context.Context, challenge, repository string) (string, error) {
+	params := parseChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get a token from %s: %s", realm, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode the token of %s: %w", realm, err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// parseChallenge parses the parameters of a `Bearer realm="...",service="...",scope="..."` challenge.
+func parseChallenge(challenge string) map[string]string {
+	params := map[string]string{}
+
+	scheme, rest, found := strings.Cut(challenge, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return params
+	}
+
+	for rest != "" {
+		var key, value string
+		key, rest, found = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if !found {
+			break
+		}
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.TrimSpace(key)] = value
+	}
+	return params
+}
+
+// DigestResult is the outcome of the verification of the published digest of an image.
+type DigestResult struct {
+	Image  Image
+	Digest string
+	Err    error
+}
+
+// VerifyDigests resolves the published digest of every image, failing the images which aren't published
+// and the ones whose digest pinned in the values doesn't match the published one.
+func VerifyDigests(ctx context.Context, resolver DigestResolver, images []Image) []DigestResult {
+	results := make([]DigestResult, 0, len(images))
+	for _, image := range images {
+		digest, err := resolver.Digest(ctx, image)
+		if err == nil && image.Digest != "" && image.Digest != digest {
+			err = fmt.Errorf("pinned digest %s doesn't match the published digest %s", image.Digest, digest)
+		}
+		results = append(results, DigestResult{Image: image, Digest: digest, Err: err})
+	}
+	return results
+}
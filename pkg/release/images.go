@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRegistry is the registry of the image references without a registry host.
+const DefaultRegistry = "docker.io"
+
+// Image is a container image referenced in the values of the chart.
+type Image struct {
+	// Path is the dotted path of the image in the values, e.g. tls.selfSigner.image.
+	Path       string
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Reference returns the full reference of the image.
+func (i Image) Reference() string {
+	ref := i.Registry + "/" + i.Repository
+	if i.Tag != "" {
+		ref += ":" + i.Tag
+	}
+	if i.Digest != "" {
+		ref += "@" + i.Digest
+	}
+	return ref
+}
+
+// ParseReference parses an image reference of the form [registry/]repository[:tag][@digest].
+func ParseReference(reference string) (Image, error) {
+	var image Image
+
+	ref := reference
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref, image.Digest = ref[:i], ref[i+1:]
+	}
+	// A colon after the last slash separates the tag, not the port of the registry.
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref, image.Tag = ref[:i], ref[i+1:]
+	}
+
+	image.Registry = DefaultRegistry
+	if i := strings.Index(ref, "/"); i >= 0 {
+		host := ref[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			image.Registry, ref = host, ref[i+1:]
+		}
+	}
+	image.Repository = ref
+
+	if image.Repository == "" {
+		return Image{}, fmt.Errorf("invalid image reference %q: empty repository", reference)
+	}
+	return image, nil
+}
+
+// ImagesFromValues returns the images referenced in the values of the chart, sorted by path. An image is
+// either a map holding a repository, and optionally a registry, a tag and a digest, or a reference string
+// under an `image` key.
+func ImagesFromValues(values []byte) ([]Image, error) {
+	var root map[string]interface{}
+	if err := yaml.Unmarshal(values, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse the values: %w", err)
+	}
+
+	var images []Image
+	if err := collectImages("", root, &images); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Path < images[j].Path
+	})
+	return images, nil
+}
+
+func collectImages(path string, node map[string]interface{}, images *[]Image) error {
+	for key, value := range node {
+		p := key
+		if path != "" {
+			p = path + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			repository, ok := v["repository"].(string)
+			if !ok {
+				if err := collectImages(p, v, images); err != nil {
+					return err
+				}
+				continue
+			}
+
+			image, err := ParseReference(repository)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			if registry, ok := v["registry"].(string); ok && registry != "" {
+				image.Registry = registry
+			}
+			if tag, ok := v["tag"]; ok && tag != nil {
+				image.Tag = fmt.Sprint(tag)
+			}
+			if digest, ok := v["digest"].(string); ok {
+				image.Digest = digest
+			}
+			image.Path = p
+			*images = append(*images, image)
+		case string:
+			if key != "image" || v == "" {
+				continue
+			}
+
+			image, err := ParseReference(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			image.Path = p
+			*images = append(*images, image)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/release"
+)
+
+const values = `
+image:
+  repository: cockroachdb/cockroach
+  tag: v23.2.0
+  credentials: {}
+tls:
+  selfSigner:
+    image:
+      repository: cockroachlabs-helm-charts/cockroach-self-signer-cert
+      tag: 1.5
+      registry: gcr.io
+init:
+  jobs:
+    wait:
+      image: busybox
+devAccess:
+  image: alpine/socat:1.8.0.0@sha256:abc
+`
+
+func TestParseReference(t *testing.T) {
+	testCases := []struct {
+		ref    string
+		expect release.Image
+	}{
+		{"busybox", release.Image{Registry: "docker.io", Repository: "busybox"}},
+		{"alpine/socat:1.8.0.0", release.Image{Registry: "docker.io", Repository: "alpine/socat", Tag: "1.8.0.0"}},
+		{"localhost:5000/crdb:v1@sha256:abc", release.Image{Registry: "localhost:5000", Repository: "crdb", Tag: "v1", Digest: "sha256:abc"}},
+		{"gcr.io/project/image", release.Image{Registry: "gcr.io", Repository: "project/image"}},
+	}
+
+	for _, testCase := range testCases {
+		image, err := release.ParseReference(testCase.ref)
+		require.NoError(t, err)
+		require.Equal(t, testCase.expect, image, testCase.ref)
+	}
+
+	_, err := release.ParseReference("gcr.io/:tag")
+	require.Error(t, err)
+}
+
+func TestImagesFromValues(t *testing.T) {
+	images, err := release.ImagesFromValues([]byte(values))
+	require.NoError(t, err)
+
+	require.Equal(t, []release.Image{
+		{Path: "devAccess.image", Registry: "docker.io", Repository: "alpine/socat", Tag: "1.8.0.0", Digest: "sha256:abc"},
+		{Path: "image", Registry: "docker.io", Repository: "cockroachdb/cockroach", Tag: "v23.2.0"},
+		{Path: "init.jobs.wait.image", Registry: "docker.io", Repository: "busybox"},
+		{Path: "tls.selfSigner.image", Registry: "gcr.io", Repository: "cockroachlabs-helm-charts/cockroach-self-signer-cert", Tag: "1.5"},
+	}, images)
+	require.Equal(t, "gcr.io/cockroachlabs-helm-charts/cockroach-self-signer-cert:1.5", images[3].Reference())
+}
+
+func TestSBOM(t *testing.T) {
+	images, err := release.ImagesFromValues([]byte(values))
+	require.NoError(t, err)
+
+	out, err := release.SBOM("cockroachdb", "11.2.0", images, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	require.NoError(t, err)
+
+	var bom struct {
+		BOMFormat string `json:"bomFormat"`
+		Metadata  struct {
+			Timestamp string `json:"timestamp"`
+			Component struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"component"`
+		} `json:"metadata"`
+		Components []struct {
+			Type   string `json:"type"`
+			Name   string `json:"name"`
+			PURL   string `json:"purl"`
+			Hashes []struct {
+				Alg     string `json:"alg"`
+				Content string `json:"content"`
+			} `json:"hashes"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(out, &bom))
+
+	require.Equal(t, "CycloneDX", bom.BOMFormat)
+	require.Equal(t, "2024-01-02T03:04:05Z", bom.Metadata.Timestamp)
+	require.Equal(t, "cockroachdb", bom.Metadata.Component.Name)
+	require.Equal(t, "11.2.0", bom.Metadata.Component.Version)
+	require.Len(t, bom.Components, 4)
+
+	socat := bom.Components[0]
+	require.Equal(t, "container", socat.Type)
+	require.Equal(t, "docker.io/alpine/socat", socat.Name)
+	require.Equal(t, "pkg:oci/socat@sha256:abc?repository_url=docker.io%2Falpine%2Fsocat&tag=1.8.0.0", socat.PURL)
+	require.Len(t, socat.Hashes, 1)
+	require.Equal(t, "SHA-256", socat.Hashes[0].Alg)
+	require.Equal(t, "abc", socat.Hashes[0].Content)
+
+	require.Empty(t, bom.Components[1].Hashes)
+}
+
+func TestRegistryResolver(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			require.Equal(t, "repository:project/image:pull", r.URL.Query().Get("scope"))
+			require.Equal(t, "registry", r.URL.Query().Get("service"))
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/project/image/manifests/v1":
+			require.Equal(t, http.MethodHead, r.Method)
+			require.True(t, strings.HasPrefix(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json"))
+			w.Header().Set("Docker-Content-Digest", "sha256:published")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+	resolver := release.RegistryResolver{Client: server.Client(), PlainHTTP: true}
+
+	results := release.VerifyDigests(context.Background(), resolver, []release.Image{
+		{Registry: registry, Repository: "project/image", Tag: "v1"},
+		{Registry: registry, Repository: "project/image", Tag: "v1", Digest: "sha256:published"},
+		{Registry: registry, Repository: "project/image", Tag: "v1", Digest: "sha256:stale"},
+		{Registry: registry, Repository: "project/image", Tag: "v2"},
+	})
+	require.Len(t, results, 4)
+
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "sha256:published", results[0].Digest)
+	require.NoError(t, results[1].Err)
+	require.EqualError(t, results[2].Err, "pinned digest sha256:stale doesn't match the published digest sha256:published")
+	require.ErrorContains(t, results[3].Err, "is not published")
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// valuesPathProperty is the SBOM property holding the path of an image in the values of the chart.
+const valuesPathProperty = "cockroachdb:values-path"
+
+type sbom struct {
+	BOMFormat   string          `json:"bomFormat"`
+	SpecVersion string          `json:"specVersion"`
+	Version     int             `json:"version"`
+	Metadata    sbomMetadata    `json:"metadata"`
+	Components  []sbomComponent `json:"components"`
+}
+
+type sbomMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Component sbomComponent `json:"component"`
+}
+
+type sbomComponent struct {
+	Type       string         `json:"type"`
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	PURL       string         `json:"purl,omitempty"`
+	Hashes     []sbomHash     `json:"hashes,omitempty"`
+	Properties []sbomProperty `json:"properties,omitempty"`
+}
+
+type sbomHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type sbomProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SBOM returns a CycloneDX JSON software bill of materials of the chart, listing the images referenced in
+// its values as container components.
+func SBOM(chartName, chartVersion string, images []Image, timestamp time.Time) ([]byte, error) {
+	bom := sbom{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: sbomMetadata{
+			Timestamp: timestamp.UTC().Format(time.RFC3339),
+			Component: sbomComponent{
+				Type:    "application",
+				Name:    chartName,
+				Version: chartVersion,
+			},
+		},
+		Components: []sbomComponent{},
+	}
+
+	for _, image := range images {
+		component := sbomComponent{
+			Type:       "container",
+			Name:       image.Registry + "/" + image.Repository,
+			Version:    image.Tag,
+			PURL:       imagePURL(image),
+			Properties: []sbomProperty{{Name: valuesPathProperty, Value: image.Path}},
+		}
+		if alg, content, ok := cutDigest(image.Digest); ok {
+			component.Hashes = []sbomHash{{Alg: alg, Content: content}}
+		}
+		bom.Components = append(bom.Components, component)
+	}
+
+	// The package URLs hold query strings, which must not be escaped as HTML.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(bom); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// imagePURL returns the package URL of an image, as specified by the `oci` type of the purl specification.
+func imagePURL(image Image) string {
+	purl := "pkg:oci/" + path.Base(image.Repository)
+	if image.Digest != "" {
+		purl += "@" + url.PathEscape(image.Digest)
+	}
+
+	query := url.Values{}
+	query.Set("repository_url", image.Registry+"/"+image.Repository)
+	if image.Tag != "" {
+		query.Set("tag", image.Tag)
+	}
+	return purl + "?" + query.Encode()
+}
+
+// cutDigest splits a sha256 or sha512 digest into the CycloneDX hash algorithm and content.
+func cutDigest(digest string) (string, string, bool) {
+	alg, content, found := strings.Cut(digest, ":")
+	if !found || content == "" {
+		return "", "", false
+	}
+	switch alg {
+	case "sha256":
+		return "SHA-256", content, true
+	case "sha512":
+		return "SHA-512", content, true
+	}
+	return "", "", false
+}
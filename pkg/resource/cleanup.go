@@ -18,23 +18,93 @@ package resource
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func Clean(ctx context.Context, cl client.Client, namespace string, stsName string) {
+// CleanOptions selects the resources pruned by Clean.
+type CleanOptions struct {
+	// Secrets prunes the CA, node and client secrets generated by the self-signer.
+	Secrets bool
+	// CSRs prunes the CertificateSigningRequests of the nodes and of the root client, named
+	// <namespace>.node.<statefulset>-<ordinal> and <namespace>.client.root.
+	CSRs bool
+	// StartOrdinal is the ordinal of the first node the CertificateSigningRequests are pruned for.
+	StartOrdinal int
+	// Replicas is the number of nodes the CertificateSigningRequests are pruned for.
+	Replicas int
+	// CompletedJobs prunes the completed Jobs matching JobSelector.
+	CompletedJobs bool
+	JobSelector   labels.Selector
+	// DryRun only logs the resources that would be deleted.
+	DryRun bool
+}
+
+// Clean deletes the resources selected by opts. Errors are logged, and the remaining resources are still cleaned up.
+func Clean(ctx context.Context, cl client.Client, namespace string, stsName string, opts CleanOptions) {
+	// kinds holds the kind of each object, for logging
+	var objs []client.Object
+	var kinds []string
+
+	if opts.Secrets {
+		for _, name := range CleanedSecrets(stsName) {
+			secret := &corev1.Secret{}
+			secret.SetName(name)
+			secret.SetNamespace(namespace)
+			objs, kinds = append(objs, secret), append(kinds, "secret")
+		}
+	}
+
+	if opts.CSRs {
+		for _, name := range CleanedCSRs(namespace, stsName, opts.StartOrdinal, opts.Replicas) {
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csr.SetName(name)
+			objs, kinds = append(objs, csr), append(kinds, "certificatesigningrequest")
+		}
+	}
 
-	secrets := []string{stsName + "-ca-secret", stsName + "-node-secret", stsName + "-client-secret"}
 	var failed bool
-	secret := &corev1.Secret{}
+	if opts.CompletedJobs {
+		jobs := &batchv1.JobList{}
+		if err := cl.List(ctx, jobs, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: opts.JobSelector}); err != nil {
+			logrus.Errorf("Failed to list jobs: error %s", err.Error())
+			failed = true
+		}
+
+		for i := range jobs.Items {
+			if isJobComplete(&jobs.Items[i]) {
+				objs, kinds = append(objs, &jobs.Items[i]), append(kinds, "job")
+			}
+		}
+	}
+
+	for i, obj := range objs {
+		kind := kinds[i]
+		if opts.DryRun {
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				if !errors.IsNotFound(err) {
+					logrus.Errorf("Failed to get %s %s: error %s", kind, obj.GetName(), err.Error())
+					failed = true
+				}
+				continue
+			}
 
-	for i := range secrets {
-		secret.SetName(secrets[i])
-		secret.SetNamespace(namespace)
-		if err := cl.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
-			logrus.Errorf("Failed to delete secret %s: error %s", secret.GetName(), err.Error())
+			logrus.Infof("Dry run: would delete %s %s", kind, obj.GetName())
+			continue
+		}
+
+		if err := cl.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logrus.Errorf("Failed to delete %s %s: error %s", kind, obj.GetName(), err.Error())
 			failed = true
 			// if error occurs, continue and try to clean as much as possible
 			continue
@@ -48,3 +118,101 @@ func Clean(ctx context.Context, cl client.Client, namespace string, stsName stri
 
 	logrus.Info("Successfully cleaned up dangling resources")
 }
+
+// CleanedSecrets returns the names of the secrets generated by the self-signer for the StatefulSet.
+func CleanedSecrets(stsName string) []string {
+	return []string{stsName + "-ca-secret", stsName + "-node-secret", stsName + "-client-secret",
+		stsName + "-client-ca-secret", stsName + "-node-client-secret"}
+}
+
+// CleanedCSRs returns the names of the CertificateSigningRequests of the nodes of the StatefulSet, whose ordinals
+// start at startOrdinal, and of the root client.
+func CleanedCSRs(namespace, stsName string, startOrdinal, replicas int) []string {
+	names := []string{fmt.Sprintf("%s.client.root", namespace)}
+	for i := startOrdinal; i < startOrdinal+replicas; i++ {
+		names = append(names, fmt.Sprintf("%s.node.%s-%d", namespace, stsName, i))
+	}
+
+	return names
+}
+
+// CSRCollectOptions selects the CertificateSigningRequests deleted by CollectCSRs.
+type CSRCollectOptions struct {
+	// Selector matches the CertificateSigningRequests labeled by the chart.
+	Selector labels.Selector
+	// TTL is the age after which a CertificateSigningRequest in a terminal state is deleted.
+	TTL time.Duration
+	// DryRun only logs the CertificateSigningRequests that would be deleted.
+	DryRun bool
+}
+
+// CollectCSRs deletes the CertificateSigningRequests of the release which are in a terminal state, i.e. issued, denied
+// or failed, and older than the TTL. The requests of the release are the ones matching the selector, and the ones named
+// after the nodes of the StatefulSet and the root client, left behind by the chart versions which didn't label them.
+// Errors are logged, and the remaining requests are still deleted.
+func CollectCSRs(ctx context.Context, cl client.Client, namespace, stsName string, opts CSRCollectOptions) error {
+	csrs := &certificatesv1.CertificateSigningRequestList{}
+	if err := cl.List(ctx, csrs); err != nil {
+		return fmt.Errorf("failed to list certificatesigningrequests: %w", err)
+	}
+
+	var failed int
+	for i := range csrs.Items {
+		csr := &csrs.Items[i]
+		if !isReleaseCSR(csr, namespace, stsName, opts.Selector) || !isCSRTerminal(csr) ||
+			time.Since(csr.CreationTimestamp.Time) < opts.TTL {
+			continue
+		}
+
+		if opts.DryRun {
+			logrus.Infof("Dry run: would delete certificatesigningrequest %s", csr.Name)
+			continue
+		}
+
+		if err := cl.Delete(ctx, csr); err != nil && !errors.IsNotFound(err) {
+			logrus.Errorf("Failed to delete certificatesigningrequest %s: error %s", csr.Name, err.Error())
+			failed++
+			continue
+		}
+		logrus.Infof("Deleted certificatesigningrequest %s", csr.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d certificatesigningrequests", failed)
+	}
+
+	return nil
+}
+
+func isReleaseCSR(csr *certificatesv1.CertificateSigningRequest, namespace, stsName string, selector labels.Selector) bool {
+	if selector != nil && !selector.Empty() && selector.Matches(labels.Set(csr.Labels)) {
+		return true
+	}
+
+	return csr.Name == fmt.Sprintf("%s.client.root", namespace) ||
+		strings.HasPrefix(csr.Name, fmt.Sprintf("%s.node.%s-", namespace, stsName))
+}
+
+func isCSRTerminal(csr *certificatesv1.CertificateSigningRequest) bool {
+	if len(csr.Status.Certificate) > 0 {
+		return true
+	}
+
+	for _, c := range csr.Status.Conditions {
+		if (c.Type == certificatesv1.CertificateDenied || c.Type == certificatesv1.CertificateFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isJobComplete(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobComplete && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
@@ -19,10 +19,17 @@ package resource_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/cockroachdb/helm-charts/pkg/kube"
 	"github.com/cockroachdb/helm-charts/pkg/resource"
@@ -44,7 +51,7 @@ func TestClean(t *testing.T) {
 	otherSecret := secretObj(other, namespace, nil, nil)
 	fakeClient := testutils.NewFakeClient(scheme, caSecret, nodeSecret, clientSecret, otherSecret)
 
-	resource.Clean(ctx, fakeClient, namespace, stsName)
+	resource.Clean(ctx, fakeClient, namespace, stsName, resource.CleanOptions{Secrets: true})
 
 	r := resource.NewKubeResource(ctx, fakeClient, namespace, kube.DefaultPersister)
 
@@ -59,3 +66,126 @@ func TestClean(t *testing.T) {
 	require.NoError(t, err)
 
 }
+
+func TestCleanCSRs(t *testing.T) {
+	ctx := context.TODO()
+	scheme := testutils.InitScheme(t)
+	namespace := "test-namespace"
+
+	csrs := []string{"test-namespace.client.root", "test-namespace.node.cockroachdb-0", "test-namespace.node.cockroachdb-1"}
+	other := "other-namespace.node.cockroachdb-0"
+	var objs []client.Object
+	for _, name := range append(csrs, other) {
+		objs = append(objs, &certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	fakeClient := testutils.NewFakeClient(scheme, objs...)
+
+	resource.Clean(ctx, fakeClient, namespace, "cockroachdb", resource.CleanOptions{CSRs: true, Replicas: 2})
+
+	for _, name := range csrs {
+		err := fakeClient.Get(ctx, client.ObjectKey{Name: name}, &certificatesv1.CertificateSigningRequest{})
+		assert.True(t, apierrors.IsNotFound(err))
+	}
+
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: other}, &certificatesv1.CertificateSigningRequest{}))
+}
+
+func TestCleanCompletedJobs(t *testing.T) {
+	ctx := context.TODO()
+	scheme := testutils.InitScheme(t)
+	namespace := "test-namespace"
+	selector := labels.SelectorFromSet(labels.Set{"app.kubernetes.io/instance": "crdb"})
+
+	job := func(name string, jobLabels map[string]string, complete bool) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: jobLabels}}
+		if complete {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		}
+		return job
+	}
+	release := map[string]string{"app.kubernetes.io/instance": "crdb"}
+	fakeClient := testutils.NewFakeClient(scheme,
+		job("completed", release, true),
+		job("running", release, false),
+		job("other-release", map[string]string{"app.kubernetes.io/instance": "other"}, true),
+	)
+
+	resource.Clean(ctx, fakeClient, namespace, "cockroachdb", resource.CleanOptions{CompletedJobs: true, JobSelector: selector})
+
+	err := fakeClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "completed"}, &batchv1.Job{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	for _, name := range []string{"running", "other-release"} {
+		require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &batchv1.Job{}))
+	}
+}
+
+func TestCleanDryRun(t *testing.T) {
+	ctx := context.TODO()
+	scheme := testutils.InitScheme(t)
+	namespace := "test-namespace"
+	ca := "cockroachdb-ca-secret"
+	csr := "test-namespace.client.root"
+	fakeClient := testutils.NewFakeClient(scheme,
+		secretObj(ca, namespace, nil, nil),
+		&certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: csr}},
+	)
+
+	resource.Clean(ctx, fakeClient, namespace, "cockroachdb", resource.CleanOptions{Secrets: true, CSRs: true, DryRun: true})
+
+	// nothing is deleted
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ca}, &corev1.Secret{}))
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: csr}, &certificatesv1.CertificateSigningRequest{}))
+}
+
+func TestCleanedCSRs(t *testing.T) {
+	require.Equal(t, []string{"ns.client.root", "ns.node.crdb-0", "ns.node.crdb-1", "ns.node.crdb-2"},
+		resource.CleanedCSRs("ns", "crdb", 0, 3))
+	require.Equal(t, []string{"ns.client.root", "ns.node.crdb-5", "ns.node.crdb-6", "ns.node.crdb-7"},
+		resource.CleanedCSRs("ns", "crdb", 5, 3))
+}
+
+func TestCollectCSRs(t *testing.T) {
+	ctx := context.TODO()
+	scheme := testutils.InitScheme(t)
+	selector := labels.SelectorFromSet(labels.Set{"app.kubernetes.io/instance": "crdb"})
+	release := map[string]string{"app.kubernetes.io/instance": "crdb"}
+
+	csr := func(name string, csrLabels map[string]string, age time.Duration, status certificatesv1.CertificateSigningRequestStatus) *certificatesv1.CertificateSigningRequest {
+		return &certificatesv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: csrLabels, CreationTimestamp: metav1.NewTime(time.Now().Add(-age))},
+			Status:     status,
+		}
+	}
+	issued := certificatesv1.CertificateSigningRequestStatus{Certificate: []byte("cert")}
+	denied := certificatesv1.CertificateSigningRequestStatus{Conditions: []certificatesv1.CertificateSigningRequestCondition{
+		{Type: certificatesv1.CertificateDenied, Status: corev1.ConditionTrue},
+	}}
+	pending := certificatesv1.CertificateSigningRequestStatus{}
+
+	fakeClient := testutils.NewFakeClient(scheme,
+		csr("test-namespace.node.cockroachdb-0", nil, 48*time.Hour, issued),
+		csr("test-namespace.client.root", nil, 48*time.Hour, denied),
+		csr("labeled", release, 48*time.Hour, issued),
+		csr("recent", release, time.Hour, issued),
+		csr("pending", release, 48*time.Hour, pending),
+		csr("other-namespace.node.cockroachdb-0", nil, 48*time.Hour, issued),
+		csr("other-release", map[string]string{"app.kubernetes.io/instance": "other"}, 48*time.Hour, issued),
+	)
+
+	opts := resource.CSRCollectOptions{Selector: selector, TTL: 24 * time.Hour, DryRun: true}
+	require.NoError(t, resource.CollectCSRs(ctx, fakeClient, "test-namespace", "cockroachdb", opts))
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "labeled"}, &certificatesv1.CertificateSigningRequest{}))
+
+	opts.DryRun = false
+	require.NoError(t, resource.CollectCSRs(ctx, fakeClient, "test-namespace", "cockroachdb", opts))
+
+	for _, name := range []string{"test-namespace.node.cockroachdb-0", "test-namespace.client.root", "labeled"} {
+		err := fakeClient.Get(ctx, client.ObjectKey{Name: name}, &certificatesv1.CertificateSigningRequest{})
+		assert.True(t, apierrors.IsNotFound(err), name)
+	}
+
+	for _, name := range []string{"recent", "pending", "other-namespace.node.cockroachdb-0", "other-release"} {
+		require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: name}, &certificatesv1.CertificateSigningRequest{}))
+	}
+}
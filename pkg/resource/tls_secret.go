@@ -28,6 +28,7 @@ import (
 
 const (
 	CaCert         = "ca.crt"
+	ClientCaCert   = "ca-client.crt"
 	CaKey          = "ca.key"
 	CertValidFrom  = "certificate-valid-from"
 	CertValidUpto  = "certificate-valid-upto"
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/vault"
+)
+
+// NewVaultResource returns a resource storing Secrets in the KV version 2 engine of Vault mounted at mount, each
+// Secret under <basePath>/<name>.
+func NewVaultResource(ctx context.Context, c *vault.Client, mount, basePath string) Resource {
+	store := &VaultStore{
+		ctx:      ctx,
+		client:   c,
+		mount:    mount,
+		basePath: basePath,
+	}
+
+	return Resource{
+		Fetcher:   store,
+		Persister: store,
+	}
+}
+
+// VaultStore fetches and persists the data and annotations of Secrets in Vault.
+type VaultStore struct {
+	ctx      context.Context
+	client   *vault.Client
+	mount    string
+	basePath string
+}
+
+// vaultSecret is the representation of a Secret stored in Vault.
+type vaultSecret struct {
+	Data        map[string][]byte `json:"data"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// Fetch reads the Secret from Vault, returning a NotFound error when it doesn't exist.
+func (s *VaultStore) Fetch(obj client.Object) error {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return fmt.Errorf("only Secrets can be stored in vault, got %T", obj)
+	}
+
+	var stored vaultSecret
+	if err := s.client.ReadKV(s.ctx, s.mount, s.path(secret.Name), &stored); err != nil {
+		if errors.Is(err, vault.ErrNotFound) {
+			return apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, secret.Name)
+		}
+		return err
+	}
+
+	secret.Data = stored.Data
+	secret.Annotations = stored.Annotations
+
+	return nil
+}
+
+// Persist applies the mutation function to the Secret and writes it to Vault.
+func (s *VaultStore) Persist(obj client.Object, mutateFn func() error) (upserted bool, err error) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return false, fmt.Errorf("only Secrets can be stored in vault, got %T", obj)
+	}
+
+	if err := mutateFn(); err != nil {
+		return false, err
+	}
+
+	stored := vaultSecret{
+		Data:        secret.Data,
+		Annotations: secret.Annotations,
+	}
+	if err := s.client.WriteKV(s.ctx, s.mount, s.path(secret.Name), stored); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *VaultStore) path(name string) string {
+	return path.Join(s.basePath, name)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/cockroachdb/helm-charts/pkg/resource"
+	"github.com/cockroachdb/helm-charts/pkg/vault"
+)
+
+// newKVServer returns a server mimicking the KV version 2 engine of Vault.
+func newKVServer(t *testing.T) *httptest.Server {
+	store := map[string]json.RawMessage{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var body struct {
+				Data json.RawMessage `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			store[r.URL.Path] = body.Data
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			data, ok := store[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		}
+	}))
+}
+
+func TestVaultResource(t *testing.T) {
+	ctx := context.TODO()
+	server := newKVServer(t)
+	defer server.Close()
+
+	c, err := vault.NewClient(server.URL, "", "")
+	require.NoError(t, err)
+	r := resource.NewVaultResource(ctx, c, "secret", "crdb/cockroachdb")
+
+	_, err = resource.LoadTLSSecret("cockroachdb-ca-secret", r)
+	require.True(t, apierrors.IsNotFound(err))
+
+	secret := resource.CreateTLSSecret("cockroachdb-ca-secret", corev1.SecretTypeOpaque, r)
+	annotations := resource.GetSecretAnnotations("2021-01-01T00:00:00Z", "2026-01-01T00:00:00Z", "43800h0m0s")
+	require.NoError(t, secret.UpdateCASecret([]byte("key"), []byte("cert"), annotations))
+
+	secret, err = resource.LoadTLSSecret("cockroachdb-ca-secret", r)
+	require.NoError(t, err)
+	require.True(t, secret.ReadyCA())
+	require.True(t, secret.ValidateAnnotations())
+	require.Equal(t, []byte("cert"), secret.CA())
+	require.Equal(t, []byte("key"), secret.CAKey())
+}
@@ -36,6 +36,7 @@ const (
 	KeyFileMode  = 0600
 	CertFileMode = 0644
 	RootUser     = "root"
+	NodeUser     = "node"
 )
 
 // PemUsage indicates the purpose of a given certificate.
@@ -65,11 +66,12 @@ const (
 
 // The following constants are used to run the crdb binary
 const (
-	CR            string = "cockroach"
-	CERT          string = "cert"
-	CREATE_CA     string = "create-ca"
-	CREATE_NODE   string = "create-node"
-	CREATE_CLIENT string = "create-client"
+	CR               string = "cockroach"
+	CERT             string = "cert"
+	CREATE_CA        string = "create-ca"
+	CREATE_CLIENT_CA string = "create-client-ca"
+	CREATE_NODE      string = "create-node"
+	CREATE_CLIENT    string = "create-client"
 
 	CERTS_DIR  string = "--certs-dir=%s"
 	CA_KEY     string = "--ca-key=%s"
@@ -88,6 +90,18 @@ func CreateCAPair(
 	return createCACertAndKey(certsDir, caKeyPath, CAPem, keySize, lifetime, allowKeyReuse, overwrite)
 }
 
+// CreateClientCAPair creates a CA certificate and associated key used to sign client certificates only.
+// The certificate is written to ca-client.crt in the certs directory.
+func CreateClientCAPair(
+	certsDir, caKeyPath string,
+	keySize int,
+	lifetime time.Duration,
+	allowKeyReuse bool,
+	overwrite bool,
+) error {
+	return createCACertAndKey(certsDir, caKeyPath, ClientCAPem, keySize, lifetime, allowKeyReuse, overwrite)
+}
+
 // createCACertAndKey creates a CA key and a CA certificate.
 // If the certs directory does not exist, it is created.
 // If the key does not exist, it is created.
@@ -105,15 +119,22 @@ func createCACertAndKey(certsDir, caKeyPath string, caType PemUsage, keySize int
 	if len(certsDir) == 0 {
 		return errors.New("the path to the certs directory is required")
 	}
-	if caType != CAPem {
-		return fmt.Errorf("caType argument to createCACertAndKey must be CAPem (%d), got: %d", CAPem, caType)
+	var command string
+	switch caType {
+	case CAPem:
+		command = CREATE_CA
+	case ClientCAPem:
+		command = CREATE_CLIENT_CA
+	default:
+		return fmt.Errorf("caType argument to createCACertAndKey must be CAPem (%d) or ClientCAPem (%d), got: %d",
+			CAPem, ClientCAPem, caType)
 	}
 
 	certsDirParam := fmt.Sprintf(CERTS_DIR, certsDir)
 	caKeyParam := fmt.Sprintf(CA_KEY, caKeyPath)
 	lifetimeParam := fmt.Sprintf(Life_Time, lifetime.String())
 
-	args := []string{CREATE_CA, certsDirParam, caKeyParam, lifetimeParam}
+	args := []string{command, certsDirParam, caKeyParam, lifetimeParam}
 
 	if overwrite {
 		args = append(args, OVER_WRITE)
@@ -199,3 +220,50 @@ func GetCertObj(pemCert []byte) (*x509.Certificate, error) {
 
 	return cert, nil
 }
+
+// GetCertObjs decodes all the certificates of a PEM bundle, preserving their order.
+func GetCertObjs(pemCerts []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemCerts = pem.Decode(pemCerts)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("failed to decode certificate")
+	}
+
+	return certs, nil
+}
+
+// EncodeCertObj encodes the certificate in PEM format.
+func EncodeCertObj(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// IsSignedBy checks if the first certificate of pemCert is signed by the first CA certificate of pemCA.
+func IsSignedBy(pemCert, pemCA []byte) (bool, error) {
+	cert, err := GetCertObj(pemCert)
+	if err != nil {
+		return false, err
+	}
+
+	ca, err := GetCertObj(pemCA)
+	if err != nil {
+		return false, err
+	}
+
+	return cert.CheckSignatureFrom(ca) == nil, nil
+}
@@ -161,6 +161,108 @@ func TestCreateClientPair(t *testing.T) {
 	}
 }
 
+func TestCreateClientCAPair(t *testing.T) {
+	certsDir, cleanup := tempDir(t)
+	defer cleanup()
+	ca := filepath.Join(certsDir, "ca.key")
+	clientCA := filepath.Join(certsDir, "ca-client.key")
+
+	err := security.CreateCAPair(certsDir, ca, defaultKeySize, defaultCALifetime, true, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = security.CreateClientCAPair(certsDir, clientCA, defaultKeySize, defaultCALifetime, true, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !fileExists(filepath.Join(certsDir, "ca-client.crt")) {
+		t.Fail()
+	}
+
+	if !fileExists(clientCA) {
+		t.Fail()
+	}
+
+	// the client certificate is signed by the client CA instead of the CA
+	err = security.CreateClientPair(certsDir, clientCA, defaultKeySize, defaultCertLifetime, true,
+		security.SQLUsername{U: security.NodeUser}, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	pemCert, err := os.ReadFile(filepath.Join(certsDir, "client.node.crt"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	pemClientCA, err := os.ReadFile(filepath.Join(certsDir, "ca-client.crt"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	pemCA, err := os.ReadFile(filepath.Join(certsDir, "ca.crt"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	signed, err := security.IsSignedBy(pemCert, pemClientCA)
+	assert.NoError(t, err)
+	assert.True(t, signed)
+
+	signed, err = security.IsSignedBy(pemCert, pemCA)
+	assert.NoError(t, err)
+	assert.False(t, signed)
+}
+
+func TestCACertBundle(t *testing.T) {
+	certsDir, cleanup := tempDir(t)
+	defer cleanup()
+	oldCA := filepath.Join(certsDir, "ca-old.key")
+	newCA := filepath.Join(certsDir, "ca-new.key")
+
+	err := security.CreateCAPair(certsDir, oldCA, defaultKeySize, defaultCALifetime, true, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// creating a new CA in the same certs directory bundles the new CA cert with the old one
+	err = security.CreateCAPair(certsDir, newCA, defaultKeySize, defaultCALifetime, true, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	pemCA, err := os.ReadFile(filepath.Join(certsDir, "ca.crt"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	caCerts, err := security.GetCertObjs(pemCA)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Len(t, caCerts, 2)
+
+	err = security.CreateNodePair(certsDir, newCA, defaultKeySize, defaultCertLifetime, true, []string{"localhost"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	pemCert, err := os.ReadFile(filepath.Join(certsDir, "node.crt"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	signed, err := security.IsSignedBy(pemCert, pemCA)
+	assert.NoError(t, err)
+	assert.True(t, signed)
+
+	signed, err = security.IsSignedBy(pemCert, security.EncodeCertObj(caCerts[1]))
+	assert.NoError(t, err)
+	assert.False(t, signed)
+}
+
 // fileExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
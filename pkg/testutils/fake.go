@@ -175,8 +175,8 @@ func (c *FakeClient) Get(ctx context.Context, key client.ObjectKey, obj client.O
 	return c.client.Get(ctx, key, obj)
 }
 
-func (c *FakeClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
-	panic("implement me")
+func (c *FakeClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.client.List(ctx, list, opts...)
 }
 
 func (c *FakeClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
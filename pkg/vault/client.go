@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ServiceAccountTokenPath is the path of the ServiceAccount token used to log in with the Kubernetes auth method.
+const ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// ErrNotFound is returned when the requested secret doesn't exist in Vault.
+var ErrNotFound = errors.New("secret not found in vault")
+
+// Client is a minimal client of the Vault HTTP API, covering the Kubernetes auth method and the KV version 2 secrets
+// engine.
+type Client struct {
+	Address   string
+	Token     string
+	Namespace string
+
+	httpClient *http.Client
+}
+
+// NewClient creates a Vault client. The CA certificate file is used to verify the Vault server when not empty.
+func NewClient(address, namespace, caCertFile string) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caCertFile != "" {
+		caCert, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the vault CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %s", caCertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &Client{
+		Address:    strings.TrimSuffix(address, "/"),
+		Namespace:  namespace,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// LoginKubernetes logs in with the Kubernetes auth method mounted at authMount, using the given ServiceAccount token,
+// and sets the token of the client.
+func (c *Client) LoginKubernetes(ctx context.Context, authMount, role, jwt string) error {
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+
+	body := map[string]string{"role": role, "jwt": jwt}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("auth/%s/login", authMount), body, &resp); err != nil {
+		return fmt.Errorf("failed to log in to vault: %w", err)
+	}
+
+	if resp.Auth.ClientToken == "" {
+		return errors.New("failed to log in to vault: no client token returned")
+	}
+	c.Token = resp.Auth.ClientToken
+
+	return nil
+}
+
+// ReadKV reads the data of the secret at the path of the KV version 2 engine mounted at mount into out.
+func (c *Client) ReadKV(ctx context.Context, mount, path string, out interface{}) error {
+	var resp struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+
+	if err := c.do(ctx, http.MethodGet, kvPath(mount, path), nil, &resp); err != nil {
+		return err
+	}
+
+	if len(resp.Data.Data) == 0 || string(resp.Data.Data) == "null" {
+		return ErrNotFound
+	}
+
+	return json.Unmarshal(resp.Data.Data, out)
+}
+
+// WriteKV writes data as a new version of the secret at the path of the KV version 2 engine mounted at mount.
+func (c *Client) WriteKV(ctx context.Context, mount, path string, data interface{}) error {
+	return c.do(ctx, http.MethodPost, kvPath(mount, path), map[string]interface{}{"data": data}, nil)
+}
+
+func kvPath(mount, path string) string {
+	return fmt.Sprintf("%s/data/%s", strings.Trim(mount, "/"), strings.Trim(path, "/"))
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/v1/%s", c.Address, path), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("X-Vault-Token", c.Token)
+	}
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("vault returned status %d for %s %s: %s", resp.StatusCode, method, path, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/vault"
+)
+
+type caData struct {
+	Cert string `json:"cert"`
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	store := map[string]json.RawMessage{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/auth/kubernetes/login":
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			if body["role"] != "crdb" || body["jwt"] != "sa-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.token"}}`))
+		case r.Header.Get("X-Vault-Token") != "s.token":
+			w.WriteHeader(http.StatusForbidden)
+		case r.Method == http.MethodPost:
+			var body struct {
+				Data json.RawMessage `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			store[r.URL.Path] = body.Data
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet:
+			data, ok := store[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		}
+	}))
+	defer server.Close()
+
+	c, err := vault.NewClient(server.URL+"/", "", "")
+	require.NoError(t, err)
+
+	require.Error(t, c.LoginKubernetes(ctx, "kubernetes", "other", "sa-token"))
+	require.NoError(t, c.LoginKubernetes(ctx, "kubernetes", "crdb", "sa-token"))
+	require.Equal(t, "s.token", c.Token)
+
+	var out caData
+	require.ErrorIs(t, c.ReadKV(ctx, "secret", "crdb/ca", &out), vault.ErrNotFound)
+
+	require.NoError(t, c.WriteKV(ctx, "secret", "/crdb/ca/", caData{Cert: "pem"}))
+	require.Contains(t, store, "/v1/secret/data/crdb/ca")
+
+	require.NoError(t, c.ReadKV(ctx, "secret", "crdb/ca", &out))
+	require.Equal(t, "pem", out.Cert)
+}
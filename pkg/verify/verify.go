@@ -0,0 +1,182 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FieldOwner is the field manager of the server-side dry-run applies.
+const FieldOwner = "chart-verify"
+
+// Reasons of the dry-run failures.
+const (
+	ReasonPodSecurity   = "PodSecurity"
+	ReasonResourceQuota = "ResourceQuota"
+	ReasonLimitRange    = "LimitRange"
+	ReasonWebhook       = "AdmissionWebhook"
+	ReasonMissingAPI    = "MissingAPI"
+	ReasonForbidden     = "Forbidden"
+	ReasonInvalid       = "Invalid"
+)
+
+// Result is the outcome of the dry-run apply of a rendered object.
+type Result struct {
+	Object   string
+	Err      error
+	Reason   string
+	Warnings []string
+}
+
+// Failed returns whether the object was rejected by the kube-apiserver.
+func (r Result) Failed() bool {
+	return r.Err != nil
+}
+
+// ParseManifests parses the YAML documents of rendered manifests, skipping the empty ones.
+func ParseManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, fmt.Errorf("failed to parse the manifests: %w", err)
+		}
+
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "" {
+			return nil, fmt.Errorf("manifest of %q has no kind", obj.GetName())
+		}
+
+		objs = append(objs, obj)
+	}
+}
+
+// Classify returns the reason of a dry-run failure from the error message of the kube-apiserver.
+func Classify(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "violates PodSecurity"):
+		return ReasonPodSecurity
+	case strings.Contains(msg, "exceeded quota"), strings.Contains(msg, "must specify limits"),
+		strings.Contains(msg, "must specify requests"):
+		return ReasonResourceQuota
+	case strings.Contains(msg, "maximum cpu usage"), strings.Contains(msg, "maximum memory usage"),
+		strings.Contains(msg, "minimum cpu usage"), strings.Contains(msg, "minimum memory usage"):
+		return ReasonLimitRange
+	case strings.Contains(msg, "admission webhook"):
+		return ReasonWebhook
+	case meta.IsNoMatchError(err), strings.Contains(msg, "no matches for kind"):
+		return ReasonMissingAPI
+	case strings.Contains(msg, "forbidden"):
+		return ReasonForbidden
+	default:
+		return ReasonInvalid
+	}
+}
+
+// WarningRecorder records the warnings returned by the kube-apiserver, such as the ones of the Pod Security Admission
+// in warn mode. It is meant to be set as the WarningHandler of the rest config of the client.
+type WarningRecorder struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// HandleWarningHeader records a warning.
+func (w *WarningRecorder) HandleWarningHeader(code int, agent string, text string) {
+	if code != 299 || text == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, text)
+}
+
+// Flush returns the warnings recorded since the last flush.
+func (w *WarningRecorder) Flush() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	warnings := w.warnings
+	w.warnings = nil
+	return warnings
+}
+
+// DryRun applies the objects with a server-side dry run one by one, so that all the admission failures are reported
+// rather than the first one. Namespaced objects without a namespace are applied in the given namespace.
+func DryRun(ctx context.Context, cl client.Client, warnings *WarningRecorder, namespace string,
+	objs []*unstructured.Unstructured) []Result {
+
+	results := make([]Result, 0, len(objs))
+	for _, obj := range objs {
+		result := Result{Object: fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())}
+
+		if err := setNamespace(cl, obj, namespace); err != nil {
+			result.Err = err
+		} else {
+			result.Err = cl.Patch(ctx, obj, client.Apply, client.DryRunAll, client.ForceOwnership,
+				client.FieldOwner(FieldOwner))
+		}
+		result.Reason = Classify(result.Err)
+		if warnings != nil {
+			result.Warnings = warnings.Flush()
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func setNamespace(cl client.Client, obj *unstructured.Unstructured, namespace string) error {
+	if obj.GetNamespace() != "" {
+		return nil
+	}
+
+	gvk := obj.GroupVersionKind()
+	mapping, err := cl.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		obj.SetNamespace(namespace)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verify_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cockroachdb/helm-charts/pkg/verify"
+)
+
+const manifests = `---
+# Source: cockroachdb/templates/serviceaccount.yaml
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: crdb-cockroachdb
+---
+# Source: cockroachdb/templates/empty.yaml
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: crdb-cockroachdb
+  namespace: crdb
+`
+
+func TestParseManifests(t *testing.T) {
+	objs, err := verify.ParseManifests(strings.NewReader(manifests))
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+	require.Equal(t, "ServiceAccount", objs[0].GetKind())
+	require.Equal(t, "", objs[0].GetNamespace())
+	require.Equal(t, "StatefulSet", objs[1].GetKind())
+	require.Equal(t, "crdb", objs[1].GetNamespace())
+
+	_, err = verify.ParseManifests(strings.NewReader("metadata:\n  name: crdb\n"))
+	require.Error(t, err)
+}
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		msg    string
+		reason string
+	}{
+		{`pods "crdb-0" is forbidden: violates PodSecurity "restricted:latest": runAsNonRoot != true`, verify.ReasonPodSecurity},
+		{`pods "crdb-0" is forbidden: exceeded quota: compute, requested: cpu=4, used: cpu=0, limited: cpu=2`, verify.ReasonResourceQuota},
+		{`pods "crdb-0" is forbidden: maximum memory usage per Container is 1Gi, but limit is 8Gi`, verify.ReasonLimitRange},
+		{`admission webhook "validate.kyverno.svc-fail" denied the request: policy require-labels`, verify.ReasonWebhook},
+		{`no matches for kind "ServiceMonitor" in version "monitoring.coreos.com/v1"`, verify.ReasonMissingAPI},
+		{`roles.rbac.authorization.k8s.io "crdb" is forbidden: user cannot escalate`, verify.ReasonForbidden},
+		{`StatefulSet.apps "crdb" is invalid: spec.replicas: Invalid value: -1`, verify.ReasonInvalid},
+	}
+
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.reason, verify.Classify(errors.New(testCase.msg)), testCase.msg)
+	}
+	require.Equal(t, "", verify.Classify(nil))
+}
+
+func TestWarningRecorder(t *testing.T) {
+	var recorder verify.WarningRecorder
+	recorder.HandleWarningHeader(299, "", `would violate PodSecurity "restricted:latest"`)
+	recorder.HandleWarningHeader(199, "", "miscellaneous")
+
+	require.Equal(t, []string{`would violate PodSecurity "restricted:latest"`}, recorder.Flush())
+	require.Empty(t, recorder.Flush())
+}
@@ -0,0 +1,149 @@
+package compat
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cockroachdb/helm-charts/pkg/e2e"
+	"github.com/cockroachdb/helm-charts/tests/testutil"
+)
+
+var (
+	cfg              = ctrl.GetConfigOrDie()
+	k8sClient, _     = client.New(cfg, client.Options{})
+	releaseName      = "crdb-test"
+	helmChartPath, _ = filepath.Abs("../../../cockroachdb")
+)
+
+// TestCockroachDbHelmCompatibility installs the chart with its default values and checks the behaviors depending on
+// the Kubernetes version of the cluster. It is meant to be run against each version of the support matrix, see
+// `e2e-runner --matrix`.
+func TestCockroachDbHelmCompatibility(t *testing.T) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	require.NoError(t, err)
+
+	serverVersion, err := discoveryClient.ServerVersion()
+	require.NoError(t, err)
+	supported, err := e2e.IsSupportedVersion(serverVersion.GitVersion)
+	require.NoError(t, err)
+	require.True(t, supported, "Kubernetes %s is not in the support matrix of the chart", serverVersion.GitVersion)
+
+	namespaceName := "cockroach" + strings.ToLower(random.UniqueId())
+	kubectlOptions := k8s.NewKubectlOptions("", "", namespaceName)
+
+	crdbCluster := testutil.CockroachCluster{
+		Cfg:              cfg,
+		K8sClient:        k8sClient,
+		StatefulSetName:  fmt.Sprintf("%s-cockroachdb", releaseName),
+		Namespace:        namespaceName,
+		ClientSecret:     fmt.Sprintf("%s-cockroachdb-client-secret", releaseName),
+		NodeSecret:       fmt.Sprintf("%s-cockroachdb-node-secret", releaseName),
+		CaSecret:         fmt.Sprintf("%s-cockroachdb-ca-secret", releaseName),
+		IsCaUserProvided: false,
+	}
+
+	k8s.CreateNamespace(t, kubectlOptions, namespaceName)
+	// ... and make sure to delete the namespace at the end of the test
+	defer k8s.DeleteNamespace(t, kubectlOptions, namespaceName)
+
+	options := &helm.Options{
+		KubectlOptions: kubectlOptions,
+		SetValues: map[string]string{
+			// Override the persistent storage size to 1Gi so that we do not run out of space.
+			"storage.persistentVolume.size": "1Gi",
+		},
+	}
+
+	helm.Install(t, options, helmChartPath, releaseName)
+	defer func() {
+		err := helm.DeleteE(t, options, releaseName, true)
+		// Ignore the error if the operation timed out.
+		if err != nil && !strings.Contains(err.Error(), "timed out") {
+			require.NoError(t, err)
+		}
+	}()
+
+	// Print the debug logs in case of test failure.
+	defer func() {
+		if t.Failed() {
+			testutil.PrintDebugLogs(t, kubectlOptions)
+		}
+	}()
+
+	testutil.RequireClusterToBeReadyEventuallyTimeout(t, crdbCluster, 600*time.Second)
+
+	ctx := context.Background()
+
+	t.Run("CronJob API version", func(t *testing.T) {
+		servesBatchV1, err := servesResource(discoveryClient, batchv1.SchemeGroupVersion.String(), "cronjobs")
+		require.NoError(t, err)
+
+		for _, name := range []string{
+			fmt.Sprintf("%s-cockroachdb-rotate-self-signer", releaseName),
+			fmt.Sprintf("%s-cockroachdb-rotate-self-signer-client", releaseName),
+		} {
+			key := types.NamespacedName{Namespace: namespaceName, Name: name}
+			if servesBatchV1 {
+				require.NoError(t, k8sClient.Get(ctx, key, &batchv1.CronJob{}), name)
+			} else {
+				require.NoError(t, k8sClient.Get(ctx, key, &batchv1beta1.CronJob{}), name)
+			}
+		}
+	})
+
+	t.Run("PodDisruptionBudget API version", func(t *testing.T) {
+		servesPolicyV1, err := servesResource(discoveryClient, policyv1.SchemeGroupVersion.String(), "poddisruptionbudgets")
+		require.NoError(t, err)
+		// policy/v1 is served by every version of the support matrix.
+		require.True(t, servesPolicyV1)
+
+		key := types.NamespacedName{Namespace: namespaceName, Name: fmt.Sprintf("%s-cockroachdb-budget", releaseName)}
+		require.NoError(t, k8sClient.Get(ctx, key, &policyv1.PodDisruptionBudget{}))
+	})
+
+	t.Run("certificate file modes", func(t *testing.T) {
+		// The copy-certs init container makes the keys copied from the Secrets readable by their owner only, which
+		// cockroach requires.
+		output, err := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, "exec",
+			fmt.Sprintf("%s-0", crdbCluster.StatefulSetName), "-c", "db", "--",
+			"stat", "-c", "%a", "/cockroach/cockroach-certs/node.key")
+		require.NoError(t, err)
+		require.Equal(t, "400", strings.TrimSpace(output))
+	})
+}
+
+// servesResource returns whether the API server serves the given resource in the given group version.
+func servesResource(discoveryClient discovery.DiscoveryInterface, groupVersion, resource string) (bool, error) {
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		if strings.Contains(err.Error(), "the server could not find the requested resource") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, r := range resources.APIResources {
+		if r.Name == resource {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,109 @@
+package integration
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cockroachdb/helm-charts/pkg/deploy"
+	"github.com/cockroachdb/helm-charts/tests/testutil"
+)
+
+// gkeAutopilotEnv is set to true by `make test/e2e-gke-autopilot` when the current kubectl context is a GKE Autopilot
+// cluster.
+const gkeAutopilotEnv = "E2E_GKE_AUTOPILOT"
+
+// TestCockroachDbHelmInstallGKEAutopilot installs the chart with gkeAutopilot.enabled on a GKE Autopilot cluster, and
+// checks that Autopilot admits the Pods with the resources of the chart instead of its own defaults, and that the
+// cluster gets ready and serves SQL.
+func TestCockroachDbHelmInstallGKEAutopilot(t *testing.T) {
+	if os.Getenv(gkeAutopilotEnv) != "true" {
+		t.Skipf("only run against GKE Autopilot clusters, set %s to true", gkeAutopilotEnv)
+	}
+
+	namespaceName := "cockroach" + strings.ToLower(random.UniqueId())
+	kubectlOptions := k8s.NewKubectlOptions("", "", namespaceName)
+
+	crdbCluster := testutil.CockroachCluster{
+		Cfg:              cfg,
+		K8sClient:        k8sClient,
+		StatefulSetName:  fmt.Sprintf("%s-cockroachdb", releaseName),
+		Namespace:        namespaceName,
+		ClientSecret:     fmt.Sprintf("%s-cockroachdb-client-secret", releaseName),
+		NodeSecret:       fmt.Sprintf("%s-cockroachdb-node-secret", releaseName),
+		CaSecret:         fmt.Sprintf("%s-cockroachdb-ca-secret", releaseName),
+		IsCaUserProvided: false,
+	}
+
+	k8s.CreateNamespace(t, kubectlOptions, namespaceName)
+	// ... and make sure to delete the namespace at the end of the test
+	defer k8s.DeleteNamespace(t, kubectlOptions, namespaceName)
+
+	// The host mounts Autopilot rejects are dropped by the chart.
+	options := helmOptions(t, namespaceName, deploy.Options{
+		ClusterName: "test",
+		Values: map[string]string{
+			"gkeAutopilot.enabled":                   "true",
+			"gkeAutopilot.resources.requests.cpu":    "1",
+			"gkeAutopilot.resources.requests.memory": "4Gi",
+			"gkeAutopilot.resources.limits.cpu":      "1",
+			"gkeAutopilot.resources.limits.memory":   "4Gi",
+			"timezone.mountHostTzdata":               "true",
+			"init.network.hostNetwork":               "true",
+		},
+	})
+
+	// Deploy the cockroachdb helm chart and checks installation should succeed.
+	helm.Install(t, options, helmChartPath, releaseName)
+	defer cleanupResources(
+		t,
+		releaseName,
+		kubectlOptions,
+		options,
+		[]string{
+			crdbCluster.CaSecret,
+			crdbCluster.ClientSecret,
+			crdbCluster.NodeSecret,
+		},
+	)
+
+	// Print the debug logs in case of test failure.
+	defer func() {
+		if t.Failed() {
+			testutil.PrintDebugLogs(t, kubectlOptions)
+		}
+	}()
+
+	// Autopilot provisions the nodes of the Pods on demand.
+	testutil.RequireClusterToBeReadyEventuallyTimeout(t, crdbCluster, 1200*time.Second)
+	time.Sleep(20 * time.Second)
+	testutil.RequireCRDBToFunction(t, crdbCluster, false)
+
+	// Autopilot replaces the resources of the containers outside of its constraints, which would make the defaults of
+	// the chart pointless.
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/name=cockroachdb,app.kubernetes.io/instance=%s", releaseName),
+	})
+	require.Len(t, pods, 3)
+	for _, pod := range pods {
+		for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+			requests := container.Resources.Requests
+			switch container.Name {
+			case "copy-certs":
+				require.Equal(t, "50m", requests.Cpu().String(), pod.Name)
+				require.Equal(t, "64Mi", requests.Memory().String(), pod.Name)
+			default:
+				require.Equal(t, "1", requests.Cpu().String(), pod.Name)
+				require.Equal(t, "4Gi", requests.Memory().String(), pod.Name)
+			}
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -22,6 +21,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/cockroachdb/helm-charts/pkg/deploy"
 	"github.com/cockroachdb/helm-charts/pkg/security"
 	util "github.com/cockroachdb/helm-charts/pkg/utils"
 	"github.com/cockroachdb/helm-charts/tests/testutil"
@@ -57,15 +57,14 @@ func TestCockroachDbHelmInstall(t *testing.T) {
 	const testDBName = "testdb"
 
 	// Setup the args. For this test, we will set the following input values:
-	options := &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues: patchHelmValues(map[string]string{
-			"conf.cluster-name":                        "test",
+	options := helmOptions(t, namespaceName, deploy.Options{
+		ClusterName: "test",
+		Values: map[string]string{
 			"init.provisioning.enabled":                "true",
 			"init.provisioning.databases[0].name":      testDBName,
 			"init.provisioning.databases[0].owners[0]": "root",
-		}),
-	}
+		},
+	})
 
 	// Deploy the cockroachdb helm chart and checks installation should succeed.
 	helm.Install(t, options, helmChartPath, releaseName)
@@ -143,13 +142,9 @@ func TestCockroachDbHelmInstallWithCAProvided(t *testing.T) {
 	defer shell.RunCommand(t, cmd)
 
 	// Setup the args. For this test, we will set the following input values:
-	options := &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues: patchHelmValues(map[string]string{
-			"tls.certs.selfSigner.caProvided": "true",
-			"tls.certs.selfSigner.caSecret":   customCASecret,
-		}),
-	}
+	options := helmOptions(t, namespaceName, deploy.Options{
+		TLS: deploy.TLS{Mode: deploy.TLSSelfSignerProvidedCA, CASecret: customCASecret},
+	})
 
 	// Deploy the cockroachdb helm chart and checks installation should succeed.
 	helm.Install(t, options, helmChartPath, releaseName)
@@ -270,15 +265,13 @@ func TestCockroachDbHelmMigration(t *testing.T) {
 	require.NoError(t, err)
 
 	// Setup the args
-	options := &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues: patchHelmValues(map[string]string{
-			"tls.certs.provided":           "true",
-			"tls.certs.selfSigner.enabled": "false",
-			"tls.certs.clientRootSecret":   crdbCluster.ClientSecret,
-			"tls.certs.nodeSecret":         crdbCluster.NodeSecret,
-		}),
-	}
+	options := helmOptions(t, namespaceName, deploy.Options{
+		TLS: deploy.TLS{
+			Mode:             deploy.TLSProvided,
+			NodeSecret:       crdbCluster.NodeSecret,
+			ClientRootSecret: crdbCluster.ClientSecret,
+		},
+	})
 
 	// Deploy the cockroachdb helm chart and checks installation should succeed.
 	helm.Install(t, options, helmChartPath, releaseName)
@@ -303,15 +296,14 @@ func TestCockroachDbHelmMigration(t *testing.T) {
 	crdbCluster.CaSecret = fmt.Sprintf("%s-cockroachdb-ca-secret", releaseName)
 
 	// Default method is self-signer so no need to set explicitly
-	options = &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues: patchHelmValues(map[string]string{
+	options = helmOptions(t, namespaceName, deploy.Options{
+		Values: map[string]string{
 			"statefulset.updateStrategy.type": "OnDelete",
-		}),
-		ExtraArgs: map[string][]string{
-			"upgrade": []string{
-				"--timeout=20m",
-			},
+		},
+	})
+	options.ExtraArgs = map[string][]string{
+		"upgrade": []string{
+			"--timeout=20m",
 		},
 	}
 
@@ -360,12 +352,9 @@ func TestCockroachDbWithInsecureMode(t *testing.T) {
 	defer k8s.DeleteNamespace(t, kubectlOptions, namespaceName)
 
 	// Setup the args. For this test, we will set the following input values:
-	options := &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues: patchHelmValues(map[string]string{
-			"tls.enabled": "false",
-		}),
-	}
+	options := helmOptions(t, namespaceName, deploy.Options{
+		TLS: deploy.TLS{Mode: deploy.TLSInsecure},
+	})
 
 	// Deploy the cockroachdb helm chart and checks installation should succeed.
 	helm.Install(t, options, helmChartPath, releaseName)
@@ -450,16 +439,9 @@ spec:
 	}
 
 	// Setup the args. For this test, we will set the following input values:
-	options := &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues: patchHelmValues(map[string]string{
-			"tls.enabled":                      "true",
-			"tls.certs.selfSigner.enabled":     "false",
-			"tls.certs.certManager":            "true",
-			"tls.certs.certManagerIssuer.kind": "Issuer",
-			"tls.certs.certManagerIssuer.name": "cockroachdb",
-		}),
-	}
+	options := helmOptions(t, namespaceName, deploy.Options{
+		TLS: deploy.TLS{Mode: deploy.TLSCertManager, IssuerKind: "Issuer", IssuerName: "cockroachdb"},
+	})
 
 	// Deploy the cockroachdb helm chart and checks installation should succeed.
 	helm.Install(t, options, helmChartPath, releaseName)
@@ -482,27 +464,14 @@ spec:
 }
 
 func TestWALFailoverSideDiskExistingCluster(t *testing.T) {
-	testWALFailoverExistingCluster(
-		t,
-		patchHelmValues(map[string]string{
-			"conf.wal-failover.value":                    "path=cockroach-failover",
-			"conf.wal-failover.persistentVolume.enabled": "true",
-			"conf.wal-failover.persistentVolume.size":    "1Gi",
-		}),
-	)
+	testWALFailoverExistingCluster(t, deploy.WALFailover{Mode: deploy.WALFailoverSideDisk, SideDiskSize: "1Gi"})
 }
 
 func TestWALFailoverAmongStoresExistingCluster(t *testing.T) {
-	testWALFailoverExistingCluster(
-		t,
-		patchHelmValues(map[string]string{
-			"conf.wal-failover.value": "among-stores",
-			"conf.store.count":        "2",
-		}),
-	)
+	testWALFailoverExistingCluster(t, deploy.WALFailover{Mode: deploy.WALFailoverAmongStores, StoreCount: 2})
 }
 
-func testWALFailoverExistingCluster(t *testing.T, additionalValues map[string]string) {
+func testWALFailoverExistingCluster(t *testing.T, walFailover deploy.WALFailover) {
 	namespaceName := "cockroach" + strings.ToLower(random.UniqueId())
 	numReplicas := 3
 	kubectlOptions := k8s.NewKubectlOptions("", "", namespaceName)
@@ -529,15 +498,14 @@ func testWALFailoverExistingCluster(t *testing.T, additionalValues map[string]st
 	}()
 
 	// Configure options for the initial deployment.
-	initialValues := patchHelmValues(map[string]string{
-		"conf.cluster-name":    "test",
-		"conf.store.enabled":   "true",
-		"statefulset.replicas": strconv.Itoa(numReplicas),
-	})
-	options := &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues:      initialValues,
+	deployOptions := deploy.Options{
+		ClusterName: "test",
+		Replicas:    numReplicas,
+		Values: map[string]string{
+			"conf.store.enabled": "true",
+		},
 	}
+	options := helmOptions(t, namespaceName, deployOptions)
 
 	// Deploy the helm chart and confirm the installation is successful.
 	helm.Install(t, options, helmChartPath, releaseName)
@@ -555,17 +523,8 @@ func testWALFailoverExistingCluster(t *testing.T, additionalValues map[string]st
 	// - upgrade the Helm chart
 
 	// Configure options for the updated deployment.
-	updatedValues := map[string]string{}
-	for k, v := range initialValues {
-		updatedValues[k] = v
-	}
-	for k, v := range additionalValues {
-		updatedValues[k] = v
-	}
-	options = &helm.Options{
-		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-		SetValues:      updatedValues,
-	}
+	deployOptions.WALFailover = walFailover
+	options = helmOptions(t, namespaceName, deployOptions)
 
 	updateSinglePod := func(idx int) {
 		podName := fmt.Sprintf("%s-%d", crdbCluster.StatefulSetName, idx)
@@ -601,17 +560,18 @@ func testWALFailoverExistingCluster(t *testing.T, additionalValues map[string]st
 	}
 }
 
-func patchHelmValues(inputValues map[string]string) map[string]string {
-	overrides := map[string]string{
-		// Override the persistent storage size to 1Gi so that we do not run out of space.
-		"storage.persistentVolume.size": "1Gi",
-	}
+// helmOptions returns the helm options of a release described by the deploy options.
+func helmOptions(t *testing.T, namespaceName string, options deploy.Options) *helm.Options {
+	// Override the persistent storage size to 1Gi so that we do not run out of space.
+	options.StorageSize = "1Gi"
 
-	for k, v := range overrides {
-		inputValues[k] = v
-	}
+	values, err := options.SetValues()
+	require.NoError(t, err)
 
-	return inputValues
+	return &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues:      values,
+	}
 }
 
 func cleanupResources(
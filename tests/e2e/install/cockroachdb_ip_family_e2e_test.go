@@ -0,0 +1,127 @@
+package integration
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cockroachdb/helm-charts/pkg/deploy"
+	"github.com/cockroachdb/helm-charts/pkg/e2e"
+	"github.com/cockroachdb/helm-charts/tests/testutil"
+)
+
+// TestCockroachDbHelmInstallIPFamily installs the chart on the IPv6-only or dual-stack cluster the suite is run against
+// with `e2e-runner --ip-family`, and checks that the nodes join and advertise their DNS names, that the Services get
+// ClusterIPs of the families of the cluster, and that the probes of the nodes pass on their IPv6 addresses.
+func TestCockroachDbHelmInstallIPFamily(t *testing.T) {
+	family, err := e2e.ParseIPFamily(os.Getenv(e2e.IPFamilyEnv))
+	require.NoError(t, err)
+	if family == e2e.IPv4 {
+		t.Skipf("only run against IPv6-only and dual-stack clusters, set %s to ipv6 or dual", e2e.IPFamilyEnv)
+	}
+
+	namespaceName := "cockroach" + strings.ToLower(random.UniqueId())
+	kubectlOptions := k8s.NewKubectlOptions("", "", namespaceName)
+
+	crdbCluster := testutil.CockroachCluster{
+		Cfg:              cfg,
+		K8sClient:        k8sClient,
+		StatefulSetName:  fmt.Sprintf("%s-cockroachdb", releaseName),
+		Namespace:        namespaceName,
+		ClientSecret:     fmt.Sprintf("%s-cockroachdb-client-secret", releaseName),
+		NodeSecret:       fmt.Sprintf("%s-cockroachdb-node-secret", releaseName),
+		CaSecret:         fmt.Sprintf("%s-cockroachdb-ca-secret", releaseName),
+		IsCaUserProvided: false,
+	}
+
+	k8s.CreateNamespace(t, kubectlOptions, namespaceName)
+	// ... and make sure to delete the namespace at the end of the test
+	defer k8s.DeleteNamespace(t, kubectlOptions, namespaceName)
+
+	families := family.ServiceIPFamilies()
+	values := map[string]string{}
+	if family == e2e.DualStack {
+		values["service.discovery.ipFamilyPolicy"] = "RequireDualStack"
+		for i, f := range families {
+			values[fmt.Sprintf("service.discovery.ipFamilies[%d]", i)] = f
+		}
+	}
+	options := helmOptions(t, namespaceName, deploy.Options{
+		ClusterName: "test",
+		Values:      values,
+	})
+
+	// Deploy the cockroachdb helm chart and checks installation should succeed.
+	helm.Install(t, options, helmChartPath, releaseName)
+	defer cleanupResources(
+		t,
+		releaseName,
+		kubectlOptions,
+		options,
+		[]string{
+			crdbCluster.CaSecret,
+			crdbCluster.ClientSecret,
+			crdbCluster.NodeSecret,
+		},
+	)
+
+	// Print the debug logs in case of test failure.
+	defer func() {
+		if t.Failed() {
+			testutil.PrintDebugLogs(t, kubectlOptions)
+		}
+	}()
+
+	serviceName := fmt.Sprintf("%s-cockroachdb-public", releaseName)
+	k8s.WaitUntilServiceAvailable(t, kubectlOptions, serviceName, 30, 2*time.Second)
+
+	// The StatefulSet only gets ready once the readiness probes of the nodes pass.
+	testutil.RequireClusterToBeReadyEventuallyTimeout(t, crdbCluster, 600*time.Second)
+	time.Sleep(20 * time.Second)
+	testutil.RequireNodesToAdvertiseDNSNames(t, crdbCluster, 3)
+	testutil.RequireCRDBToFunction(t, crdbCluster, false)
+
+	// The public Service gets the primary family of the cluster, the discovery Service the families it requires.
+	public := k8s.GetService(t, kubectlOptions, serviceName)
+	requireIPFamilies(t, families[:1], public.Spec.ClusterIPs)
+	discovery := k8s.GetService(t, kubectlOptions, crdbCluster.StatefulSetName)
+	if family == e2e.DualStack {
+		require.Equal(t, []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}, discovery.Spec.IPFamilies)
+	}
+
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/name=cockroachdb,app.kubernetes.io/instance=%s", releaseName),
+	})
+	require.Len(t, pods, 3)
+	for _, pod := range pods {
+		var podIPs []string
+		for _, podIP := range pod.Status.PodIPs {
+			podIPs = append(podIPs, podIP.IP)
+		}
+		requireIPFamilies(t, families, podIPs)
+	}
+}
+
+// requireIPFamilies checks that the IPs are of the given families, in this order.
+func requireIPFamilies(t *testing.T, families []string, ips []string) {
+	require.Len(t, ips, len(families), ips)
+	for i, ip := range ips {
+		parsed := net.ParseIP(ip)
+		require.NotNil(t, parsed, ip)
+		f := "IPv6"
+		if parsed.To4() != nil {
+			f = "IPv4"
+		}
+		require.Equal(t, families[i], f, ip)
+	}
+}
@@ -143,3 +143,137 @@ func TestCockroachDbRotateCertificates(t *testing.T) {
 	require.NotEqual(t, caCert.Annotations["certificate-valid-upto"], newCaCert.Annotations["certificate-valid-upto"])
 	t.Log("CA Certificates rotated successfully")
 }
+
+// TestCockroachDbRotateCertificatesOnSchedule checks that the rotation CronJobs of the chart rotate the certificates
+// once they run and roll the CRDB pods onto the rotated certificates, which the copy-certs init container copies
+// from the secrets on start, without interrupting the SQL traffic of the cluster.
+func TestCockroachDbRotateCertificatesOnSchedule(t *testing.T) {
+	// Path to the helm chart we will test
+	helmChartPath, err := filepath.Abs("../../../cockroachdb")
+	require.NoError(t, err)
+
+	namespaceName := "cockroach" + strings.ToLower(random.UniqueId())
+	kubectlOptions := k8s.NewKubectlOptions("", "", namespaceName)
+	numReplicas := 3
+
+	crdbCluster := testutil.CockroachCluster{
+		Cfg:              cfg,
+		K8sClient:        k8sClient,
+		StatefulSetName:  fmt.Sprintf("%s-cockroachdb", releaseName),
+		Namespace:        namespaceName,
+		ClientSecret:     fmt.Sprintf("%s-cockroachdb-client-secret", releaseName),
+		NodeSecret:       fmt.Sprintf("%s-cockroachdb-node-secret", releaseName),
+		CaSecret:         fmt.Sprintf("%s-cockroachdb-ca-secret", releaseName),
+		IsCaUserProvided: false,
+	}
+
+	cmd := shell.Command{
+		Command:    "yq",
+		Args:       []string{".tls.selfSigner.image.tag", path.Join(helmChartPath, "values.yaml")},
+		WorkingDir: ".",
+	}
+
+	tagOutput := shell.RunCommandAndGetOutput(t, cmd)
+	t.Log(tagOutput)
+
+	k8s.CreateNamespace(t, kubectlOptions, namespaceName)
+	// ... and make sure to delete the namespace at the end of the test
+	defer k8s.DeleteNamespace(t, kubectlOptions, namespaceName)
+
+	// The rotation CronJobs are scheduled every two minutes through the maintenance window. The certificates are
+	// rotated by the first run following a change of their duration.
+	helmValues := map[string]string{
+		"tls.selfSigner.image.tag":                    tagOutput,
+		"storage.persistentVolume.size":               "1Gi",
+		"statefulset.replicas":                        fmt.Sprintf("%d", numReplicas),
+		"maintenanceWindow.enabled":                   "true",
+		"maintenanceWindow.schedule":                  "*/2 * * * *",
+		"maintenanceWindow.duration":                  "1m",
+		"tls.certs.selfSigner.minimumCertDuration":    "24h",
+		"tls.certs.selfSigner.caCertDuration":         "720h",
+		"tls.certs.selfSigner.caCertExpiryWindow":     "48h",
+		"tls.certs.selfSigner.clientCertDuration":     "240h",
+		"tls.certs.selfSigner.clientCertExpiryWindow": "24h",
+		"tls.certs.selfSigner.nodeCertDuration":       "440h",
+		"tls.certs.selfSigner.nodeCertExpiryWindow":   "36h",
+		"tls.certs.selfSigner.readinessWait":          "30s",
+	}
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues:      helmValues,
+	}
+
+	// Deploy the cockroachdb helm chart and checks installation should succeed.
+	err = helm.InstallE(t, options, helmChartPath, releaseName)
+	require.NoError(t, err)
+
+	// ... and make sure to delete the helm release at the end of the test.
+	defer helm.Delete(t, options, releaseName, true)
+	// Print the debug logs in case of test failure.
+	defer func() {
+		if t.Failed() {
+			testutil.PrintDebugLogs(t, kubectlOptions)
+			logs, _ := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, "logs", "-l", "job-name", "--tail=-1",
+				"--prefix")
+			t.Log(logs)
+		}
+	}()
+
+	// Next we wait for the service endpoint
+	serviceName := fmt.Sprintf("%s-cockroachdb-public", releaseName)
+	k8s.WaitUntilServiceAvailable(t, kubectlOptions, serviceName, 30, 2*time.Second)
+
+	testutil.RequireCertificatesToBeValid(t, crdbCluster)
+	testutil.RequireClusterToBeReadyEventuallyTimeout(t, crdbCluster, 500*time.Second)
+	time.Sleep(20 * time.Second)
+	// This will create a database, a table and insert two rows into that table.
+	testutil.RequireCRDBToFunction(t, crdbCluster, false)
+
+	traffic := testutil.StartSQLTraffic(t, crdbCluster, numReplicas)
+
+	t.Log("Rotating the Client and Node certificate for the CRDB through the rotation CronJob")
+
+	clientCert := k8s.GetSecret(t, kubectlOptions, crdbCluster.ClientSecret)
+	nodeCert := k8s.GetSecret(t, kubectlOptions, crdbCluster.NodeSecret)
+
+	helmValues["tls.certs.selfSigner.clientCertDuration"] = "264h"
+	helmValues["tls.certs.selfSigner.nodeCertDuration"] = "464h"
+	helm.Upgrade(t, options, helmChartPath, releaseName)
+
+	newClientCert := testutil.RequireSecretToBeRotatedEventually(t, crdbCluster, crdbCluster.ClientSecret,
+		clientCert.Annotations["certificate-valid-upto"], 300*time.Second)
+	newNodeCert := testutil.RequireSecretToBeRotatedEventually(t, crdbCluster, crdbCluster.NodeSecret,
+		nodeCert.Annotations["certificate-valid-upto"], 300*time.Second)
+	require.Equal(t, "264h0m0s", newClientCert.Annotations["certificate-duration"])
+	require.Equal(t, "464h0m0s", newNodeCert.Annotations["certificate-duration"])
+
+	// The copy-certs init container only picks the rotated node certificate up when the pods are restarted.
+	testutil.RequireNodesToServeCertificateEventually(t, crdbCluster, numReplicas, 600*time.Second)
+	testutil.RequireClusterToBeReadyEventuallyTimeout(t, crdbCluster, 500*time.Second)
+	testutil.RequireCertificatesToBeValid(t, crdbCluster)
+	t.Log("Client and Node Certificates rotated successfully")
+
+	t.Log("Rotating the CA certificate for the CRDB through the rotation CronJob")
+
+	caCert := k8s.GetSecret(t, kubectlOptions, crdbCluster.CaSecret)
+	nodeCert = k8s.GetSecret(t, kubectlOptions, crdbCluster.NodeSecret)
+
+	helmValues["tls.certs.selfSigner.caCertDuration"] = "744h"
+	helm.Upgrade(t, options, helmChartPath, releaseName)
+
+	newCaCert := testutil.RequireSecretToBeRotatedEventually(t, crdbCluster, crdbCluster.CaSecret,
+		caCert.Annotations["certificate-valid-upto"], 300*time.Second)
+	require.Equal(t, "744h0m0s", newCaCert.Annotations["certificate-duration"])
+
+	// The node certificate is re-issued by the new CA on the next run of the node and client rotation CronJob.
+	testutil.RequireSecretToBeRotatedEventually(t, crdbCluster, crdbCluster.NodeSecret,
+		nodeCert.Annotations["certificate-valid-upto"], 900*time.Second)
+	testutil.RequireNodesToServeCertificateEventually(t, crdbCluster, numReplicas, 600*time.Second)
+	testutil.RequireClusterToBeReadyEventuallyTimeout(t, crdbCluster, 500*time.Second)
+	testutil.RequireCertificatesToBeValid(t, crdbCluster)
+	t.Log("CA Certificates rotated successfully")
+
+	testutil.RequireSQLTrafficToBeUninterrupted(t, traffic)
+	// This will check after rotation the database is working properly.
+	testutil.RequireCRDBToFunction(t, crdbCluster, true)
+}
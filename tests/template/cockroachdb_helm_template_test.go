@@ -1,7 +1,11 @@
 package template
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -11,6 +15,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/gruntwork-io/terratest/modules/helm"
 	"github.com/gruntwork-io/terratest/modules/k8s"
@@ -218,7 +223,7 @@ func TestHelmSelfCertSignerCronJob(t *testing.T) {
 	// Rendering the template of self signer service account
 	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-ca-certSelfSigner.yaml"})
 
-	var cronjob v1beta1.CronJob
+	var cronjob batchv1.CronJob
 	helm.UnmarshalK8SYaml(t, output, &cronjob)
 	require.Equal(t, namespaceName, cronjob.Namespace)
 
@@ -280,7 +285,7 @@ func TestHelmSelfCertSignerCronJobSchedule(t *testing.T) {
 	// Rendering the template of self signer service account
 	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-ca-certSelfSigner.yaml"})
 
-	var cronjob v1beta1.CronJob
+	var cronjob batchv1.CronJob
 	helm.UnmarshalK8SYaml(t, output, &cronjob)
 	require.Equal(t, namespaceName, cronjob.Namespace)
 
@@ -329,7 +334,7 @@ func TestHelmSelfCertSignerCronJobSchedule(t *testing.T) {
 			options := &helm.Options{SetValues: testCase.values}
 			output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-ca-certSelfSigner.yaml"})
 
-			var cronjob v1beta1.CronJob
+			var cronjob batchv1.CronJob
 			helm.UnmarshalK8SYaml(t, output, &cronjob)
 
 			require.Equal(subT, cronjob.Spec.Schedule, testCase.caExpectedCron)
@@ -343,6 +348,114 @@ func TestHelmSelfCertSignerCronJobSchedule(t *testing.T) {
 }
 
 // TestHelmSelfCertSignerStatefulSet contains the tests around the statefulset of self signer utility
+func TestHelmCronJobAPIVersion(t *testing.T) {
+	t.Parallel()
+
+	templates := map[string]map[string]string{
+		"templates/cronjob-ca-certSelfSigner.yaml":          {},
+		"templates/cronjob-client-node-certSelfSigner.yaml": {},
+		"templates/cronjob-csrCollector.yaml":               {"tls.certs.selfSigner.csrCollector.enabled": "true"},
+		"templates/cronjob-driftDetector.yaml":              {"driftDetection.enabled": "true"},
+		"templates/cronjob.statistics.yaml":                 {"statistics.reset.enabled": "true"},
+	}
+
+	testCases := []struct {
+		name       string
+		values     map[string]string
+		args       []string
+		apiVersion string
+		renderErr  string
+	}{
+		{
+			"Kubernetes 1.20",
+			nil,
+			[]string{"--kube-version", "1.20.0"},
+			"batch/v1beta1",
+			"",
+		},
+		{
+			"Kubernetes 1.20 serving batch/v1 CronJobs",
+			nil,
+			[]string{"--kube-version", "1.20.0", "--api-versions", "batch/v1/CronJob"},
+			"batch/v1",
+			"",
+		},
+		{
+			"Kubernetes 1.21",
+			nil,
+			[]string{"--kube-version", "1.21.0"},
+			"batch/v1",
+			"",
+		},
+		{
+			"Kubernetes 1.20 with batch/v1 set",
+			map[string]string{"global.cronJobApiVersion": "batch/v1"},
+			[]string{"--kube-version", "1.20.0"},
+			"batch/v1",
+			"",
+		},
+		{
+			"Kubernetes 1.21 with batch/v1beta1 set",
+			map[string]string{"global.cronJobApiVersion": "batch/v1beta1"},
+			[]string{"--kube-version", "1.21.0"},
+			"batch/v1beta1",
+			"",
+		},
+		{
+			"Kubernetes 1.25 with batch/v1beta1 set",
+			map[string]string{"global.cronJobApiVersion": "batch/v1beta1"},
+			[]string{"--kube-version", "1.25.0"},
+			"",
+			"batch/v1beta1 CronJobs are no longer served by Kubernetes v1.25.0, set global.cronJobApiVersion to batch/v1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			for template, templateValues := range templates {
+				values := map[string]string{}
+				for k, v := range templateValues {
+					values[k] = v
+				}
+				for k, v := range testCase.values {
+					values[k] = v
+				}
+				options := &helm.Options{
+					KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+					SetValues:      values,
+				}
+
+				output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{template}, testCase.args...)
+				if testCase.renderErr != "" {
+					require.ErrorContains(subT, err, testCase.renderErr, template)
+					continue
+				}
+				require.NoError(subT, err, template)
+
+				for _, manifest := range strings.Split(output, "\n---") {
+					if !strings.Contains(manifest, "kind:") {
+						continue
+					}
+
+					if testCase.apiVersion == "batch/v1beta1" {
+						var cronjob v1beta1.CronJob
+						helm.UnmarshalK8SYaml(subT, manifest, &cronjob)
+						require.Equal(subT, testCase.apiVersion, cronjob.APIVersion, template)
+					} else {
+						var cronjob batchv1.CronJob
+						helm.UnmarshalK8SYaml(subT, manifest, &cronjob)
+						require.Equal(subT, testCase.apiVersion, cronjob.APIVersion, template)
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestHelmSelfCertSignerStatefulSet(t *testing.T) {
 	t.Parallel()
 
@@ -998,6 +1111,114 @@ func TestHelmDatabaseProvisioning(t *testing.T) {
 				},
 			},
 		},
+		{
+			"Database backup provisioning to multiple destinations",
+			map[string]string{
+				"init.provisioning.enabled":                                     "true",
+				"init.provisioning.databases[0].name":                           "testDatabase",
+				"init.provisioning.databases[0].backups[0].name":                "s3",
+				"init.provisioning.databases[0].backups[0].into":                "s3://backups/testDatabase",
+				"init.provisioning.databases[0].backups[0].recurring":           "@hourly",
+				"init.provisioning.databases[0].backups[1].name":                "gcs",
+				"init.provisioning.databases[0].backups[1].into":                "gs://backups/testDatabase",
+				"init.provisioning.databases[0].backups[1].options[0]":          "revision_history",
+				"init.provisioning.databases[0].backups[1].recurring":           "@daily",
+				"init.provisioning.databases[0].backups[1].fullBackup":          "@weekly",
+				"init.provisioning.databases[0].backups[1].schedule.options[0]": "first_run = 'now'",
+			},
+			struct {
+				job struct {
+					exists           bool
+					hookDeletePolicy string
+					initCluster      bool
+					provisionCluster bool
+					sql              string
+				}
+				secret struct {
+					exists          bool
+					users           map[string]string
+					clusterSettings map[string]string
+				}
+			}{
+				struct {
+					exists           bool
+					hookDeletePolicy string
+					initCluster      bool
+					provisionCluster bool
+					sql              string
+				}{
+					true,
+					"before-hook-creation",
+					true,
+					true,
+					"CREATE DATABASE IF NOT EXISTS testDatabase;" +
+						"CREATE SCHEDULE IF NOT EXISTS testDatabase_s3_scheduled_backup" +
+						"FOR BACKUP DATABASE testDatabase INTO 's3://backups/testDatabase'" +
+						"RECURRING '@hourly'" +
+						"FULL BACKUP ALWAYS;" +
+						"CREATE SCHEDULE IF NOT EXISTS testDatabase_gcs_scheduled_backup" +
+						"FOR BACKUP DATABASE testDatabase INTO 'gs://backups/testDatabase'" +
+						"WITH revision_history" +
+						"RECURRING '@daily'" +
+						"FULL BACKUP '@weekly'" +
+						"WITH SCHEDULE OPTIONS first_run = 'now';",
+				},
+				struct {
+					exists          bool
+					users           map[string]string
+					clusterSettings map[string]string
+				}{
+					true,
+					nil,
+					nil,
+				},
+			},
+		},
+		{
+			"Database backup provisioning without a schedule name",
+			map[string]string{
+				"init.provisioning.enabled":                      "true",
+				"init.provisioning.databases[0].name":            "testDatabase",
+				"init.provisioning.databases[0].backups[0].into": "s3://backups/testDatabase",
+			},
+			struct {
+				job struct {
+					exists           bool
+					hookDeletePolicy string
+					initCluster      bool
+					provisionCluster bool
+					sql              string
+				}
+				secret struct {
+					exists          bool
+					users           map[string]string
+					clusterSettings map[string]string
+				}
+			}{
+				struct {
+					exists           bool
+					hookDeletePolicy string
+					initCluster      bool
+					provisionCluster bool
+					sql              string
+				}{
+					false,
+					"",
+					false,
+					false,
+					"",
+				},
+				struct {
+					exists          bool
+					users           map[string]string
+					clusterSettings map[string]string
+				}{
+					false,
+					nil,
+					nil,
+				},
+			},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -1073,6 +1294,116 @@ func TestHelmDatabaseProvisioning(t *testing.T) {
 	}
 }
 
+func TestHelmInitClusterSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		contains []string
+		env      map[string]*corev1.SecretKeySelector
+		expErr   string
+	}{
+		{
+			"Inline and secret-backed settings",
+			map[string]string{
+				"init.provisioning.enabled":                                        "true",
+				"init.provisioning.clusterSettings[0].name":                        "cluster.organization",
+				"init.provisioning.clusterSettings[0].value":                       "FooCorp's",
+				"init.provisioning.clusterSettings[1].name":                        "enterprise.license",
+				"init.provisioning.clusterSettings[1].valueFrom.secretKeyRef.name": "cockroachdb-license",
+				"init.provisioning.clusterSettings[1].valueFrom.secretKeyRef.key":  "license",
+				"init.provisioning.clusterSettings[2].name":                        "kv.rangefeed.enabled",
+				"init.provisioning.clusterSettings[2].value":                       "true",
+			},
+			[]string{
+				"SET CLUSTER SETTING cluster.organization = 'FooCorp''s';",
+				"SET CLUSTER SETTING enterprise.license = '$enterprise_license_CLUSTER_SETTING';",
+				"SET CLUSTER SETTING kv.rangefeed.enabled = 'true';",
+			},
+			map[string]*corev1.SecretKeySelector{
+				"enterprise_license_CLUSTER_SETTING": {
+					LocalObjectReference: corev1.LocalObjectReference{Name: "cockroachdb-license"},
+					Key:                  "license",
+				},
+			},
+			"",
+		},
+		{
+			"Deprecated map of settings",
+			map[string]string{
+				"init.provisioning.enabled":                                "true",
+				"init.provisioning.clusterSettings.cluster\\.organization": "testOrganization",
+			},
+			[]string{
+				"SET CLUSTER SETTING cluster.organization = '$cluster_organization_CLUSTER_SETTING';",
+			},
+			map[string]*corev1.SecretKeySelector{
+				"cluster_organization_CLUSTER_SETTING": {
+					LocalObjectReference: corev1.LocalObjectReference{Name: fmt.Sprintf("%s-cockroachdb-init", releaseName)},
+					Key:                  "cluster-organization-cluster-setting",
+				},
+			},
+			"",
+		},
+		{
+			"Inline value referencing a variable",
+			map[string]string{
+				"init.provisioning.enabled":                  "true",
+				"init.provisioning.clusterSettings[0].name":  "server.oidc_authentication.client_secret",
+				"init.provisioning.clusterSettings[0].value": "$ecret",
+			},
+			nil,
+			nil,
+			"init.provisioning.clusterSettings value of server.oidc_authentication.client_secret can't contain $ or `, set it with valueFrom.secretKeyRef instead",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			container := job.Spec.Template.Spec.Containers[0]
+			for _, s := range testCase.contains {
+				require.Contains(subT, container.Command[2], s)
+			}
+
+			env := map[string]*corev1.SecretKeySelector{}
+			for _, e := range container.Env {
+				if strings.HasSuffix(e.Name, "_CLUSTER_SETTING") {
+					env[e.Name] = e.ValueFrom.SecretKeyRef
+				}
+			}
+			require.Equal(subT, testCase.env, env)
+
+			// Only the values of the deprecated map are stored in the init Secret.
+			output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/secrets.init.yaml"})
+			var secret corev1.Secret
+			helm.UnmarshalK8SYaml(subT, output, &secret)
+			for name, ref := range testCase.env {
+				_, stored := secret.StringData[strings.ReplaceAll(strings.TrimSuffix(name, "_CLUSTER_SETTING"), "_", "-")+"-cluster-setting"]
+				require.Equal(subT, ref.Name == secret.Name, stored)
+			}
+		})
+	}
+}
+
 func TestHelmServiceMonitor(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -1287,66 +1618,542 @@ func TestHelmIngress(t *testing.T) {
 	}
 }
 
-// TestHelmInitJobAnnotations contains the tests for the annotations of the Init Job
-func TestHelmInitJobAnnotations(t *testing.T) {
+// TestHelmIngressTLSTermination contains the tests for the TLS termination of the DB Console by the Ingress
+func TestHelmIngressTLSTermination(t *testing.T) {
 	t.Parallel()
+
 	testCases := []struct {
 		name        string
 		values      map[string]string
 		annotations map[string]string
+		tls         []networkingv1.IngressTLS
+		expErr      string
 	}{
 		{
-			"No extra job annotations were supplied",
+			"No annotations without a controller",
 			map[string]string{},
+			map[string]string{},
+			nil,
+			"",
+		},
+		{
+			"Re-encrypted by nginx",
 			map[string]string{
-				"helm.sh/hook":               "post-install,post-upgrade",
-				"helm.sh/hook-delete-policy": "before-hook-creation",
+				"ingress.tlsTermination.controller":      "nginx",
+				"ingress.tlsTermination.secretName":      "console-tls",
+				"ingress.tlsTermination.backendCASecret": "helm-basic-cockroachdb-ca-secret",
 			},
+			map[string]string{
+				"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
+				"nginx.ingress.kubernetes.io/proxy-ssl-secret": namespaceName + "/helm-basic-cockroachdb-ca-secret",
+				"nginx.ingress.kubernetes.io/proxy-ssl-verify": "on",
+				"nginx.ingress.kubernetes.io/proxy-ssl-name":   fmt.Sprintf("helm-basic-cockroachdb-public.%s.svc.cluster.local", namespaceName),
+			},
+			[]networkingv1.IngressTLS{{Hosts: []string{"console.example.com"}, SecretName: "console-tls"}},
+			"",
 		},
 		{
-			"Extra job annotations were supplied",
+			"Passed through by nginx",
 			map[string]string{
-				"init.jobAnnotations.test-key-1": "test-value-1",
-				"init.jobAnnotations.test-key-2": "test-value-2",
+				"ingress.tlsTermination.controller": "nginx",
+				"ingress.tlsTermination.mode":       "passthrough",
+				"ingress.tlsTermination.secretName": "console-tls",
 			},
 			map[string]string{
-				"helm.sh/hook":               "post-install,post-upgrade",
-				"helm.sh/hook-delete-policy": "before-hook-creation",
-				"test-key-1":                 "test-value-1",
-				"test-key-2":                 "test-value-2",
+				"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
+				"nginx.ingress.kubernetes.io/ssl-passthrough":  "true",
+			},
+			nil,
+			"",
+		},
+		{
+			"Terminated by the ALB",
+			map[string]string{
+				"tls.enabled":                       "false",
+				"ingress.tlsTermination.controller": "alb",
+				"ingress.tlsTermination.mode":       "edge",
+				"ingress.annotations.alb\\.ingress\\.kubernetes\\.io/healthcheck-path": "/_admin/v1/health",
+			},
+			map[string]string{
+				"alb.ingress.kubernetes.io/backend-protocol":     "HTTP",
+				"alb.ingress.kubernetes.io/healthcheck-protocol": "HTTP",
+				"alb.ingress.kubernetes.io/healthcheck-path":     "/_admin/v1/health",
+				"alb.ingress.kubernetes.io/listen-ports":         `[{"HTTPS":443}]`,
+			},
+			nil,
+			"",
+		},
+		{
+			"Edge termination with TLS enabled",
+			map[string]string{
+				"ingress.tlsTermination.controller": "nginx",
+				"ingress.tlsTermination.mode":       "edge",
+			},
+			nil,
+			nil,
+			"ingress.tlsTermination.mode edge requires tls.enabled to be false",
+		},
+		{
+			"Re-encryption with TLS disabled",
+			map[string]string{
+				"tls.enabled":                       "false",
+				"ingress.tlsTermination.controller": "nginx",
+			},
+			nil,
+			nil,
+			"ingress.tlsTermination.mode reencrypt requires tls.enabled",
+		},
+		{
+			"Passthrough not supported by GCE",
+			map[string]string{
+				"ingress.tlsTermination.controller": "gce",
+				"ingress.tlsTermination.mode":       "passthrough",
+			},
+			nil,
+			nil,
+			"ingress.tlsTermination.mode passthrough is not supported by the gce Ingress controller",
+		},
+		{
+			"Unknown controller",
+			map[string]string{
+				"ingress.tlsTermination.controller": "traefik",
 			},
+			nil,
+			nil,
+			"ingress.tlsTermination.controller must be one of nginx, alb or gce, got traefik",
 		},
 	}
 
 	for _, testCase := range testCases {
-		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
-		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
-		// and will be the next testCase!
 		testCase := testCase
 		t.Run(testCase.name, func(subT *testing.T) {
 			subT.Parallel()
 
+			values := map[string]string{
+				"ingress.enabled":  "true",
+				"ingress.hosts[0]": "console.example.com",
+			}
+			for k, v := range testCase.values {
+				values[k] = v
+			}
 			options := &helm.Options{
 				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
-				SetValues:      testCase.values,
+				SetValues:      values,
 			}
-			output, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
 
-			require.Equal(subT, err, nil)
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/ingress.yaml"}, "--api-versions", "networking.k8s.io/v1/Ingress")
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
 
-			var job batchv1.Job
-			helm.UnmarshalK8SYaml(t, output, &job)
+			var ingress networkingv1.Ingress
+			helm.UnmarshalK8SYaml(subT, output, &ingress)
 
-			require.Equal(t, testCase.annotations, job.Annotations)
+			require.Len(subT, ingress.Annotations, len(testCase.annotations))
+			for key, value := range testCase.annotations {
+				require.Equal(subT, value, ingress.Annotations[key], key)
+			}
+			require.Equal(subT, testCase.tls, ingress.Spec.TLS)
 		})
 	}
+
+	t.Run("GCE", func(subT *testing.T) {
+		subT.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"ingress.enabled":                   "true",
+				"ingress.tlsTermination.controller": "gce",
+				"ingress.tlsTermination.secretName": "console-tls",
+			},
+		}
+
+		output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/ingress.yaml"}, "--api-versions", "networking.k8s.io/v1/Ingress")
+		var ingress networkingv1.Ingress
+		helm.UnmarshalK8SYaml(subT, output, &ingress)
+		require.Equal(subT, "false", ingress.Annotations["kubernetes.io/ingress.allow-http"])
+		require.Equal(subT, []networkingv1.IngressTLS{{SecretName: "console-tls"}}, ingress.Spec.TLS)
+
+		output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/service.public.yaml"})
+		var service corev1.Service
+		helm.UnmarshalK8SYaml(subT, output, &service)
+		require.Equal(subT, `{"http":"HTTPS"}`, service.Annotations["cloud.google.com/app-protocols"])
+	})
 }
 
-func TestStatefulSetInitContainers(t *testing.T) {
+func TestHelmCapacityPlanning(t *testing.T) {
 	t.Parallel()
+
 	testCases := []struct {
-		name          string
-		initContainer bool
+		name   string
+		values map[string]string
+		expect map[string]string
+	}{
+		{
+			"Resources of three regions",
+			map[string]string{
+				"capacityPlanning.regions":                   "3",
+				"conf.log.enabled":                           "true",
+				"statefulset.resources.requests.cpu":         "2",
+				"statefulset.resources.requests.memory":      "8Gi",
+				"statefulset.resources.limits.cpu":           "2500m",
+				"statefulset.resources.limits.memory":        "8Gi",
+				"conf.log.persistentVolume.enabled":          "true",
+				"conf.log.persistentVolume.size":             "512Mi",
+				"storage.persistentVolume.size":              "100Gi",
+				"statefulset.replicas":                       "3",
+				"conf.wal-failover.persistentVolume.enabled": "false",
+				"conf.temp-dir.persistentVolume.enabled":     "false",
+				"storage.persistentVolume.enabled":           "true",
+				"conf.store.count":                           "1",
+			},
+			map[string]string{
+				"replicas":                     "3",
+				"regions":                      "3",
+				"requests.cpu":                 "6",
+				"requests.memory":              "24Gi",
+				"limits.cpu":                   "7500m",
+				"limits.memory":                "24Gi",
+				"requests.storage":             "308736Mi",
+				"persistentvolumeclaims":       "6",
+				"total.requests.cpu":           "18",
+				"total.requests.memory":        "72Gi",
+				"total.limits.cpu":             "22500m",
+				"total.limits.memory":          "72Gi",
+				"total.requests.storage":       "926208Mi",
+				"total.persistentvolumeclaims": "18",
+			},
+		},
+		{
+			"Presets of the medium profile",
+			map[string]string{
+				"profile":              "medium",
+				"statefulset.replicas": "5",
+			},
+			map[string]string{
+				"replicas":                     "5",
+				"regions":                      "1",
+				"requests.cpu":                 "10",
+				"requests.memory":              "40Gi",
+				"limits.cpu":                   "0",
+				"limits.memory":                "40Gi",
+				"requests.storage":             "250Gi",
+				"persistentvolumeclaims":       "5",
+				"total.requests.cpu":           "10",
+				"total.requests.memory":        "40Gi",
+				"total.limits.cpu":             "0",
+				"total.limits.memory":          "40Gi",
+				"total.requests.storage":       "250Gi",
+				"total.persistentvolumeclaims": "5",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			values := map[string]string{"capacityPlanning.configMap": "true"}
+			for k, v := range testCase.values {
+				values[k] = v
+			}
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      values,
+			}
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/configmap.capacity.yaml"})
+
+			var configMap corev1.ConfigMap
+			helm.UnmarshalK8SYaml(subT, output, &configMap)
+			require.Equal(subT, fmt.Sprintf("%s-cockroachdb-capacity", releaseName), configMap.Name)
+			require.Equal(subT, testCase.expect, configMap.Data)
+		})
+	}
+
+	// `helm template` doesn't render NOTES.txt, which shares the capacity of the ConfigMap.
+	t.Run("Small profile in two regions", func(t *testing.T) {
+		t.Parallel()
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"capacityPlanning.configMap": "true",
+				"capacityPlanning.regions":   "2",
+				"profile":                    "small",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/configmap.capacity.yaml"})
+
+		var configMap corev1.ConfigMap
+		helm.UnmarshalK8SYaml(t, output, &configMap)
+		require.Equal(t, "3", configMap.Data["replicas"])
+		require.Equal(t, "2", configMap.Data["regions"])
+		require.Equal(t, "1500m", configMap.Data["requests.cpu"])
+		require.Equal(t, "3", configMap.Data["total.requests.cpu"])
+		require.Equal(t, "30Gi", configMap.Data["requests.storage"])
+		require.Equal(t, "60Gi", configMap.Data["total.requests.storage"])
+	})
+}
+
+func TestHelmNetworkPolicyEgress(t *testing.T) {
+	t.Parallel()
+
+	egressValues := func(values map[string]string) map[string]string {
+		merged := map[string]string{
+			"networkPolicy.enabled":        "true",
+			"networkPolicy.egress.enabled": "true",
+		}
+		for k, v := range values {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	t.Run("Validation", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			name   string
+			values map[string]string
+			expErr string
+		}{
+			{
+				"NetworkPolicy disabled",
+				map[string]string{
+					"networkPolicy.egress.enabled": "true",
+				},
+				"networkPolicy.egress.enabled requires networkPolicy.enabled",
+			},
+			{
+				"Unknown FQDN provider",
+				egressValues(map[string]string{
+					"networkPolicy.egress.fqdnProvider": "weave",
+				}),
+				"networkPolicy.egress.fqdnProvider must be one of cilium or calico, got weave",
+			},
+			{
+				"Unknown type",
+				egressValues(map[string]string{
+					"networkPolicy.egress.fqdnProvider":    "cilium",
+					"networkPolicy.egress.targets[0].name": "backups",
+					"networkPolicy.egress.targets[0].type": "minio",
+				}),
+				"networkPolicy.egress.targets[backups].type must be one of s3, gcs, azureBlob, awsKms, gcpKms, azureKeyVault or oidc, got minio",
+			},
+			{
+				"S3 without a region",
+				egressValues(map[string]string{
+					"networkPolicy.egress.fqdnProvider":    "cilium",
+					"networkPolicy.egress.targets[0].name": "backups",
+					"networkPolicy.egress.targets[0].type": "s3",
+				}),
+				"networkPolicy.egress.targets[backups] of type s3 requires a region",
+			},
+			{
+				"Duplicate names",
+				egressValues(map[string]string{
+					"networkPolicy.egress.targets[0].name":     "backups",
+					"networkPolicy.egress.targets[0].cidrs[0]": "10.0.0.0/8",
+					"networkPolicy.egress.targets[1].name":     "backups",
+					"networkPolicy.egress.targets[1].cidrs[0]": "10.0.0.0/8",
+				}),
+				"networkPolicy.egress.targets has several targets named backups",
+			},
+			{
+				"FQDNs without a provider",
+				egressValues(map[string]string{
+					"networkPolicy.egress.targets[0].name": "backups",
+					"networkPolicy.egress.targets[0].type": "gcs",
+				}),
+				"networkPolicy.egress.targets[backups] is only reachable by FQDN, which requires networkPolicy.egress.fqdnProvider, or must have cidrs",
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+			t.Run(testCase.name, func(subT *testing.T) {
+				subT.Parallel()
+
+				options := &helm.Options{
+					KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+					SetValues:      testCase.values,
+				}
+
+				_, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+				require.ErrorContains(subT, err, testCase.expErr)
+			})
+		}
+	})
+
+	t.Run("CIDR targets", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: egressValues(map[string]string{
+				"networkPolicy.egress.targets[0].name":     "kafka",
+				"networkPolicy.egress.targets[0].cidrs[0]": "10.20.0.0/16",
+				"networkPolicy.egress.targets[0].ports[0]": "9092",
+				"networkPolicy.egress.targets[1].name":     "backups",
+				"networkPolicy.egress.targets[1].type":     "s3",
+				"networkPolicy.egress.targets[1].region":   "us-east-1",
+				"networkPolicy.egress.targets[1].cidrs[0]": "52.216.0.0/15",
+			}),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/networkpolicy.yaml"})
+		var policy networkingv1.NetworkPolicy
+		helm.UnmarshalK8SYaml(t, output, &policy)
+
+		require.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}, policy.Spec.PolicyTypes)
+		// DNS, the other CockroachDB Pods, then the targets.
+		require.Len(t, policy.Spec.Egress, 4)
+		require.Equal(t, int32(53), policy.Spec.Egress[0].Ports[0].Port.IntVal)
+		require.Equal(t, "grpc", policy.Spec.Egress[1].Ports[0].Port.StrVal)
+		require.Equal(t, "10.20.0.0/16", policy.Spec.Egress[2].To[0].IPBlock.CIDR)
+		require.Equal(t, int32(9092), policy.Spec.Egress[2].Ports[0].Port.IntVal)
+		require.Equal(t, "52.216.0.0/15", policy.Spec.Egress[3].To[0].IPBlock.CIDR)
+		require.Equal(t, int32(443), policy.Spec.Egress[3].Ports[0].Port.IntVal)
+
+		// The FQDNs are only enforced by an FQDN provider.
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/networkpolicy.fqdn.yaml"})
+		require.ErrorContains(t, err, "could not find template templates/networkpolicy.fqdn.yaml in chart")
+	})
+
+	t.Run("Cilium", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: egressValues(map[string]string{
+				"networkPolicy.egress.fqdnProvider":         "cilium",
+				"networkPolicy.egress.targets[0].name":      "backups",
+				"networkPolicy.egress.targets[0].type":      "s3",
+				"networkPolicy.egress.targets[0].region":    "us-east-1",
+				"networkPolicy.egress.targets[1].name":      "sso",
+				"networkPolicy.egress.targets[1].type":      "oidc",
+				"networkPolicy.egress.targets[1].issuerUrl": "https://sso.example.com:8443/realms/db",
+			}),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/networkpolicy.fqdn.yaml"})
+		var policy unstructured.Unstructured
+		helm.UnmarshalK8SYaml(t, output, &policy)
+		require.Equal(t, "CiliumNetworkPolicy", policy.GetKind())
+
+		egress, _, err := unstructured.NestedSlice(policy.Object, "spec", "egress")
+		require.NoError(t, err)
+		require.Len(t, egress, 3)
+		require.Equal(t, []interface{}{
+			map[string]interface{}{"matchName": "s3.us-east-1.amazonaws.com"},
+			map[string]interface{}{"matchPattern": "*.s3.us-east-1.amazonaws.com"},
+			map[string]interface{}{"matchName": "sts.us-east-1.amazonaws.com"},
+		}, egress[1].(map[string]interface{})["toFQDNs"])
+		require.Equal(t, []interface{}{
+			map[string]interface{}{"matchName": "sso.example.com"},
+		}, egress[2].(map[string]interface{})["toFQDNs"])
+		require.Contains(t, output, `port: "8443"`)
+	})
+
+	t.Run("Calico", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: egressValues(map[string]string{
+				"networkPolicy.egress.fqdnProvider":       "calico",
+				"networkPolicy.egress.targets[0].name":    "kms",
+				"networkPolicy.egress.targets[0].type":    "azureKeyVault",
+				"networkPolicy.egress.targets[0].account": "db-vault",
+			}),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/networkpolicy.fqdn.yaml"})
+		var policy unstructured.Unstructured
+		helm.UnmarshalK8SYaml(t, output, &policy)
+		require.Equal(t, "projectcalico.org/v3", policy.GetAPIVersion())
+
+		selector, _, err := unstructured.NestedString(policy.Object, "spec", "selector")
+		require.NoError(t, err)
+		require.Contains(t, selector, fmt.Sprintf("app.kubernetes.io/instance == '%s'", releaseName))
+
+		egress, _, err := unstructured.NestedSlice(policy.Object, "spec", "egress")
+		require.NoError(t, err)
+		require.Len(t, egress, 1)
+		require.Equal(t, map[string]interface{}{
+			"domains": []interface{}{"db-vault.vault.azure.net", "login.microsoftonline.com"},
+			"ports":   []interface{}{int64(443)},
+		}, egress[0].(map[string]interface{})["destination"])
+	})
+}
+
+// TestHelmInitJobAnnotations contains the tests for the annotations of the Init Job
+func TestHelmInitJobAnnotations(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		values      map[string]string
+		annotations map[string]string
+	}{
+		{
+			"No extra job annotations were supplied",
+			map[string]string{},
+			map[string]string{
+				"helm.sh/hook":               "post-install,post-upgrade",
+				"helm.sh/hook-weight":        "0",
+				"helm.sh/hook-delete-policy": "before-hook-creation",
+			},
+		},
+		{
+			"Extra job annotations were supplied",
+			map[string]string{
+				"init.jobAnnotations.test-key-1": "test-value-1",
+				"init.jobAnnotations.test-key-2": "test-value-2",
+			},
+			map[string]string{
+				"helm.sh/hook":               "post-install,post-upgrade",
+				"helm.sh/hook-weight":        "0",
+				"helm.sh/hook-delete-policy": "before-hook-creation",
+				"test-key-1":                 "test-value-1",
+				"test-key-2":                 "test-value-2",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+			output, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+			require.Equal(subT, err, nil)
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(t, output, &job)
+
+			require.Equal(t, testCase.annotations, job.Annotations)
+		})
+	}
+}
+
+func TestStatefulSetInitContainers(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		initContainer bool
 		volume        bool
 		values        map[string]string
 	}{
@@ -1449,6 +2256,62 @@ func TestStatefulSetInitContainers(t *testing.T) {
 }
 
 // TestHelmCockroachStartCmd tests the arguments to the cockroach start command.
+func TestHelmEntrypointOverride(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		t.Parallel()
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		podSpec := statefulset.Spec.Template.Spec
+		require.Contains(t, podSpec.Containers[0].Args[2], "exec /cockroach/cockroach start")
+		for _, volume := range podSpec.Volumes {
+			require.NotEqual(t, "entrypoint", volume.Name)
+		}
+	})
+
+	t.Run("Wrapper script of a ConfigMap", func(t *testing.T) {
+		t.Parallel()
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"statefulset.entrypointOverride.configMap": "cockroachdb-entrypoint",
+				"statefulset.entrypointOverride.key":       "wrapper.sh",
+			},
+		}
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		podSpec := statefulset.Spec.Template.Spec
+		require.Contains(t, podSpec.Containers[0].Args[2], "exec /cockroach/entrypoint/wrapper.sh /cockroach/cockroach start")
+		require.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "entrypoint",
+			MountPath: "/cockroach/entrypoint/",
+			ReadOnly:  true,
+		})
+
+		mode := int32(0555)
+		require.Contains(t, podSpec.Volumes, corev1.Volume{
+			Name: "entrypoint",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "cockroachdb-entrypoint"},
+					Items:                []corev1.KeyToPath{{Key: "wrapper.sh", Path: "wrapper.sh"}},
+					DefaultMode:          &mode,
+				},
+			},
+		})
+	})
+}
+
 func TestHelmCockroachStartCmd(t *testing.T) {
 	t.Parallel()
 
@@ -1464,7 +2327,8 @@ func TestHelmCockroachStartCmd(t *testing.T) {
 		{
 			"start single node with default args",
 			map[string]string{
-				"conf.single-node": "true",
+				"conf.single-node":     "true",
+				"statefulset.replicas": "1",
 			},
 			expect{
 				"exec /cockroach/cockroach start-single-node " +
@@ -1481,6 +2345,7 @@ func TestHelmCockroachStartCmd(t *testing.T) {
 			"start single node with custom args",
 			map[string]string{
 				"conf.single-node":                 "true",
+				"statefulset.replicas":             "1",
 				"tls.enabled":                      "false",
 				"conf.attrs":                       "gpu",
 				"service.ports.http.port":          "8081",
@@ -1807,3 +2672,5149 @@ func TestHelmWALFailoverConfiguration(t *testing.T) {
 		})
 	}
 }
+
+// TestHelmFullnameOverride verifies that every internal reference to a generated resource name follows
+// fullnameOverride, so that the StatefulSet, its Services, the init Job and the certificates stay consistent.
+func TestHelmListenAddresses(t *testing.T) {
+	t.Parallel()
+
+	type expect struct {
+		statefulsetArgument string
+		renderErr           string
+		podIPEnv            bool
+	}
+
+	testCases := []struct {
+		name   string
+		values map[string]string
+		expect expect
+	}{
+		{
+			"Listeners bound to the Pod IP",
+			map[string]string{
+				"conf.listen.addr":              "podIP",
+				"conf.listen.httpAddr":          "podIP",
+				"conf.listen.advertiseHttpAddr": "podIP",
+			},
+			expect{
+				"--port=26257 " +
+					"--listen-addr=${POD_IP}:26257 " +
+					"--http-addr=${POD_IP}:8080 " +
+					"--advertise-http-addr=${POD_IP}",
+				"",
+				true,
+			},
+		},
+		{
+			"Separate SQL listener",
+			map[string]string{
+				"conf.listen.addr":    "10.0.0.1",
+				"conf.listen.sqlAddr": "192.168.0.1",
+			},
+			expect{
+				"--listen-addr=10.0.0.1:26257 " +
+					"--sql-addr=192.168.0.1:26257",
+				"",
+				false,
+			},
+		},
+		{
+			"SQL listener without RPC listener host",
+			map[string]string{
+				"conf.listen.sqlAddr": "podIP",
+			},
+			expect{
+				"",
+				"conf.listen.sqlAddr requires conf.listen.addr to be set to another host",
+				false,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		var statefulset appsv1.StatefulSet
+
+		// Here, we capture the range variable and force it into the scope of this block.
+		// If we don't do this, when the subtest switches contexts (because of t.Parallel),
+		// the testCase value will have been updated by the for loop and will be the next testCase.
+		testCase := testCase
+
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(
+				subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"},
+			)
+			if testCase.expect.renderErr != "" {
+				require.ErrorContains(subT, err, testCase.expect.renderErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			container := statefulset.Spec.Template.Spec.Containers[0]
+			require.Contains(subT, container.Args[2], testCase.expect.statefulsetArgument)
+
+			podIPEnv := false
+			for _, env := range container.Env {
+				if env.Name == "POD_IP" {
+					podIPEnv = true
+					require.Equal(subT, "status.podIP", env.ValueFrom.FieldRef.FieldPath)
+				}
+			}
+			require.Equal(subT, testCase.expect.podIPEnv, podIPEnv)
+		})
+	}
+}
+
+func TestHelmMaxGoMemory(t *testing.T) {
+	t.Parallel()
+
+	type expect struct {
+		flag      string
+		env       string
+		renderErr string
+	}
+
+	testCases := []struct {
+		name   string
+		values map[string]string
+		expect expect
+	}{
+		{
+			"Default of CockroachDB",
+			map[string]string{},
+			expect{"", "", ""},
+		},
+		{
+			"Percentage of the memory limit as a flag",
+			map[string]string{
+				"conf.max-go-memory":                  "80%",
+				"statefulset.resources.limits.memory": "8Gi",
+			},
+			expect{"--max-go-memory=6871947673", "", ""},
+		},
+		{
+			"Percentage of the memory limit of the profile",
+			map[string]string{
+				"profile":            "small",
+				"conf.max-go-memory": "75%",
+			},
+			expect{"--max-go-memory=1610612736", "", ""},
+		},
+		{
+			"Percentage of the memory limit as an env var before v23.2",
+			map[string]string{
+				"image.tag":                           "v23.1.14",
+				"conf.max-go-memory":                  "80%",
+				"statefulset.resources.limits.memory": "4G",
+			},
+			expect{"", "3200000000", ""},
+		},
+		{
+			"Size as an env var of a custom image",
+			map[string]string{
+				"image.repository":   "registry.example.com/cockroach",
+				"conf.max-go-memory": "6GiB",
+			},
+			expect{"", "6GiB", ""},
+		},
+		{
+			"Percentage without memory limit",
+			map[string]string{
+				"conf.max-go-memory": "80%",
+			},
+			expect{"", "", "conf.max-go-memory set to a percentage requires a memory limit"},
+		},
+		{
+			"Combined with a GOMEMLIMIT env var",
+			map[string]string{
+				"conf.max-go-memory":       "6GiB",
+				"statefulset.env[0].name":  "GOMEMLIMIT",
+				"statefulset.env[0].value": "4GiB",
+			},
+			expect{"", "", "conf.max-go-memory can't be combined with a GOMEMLIMIT env var"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		var statefulset appsv1.StatefulSet
+
+		// Here, we capture the range variable and force it into the scope of this block.
+		// If we don't do this, when the subtest switches contexts (because of t.Parallel),
+		// the testCase value will have been updated by the for loop and will be the next testCase.
+		testCase := testCase
+
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(
+				subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"},
+			)
+			if testCase.expect.renderErr != "" {
+				require.ErrorContains(subT, err, testCase.expect.renderErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			container := statefulset.Spec.Template.Spec.Containers[0]
+			if testCase.expect.flag != "" {
+				require.Contains(subT, container.Args[2], testCase.expect.flag)
+			} else {
+				require.NotContains(subT, container.Args[2], "--max-go-memory")
+			}
+
+			goMemLimit := ""
+			for _, env := range container.Env {
+				if env.Name == "GOMEMLIMIT" {
+					goMemLimit = env.Value
+				}
+			}
+			require.Equal(subT, testCase.expect.env, goMemLimit)
+		})
+	}
+}
+
+func TestHelmStartupProbe(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		values           map[string]string
+		failureThreshold int32
+	}{
+		{
+			"Disabled by default",
+			map[string]string{},
+			0,
+		},
+		{
+			"Sized after the persistent volume",
+			map[string]string{
+				"statefulset.startupProbe.enabled": "true",
+			},
+			// ceil((300 + 600 * 100 / 1024) / 10)
+			36,
+		},
+		{
+			"Sized after the store size",
+			map[string]string{
+				"statefulset.startupProbe.enabled":       "true",
+				"statefulset.startupProbe.storeSize":     "4Ti",
+				"statefulset.startupProbe.periodSeconds": "20",
+			},
+			// ceil((300 + 600 * 4) / 20)
+			135,
+		},
+		{
+			"Overridden by the custom startup probe",
+			map[string]string{
+				"statefulset.startupProbe.enabled":                "true",
+				"statefulset.customStartupProbe.tcpSocket.port":   "grpc",
+				"statefulset.customStartupProbe.failureThreshold": "1000",
+			},
+			1000,
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			probe := statefulset.Spec.Template.Spec.Containers[0].StartupProbe
+			if testCase.failureThreshold == 0 {
+				require.Nil(subT, probe)
+				return
+			}
+			require.NotNil(subT, probe)
+			require.Equal(subT, testCase.failureThreshold, probe.FailureThreshold)
+		})
+	}
+}
+
+func TestHelmFullnameOverride(t *testing.T) {
+	t.Parallel()
+
+	const fullname = "crdb-custom"
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"fullnameOverride":                          fullname,
+			"image.credentials.registry":                "docker.io",
+			"image.credentials.username":                "john_doe",
+			"image.credentials.password":                "changeme",
+			"tls.selfSigner.image.credentials.registry": "gcr.io",
+			"tls.selfSigner.image.credentials.username": "john_doe",
+			"tls.selfSigner.image.credentials.password": "changeme",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	require.Equal(t, fullname, statefulset.Name)
+	require.Equal(t, fullname, statefulset.Spec.ServiceName)
+
+	env := map[string]string{}
+	for _, e := range statefulset.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	require.Equal(t, fullname, env["STATEFULSET_NAME"])
+	require.Equal(t, fullname+"."+namespaceName+".svc.cluster.local", env["STATEFULSET_FQDN"])
+
+	var pullSecrets []string
+	for _, s := range statefulset.Spec.Template.Spec.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, s.Name)
+	}
+	require.Equal(t, []string{fullname + ".db.registry", fullname + ".init-certs.registry"}, pullSecrets)
+
+	var nodeSecretFound bool
+	for _, v := range statefulset.Spec.Template.Spec.Volumes {
+		if v.Name == "certs-secret" {
+			nodeSecretFound = true
+			require.Equal(t, fullname+"-node-secret", v.Projected.Sources[0].Secret.Name)
+		}
+	}
+	require.True(t, nodeSecretFound, "Volume certs-secret not found")
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/secret.registry.yaml"})
+	require.Contains(t, output, "name: "+fullname+".db.registry")
+	require.Contains(t, output, "name: "+fullname+".init-certs.registry")
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	require.Equal(t, fullname+"-init", job.Name)
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2], "--host="+fullname+"-0."+fullname+":26257")
+	var clientSecretFound bool
+	for _, v := range job.Spec.Template.Spec.Volumes {
+		if v.Name == "certs-secret" {
+			clientSecretFound = true
+			require.Equal(t, fullname+"-client-secret", v.Projected.Sources[0].Secret.Name)
+		}
+	}
+	require.True(t, clientSecretFound, "Volume certs-secret not found")
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-certSelfSigner.yaml"})
+	helm.UnmarshalK8SYaml(t, output, &job)
+	require.Equal(t, fullname+"-self-signer", job.Name)
+	require.Equal(t, "STATEFULSET_NAME", job.Spec.Template.Spec.Containers[0].Env[0].Name)
+	require.Equal(t, fullname, job.Spec.Template.Spec.Containers[0].Env[0].Value)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/service.public.yaml"})
+	var service corev1.Service
+	helm.UnmarshalK8SYaml(t, output, &service)
+	require.Equal(t, fullname+"-public", service.Name)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/service.discovery.yaml"})
+	helm.UnmarshalK8SYaml(t, output, &service)
+	require.Equal(t, fullname, service.Name)
+
+	certManagerOptions := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"fullnameOverride":             fullname,
+			"tls.certs.selfSigner.enabled": "false",
+			"tls.certs.certManager":        "true",
+		},
+	}
+	output = helm.RenderTemplate(t, certManagerOptions, helmChartPath, releaseName, []string{"templates/certificate.node.yaml"})
+	require.Contains(t, output, fullname+"-public."+namespaceName+".svc.cluster.local")
+	require.Contains(t, output, "*."+fullname+"."+namespaceName+".svc.cluster.local")
+}
+
+// TestHelmServicePortsAppProtocol tests the appProtocol and naming of the ports in the public and discovery Services.
+func TestHelmDiscoveryServiceDNS(t *testing.T) {
+	t.Parallel()
+
+	const tolerateUnreadyEndpoints = "service.alpha.kubernetes.io/tolerate-unready-endpoints"
+
+	t.Run("Not ready addresses published by default", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/service.discovery.yaml"})
+
+		var service corev1.Service
+		helm.UnmarshalK8SYaml(t, output, &service)
+		require.True(t, service.Spec.PublishNotReadyAddresses)
+		require.Equal(t, "true", service.Annotations[tolerateUnreadyEndpoints])
+		require.Nil(t, service.Spec.IPFamilyPolicy)
+		require.Empty(t, service.Spec.IPFamilies)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+		require.Empty(t, statefulset.Spec.Template.Spec.DNSPolicy)
+		require.Nil(t, statefulset.Spec.Template.Spec.DNSConfig)
+	})
+
+	t.Run("Custom discovery and DNS options", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"service.discovery.publishNotReadyAddresses": "false",
+				"service.discovery.ipFamilyPolicy":           "PreferDualStack",
+				"service.discovery.ipFamilies[0]":            "IPv6",
+				"service.discovery.ipFamilies[1]":            "IPv4",
+				"statefulset.dnsPolicy":                      "None",
+				"statefulset.dnsConfig.nameservers[0]":       "10.96.0.10",
+				"statefulset.dnsConfig.searches[0]":          namespaceName + ".svc.cluster.local",
+				"statefulset.dnsConfig.options[0].name":      "ndots",
+			},
+			SetStrValues: map[string]string{
+				"statefulset.dnsConfig.options[0].value": "2",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/service.discovery.yaml"})
+
+		var service corev1.Service
+		helm.UnmarshalK8SYaml(t, output, &service)
+		require.False(t, service.Spec.PublishNotReadyAddresses)
+		require.NotContains(t, service.Annotations, tolerateUnreadyEndpoints)
+		require.Equal(t, corev1.IPFamilyPolicyPreferDualStack, *service.Spec.IPFamilyPolicy)
+		require.Equal(t, []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}, service.Spec.IPFamilies)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+		podSpec := statefulset.Spec.Template.Spec
+		require.Equal(t, corev1.DNSNone, podSpec.DNSPolicy)
+		ndots := "2"
+		require.Equal(t, &corev1.PodDNSConfig{
+			Nameservers: []string{"10.96.0.10"},
+			Searches:    []string{namespaceName + ".svc.cluster.local"},
+			Options:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}},
+		}, podSpec.DNSConfig)
+	})
+}
+
+func TestHelmServicePortsAppProtocol(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		values       map[string]string
+		expectNames  []string
+		appProtocols map[string]string
+	}{
+		{
+			"No appProtocol by default",
+			map[string]string{},
+			[]string{"grpc", "http"},
+			map[string]string{},
+		},
+		{
+			"Custom appProtocol and port names",
+			map[string]string{
+				"service.ports.grpc.external.name":        "tcp-sql",
+				"service.ports.grpc.external.appProtocol": "postgres",
+				"service.ports.grpc.internal.port":        "26258",
+				"service.ports.grpc.internal.name":        "tcp-rpc",
+				"service.ports.grpc.internal.appProtocol": "tcp",
+				"service.ports.http.name":                 "https-ui",
+				"service.ports.http.appProtocol":          "https",
+			},
+			[]string{"tcp-sql", "tcp-rpc", "https-ui"},
+			map[string]string{
+				"tcp-sql":  "postgres",
+				"tcp-rpc":  "tcp",
+				"https-ui": "https",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			for _, template := range []string{"templates/service.public.yaml", "templates/service.discovery.yaml"} {
+				output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{template})
+
+				var service corev1.Service
+				helm.UnmarshalK8SYaml(subT, output, &service)
+
+				var names []string
+				for _, port := range service.Spec.Ports {
+					names = append(names, port.Name)
+					if appProtocol, ok := testCase.appProtocols[port.Name]; ok {
+						require.NotNil(subT, port.AppProtocol)
+						require.Equal(subT, appProtocol, *port.AppProtocol)
+					} else {
+						require.Nil(subT, port.AppProtocol)
+					}
+				}
+				require.Equal(subT, testCase.expectNames, names)
+			}
+		})
+	}
+}
+
+// TestHelmGatewayAPIRoutes contains the tests for the Gateway API routes
+func TestHelmGatewayAPIRoutes(t *testing.T) {
+	t.Parallel()
+
+	type expect struct {
+		kind       string
+		hostnames  []interface{}
+		parentName string
+		port       int64
+	}
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		template string
+		expect   expect
+		expErr   string
+	}{
+		{
+			"HTTPRoute for the DB Console",
+			map[string]string{
+				"gatewayApi.enabled":                 "true",
+				"gatewayApi.http.enabled":            "true",
+				"gatewayApi.http.parentRefs[0].name": "gw",
+				"gatewayApi.http.hostnames[0]":       "crdb.example.com",
+			},
+			"templates/route.http.yaml",
+			expect{"HTTPRoute", []interface{}{"crdb.example.com"}, "gw", 8080},
+			"",
+		},
+		{
+			"HTTPRoute without parentRefs",
+			map[string]string{
+				"gatewayApi.enabled":      "true",
+				"gatewayApi.http.enabled": "true",
+			},
+			"templates/route.http.yaml",
+			expect{},
+			"gatewayApi.http.parentRefs can't be empty if gatewayApi.http.enabled is set to true",
+		},
+		{
+			"TCPRoute for SQL clients",
+			map[string]string{
+				"gatewayApi.enabled":                "true",
+				"gatewayApi.sql.enabled":            "true",
+				"gatewayApi.sql.parentRefs[0].name": "gw",
+				"gatewayApi.sql.hostnames[0]":       "sql.example.com",
+			},
+			"templates/route.sql.yaml",
+			expect{"TCPRoute", nil, "gw", 26257},
+			"",
+		},
+		{
+			"TLSRoute for SQL clients",
+			map[string]string{
+				"gatewayApi.enabled":                "true",
+				"gatewayApi.sql.enabled":            "true",
+				"gatewayApi.sql.kind":               "TLSRoute",
+				"gatewayApi.sql.parentRefs[0].name": "gw",
+				"gatewayApi.sql.hostnames[0]":       "sql.example.com",
+			},
+			"templates/route.sql.yaml",
+			expect{"TLSRoute", []interface{}{"sql.example.com"}, "gw", 26257},
+			"",
+		},
+		{
+			"Invalid SQL route kind",
+			map[string]string{
+				"gatewayApi.enabled":                "true",
+				"gatewayApi.sql.enabled":            "true",
+				"gatewayApi.sql.kind":               "UDPRoute",
+				"gatewayApi.sql.parentRefs[0].name": "gw",
+			},
+			"templates/route.sql.yaml",
+			expect{},
+			"gatewayApi.sql.kind should be either TCPRoute or TLSRoute",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{testCase.template})
+			if testCase.expErr != "" {
+				require.Error(subT, err)
+				require.Contains(subT, err.Error(), testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var route unstructured.Unstructured
+			helm.UnmarshalK8SYaml(subT, output, &route)
+
+			require.Equal(subT, testCase.expect.kind, route.GetKind())
+
+			hostnames, _, _ := unstructured.NestedSlice(route.Object, "spec", "hostnames")
+			require.Equal(subT, testCase.expect.hostnames, hostnames)
+
+			parentRefs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+			require.Len(subT, parentRefs, 1)
+			require.Equal(subT, testCase.expect.parentName, parentRefs[0].(map[string]interface{})["name"])
+
+			rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+			require.Len(subT, rules, 1)
+			backendRefs, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "backendRefs")
+			require.Len(subT, backendRefs, 1)
+			backendRef := backendRefs[0].(map[string]interface{})
+			require.Equal(subT, "helm-basic-cockroachdb-public", backendRef["name"])
+			require.Equal(subT, testCase.expect.port, backendRef["port"])
+		})
+	}
+}
+
+// TestHelmHookAnnotations contains the tests for the hook annotations of the hook resources
+func TestHelmHookAnnotations(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		values      map[string]string
+		template    string
+		annotations map[string]string
+	}{
+		{
+			"Default self-signer job hook annotations",
+			map[string]string{
+				"tls.enabled": "true",
+			},
+			"templates/job-certSelfSigner.yaml",
+			map[string]string{
+				"helm.sh/hook":               "pre-install,pre-upgrade",
+				"helm.sh/hook-weight":        "4",
+				"helm.sh/hook-delete-policy": "hook-succeeded,hook-failed",
+			},
+		},
+		{
+			"Custom self-signer job hook weight and delete policy",
+			map[string]string{
+				"tls.enabled":                     "true",
+				"hooks.weights.selfSignerJob":     "10",
+				"hooks.deletePolicies.selfSigner": "before-hook-creation",
+			},
+			"templates/job-certSelfSigner.yaml",
+			map[string]string{
+				"helm.sh/hook":               "pre-install,pre-upgrade",
+				"helm.sh/hook-weight":        "10",
+				"helm.sh/hook-delete-policy": "before-hook-creation",
+			},
+		},
+		{
+			"Argo CD self-signer job hook annotations",
+			map[string]string{
+				"tls.enabled":                 "true",
+				"argocdCompatibility.enabled": "true",
+			},
+			"templates/job-certSelfSigner.yaml",
+			map[string]string{
+				"argocd.argoproj.io/hook":               "PreSync",
+				"argocd.argoproj.io/sync-wave":          "4",
+				"argocd.argoproj.io/hook-delete-policy": "HookSucceeded,HookFailed",
+			},
+		},
+		{
+			"Argo CD init job hook annotations",
+			map[string]string{
+				"argocdCompatibility.enabled": "true",
+			},
+			"templates/job.init.yaml",
+			map[string]string{
+				"argocd.argoproj.io/hook":               "PostSync",
+				"argocd.argoproj.io/sync-wave":          "0",
+				"argocd.argoproj.io/hook-delete-policy": "BeforeHookCreation",
+			},
+		},
+		{
+			"Argo CD cleaner job hook annotations",
+			map[string]string{
+				"tls.enabled":                 "true",
+				"argocdCompatibility.enabled": "true",
+			},
+			"templates/job-cleaner.yaml",
+			map[string]string{
+				"argocd.argoproj.io/hook":               "PreDelete",
+				"argocd.argoproj.io/sync-wave":          "0",
+				"argocd.argoproj.io/hook-delete-policy": "HookSucceeded,HookFailed",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{testCase.template})
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			for key, value := range testCase.annotations {
+				require.Equal(subT, value, job.Annotations[key])
+			}
+
+			if testCase.values["argocdCompatibility.enabled"] == "true" {
+				require.NotContains(subT, job.Annotations, "helm.sh/hook")
+			}
+		})
+	}
+}
+
+// TestHelmStatefulSetPodManagement contains the tests for the StatefulSet Pod management values
+func TestHelmStatefulSetPodManagement(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		values              map[string]string
+		podManagementPolicy appsv1.PodManagementPolicyType
+		minReadySeconds     int32
+		startOrdinal        int64
+	}{
+		{
+			"Default values",
+			map[string]string{},
+			appsv1.ParallelPodManagement,
+			0,
+			0,
+		},
+		{
+			"Custom values",
+			map[string]string{
+				"statefulset.podManagementPolicy": "OrderedReady",
+				"statefulset.minReadySeconds":     "10",
+				"statefulset.ordinals.start":      "1",
+			},
+			appsv1.OrderedReadyPodManagement,
+			10,
+			1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			require.Equal(subT, testCase.podManagementPolicy, statefulset.Spec.PodManagementPolicy)
+			require.Equal(subT, testCase.minReadySeconds, statefulset.Spec.MinReadySeconds)
+
+			// ordinals are not part of the vendored StatefulSet API yet
+			var sts unstructured.Unstructured
+			helm.UnmarshalK8SYaml(subT, output, &sts)
+			startOrdinal, _, _ := unstructured.NestedInt64(sts.Object, "spec", "ordinals", "start")
+			require.Equal(subT, testCase.startOrdinal, startOrdinal)
+
+			startCmd := statefulset.Spec.Template.Spec.Containers[0].Args[2]
+			require.Contains(subT, startCmd, fmt.Sprintf("--join=${STATEFULSET_NAME}-%d.${STATEFULSET_FQDN}:26257", testCase.startOrdinal))
+
+			output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			require.Contains(subT, job.Spec.Template.Spec.Containers[0].Command[2],
+				fmt.Sprintf("--host=helm-basic-cockroachdb-%d.helm-basic-cockroachdb:26257", testCase.startOrdinal))
+		})
+	}
+}
+
+// TestHelmFollowerReadsService contains the tests for the follower reads Service
+func TestHelmFollowerReadsService(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/service.followerreads.yaml"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not find template templates/service.followerreads.yaml in chart")
+
+	options.SetValues = map[string]string{
+		"service.followerReads.enabled":                           "true",
+		"service.followerReads.port":                              "26260",
+		"service.followerReads.name":                              "sql-follower-reads",
+		"service.followerReads.annotations.example\\.com/traffic": "read-only",
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/service.followerreads.yaml"})
+
+	var service corev1.Service
+	helm.UnmarshalK8SYaml(t, output, &service)
+
+	require.Equal(t, "helm-basic-cockroachdb-follower-reads", service.Name)
+	require.Equal(t, "read-only", service.Annotations["example.com/traffic"])
+	require.Len(t, service.Spec.Ports, 1)
+	require.Equal(t, "sql-follower-reads", service.Spec.Ports[0].Name)
+	require.Equal(t, int32(26260), service.Spec.Ports[0].Port)
+	require.Equal(t, "grpc", service.Spec.Ports[0].TargetPort.String())
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/service.public.yaml"})
+
+	var publicService corev1.Service
+	helm.UnmarshalK8SYaml(t, output, &publicService)
+
+	require.Equal(t, publicService.Spec.Selector, service.Spec.Selector)
+
+	// The nodes serve the follower reads Service with their certificates.
+	followerReadsNames := []string{
+		"helm-basic-cockroachdb-follower-reads",
+		"helm-basic-cockroachdb-follower-reads." + namespaceName,
+		"helm-basic-cockroachdb-follower-reads." + namespaceName + ".svc.cluster.local",
+	}
+
+	options.SetValues["tls.certs.selfSigner.enabled"] = "false"
+	options.SetValues["tls.certs.certManager"] = "true"
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/certificate.node.yaml"})
+
+	var certificate struct {
+		Spec struct {
+			DNSNames []string `json:"dnsNames"`
+		} `json:"spec"`
+	}
+	helm.UnmarshalK8SYaml(t, output, &certificate)
+	require.Subset(t, certificate.Spec.DNSNames, followerReadsNames)
+
+	options.SetValues["service.followerReads.enabled"] = "false"
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/certificate.node.yaml"})
+	helm.UnmarshalK8SYaml(t, output, &certificate)
+	require.NotContains(t, certificate.Spec.DNSNames, followerReadsNames[0])
+
+	options.SetValues = map[string]string{"service.followerReads.enabled": "true"}
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-certSelfSigner.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Env,
+		corev1.EnvVar{Name: "FOLLOWER_READS_SERVICE_NAME", Value: "helm-basic-cockroachdb-follower-reads"})
+}
+
+// TestHelmPublicServiceDisabled contains the tests for the clusters only exposed through the discovery Service
+func TestHelmPublicServiceDisabled(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"service.public.enabled":   "false",
+			"statistics.reset.enabled": "true",
+		},
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/service.public.yaml"})
+	require.ErrorContains(t, err, "could not find template templates/service.public.yaml in chart")
+
+	// The Jobs of the chart connect through the discovery Service instead.
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob.statistics.yaml"})
+	require.Contains(t, output, "--host=helm-basic-cockroachdb:26257")
+	require.NotContains(t, output, "helm-basic-cockroachdb-public")
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		template string
+		expErr   string
+	}{
+		{
+			"Ingress",
+			map[string]string{
+				"service.public.enabled": "false",
+				"ingress.enabled":        "true",
+			},
+			"templates/ingress.yaml",
+			"ingress.enabled requires service.public.enabled",
+		},
+		{
+			"SQL route",
+			map[string]string{
+				"service.public.enabled":  "false",
+				"gatewayApi.enabled":      "true",
+				"gatewayApi.sql.enabled":  "true",
+				"gatewayApi.http.enabled": "false",
+			},
+			"templates/route.sql.yaml",
+			"gatewayApi.http and gatewayApi.sql require service.public.enabled",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			_, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{testCase.template})
+			require.ErrorContains(subT, err, testCase.expErr)
+		})
+	}
+}
+
+// TestHelmNamespaceScopedRBAC contains the tests for the installs without cluster-scoped RBAC
+func TestHelmNamespaceScopedRBAC(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		values        map[string]string
+		clusterScoped bool
+	}{
+		{
+			"Cluster-scoped RBAC by default",
+			map[string]string{
+				"tls.enabled": "true",
+			},
+			true,
+		},
+		{
+			"Namespace-scoped RBAC only",
+			map[string]string{
+				"tls.enabled":        "true",
+				"rbac.clusterScoped": "false",
+			},
+			false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			for _, template := range []string{"templates/clusterrole.yaml", "templates/clusterrolebinding.yaml"} {
+				_, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{template})
+				require.Equal(subT, testCase.clusterScoped, err == nil)
+			}
+
+			// namespaced RBAC is rendered regardless of the cluster-scoped one
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/role.yaml"})
+
+			var role rbacv1.Role
+			helm.UnmarshalK8SYaml(subT, output, &role)
+			require.Equal(subT, namespaceName, role.Namespace)
+		})
+	}
+}
+
+// TestHelmLocalityFromNodeLabels contains the tests for deriving the locality from the node labels
+func TestHelmLocalityFromNodeLabels(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		locality string
+		expErr   string
+	}{
+		{
+			"Locality derived from node labels",
+			map[string]string{
+				"conf.localityFromNodeLabels.enabled": "true",
+			},
+			"--locality=$(cat /cockroach/locality/locality)",
+			"",
+		},
+		{
+			"Locality derived from node labels with additional tiers",
+			map[string]string{
+				"conf.localityFromNodeLabels.enabled": "true",
+				"conf.locality":                       "rack=12",
+			},
+			"--locality=$(cat /cockroach/locality/locality),rack=12",
+			"",
+		},
+		{
+			"Locality derived from node labels without cluster-scoped RBAC",
+			map[string]string{
+				"conf.localityFromNodeLabels.enabled": "true",
+				"rbac.clusterScoped":                  "false",
+			},
+			"",
+			"conf.localityFromNodeLabels requires rbac.clusterScoped to be enabled to read the node labels",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			if testCase.expErr != "" {
+				require.Error(subT, err)
+				require.Contains(subT, err.Error(), testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			require.Contains(subT, statefulset.Spec.Template.Spec.Containers[0].Args[2], testCase.locality)
+
+			var localityContainer *corev1.Container
+			for i, container := range statefulset.Spec.Template.Spec.InitContainers {
+				if container.Name == "locality" {
+					localityContainer = &statefulset.Spec.Template.Spec.InitContainers[i]
+				}
+			}
+			require.NotNil(subT, localityContainer)
+			require.Equal(subT, []string{
+				"locality",
+				"--tier=region=topology.kubernetes.io/region",
+				"--tier=zone=topology.kubernetes.io/zone",
+				"--output=/cockroach/locality/locality",
+			}, localityContainer.Args)
+			require.Equal(subT, "spec.nodeName", localityContainer.Env[0].ValueFrom.FieldRef.FieldPath)
+
+			output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/clusterrole.yaml"})
+
+			var clusterRole rbacv1.ClusterRole
+			helm.UnmarshalK8SYaml(subT, output, &clusterRole)
+
+			require.Contains(subT, clusterRole.Rules, rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"nodes"},
+				Verbs:     []string{"get"},
+			})
+		})
+	}
+}
+
+func TestHelmLocalityFromPodLabelsAndFile(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		locality string
+		expErr   string
+	}{
+		{
+			"Locality derived from Pod labels",
+			map[string]string{
+				"conf.localityFromPodLabels.enabled": "true",
+				"rbac.clusterScoped":                 "false",
+			},
+			"--locality=$(cat /cockroach/locality/locality)",
+			"",
+		},
+		{
+			"Locality read from a file with additional tiers",
+			map[string]string{
+				"conf.localityFile": "/cockroach/locality-config/locality",
+				"conf.locality":     "rack=12",
+			},
+			"--locality=$(cat /cockroach/locality-config/locality),rack=12",
+			"",
+		},
+		{
+			"Relative locality file",
+			map[string]string{
+				"conf.localityFile": "locality",
+			},
+			"",
+			"conf.localityFile must be an absolute path, got locality",
+		},
+		{
+			"Locality derived from both node and Pod labels",
+			map[string]string{
+				"conf.localityFromNodeLabels.enabled": "true",
+				"conf.localityFromPodLabels.enabled":  "true",
+			},
+			"",
+			"only one of conf.localityFromNodeLabels, conf.localityFromPodLabels can be set",
+		},
+		{
+			"Pod label tier without key",
+			map[string]string{
+				"conf.localityFromPodLabels.enabled":  "true",
+				"conf.localityFromPodLabels.tiers[0]": "topology.kubernetes.io/region",
+			},
+			"",
+			"conf.localityFromPodLabels.tiers must be key=label pairs, got topology.kubernetes.io/region",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			require.Contains(subT, statefulset.Spec.Template.Spec.Containers[0].Args[2], testCase.locality)
+
+			var localityContainer *corev1.Container
+			for i, container := range statefulset.Spec.Template.Spec.InitContainers {
+				if container.Name == "locality" {
+					localityContainer = &statefulset.Spec.Template.Spec.InitContainers[i]
+				}
+			}
+			if testCase.values["conf.localityFromPodLabels.enabled"] != "true" {
+				require.Nil(subT, localityContainer)
+				return
+			}
+
+			// The labels of the Pod are projected for the init container writing the locality file.
+			require.NotNil(subT, localityContainer)
+			require.Equal(subT, corev1.EnvVar{Name: "TIERS", Value: "region=topology.kubernetes.io/region zone=topology.kubernetes.io/zone"}, localityContainer.Env[0])
+			require.Contains(subT, localityContainer.Command[2], `echo -n "${locality}" > /cockroach/locality/locality`)
+
+			var podLabels *corev1.DownwardAPIVolumeSource
+			for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+				if volume.Name == "pod-labels" {
+					podLabels = volume.DownwardAPI
+				}
+			}
+			require.NotNil(subT, podLabels)
+			require.Equal(subT, "metadata.labels", podLabels.Items[0].FieldRef.FieldPath)
+		})
+	}
+}
+
+// TestHelmPreUpgradeBackupJob contains the tests for the pre-upgrade backup Job
+func TestHelmPreUpgradeBackupJob(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		values      map[string]string
+		statement   string
+		destination string
+		expErr      string
+	}{
+		{
+			"Backup to a destination",
+			map[string]string{
+				"upgrade.backupFirst.enabled":     "true",
+				"upgrade.backupFirst.destination": "s3://backups/crdb?AUTH=implicit",
+			},
+			`--execute="BACKUP INTO '${BACKUP_DESTINATION}' AS OF SYSTEM TIME '-10s';"`,
+			"s3://backups/crdb?AUTH=implicit",
+			"",
+		},
+		{
+			"Backup with options",
+			map[string]string{
+				"upgrade.backupFirst.enabled":     "true",
+				"upgrade.backupFirst.destination": "s3://backups/crdb?AUTH=implicit",
+				"upgrade.backupFirst.options[0]":  "revision_history",
+			},
+			`--execute="BACKUP INTO '${BACKUP_DESTINATION}' AS OF SYSTEM TIME '-10s' WITH revision_history;"`,
+			"s3://backups/crdb?AUTH=implicit",
+			"",
+		},
+		{
+			"Backup encrypted with a KMS key",
+			map[string]string{
+				"upgrade.backupFirst.enabled":           "true",
+				"upgrade.backupFirst.destination":       "s3://backups/crdb?AUTH=implicit",
+				"upgrade.backupFirst.options[0]":        "revision_history",
+				"upgrade.backupFirst.encryption.kmsUri": "aws-kms:///key?AUTH=implicit&REGION=us-east-1",
+			},
+			`--execute="BACKUP INTO '${BACKUP_DESTINATION}' AS OF SYSTEM TIME '-10s' WITH revision_history, kms = '$BACKUP_KMS_URI';"`,
+			"s3://backups/crdb?AUTH=implicit",
+			"",
+		},
+		{
+			"Backup encrypted with a passphrase",
+			map[string]string{
+				"upgrade.backupFirst.enabled":                     "true",
+				"upgrade.backupFirst.destination":                 "s3://backups/crdb?AUTH=implicit",
+				"upgrade.backupFirst.encryption.passphraseSecret": "backup-passphrase",
+			},
+			`--execute="BACKUP INTO '${BACKUP_DESTINATION}' AS OF SYSTEM TIME '-10s' WITH encryption_passphrase = '$BACKUP_PASSPHRASE';"`,
+			"s3://backups/crdb?AUTH=implicit",
+			"",
+		},
+		{
+			"Backup encrypted with both a KMS key and a passphrase",
+			map[string]string{
+				"upgrade.backupFirst.enabled":                     "true",
+				"upgrade.backupFirst.destination":                 "s3://backups/crdb?AUTH=implicit",
+				"upgrade.backupFirst.encryption.kmsUri":           "aws-kms:///key?AUTH=implicit&REGION=us-east-1",
+				"upgrade.backupFirst.encryption.passphraseSecret": "backup-passphrase",
+			},
+			"",
+			"",
+			"encryption.kmsUri and encryption.passphraseSecret of a backup can't be both set",
+		},
+		{
+			"Backup without destination",
+			map[string]string{
+				"upgrade.backupFirst.enabled": "true",
+			},
+			"",
+			"",
+			"upgrade.backupFirst.destination or upgrade.backupFirst.destinationSecret must be set if upgrade.backupFirst.enabled is set to true",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/job.backup.yaml"})
+			if testCase.expErr != "" {
+				require.Error(subT, err)
+				require.Contains(subT, err.Error(), testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			require.Equal(subT, "pre-upgrade", job.Annotations["helm.sh/hook"])
+			require.Equal(subT, "5", job.Annotations["helm.sh/hook-weight"])
+
+			container := job.Spec.Template.Spec.Containers[0]
+			require.Contains(subT, container.Command[2], testCase.statement)
+			require.Contains(subT, container.Command[2], "--host=helm-basic-cockroachdb-public:26257")
+			require.Equal(subT, "BACKUP_DESTINATION", container.Env[0].Name)
+			require.Equal(subT, testCase.destination, container.Env[0].Value)
+		})
+	}
+}
+
+// TestHelmUpgradeFinalization contains the tests for the manual finalization of the major version upgrades
+func TestHelmUpgradeFinalization(t *testing.T) {
+	t.Parallel()
+
+	templates := []string{"templates/job.upgradeFinalization.yaml", "templates/tests/upgradeFinalization.yaml"}
+
+	testCases := []struct {
+		name      string
+		values    map[string]string
+		jobName   string
+		hook      string
+		statement string
+		expErr    string
+	}{
+		{
+			"Disabled by default",
+			map[string]string{},
+			"",
+			"",
+			"",
+			"could not find template templates/job.upgradeFinalization.yaml in chart",
+		},
+		{
+			"Preserve the downgrade option",
+			map[string]string{
+				"upgrade.finalize.manual": "true",
+			},
+			"helm-basic-cockroachdb-preserve-downgrade",
+			"pre-upgrade",
+			`SET CLUSTER SETTING cluster.preserve_downgrade_option = '${VERSION}'`,
+			"",
+		},
+		{
+			"Finalize the upgrade",
+			map[string]string{
+				"upgrade.finalize.manual":  "true",
+				"upgrade.finalize.enabled": "true",
+			},
+			"helm-basic-cockroachdb-finalize-upgrade",
+			"post-upgrade",
+			"RESET CLUSTER SETTING cluster.preserve_downgrade_option",
+			"",
+		},
+		{
+			"Not supported with Argo CD",
+			map[string]string{
+				"upgrade.finalize.manual":     "true",
+				"argocdCompatibility.enabled": "true",
+			},
+			"",
+			"",
+			"",
+			"upgrade.finalize is not supported with argocdCompatibility",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, templates[:1])
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			require.Equal(subT, testCase.jobName, job.Name)
+			require.Equal(subT, testCase.hook, job.Annotations["helm.sh/hook"])
+			require.Equal(subT, "6", job.Annotations["helm.sh/hook-weight"])
+
+			container := job.Spec.Template.Spec.Containers[0]
+			require.Contains(subT, container.Command[2], testCase.statement)
+			require.Contains(subT, container.Command[2], "SHOW CLUSTER SETTING version")
+			require.Equal(subT, corev1.EnvVar{Name: "COCKROACH_HOST", Value: "helm-basic-cockroachdb-public:26257"}, container.Env[0])
+			require.Equal(subT, corev1.EnvVar{Name: "COCKROACH_CERTS_DIR", Value: "/cockroach-certs/"}, container.Env[1])
+
+			// The status of the finalization is reported by a Helm test.
+			output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, templates[1:])
+
+			var pod corev1.Pod
+			helm.UnmarshalK8SYaml(subT, output, &pod)
+
+			require.Equal(subT, "test", pod.Annotations["helm.sh/hook"])
+			require.Contains(subT, pod.Spec.Containers[0].Command[2], "crdb_internal.node_executable_version()")
+			require.NotContains(subT, pod.Spec.Containers[0].Command[2], "preserve_downgrade_option =")
+		})
+	}
+}
+
+func TestHelmRebalance(t *testing.T) {
+	t.Parallel()
+
+	template := []string{"templates/job.rebalance.yaml"}
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, template)
+	require.ErrorContains(t, err, "could not find template templates/job.rebalance.yaml in chart")
+
+	t.Run("Wait for the rebalancing", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"rebalance.enabled":       "true",
+				"rebalance.settledChecks": "5",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, template)
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+
+		require.Equal(t, "helm-basic-cockroachdb-rebalance", job.Name)
+		require.Equal(t, "post-install,post-upgrade", job.Annotations["helm.sh/hook"])
+		require.Equal(t, "7", job.Annotations["helm.sh/hook-weight"])
+
+		// Without statements, only the certificates are copied before waiting.
+		require.Len(t, job.Spec.Template.Spec.InitContainers, 1)
+		require.Equal(t, "copy-certs", job.Spec.Template.Spec.InitContainers[0].Name)
+
+		container := job.Spec.Template.Spec.Containers[0]
+		require.Contains(t, container.Command[2], `sql "${STATUS_QUERY}"`)
+		require.Contains(t, container.Command[2], "The rebalancing settled")
+		require.Equal(t, corev1.EnvVar{Name: "COCKROACH_HOST", Value: "helm-basic-cockroachdb-public:26257"}, container.Env[0])
+		require.Equal(t, corev1.EnvVar{Name: "COCKROACH_CERTS_DIR", Value: "/cockroach-certs/"}, container.Env[1])
+		require.Contains(t, container.Env[2].Value, "FROM crdb_internal.kv_store_status")
+		require.Equal(t, corev1.EnvVar{Name: "SETTLED_CHECKS", Value: "5"}, container.Env[4])
+	})
+
+	t.Run("Statements on an insecure cluster", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.enabled":             "false",
+				"rebalance.enabled":       "true",
+				"rebalance.statements[0]": "ALTER RANGE default CONFIGURE ZONE USING num_replicas = 5",
+				"rebalance.statements[1]": "ALTER DATABASE system CONFIGURE ZONE USING num_replicas = 5",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, template)
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+
+		require.Len(t, job.Spec.Template.Spec.InitContainers, 1)
+		statements := job.Spec.Template.Spec.InitContainers[0]
+		require.Equal(t, "rebalance-statements", statements.Name)
+		require.Equal(t, []string{
+			"/cockroach/cockroach",
+			"sql",
+			"--echo-sql",
+			"--execute=ALTER RANGE default CONFIGURE ZONE USING num_replicas = 5",
+			"--execute=ALTER DATABASE system CONFIGURE ZONE USING num_replicas = 5",
+		}, statements.Command)
+		require.Equal(t, corev1.EnvVar{Name: "COCKROACH_INSECURE", Value: "true"}, statements.Env[1])
+		require.Empty(t, job.Spec.Template.Spec.Volumes)
+	})
+}
+
+// TestHelmSelfSignerRotationNotifications contains the tests for the rotation notifications webhook
+func TestHelmSelfSignerRotationNotifications(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		values map[string]string
+		expect *corev1.EnvVar
+	}{
+		{
+			"No notifications by default",
+			map[string]string{},
+			nil,
+		},
+		{
+			"Webhook URL",
+			map[string]string{
+				"tls.certs.selfSigner.notifications.webhookUrl": "https://hooks.example.com/rotation",
+			},
+			&corev1.EnvVar{Name: "NOTIFICATION_WEBHOOK_URL", Value: "https://hooks.example.com/rotation"},
+		},
+		{
+			"Webhook URL from a Secret",
+			map[string]string{
+				"tls.certs.selfSigner.notifications.webhookUrl":       "https://hooks.example.com/rotation",
+				"tls.certs.selfSigner.notifications.webhookUrlSecret": "rotation-webhook",
+			},
+			&corev1.EnvVar{
+				Name: "NOTIFICATION_WEBHOOK_URL",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "rotation-webhook"},
+						Key:                  "webhookUrl",
+					},
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			values := map[string]string{"tls.enabled": "true"}
+			for key, value := range testCase.values {
+				values[key] = value
+			}
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      values,
+			}
+
+			for _, template := range []string{"templates/cronjob-ca-certSelfSigner.yaml", "templates/cronjob-client-node-certSelfSigner.yaml"} {
+				output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{template})
+
+				var cronjob batchv1.CronJob
+				helm.UnmarshalK8SYaml(subT, output, &cronjob)
+
+				var env *corev1.EnvVar
+				for i, e := range cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env {
+					if e.Name == "NOTIFICATION_WEBHOOK_URL" {
+						env = &cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env[i]
+					}
+				}
+				require.Equal(subT, testCase.expect, env)
+			}
+		})
+	}
+}
+
+// TestHelmTimezone contains the tests for the timezone configuration
+func TestHelmTimezone(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"timezone.name":                       "Europe/Paris",
+			"timezone.mountHostTzdata":            "true",
+			"timezone.sqlDefault":                 "Europe/Paris",
+			"init.provisioning.enabled":           "true",
+			"init.provisioning.databases[0].name": "testDatabase",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	container := statefulset.Spec.Template.Spec.Containers[0]
+	require.Contains(t, container.Env, corev1.EnvVar{Name: "TZ", Value: "Europe/Paris"})
+	require.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "tzdata", MountPath: "/usr/share/zoneinfo", ReadOnly: true})
+
+	var tzdata *corev1.Volume
+	for i, volume := range statefulset.Spec.Template.Spec.Volumes {
+		if volume.Name == "tzdata" {
+			tzdata = &statefulset.Spec.Template.Spec.Volumes[i]
+		}
+	}
+	require.NotNil(t, tzdata)
+	require.Equal(t, "/usr/share/zoneinfo", tzdata.HostPath.Path)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "TZ", Value: "Europe/Paris"})
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2], "ALTER ROLE ALL SET timezone = 'Europe/Paris';")
+}
+
+func TestHelmProvisioningSQLConfigMaps(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"init.provisioning.enabled":          "true",
+			"init.provisioning.sqlConfigMaps[0]": "schema",
+			"init.provisioning.sqlConfigMaps[1]": "seed",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	container := job.Spec.Template.Spec.Containers[0]
+	require.Contains(t, container.Command[2], "runSqlScripts;")
+	require.Contains(t, container.Command[2], "defaultdb.public.helm_sql_scripts")
+	require.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "sql-0", MountPath: "/cockroach/sql/00-schema/", ReadOnly: true})
+	require.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "sql-1", MountPath: "/cockroach/sql/01-seed/", ReadOnly: true})
+
+	configMaps := map[string]string{}
+	for _, volume := range job.Spec.Template.Spec.Volumes {
+		if volume.ConfigMap != nil {
+			configMaps[volume.Name] = volume.ConfigMap.Name
+		}
+	}
+	require.Equal(t, map[string]string{"sql-0": "schema", "sql-1": "seed"}, configMaps)
+
+	options.SetValues["init.provisioning.enabled"] = "false"
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	helm.UnmarshalK8SYaml(t, output, &job)
+	require.NotContains(t, job.Spec.Template.Spec.Containers[0].Command[2], "runSqlScripts;")
+}
+
+func TestHelmKerberos(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"kerberos.enabled":          "true",
+			"kerberos.keytabSecret":     "crdb-keytab",
+			"kerberos.krb5ConfigMap":    "krb5",
+			"init.provisioning.enabled": "true",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	container := statefulset.Spec.Template.Spec.Containers[0]
+	require.Contains(t, container.Env, corev1.EnvVar{Name: "KRB5_KTNAME", Value: "/cockroach/kerberos/keytab/krb5.keytab"})
+	require.Contains(t, container.Env, corev1.EnvVar{Name: "KRB5_CONFIG", Value: "/cockroach/kerberos/conf/krb5.conf"})
+	require.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "kerberos-keytab", MountPath: "/cockroach/kerberos/keytab/", ReadOnly: true})
+	require.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "kerberos-conf", MountPath: "/cockroach/kerberos/conf/", ReadOnly: true})
+
+	volumes := map[string]corev1.Volume{}
+	for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+		volumes[volume.Name] = volume
+	}
+	require.Equal(t, "crdb-keytab", volumes["kerberos-keytab"].Secret.SecretName)
+	require.Equal(t, "krb5", volumes["kerberos-conf"].ConfigMap.Name)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2],
+		"SET CLUSTER SETTING server.host_based_authentication.configuration = e'host all all all gss include_realm=0';")
+
+	options.SetValues["kerberos.keytabSecret"] = ""
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "kerberos.keytabSecret can't be empty")
+}
+
+func TestHelmEffectiveConfig(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"statefulset.effectiveConfig.enabled": "true",
+			"statefulset.args[0]":                 "--vmodule=raft=1",
+			"init.provisioning.enabled":           "true",
+			"init.provisioning.users[0].name":     "testUser",
+			"init.provisioning.users[0].password": "testPassword",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/configmap.effective-config.yaml"})
+
+	var configMap corev1.ConfigMap
+	helm.UnmarshalK8SYaml(t, output, &configMap)
+
+	require.Equal(t, fmt.Sprintf("%s-cockroachdb-effective-config", releaseName), configMap.Name)
+	require.Equal(t, "1", configMap.Data["revision"])
+	require.True(t, strings.HasPrefix(configMap.Data["start-command"], "exec /cockroach/cockroach\nstart --join="))
+	require.Contains(t, configMap.Data["start-command"], "\n--vmodule=raft=1")
+	require.Contains(t, configMap.Data["values.yaml"], "replicas: 3")
+	require.NotContains(t, output, "testPassword")
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	require.Equal(t, configMap.Data["start-command.sha256"], statefulset.Spec.Template.Annotations["checksum/start-command"])
+	require.Contains(t, statefulset.Spec.Template.Spec.Containers[0].Args[2], strings.ReplaceAll(strings.TrimSpace(configMap.Data["start-command"]), "\n", " "))
+}
+
+func TestHelmLocalityValidation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		values  map[string]string
+		expArgs []string
+		expErr  string
+	}{
+		{
+			"Static locality",
+			map[string]string{
+				"conf.localityValidation.enabled":    "true",
+				"conf.locality":                      "region=us-east1\\,zone=us-east1-b",
+				"statefulset.nodeSelector.pool":      "crdb",
+				"statefulset.nodeSelector.disk-type": "ssd",
+			},
+			[]string{
+				"validate-topology",
+				"--locality=region=us-east1,zone=us-east1-b",
+				"--tier=region=topology.kubernetes.io/region",
+				"--tier=zone=topology.kubernetes.io/zone",
+				"--node-selector=disk-type=ssd,pool=crdb",
+			},
+			"",
+		},
+		{
+			"Locality derived from the node labels",
+			map[string]string{
+				"conf.localityValidation.enabled":     "true",
+				"conf.localityFromNodeLabels.enabled": "true",
+			},
+			[]string{
+				"validate-topology",
+				"--from-node-labels",
+				"--tier=region=topology.kubernetes.io/region",
+				"--tier=zone=topology.kubernetes.io/zone",
+				"--node-selector=",
+			},
+			"",
+		},
+		{
+			"No locality to validate",
+			map[string]string{
+				"conf.localityValidation.enabled": "true",
+			},
+			nil,
+			"conf.localityValidation requires conf.locality or conf.localityFromNodeLabels to be set",
+		},
+		{
+			"Namespace-scoped RBAC",
+			map[string]string{
+				"conf.localityValidation.enabled": "true",
+				"conf.locality":                   "region=us-east1",
+				"rbac.clusterScoped":              "false",
+			},
+			nil,
+			"conf.localityValidation requires rbac.clusterScoped to be enabled to read the node labels",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/job-validateTopology.yaml"})
+			if testCase.expErr != "" {
+				require.Error(subT, err)
+				require.Contains(subT, err.Error(), testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			require.Equal(subT, "pre-install,pre-upgrade", job.Annotations["helm.sh/hook"])
+			require.Equal(subT, "helm-basic-cockroachdb-validate-topology", job.Spec.Template.Spec.ServiceAccountName)
+			require.Equal(subT, testCase.expArgs, job.Spec.Template.Spec.Containers[0].Args)
+
+			output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/clusterrole-validateTopology.yaml"})
+
+			var clusterRole rbacv1.ClusterRole
+			helm.UnmarshalK8SYaml(subT, output, &clusterRole)
+			require.Equal(subT, []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"list"}}}, clusterRole.Rules)
+		})
+	}
+}
+
+func TestHelmInitBarrier(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"init.barrier.enabled": "true",
+			"init.barrier.timeout": "5m",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/configmap.init-status.yaml"})
+
+	var configMap corev1.ConfigMap
+	helm.UnmarshalK8SYaml(t, output, &configMap)
+	require.Equal(t, fmt.Sprintf("%s-cockroachdb-init-status", releaseName), configMap.Name)
+	require.Equal(t, "Pending", configMap.Data["status"])
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	containers := job.Spec.Template.Spec.Containers
+	require.Len(t, containers, 2)
+	require.Equal(t, "init-barrier", containers[1].Name)
+	require.Equal(t, []string{
+		"init-barrier",
+		fmt.Sprintf("--configmap=%s-cockroachdb-init-status", releaseName),
+		"--container=cluster-init",
+		fmt.Sprintf("--pod-selector=app.kubernetes.io/name=cockroachdb,app.kubernetes.io/instance=%s,!job-name", releaseName),
+		"--timeout=5m",
+	}, containers[1].Args)
+
+	options.SetValues["tls.enabled"] = "false"
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/role.yaml"})
+
+	var role rbacv1.Role
+	helm.UnmarshalK8SYaml(t, output, &role)
+	require.Len(t, role.Rules, 3)
+	require.Equal(t, []string{fmt.Sprintf("%s-cockroachdb-init-status", releaseName)}, role.Rules[0].ResourceNames)
+}
+
+func TestHelmHookEvents(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"hooks.events.enabled":            "true",
+			"init.barrier.enabled":            "true",
+			"init.provisioning.enabled":       "true",
+			"init.provisioning.transactional": "true",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	containers := job.Spec.Template.Spec.Containers
+	require.Contains(t, containers[0].Command[2], fmt.Sprintf("--event-statefulset=%s-cockroachdb", releaseName))
+	require.Contains(t, containers[0].Command[2], fmt.Sprintf("--event-namespace=%s", namespaceName))
+	require.Contains(t, containers[1].Args, fmt.Sprintf("--event-statefulset=%s-cockroachdb", releaseName))
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-client-node-certSelfSigner.yaml"})
+
+	var cronjob batchv1.CronJob
+	helm.UnmarshalK8SYaml(t, output, &cronjob)
+	require.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args, fmt.Sprintf("--event-statefulset=%s-cockroachdb", releaseName))
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/role.yaml"})
+
+	var role rbacv1.Role
+	helm.UnmarshalK8SYaml(t, output, &role)
+	require.Contains(t, role.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}})
+	require.Contains(t, role.Rules, rbacv1.PolicyRule{
+		APIGroups:     []string{"apps"},
+		Resources:     []string{"statefulsets"},
+		ResourceNames: []string{fmt.Sprintf("%s-cockroachdb", releaseName)},
+		Verbs:         []string{"get"},
+	})
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/role-certRotateSelfSigner.yaml"})
+
+	var rotateRole rbacv1.Role
+	helm.UnmarshalK8SYaml(t, output, &rotateRole)
+	require.Contains(t, rotateRole.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}})
+}
+
+func TestHelmGlobalLabelsAndAnnotations(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"global.labels.cost-center":    "1234",
+			"global.annotations.owner":     "team-db",
+			"labels.cost-center":           "5678",
+			"service.public.annotations.a": "b",
+			"ingress.enabled":              "true",
+			"init.provisioning.enabled":    "true",
+			"networkPolicy.enabled":        "true",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{})
+
+	for _, manifest := range strings.Split(output, "\n---") {
+		if !strings.Contains(manifest, "kind:") {
+			continue
+		}
+
+		var resource unstructured.Unstructured
+		helm.UnmarshalK8SYaml(t, manifest, &resource)
+		if resource.GetKind() == "Pod" {
+			// The helm test Pod isn't part of the release.
+			continue
+		}
+
+		name := fmt.Sprintf("%s/%s", resource.GetKind(), resource.GetName())
+		// The chart-wide labels take precedence over the global ones.
+		require.Equal(t, "5678", resource.GetLabels()["cost-center"], name)
+		require.Equal(t, "team-db", resource.GetAnnotations()["owner"], name)
+
+		if resource.GetName() == fmt.Sprintf("%s-cockroachdb-public", releaseName) {
+			require.Equal(t, "b", resource.GetAnnotations()["a"])
+		}
+	}
+}
+
+func TestHelmLabelSanitization(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"labels.team":             "Platform Team/DB",
+			"labels.description":      strings.Repeat("a", 62) + "_-suffix",
+			"statefulset.labels.tier": "-database-",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	for _, labels := range []map[string]string{statefulset.Labels, statefulset.Spec.Template.Labels} {
+		require.Equal(t, "Platform-Team-DB", labels["team"])
+		// Truncated to 63 characters and trimmed of the trailing underscore.
+		require.Equal(t, strings.Repeat("a", 62), labels["description"])
+	}
+	require.Equal(t, "database", statefulset.Spec.Template.Labels["tier"])
+	require.Equal(t, "database", statefulset.Spec.Selector.MatchLabels["tier"])
+}
+
+func TestHelmReadOnlyRootFilesystem(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		readOnly bool
+	}{
+		{
+			"Read-only root filesystem by default",
+			map[string]string{},
+			true,
+		},
+		{
+			"Writable root filesystem",
+			map[string]string{"statefulset.securityContext.readOnlyRootFilesystem": "false"},
+			false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			container := statefulset.Spec.Template.Spec.Containers[0]
+			require.Equal(subT, testCase.readOnly, *container.SecurityContext.ReadOnlyRootFilesystem)
+
+			var tmp *corev1.Volume
+			for i, volume := range statefulset.Spec.Template.Spec.Volumes {
+				if volume.Name == "tmp" {
+					tmp = &statefulset.Spec.Template.Spec.Volumes[i]
+				}
+			}
+
+			if testCase.readOnly {
+				require.Contains(subT, container.VolumeMounts, corev1.VolumeMount{Name: "tmp", MountPath: "/tmp"})
+				require.NotNil(subT, tmp)
+				require.Equal(subT, "64Mi", tmp.EmptyDir.SizeLimit.String())
+			} else {
+				require.NotContains(subT, container.VolumeMounts, corev1.VolumeMount{Name: "tmp", MountPath: "/tmp"})
+				require.Nil(subT, tmp)
+			}
+		})
+	}
+}
+
+func TestHelmPodSysctlsAndUlimits(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		values    map[string]string
+		strValues map[string]string
+		sysctls   []corev1.Sysctl
+		renderErr string
+	}{
+		{
+			"Safe sysctl",
+			map[string]string{},
+			map[string]string{
+				"statefulset.podSysctls[0].name":  "net.ipv4.tcp_keepalive_time",
+				"statefulset.podSysctls[0].value": "60",
+			},
+			[]corev1.Sysctl{{Name: "net.ipv4.tcp_keepalive_time", Value: "60"}},
+			"",
+		},
+		{
+			"Unsafe sysctl without allowUnsafeSysctls",
+			map[string]string{},
+			map[string]string{
+				"statefulset.podSysctls[0].name":  "net.core.somaxconn",
+				"statefulset.podSysctls[0].value": "1024",
+			},
+			nil,
+			"sysctl net.core.somaxconn is not safe",
+		},
+		{
+			"Unsafe sysctl with allowUnsafeSysctls",
+			map[string]string{"statefulset.allowUnsafeSysctls": "true"},
+			map[string]string{
+				"statefulset.podSysctls[0].name":  "net.core.somaxconn",
+				"statefulset.podSysctls[0].value": "1024",
+			},
+			[]corev1.Sysctl{{Name: "net.core.somaxconn", Value: "1024"}},
+			"",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+				SetStrValues:   testCase.strValues,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			if testCase.renderErr != "" {
+				require.ErrorContains(subT, err, testCase.renderErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			require.Equal(subT, testCase.sysctls, statefulset.Spec.Template.Spec.SecurityContext.Sysctls)
+		})
+	}
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues:      map[string]string{"statefulset.ulimits.nofile": "1048576"},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	require.True(t, strings.HasPrefix(statefulset.Spec.Template.Spec.Containers[0].Args[2], "ulimit -n 1048576 || "))
+}
+
+func TestHelmPerformance(t *testing.T) {
+	t.Parallel()
+
+	guaranteed := map[string]string{
+		"tls.enabled":                            "false",
+		"statefulset.resources.requests.cpu":     "4",
+		"statefulset.resources.requests.memory":  "16Gi",
+		"statefulset.resources.limits.cpu":       "4",
+		"statefulset.resources.limits.memory":    "16Gi",
+		"statefulset.performance.cpuPinning":     "true",
+		"statefulset.performance.hugepages.size": "2Mi",
+	}
+
+	testCases := []struct {
+		name      string
+		values    map[string]string
+		renderErr string
+	}{
+		{
+			"Huge pages and pinned CPUs",
+			map[string]string{
+				"statefulset.performance.hugepages.amount":                  "1Gi",
+				"statefulset.performance.runtimeClassName":                  "performance-dedicated",
+				"statefulset.performance.annotations.cpu-quota\\.crio\\.io": "disable",
+			},
+			"",
+		},
+		{
+			"Fractional CPU limit",
+			map[string]string{
+				"statefulset.resources.requests.cpu": "3500m",
+				"statefulset.resources.limits.cpu":   "3500m",
+			},
+			"statefulset.performance.cpuPinning requires a CPU limit of a whole number of cores",
+		},
+		{
+			"Memory request below the limit",
+			map[string]string{
+				"statefulset.resources.requests.memory": "8Gi",
+			},
+			"requires the memory request of the db container to be equal to its limit",
+		},
+		{
+			"copy-certs container without limits",
+			map[string]string{
+				"tls.enabled": "true",
+			},
+			"requires a cpu limit on the copy-certs container",
+		},
+		{
+			"Huge pages not a multiple of the size",
+			map[string]string{
+				"statefulset.performance.hugepages.amount": "3Mi",
+			},
+			"statefulset.performance.hugepages.amount 3Mi must be a multiple of the size 2Mi",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			values := map[string]string{}
+			for k, v := range guaranteed {
+				values[k] = v
+			}
+			for k, v := range testCase.values {
+				values[k] = v
+			}
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			if testCase.renderErr != "" {
+				require.ErrorContains(subT, err, testCase.renderErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			podSpec := statefulset.Spec.Template.Spec
+			resources := podSpec.Containers[0].Resources
+			hugepages := corev1.ResourceName("hugepages-2Mi")
+			require.Equal(subT, "1Gi", resources.Requests.Name(hugepages, "").String())
+			require.Equal(subT, "1Gi", resources.Limits.Name(hugepages, "").String())
+			require.Equal(subT, "4", resources.Limits.Cpu().String())
+			require.Contains(subT, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+				Name:      "hugepages",
+				MountPath: "/hugepages/",
+			})
+			require.Contains(subT, podSpec.Volumes, corev1.Volume{
+				Name: "hugepages",
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{Medium: "HugePages-2Mi"},
+				},
+			})
+			require.Equal(subT, "performance-dedicated", *podSpec.RuntimeClassName)
+			require.Equal(subT, "disable", statefulset.Spec.Template.Annotations["cpu-quota.crio.io"])
+		})
+	}
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues:      map[string]string{"statefulset.performance.hugepages.amount": "1Gi"},
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "statefulset.performance.hugepages requires CPU or memory resources in statefulset.resources")
+}
+
+func TestHelmGKEAutopilot(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		values    map[string]string
+		requests  map[string]string
+		renderErr string
+	}{
+		{
+			"Resources of Autopilot",
+			map[string]string{
+				"gkeAutopilot.enabled":     "true",
+				"timezone.mountHostTzdata": "true",
+			},
+			map[string]string{"db": "2", "copy-certs": "50m"},
+			"",
+		},
+		{
+			"Resources of the values",
+			map[string]string{
+				"gkeAutopilot.enabled":                    "true",
+				"statefulset.resources.requests.cpu":      "4",
+				"statefulset.resources.requests.memory":   "16Gi",
+				"tls.copyCerts.resources.requests.cpu":    "10m",
+				"tls.copyCerts.resources.limits.cpu":      "10m",
+				"tls.copyCerts.resources.limits.memory":   "16Mi",
+				"tls.copyCerts.resources.requests.memory": "16Mi",
+			},
+			map[string]string{"db": "4", "copy-certs": "10m"},
+			"",
+		},
+		{
+			"Resources of the profile",
+			map[string]string{
+				"gkeAutopilot.enabled": "true",
+				"profile":              "small",
+			},
+			map[string]string{"db": "500m", "copy-certs": "50m"},
+			"",
+		},
+		{
+			"hostPath storage",
+			map[string]string{
+				"gkeAutopilot.enabled":             "true",
+				"storage.persistentVolume.enabled": "false",
+				"storage.hostPath":                 "/mnt/cockroach",
+			},
+			nil,
+			"gkeAutopilot.enabled can't be combined with storage.hostPath",
+		},
+		{
+			"Unsafe sysctls",
+			map[string]string{
+				"gkeAutopilot.enabled":           "true",
+				"statefulset.allowUnsafeSysctls": "true",
+			},
+			nil,
+			"gkeAutopilot.enabled can't be combined with statefulset.allowUnsafeSysctls",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			if testCase.renderErr != "" {
+				require.ErrorContains(subT, err, testCase.renderErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			podSpec := statefulset.Spec.Template.Spec
+			requests := map[string]string{}
+			for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+				requests[container.Name] = container.Resources.Requests.Cpu().String()
+			}
+			require.Equal(subT, testCase.requests, requests)
+			for _, volume := range podSpec.Volumes {
+				require.Nil(subT, volume.HostPath, volume.Name)
+			}
+		})
+	}
+}
+
+func TestHelmSecurityProfiles(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]string{
+		"securityProfiles.seLinuxOptions.level":        "s0:c123\\,c456",
+		"securityProfiles.appArmor.type":               "Localhost",
+		"securityProfiles.appArmor.localhostProfile":   "cockroachdb",
+		"conf.localityFromNodeLabels.enabled":          "true",
+		"volumeExporter.enabled":                       "true",
+		"conf.log.enabled":                             "true",
+		"conf.log.persistentVolume.enabled":            "true",
+		"tls.certs.selfSigner.securityContext.enabled": "false",
+	}
+	seLinuxOptions := &corev1.SELinuxOptions{Level: "s0:c123,c456"}
+
+	t.Run("Field from Kubernetes v1.30", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      values,
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"}, "--kube-version", "1.30.0")
+
+		// The appArmorProfile field is more recent than the Kubernetes API types of this module.
+		var statefulset struct {
+			Spec struct {
+				Template struct {
+					Metadata struct {
+						Annotations map[string]string `json:"annotations"`
+					} `json:"metadata"`
+					Spec struct {
+						SecurityContext map[string]interface{} `json:"securityContext"`
+					} `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		}
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+		securityContext := statefulset.Spec.Template.Spec.SecurityContext
+		require.Equal(t, map[string]interface{}{"level": "s0:c123,c456"}, securityContext["seLinuxOptions"])
+		require.Equal(t, map[string]interface{}{"type": "Localhost", "localhostProfile": "cockroachdb"}, securityContext["appArmorProfile"])
+		require.Equal(t, "RuntimeDefault", securityContext["seccompProfile"].(map[string]interface{})["type"])
+		for name := range statefulset.Spec.Template.Metadata.Annotations {
+			require.NotContains(t, name, "apparmor")
+		}
+
+		// The Jobs without a security context of their own get one for the profiles.
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-certSelfSigner.yaml"}, "--kube-version", "1.30.0")
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		require.Equal(t, &corev1.PodSecurityContext{SELinuxOptions: seLinuxOptions}, job.Spec.Template.Spec.SecurityContext)
+	})
+
+	t.Run("Annotations before Kubernetes v1.30", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      values,
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"}, "--kube-version", "1.29.0")
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+		require.Equal(t, seLinuxOptions, statefulset.Spec.Template.Spec.SecurityContext.SELinuxOptions)
+		annotations := statefulset.Spec.Template.Annotations
+		for _, container := range []string{"db", "copy-certs", "locality", "volume-exporter"} {
+			require.Equal(t, "localhost/cockroachdb", annotations["container.apparmor.security.beta.kubernetes.io/"+container], container)
+		}
+		require.Equal(t, "db", annotations["kubectl.kubernetes.io/default-container"])
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"}, "--kube-version", "1.29.0")
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		require.Equal(t, seLinuxOptions, job.Spec.Template.Spec.SecurityContext.SELinuxOptions)
+		var profiled []string
+		for name, value := range job.Spec.Template.Annotations {
+			if strings.HasPrefix(name, "container.apparmor.security.beta.kubernetes.io/") {
+				require.Equal(t, "localhost/cockroachdb", value)
+				profiled = append(profiled, strings.TrimPrefix(name, "container.apparmor.security.beta.kubernetes.io/"))
+			}
+		}
+		require.ElementsMatch(t, []string{"cluster-init", "copy-certs"}, profiled)
+	})
+
+	t.Run("Localhost profile without name", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"securityProfiles.appArmor.type": "Localhost",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		require.ErrorContains(t, err, "securityProfiles.appArmor.localhostProfile must be set if and only if securityProfiles.appArmor.type is Localhost")
+	})
+}
+
+func TestHelmVolumeExpansion(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"storage.persistentVolume.expansion.enabled":           "true",
+			"storage.persistentVolume.size":                        "200Gi",
+			"storage.persistentVolume.storageClass":                "ssd",
+			"storage.persistentVolume.perNodeOverrides[0].ordinal": "2",
+			"storage.persistentVolume.perNodeOverrides[0].size":    "500Gi",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-resizeVolumes.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	require.Equal(t, "pre-install,pre-upgrade", job.Annotations["helm.sh/hook"])
+	require.Equal(t, "6", job.Annotations["helm.sh/hook-weight"])
+	require.Equal(t, fmt.Sprintf("%s-cockroachdb-resize-volumes", releaseName), job.Spec.Template.Spec.ServiceAccountName)
+	require.Equal(t, []string{
+		"resize-volumes",
+		fmt.Sprintf("--statefulset=%s-cockroachdb", releaseName),
+		"--volume=datadir",
+		"--size=200Gi",
+		"--override=2=500Gi",
+		"--start-ordinal=0",
+		"--replicas=3",
+		"--storage-class=ssd",
+		"--label=app.kubernetes.io/name=cockroachdb",
+		fmt.Sprintf("--label=app.kubernetes.io/instance=%s", releaseName),
+	}, job.Spec.Template.Spec.Containers[0].Args)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/role-resizeVolumes.yaml"})
+
+	var role rbacv1.Role
+	helm.UnmarshalK8SYaml(t, output, &role)
+	require.Equal(t, []string{"create", "get", "patch"}, role.Rules[0].Verbs)
+
+	options.SetValues["storage.persistentVolume.expansion.enabled"] = "false"
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "storage.persistentVolume.perNodeOverrides requires storage.persistentVolume.expansion.enabled")
+}
+
+func TestHelmInitJobNetwork(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		values      map[string]string
+		clientLabel bool
+		hostNetwork bool
+		host        string
+	}{
+		{
+			"default",
+			map[string]string{},
+			false,
+			false,
+			fmt.Sprintf("--host=%s-cockroachdb-0.%s-cockroachdb:26257", releaseName, releaseName),
+		},
+		{
+			"client label",
+			map[string]string{"init.network.clientLabel": "true"},
+			true,
+			false,
+			fmt.Sprintf("--host=%s-cockroachdb-0.%s-cockroachdb.%s.svc.cluster.local:26257", releaseName, releaseName, namespaceName),
+		},
+		{
+			"host network",
+			map[string]string{"init.network.hostNetwork": "true"},
+			false,
+			true,
+			fmt.Sprintf("--host=%s-cockroachdb-0.%s-cockroachdb.%s.svc.cluster.local:26257", releaseName, releaseName, namespaceName),
+		},
+		{
+			"host network dropped on GKE Autopilot",
+			map[string]string{"init.network.hostNetwork": "true", "gkeAutopilot.enabled": "true"},
+			false,
+			false,
+			fmt.Sprintf("--host=%s-cockroachdb-0.%s-cockroachdb:26257", releaseName, releaseName),
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			_, ok := job.Spec.Template.Labels[fmt.Sprintf("%s-cockroachdb-client", releaseName)]
+			require.Equal(subT, testCase.clientLabel, ok)
+			require.Equal(subT, testCase.hostNetwork, job.Spec.Template.Spec.HostNetwork)
+			if testCase.hostNetwork {
+				require.Equal(subT, corev1.DNSClusterFirstWithHostNet, job.Spec.Template.Spec.DNSPolicy)
+			}
+			require.Contains(subT, job.Spec.Template.Spec.Containers[0].Command[2], testCase.host)
+		})
+	}
+}
+
+func TestHelmSingleNode(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"conf.single-node":     "true",
+			"statefulset.replicas": "3",
+		},
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "statefulset.replicas")
+
+	options.SetValues["statefulset.replicas"] = "1"
+	options.SetValues["init.singleNodeConversion.enabled"] = "true"
+	_, err = helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "init.singleNodeConversion requires conf.single-node to be set to false")
+
+	options.SetValues["conf.single-node"] = "false"
+	_, err = helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "init.singleNodeConversion requires statefulset.replicas to be at least 3")
+
+	options.SetValues["statefulset.replicas"] = "5"
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	command := job.Spec.Template.Spec.Containers[0].Command[2]
+	require.Contains(t, command, "SHOW ZONE CONFIGURATION FOR RANGE default")
+	require.Contains(t, command, "ALTER RANGE default CONFIGURE ZONE USING num_replicas = 3;")
+	require.Contains(t, command, "ALTER RANGE liveness CONFIGURE ZONE USING num_replicas = 5;")
+	require.Contains(t, command, "convertSingleNodeCluster;")
+}
+
+func TestHelmVirtualization(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		values         map[string]string
+		virtualCluster string
+		expErr         string
+	}{
+		{
+			"Not virtualized by default",
+			map[string]string{},
+			"",
+			"",
+		},
+		{
+			"Shared-process virtual cluster",
+			map[string]string{
+				"virtualization.enabled": "true",
+			},
+			"main",
+			"",
+		},
+		{
+			"Named virtual cluster",
+			map[string]string{
+				"virtualization.enabled": "true",
+				"virtualization.name":    "app",
+			},
+			"app",
+			"",
+		},
+		{
+			"Image predating cluster virtualization",
+			map[string]string{
+				"virtualization.enabled": "true",
+				"image.tag":              "v23.2.5",
+			},
+			"",
+			"image.tag: Does not match pattern",
+		},
+		{
+			"Custom image",
+			map[string]string{
+				"virtualization.enabled": "true",
+				"image.repository":       "registry.example.com/cockroach",
+				"image.tag":              "custom",
+			},
+			"main",
+			"",
+		},
+		{
+			"Combined with PCR",
+			map[string]string{
+				"virtualization.enabled": "true",
+				"init.pcr.enabled":       "true",
+				"init.pcr.isPrimary":     "true",
+			},
+			"",
+			"virtualization.enabled can't be combined with init.pcr.enabled",
+		},
+		{
+			"System virtual cluster",
+			map[string]string{
+				"virtualization.enabled": "true",
+				"virtualization.name":    "system",
+			},
+			"",
+			"virtualization.name: invalid virtual cluster name system",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			_, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			command := job.Spec.Template.Spec.Containers[0].Command[2]
+			if testCase.virtualCluster == "" {
+				require.NotContains(subT, command, "--virtualized")
+				require.NotContains(subT, command, "startVirtualCluster")
+				return
+			}
+			require.Contains(subT, command, "--virtualized-empty")
+			require.Contains(subT, command, "--database=cluster:system/defaultdb")
+			require.Contains(subT, command, fmt.Sprintf("CREATE VIRTUAL CLUSTER IF NOT EXISTS %s;", testCase.virtualCluster))
+			require.Contains(subT, command, fmt.Sprintf("ALTER VIRTUAL CLUSTER %s START SERVICE SHARED;", testCase.virtualCluster))
+			require.Contains(subT, command, fmt.Sprintf("SET CLUSTER SETTING server.controller.default_target_cluster = '%s';", testCase.virtualCluster))
+			require.Contains(subT, command, "startVirtualCluster;")
+		})
+	}
+}
+
+func TestHelmNamespaceCreate(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"namespaceCreate.enabled":                      "true",
+			"namespaceCreate.podSecurity.enforce":          "baseline",
+			"namespaceCreate.podSecurity.warn":             "restricted",
+			"namespaceCreate.podSecurity.warnVersion":      "v1.29",
+			"namespaceCreate.resourceQuota.hard.pods":      "10",
+			"namespaceCreate.limitRange.limits[0].type":    "Container",
+			"namespaceCreate.limitRange.limits[0].max.cpu": "4",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/namespace.yaml"})
+
+	var namespace corev1.Namespace
+	helm.UnmarshalK8SYaml(t, output, &namespace)
+
+	require.Equal(t, namespaceName, namespace.Name)
+	require.Equal(t, "baseline", namespace.Labels["pod-security.kubernetes.io/enforce"])
+	require.Equal(t, "latest", namespace.Labels["pod-security.kubernetes.io/enforce-version"])
+	require.Equal(t, "restricted", namespace.Labels["pod-security.kubernetes.io/warn"])
+	require.Equal(t, "v1.29", namespace.Labels["pod-security.kubernetes.io/warn-version"])
+	require.NotContains(t, namespace.Labels, "pod-security.kubernetes.io/audit")
+	require.Equal(t, "keep", namespace.Annotations["helm.sh/resource-policy"])
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/resourcequota.yaml"})
+
+	var quota corev1.ResourceQuota
+	helm.UnmarshalK8SYaml(t, output, &quota)
+	require.Equal(t, "10", quota.Spec.Hard.Pods().String())
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/limitrange.yaml"})
+
+	var limitRange corev1.LimitRange
+	helm.UnmarshalK8SYaml(t, output, &limitRange)
+	require.Equal(t, corev1.LimitTypeContainer, limitRange.Spec.Limits[0].Type)
+	require.Equal(t, "4", limitRange.Spec.Limits[0].Max.Cpu().String())
+
+	options.SetValues["namespaceCreate.podSecurity.audit"] = "strict"
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/namespace.yaml"})
+	require.ErrorContains(t, err, "namespaceCreate.podSecurity.audit")
+}
+
+func TestHelmSelfSignerVault(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"tls.certs.selfSigner.vault.enabled":      "true",
+			"tls.certs.selfSigner.vault.address":      "https://vault.vault.svc:8200",
+			"tls.certs.selfSigner.vault.role":         "cockroachdb",
+			"tls.certs.selfSigner.vault.caCertSecret": "vault-ca",
+		},
+	}
+
+	for _, template := range []string{
+		"templates/job-certSelfSigner.yaml",
+		"templates/cronjob-ca-certSelfSigner.yaml",
+		"templates/cronjob-client-node-certSelfSigner.yaml",
+	} {
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{template})
+
+		var podSpec corev1.PodSpec
+		if strings.HasPrefix(template, "templates/cronjob") {
+			var cronJob batchv1.CronJob
+			helm.UnmarshalK8SYaml(t, output, &cronJob)
+			podSpec = cronJob.Spec.JobTemplate.Spec.Template.Spec
+		} else {
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(t, output, &job)
+			podSpec = job.Spec.Template.Spec
+		}
+
+		env := map[string]string{}
+		for _, e := range podSpec.Containers[0].Env {
+			env[e.Name] = e.Value
+		}
+		require.Equal(t, "https://vault.vault.svc:8200", env["VAULT_ADDR"], template)
+		require.Equal(t, "cockroachdb", env["VAULT_ROLE"], template)
+		require.Equal(t, "kubernetes", env["VAULT_AUTH_MOUNT"], template)
+		require.Equal(t, "secret", env["VAULT_KV_MOUNT"], template)
+		require.Equal(t, fmt.Sprintf("cockroachdb/%s/%s-cockroachdb", namespaceName, releaseName), env["VAULT_PATH"], template)
+		require.Equal(t, "/vault/tls/ca.crt", env["VAULT_CACERT"], template)
+		require.Equal(t, "vault-tls", podSpec.Containers[0].VolumeMounts[0].Name, template)
+		require.Equal(t, "vault-ca", podSpec.Volumes[0].Secret.SecretName, template)
+	}
+
+	options.SetValues["tls.certs.selfSigner.caProvided"] = "true"
+	options.SetValues["tls.certs.selfSigner.caSecret"] = "my-ca"
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/serviceaccount-certSelfSigner.yaml"})
+	require.ErrorContains(t, err, "tls.certs.selfSigner.vault can't be used with tls.certs.selfSigner.caProvided")
+}
+
+func TestHelmDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"diagnostics.profiling.enabled":           "true",
+			"diagnostics.profiling.blockProfileRate":  "10000000",
+			"diagnostics.profiling.cpuUsageThreshold": "80",
+			"diagnostics.tracing.enabled":             "true",
+			"diagnostics.tracing.stmtThreshold":       "1s",
+		},
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "require diagnostics.dangerZone to be set to true")
+
+	options.SetValues["diagnostics.dangerZone"] = "true"
+	_, err = helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "require init.provisioning.enabled")
+
+	options.SetValues["init.provisioning.enabled"] = "true"
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	env := map[string]string{}
+	for _, e := range statefulset.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	require.Equal(t, "10000000", env["COCKROACH_BLOCK_PROFILE_RATE"])
+	require.NotContains(t, env, "COCKROACH_MUTEX_PROFILE_RATE")
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	command := job.Spec.Template.Spec.Containers[0].Command[2]
+	require.Contains(t, command, "SET CLUSTER SETTING server.cpu_profile.cpu_usage_combined_threshold = 80;")
+	require.Contains(t, command, "SET CLUSTER SETTING sql.trace.stmt.enable_threshold = '1s';")
+	require.Contains(t, command, "SET CLUSTER SETTING sql.trace.log_statement_execute = false;")
+	require.NotContains(t, command, "sql.trace.txn.enable_threshold")
+}
+
+func TestHelmStatementBundle(t *testing.T) {
+	t.Parallel()
+
+	templatePath := "templates/job.statementBundle.yaml"
+	fullname := fmt.Sprintf("%s-cockroachdb", releaseName)
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{templatePath})
+		require.ErrorContains(t, err, "could not find template templates/job.statementBundle.yaml in chart")
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"diagnostics.statementBundle.enabled":  "true",
+				"diagnostics.statementBundle.database": "bank",
+			},
+		}
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{templatePath})
+		require.ErrorContains(t, err, "diagnostics.statementBundle requires diagnostics.dangerZone to be set to true")
+
+		options.SetValues["diagnostics.dangerZone"] = "true"
+		_, err = helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{templatePath})
+		require.ErrorContains(t, err, "diagnostics.statementBundle requires either a fingerprint or a statement")
+
+		options.SetValues["diagnostics.statementBundle.fingerprint"] = "SELECT * FROM accounts WHERE id = _"
+		options.SetValues["diagnostics.statementBundle.statement"] = "SELECT * FROM accounts WHERE id = 1"
+		_, err = helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{templatePath})
+		require.ErrorContains(t, err, "diagnostics.statementBundle requires either a fingerprint or a statement")
+
+		delete(options.SetValues, "diagnostics.statementBundle.statement")
+		_, err = helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{templatePath})
+		require.ErrorContains(t, err, "diagnostics.statementBundle requires upload.image and upload.command to upload the bundle")
+	})
+
+	upload := map[string]string{
+		"diagnostics.dangerZone":                          "true",
+		"diagnostics.statementBundle.enabled":             "true",
+		"diagnostics.statementBundle.upload.image":        "amazon/aws-cli",
+		"diagnostics.statementBundle.upload.command[0]":   "aws",
+		"diagnostics.statementBundle.upload.command[1]":   "s3",
+		"diagnostics.statementBundle.upload.command[2]":   "cp",
+		"diagnostics.statementBundle.upload.command[3]":   "$(BUNDLE_FILE)",
+		"diagnostics.statementBundle.upload.command[4]":   "s3://bundles/",
+		"diagnostics.statementBundle.upload.env[0].name":  "AWS_REGION",
+		"diagnostics.statementBundle.upload.env[0].value": "us-east-1",
+	}
+
+	render := func(t *testing.T, values map[string]string) (batchv1.Job, map[string]string) {
+		setValues := map[string]string{}
+		for k, v := range upload {
+			setValues[k] = v
+		}
+		for k, v := range values {
+			setValues[k] = v
+		}
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      setValues,
+		}
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{templatePath})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+
+		podSpec := job.Spec.Template.Spec
+		require.Len(t, podSpec.InitContainers, 2)
+		require.Equal(t, "copy-certs", podSpec.InitContainers[0].Name)
+		require.Equal(t, "collect-bundle", podSpec.InitContainers[1].Name)
+
+		env := map[string]string{}
+		for _, e := range podSpec.InitContainers[1].Env {
+			env[e.Name] = e.Value
+		}
+		return job, env
+	}
+
+	t.Run("Fingerprint", func(t *testing.T) {
+		t.Parallel()
+
+		job, env := render(t, map[string]string{
+			"diagnostics.statementBundle.fingerprint":         "SELECT * FROM accounts WHERE name = '_'",
+			"diagnostics.statementBundle.minExecutionLatency": "100ms",
+		})
+
+		require.True(t, strings.HasPrefix(job.Name, fullname+"-statement-bundle-"))
+		require.Equal(t, corev1.RestartPolicyNever, job.Spec.Template.Spec.RestartPolicy)
+
+		collect := job.Spec.Template.Spec.InitContainers[1]
+		require.Contains(t, collect.Command[2], "crdb_internal.request_statement_bundle")
+		require.NotContains(t, collect.Command[2], "EXPLAIN ANALYZE (DEBUG)")
+		require.Contains(t, collect.Command[2], "statement-diag download")
+		require.Equal(t, "SELECT * FROM accounts WHERE name = ''_''", env["FINGERPRINT"])
+		require.Equal(t, "100ms", env["MIN_EXECUTION_LATENCY"])
+		require.Equal(t, "1h", env["EXPIRES_AFTER"])
+		require.Equal(t, "defaultdb", env["DATABASE"])
+		require.NotContains(t, env, "STATEMENT")
+
+		uploader := job.Spec.Template.Spec.Containers[0]
+		require.Equal(t, "upload", uploader.Name)
+		require.Equal(t, "amazon/aws-cli", uploader.Image)
+		require.Equal(t, []string{"aws", "s3", "cp", "$(BUNDLE_FILE)", "s3://bundles/"}, uploader.Command)
+		require.Equal(t, env["BUNDLE_FILE"], uploader.Env[0].Value)
+		require.Equal(t, corev1.EnvVar{Name: "AWS_REGION", Value: "us-east-1"}, uploader.Env[1])
+		require.True(t, uploader.VolumeMounts[0].ReadOnly)
+	})
+
+	t.Run("Statement", func(t *testing.T) {
+		t.Parallel()
+
+		job, env := render(t, map[string]string{
+			"diagnostics.statementBundle.statement": "SELECT * FROM accounts WHERE id = 1",
+			"diagnostics.statementBundle.database":  "bank",
+		})
+
+		collect := job.Spec.Template.Spec.InitContainers[1]
+		require.Contains(t, collect.Command[2], "EXPLAIN ANALYZE (DEBUG) ${STATEMENT}")
+		require.NotContains(t, collect.Command[2], "crdb_internal.request_statement_bundle")
+		require.Equal(t, "SELECT * FROM accounts WHERE id = 1", env["STATEMENT"])
+		require.Equal(t, "bank", env["DATABASE"])
+		require.NotContains(t, env, "FINGERPRINT")
+
+		// Another request renders another Job, as the template of a Job is immutable.
+		other, _ := render(t, map[string]string{
+			"diagnostics.statementBundle.statement": "SELECT * FROM accounts WHERE id = 2",
+		})
+		require.NotEqual(t, job.Name, other.Name)
+	})
+}
+
+func TestHelmGlobalImageRegistry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("No template bypasses the image helpers", func(t *testing.T) {
+		t.Parallel()
+
+		imageLine := regexp.MustCompile(`\bimage(PullPolicy)?:|--image=`)
+		err := filepath.Walk(filepath.Join(helmChartPath, "templates"), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) == ".tpl" {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for i, line := range strings.Split(string(content), "\n") {
+				if imageLine.MatchString(line) {
+					require.Contains(t, line, `include "cockroachdb.image`, "%s:%d", path, i+1)
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Images and pull policies", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"global.imageRegistry":                          "registry.example.com/mirror/",
+				"global.imagePullPolicy":                        "Always",
+				"tls.copyCerts.image":                           "docker.io/library/busybox:1.36",
+				"diagnostics.dangerZone":                        "true",
+				"diagnostics.statementBundle.enabled":           "true",
+				"diagnostics.statementBundle.fingerprint":       "SELECT * FROM accounts WHERE id = _",
+				"diagnostics.statementBundle.upload.image":      "amazon/aws-cli",
+				"diagnostics.statementBundle.upload.command[0]": "aws",
+			},
+		}
+
+		dbImage := "registry.example.com/mirror/cockroachdb/cockroach:v24.3.3"
+		selfSignerImage := "registry.example.com/mirror/cockroachlabs-helm-charts/cockroach-self-signer-cert:1.6"
+		copyCertsImage := "registry.example.com/mirror/library/busybox:1.36"
+
+		// Returns the Pod spec of a workload, CronJobs included.
+		podSpec := func(t *testing.T, template string) corev1.PodSpec {
+			var podSpecs struct {
+				Spec struct {
+					Template    corev1.PodTemplateSpec
+					JobTemplate struct {
+						Spec struct {
+							Template corev1.PodTemplateSpec
+						}
+					}
+				}
+			}
+			output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{template})
+			helm.UnmarshalK8SYaml(t, output, &podSpecs)
+			if len(podSpecs.Spec.JobTemplate.Spec.Template.Spec.Containers) > 0 {
+				return podSpecs.Spec.JobTemplate.Spec.Template.Spec
+			}
+			return podSpecs.Spec.Template.Spec
+		}
+
+		for _, tc := range []struct {
+			template       string
+			initContainers []string
+			containers     []string
+		}{
+			{"templates/statefulset.yaml", []string{copyCertsImage}, []string{dbImage}},
+			{"templates/job.init.yaml", []string{copyCertsImage}, []string{dbImage}},
+			{"templates/job-certSelfSigner.yaml", nil, []string{selfSignerImage}},
+			{"templates/cronjob-ca-certSelfSigner.yaml", nil, []string{selfSignerImage}},
+			{"templates/job.statementBundle.yaml", []string{copyCertsImage, dbImage}, []string{"registry.example.com/mirror/amazon/aws-cli"}},
+		} {
+			spec := podSpec(t, tc.template)
+			for i, images := range [][]string{tc.initContainers, tc.containers} {
+				containers := [][]corev1.Container{spec.InitContainers, spec.Containers}[i]
+				require.Len(t, containers, len(images), tc.template)
+				for j, c := range containers {
+					require.Equal(t, images[j], c.Image, tc.template)
+					require.Equal(t, corev1.PullAlways, c.ImagePullPolicy, tc.template)
+				}
+			}
+		}
+
+		// The pull policy of an image takes precedence over the global one.
+		options.SetValues["image.pullPolicy"] = "Never"
+		spec := podSpec(t, "templates/statefulset.yaml")
+		require.Equal(t, corev1.PullNever, spec.Containers[0].ImagePullPolicy)
+		require.Equal(t, corev1.PullAlways, spec.InitContainers[0].ImagePullPolicy)
+	})
+}
+
+func TestHelmInitContainerResources(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Resources", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.copyCerts.resources.requests.cpu":                      "10m",
+				"tls.copyCerts.resources.limits.memory":                     "32Mi",
+				"conf.localityFromNodeLabels.enabled":                       "true",
+				"conf.localityFromNodeLabels.resources.requests.cpu":        "20m",
+				"init.provisioning.enabled":                                 "true",
+				"init.provisioning.transactional":                           "true",
+				"init.provisioning.copyProvisioner.resources.requests.cpu":  "30m",
+				"init.provisioning.copyProvisioner.resources.limits.memory": "64Mi",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		initContainers := statefulset.Spec.Template.Spec.InitContainers
+		require.Len(t, initContainers, 2)
+		require.Equal(t, "copy-certs", initContainers[0].Name)
+		require.Equal(t, "10m", initContainers[0].Resources.Requests.Cpu().String())
+		require.Equal(t, "32Mi", initContainers[0].Resources.Limits.Memory().String())
+		require.Equal(t, "locality", initContainers[1].Name)
+		require.Equal(t, "20m", initContainers[1].Resources.Requests.Cpu().String())
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+
+		initContainers = job.Spec.Template.Spec.InitContainers
+		require.Len(t, initContainers, 2)
+		require.Equal(t, "10m", initContainers[0].Resources.Requests.Cpu().String())
+		require.Equal(t, "copy-provisioner", initContainers[1].Name)
+		require.Equal(t, "30m", initContainers[1].Resources.Requests.Cpu().String())
+		require.Equal(t, "64Mi", initContainers[1].Resources.Limits.Memory().String())
+	})
+
+	t.Run("No resources by default", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+		require.Empty(t, statefulset.Spec.Template.Spec.InitContainers[0].Resources)
+	})
+
+	t.Run("Invalid quantity", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.copyCerts.resources.requests.cpu": "ten",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		require.ErrorContains(t, err, "tls.copyCerts.resources.requests.cpu: Does not match pattern")
+	})
+}
+
+func TestHelmProxy(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"proxy.httpsProxy":  "http://proxy.corp.example:3128",
+			"proxy.noProxy[0]":  ".corp.example",
+			"proxy.serviceCIDR": "10.96.0.0/12",
+		},
+	}
+
+	fullname := fmt.Sprintf("%s-cockroachdb", releaseName)
+	expectedNoProxy := strings.Join([]string{
+		"localhost", "127.0.0.1", "::1", "10.96.0.0/12",
+		"kubernetes.default", "kubernetes.default.svc.cluster.local", ".svc", ".svc.cluster.local",
+		fullname, fullname + "-public", fmt.Sprintf(".%s.%s.svc.cluster.local", fullname, namespaceName),
+		".corp.example",
+	}, ",")
+
+	requireProxyEnv := func(t *testing.T, envVars []corev1.EnvVar) {
+		env := map[string]string{}
+		for _, e := range envVars {
+			env[e.Name] = e.Value
+		}
+		require.Equal(t, "http://proxy.corp.example:3128", env["HTTPS_PROXY"])
+		require.Equal(t, expectedNoProxy, env["NO_PROXY"])
+		require.NotContains(t, env, "HTTP_PROXY")
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+	requireProxyEnv(t, statefulset.Spec.Template.Spec.Containers[0].Env)
+
+	for _, template := range []string{"templates/job.init.yaml", "templates/job-certSelfSigner.yaml"} {
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{template})
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		requireProxyEnv(t, job.Spec.Template.Spec.Containers[0].Env)
+	}
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-ca-certSelfSigner.yaml"})
+	var cronJob batchv1.CronJob
+	helm.UnmarshalK8SYaml(t, output, &cronJob)
+	requireProxyEnv(t, cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env)
+
+	// No proxy env is rendered unless a proxy is configured.
+	delete(options.SetValues, "proxy.httpsProxy")
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	var statefulsetWithoutProxy appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulsetWithoutProxy)
+	for _, e := range statefulsetWithoutProxy.Spec.Template.Spec.Containers[0].Env {
+		require.NotEqual(t, "NO_PROXY", e.Name)
+	}
+}
+
+func TestHelmProvisioningTransactional(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"init.provisioning.enabled":                                "true",
+			"init.provisioning.transactional":                          "true",
+			"init.provisioning.clusterSettings.cluster\\.organization": "testOrganization",
+			"init.provisioning.users[0].name":                          "testUser",
+			"init.provisioning.users[0].password":                      "testPassword",
+			"init.provisioning.databases[0].name":                      "testDatabase",
+			"init.provisioning.databases[0].owners[0]":                 "testUser",
+			"init.provisioning.databases[0].backup.into":               "s3://backups/testDatabase",
+			"init.provisioning.databases[0].backup.recurring":          "@daily",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/configmap.provisioning.yaml"})
+
+	var configMap corev1.ConfigMap
+	helm.UnmarshalK8SYaml(t, output, &configMap)
+
+	var plan struct {
+		Steps []struct {
+			Name          string   `json:"name"`
+			Transactional bool     `json:"transactional"`
+			Statements    []string `json:"statements"`
+		} `json:"steps"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(configMap.Data["steps.json"]), &plan))
+	require.Len(t, plan.Steps, 4)
+
+	require.False(t, plan.Steps[0].Transactional)
+	require.Equal(t, []string{"SET CLUSTER SETTING cluster.organization = '$cluster_organization_CLUSTER_SETTING'"}, plan.Steps[0].Statements)
+
+	require.True(t, plan.Steps[1].Transactional)
+	require.Equal(t, []string{
+		"CREATE USER IF NOT EXISTS testUser WITH PASSWORD '$testUser_PASSWORD'",
+		"CREATE DATABASE IF NOT EXISTS testDatabase",
+		"GRANT ALL ON DATABASE testDatabase TO testUser",
+	}, plan.Steps[1].Statements)
+
+	require.Empty(t, plan.Steps[2].Statements)
+
+	require.False(t, plan.Steps[3].Transactional)
+	require.Len(t, plan.Steps[3].Statements, 1)
+	require.Contains(t, plan.Steps[3].Statements[0], "CREATE SCHEDULE IF NOT EXISTS testDatabase_scheduled_backup")
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	command := job.Spec.Template.Spec.Containers[0].Command[2]
+	require.Contains(t, command, "/cockroach/provisioner/provisioner")
+	require.Contains(t, command, "--steps=/cockroach/provisioning/steps.json")
+	require.NotContains(t, command, "CREATE USER")
+
+	var initContainers []string
+	for _, c := range job.Spec.Template.Spec.InitContainers {
+		initContainers = append(initContainers, c.Name)
+	}
+	require.Equal(t, []string{"copy-certs", "copy-provisioner"}, initContainers)
+
+	var configMapVolume string
+	for _, v := range job.Spec.Template.Spec.Volumes {
+		if v.ConfigMap != nil {
+			configMapVolume = v.ConfigMap.Name
+		}
+	}
+	require.Equal(t, fmt.Sprintf("%s-cockroachdb-provisioning", releaseName), configMapVolume)
+}
+
+func TestHelmProvisioningZoneConfigs(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]string{
+		"init.provisioning.enabled":                        "true",
+		"init.provisioning.databases[0].name":              "testDatabase",
+		"init.provisioning.zoneConfigs[0].target":          "RANGE default",
+		"init.provisioning.zoneConfigs[0].num_replicas":    "5",
+		"init.provisioning.zoneConfigs[0].gc\\.ttlseconds": "14400",
+		"init.provisioning.zoneConfigs[0].constraints":     "[+region=us-east1]",
+		"init.provisioning.zoneConfigs[1].target":          "DATABASE testDatabase",
+		"init.provisioning.zoneConfigs[1].options[0]":      `lease_preferences = '[[+region=us-east1]]'`,
+		"init.provisioning.zoneConfigs[1].options[1]":      `constraints = '{"+region=us-east1": 1}'`,
+	}
+	zoneStatements := []string{
+		"ALTER RANGE default CONFIGURE ZONE USING num_replicas = 5, gc.ttlseconds = 14400, constraints = '[+region=us-east1]'",
+		`ALTER DATABASE testDatabase CONFIGURE ZONE USING lease_preferences = '[[+region=us-east1]]', constraints = '{"+region=us-east1": 1}'`,
+	}
+
+	t.Run("Transactional", func(t *testing.T) {
+		t.Parallel()
+
+		setValues := map[string]string{"init.provisioning.transactional": "true"}
+		for k, v := range values {
+			setValues[k] = v
+		}
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      setValues,
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/configmap.provisioning.yaml"})
+
+		var configMap corev1.ConfigMap
+		helm.UnmarshalK8SYaml(t, output, &configMap)
+
+		var plan struct {
+			Steps []struct {
+				Name       string   `json:"name"`
+				Statements []string `json:"statements"`
+			} `json:"steps"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(configMap.Data["steps.json"]), &plan))
+		require.Equal(t, "zone configurations", plan.Steps[2].Name)
+		require.Equal(t, zoneStatements, plan.Steps[2].Statements)
+	})
+
+	t.Run("Shell", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      values,
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+
+		command := job.Spec.Template.Spec.Containers[0].Command[2]
+		require.Contains(t, command, "CREATE DATABASE IF NOT EXISTS testDatabase;")
+		require.Contains(t, command, zoneStatements[0]+";")
+		// The double quotes are escaped in the --execute argument of the shell.
+		require.Contains(t, command, `constraints = '{\"+region=us-east1\": 1}'`)
+	})
+
+	t.Run("Missing target", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"init.provisioning.enabled":                     "true",
+				"init.provisioning.zoneConfigs[0].num_replicas": "5",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+		require.ErrorContains(t, err, `init.provisioning.zoneConfigs target "" must be a RANGE, DATABASE, TABLE, INDEX or PARTITION`)
+	})
+
+	t.Run("No variable", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"init.provisioning.enabled":               "true",
+				"init.provisioning.zoneConfigs[0].target": "RANGE default",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+		require.ErrorContains(t, err, "init.provisioning.zoneConfigs of RANGE default sets no variable")
+	})
+}
+
+func TestHelmInitSampleData(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		contains []string
+		expErr   string
+	}{
+		{
+			"No example data by default",
+			map[string]string{},
+			nil,
+			"",
+		},
+		{
+			"MovR in a secure cluster",
+			map[string]string{
+				"init.sampleData.workload":                 "movr",
+				"init.sampleData.acknowledgeNonProduction": "true",
+			},
+			[]string{
+				"database_name = 'movr'",
+				"/cockroach/cockroach workload init movr \"$url\"",
+				"sslmode=verify-full&sslrootcert=/cockroach-certs/ca.crt&sslcert=/cockroach-certs/client.root.crt&sslkey=/cockroach-certs/client.root.key",
+			},
+			"",
+		},
+		{
+			"KV in a single-node insecure cluster",
+			map[string]string{
+				"conf.single-node":                         "true",
+				"statefulset.replicas":                     "1",
+				"tls.enabled":                              "false",
+				"init.sampleData.workload":                 "kv",
+				"init.sampleData.acknowledgeNonProduction": "true",
+			},
+			[]string{
+				"/cockroach/cockroach workload init kv \"$url\"",
+				"local url=\"postgresql://root@helm-basic-cockroachdb-0.helm-basic-cockroachdb:26257/?sslmode=disable\"",
+			},
+			"",
+		},
+		{
+			"Not acknowledged",
+			map[string]string{
+				"init.sampleData.workload": "movr",
+			},
+			nil,
+			"init.sampleData.workload movr loads example data, which isn't meant for production clusters, and requires init.sampleData.acknowledgeNonProduction to be set to true",
+		},
+		{
+			"Unknown workload",
+			map[string]string{
+				"init.sampleData.workload":                 "tpcc",
+				"init.sampleData.acknowledgeNonProduction": "true",
+			},
+			nil,
+			"init.sampleData.workload must be one of movr, kv or none, got tpcc",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			command := job.Spec.Template.Spec.Containers[0].Command[2]
+			if testCase.contains == nil {
+				require.NotContains(subT, command, "loadSampleData")
+				return
+			}
+			require.Contains(subT, command, "loadSampleData;")
+			for _, s := range testCase.contains {
+				require.Contains(subT, command, s)
+			}
+		})
+	}
+}
+
+func TestHelmStatisticsCronJobs(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		commands map[string][]string
+		expErr   string
+	}{
+		{
+			"Disabled by default",
+			map[string]string{},
+			nil,
+			"could not find template templates/cronjob.statistics.yaml in chart",
+		},
+		{
+			"Statistics refresh and SQL statistics reset",
+			map[string]string{
+				"statistics.refresh.enabled":   "true",
+				"statistics.refresh.tables[0]": "bank.accounts",
+				"statistics.refresh.tables[1]": "movr.public.rides",
+				"statistics.reset.enabled":     "true",
+			},
+			map[string][]string{
+				fmt.Sprintf("%s-cockroachdb-statistics-refresh", releaseName): {
+					"/cockroach/cockroach", "sql", "--certs-dir=/cockroach-certs/",
+					fmt.Sprintf("--host=%s-cockroachdb-public:26257", releaseName),
+					"--execute=ANALYZE bank.accounts", "--execute=ANALYZE movr.public.rides",
+				},
+				fmt.Sprintf("%s-cockroachdb-sql-stats-reset", releaseName): {
+					"/cockroach/cockroach", "sql", "--certs-dir=/cockroach-certs/",
+					fmt.Sprintf("--host=%s-cockroachdb-public:26257", releaseName),
+					"--execute=SELECT crdb_internal.reset_sql_stats()",
+				},
+			},
+			"",
+		},
+		{
+			"SQL statistics reset in an insecure cluster",
+			map[string]string{
+				"tls.enabled":              "false",
+				"statistics.reset.enabled": "true",
+			},
+			map[string][]string{
+				fmt.Sprintf("%s-cockroachdb-sql-stats-reset", releaseName): {
+					"/cockroach/cockroach", "sql", "--insecure",
+					fmt.Sprintf("--host=%s-cockroachdb-public:26257", releaseName),
+					"--execute=SELECT crdb_internal.reset_sql_stats()",
+				},
+			},
+			"",
+		},
+		{
+			"No table to refresh",
+			map[string]string{
+				"statistics.refresh.enabled": "true",
+			},
+			nil,
+			"statistics.refresh.tables can't be empty if statistics.refresh.enabled is set to true",
+		},
+		{
+			"Unqualified table",
+			map[string]string{
+				"statistics.refresh.enabled":   "true",
+				"statistics.refresh.tables[0]": "accounts; DROP TABLE users",
+			},
+			nil,
+			"statistics.refresh.tables \"accounts; DROP TABLE users\" must be <database>.<table> or <database>.<schema>.<table>",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/cronjob.statistics.yaml"})
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			commands := map[string][]string{}
+			for _, manifest := range strings.Split(output, "\n---") {
+				if !strings.Contains(manifest, "kind:") {
+					continue
+				}
+
+				var cronJob batchv1.CronJob
+				helm.UnmarshalK8SYaml(subT, manifest, &cronJob)
+				require.Equal(subT, "Forbid", string(cronJob.Spec.ConcurrencyPolicy))
+
+				podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+				commands[cronJob.Name] = podSpec.Containers[0].Command
+				require.Equal(subT, testCase.values["tls.enabled"] != "false", len(podSpec.InitContainers) == 1)
+			}
+			require.Equal(subT, testCase.commands, commands)
+		})
+	}
+}
+
+func TestHelmTimeseries(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"conf.max-tsdb-memory":        "1GiB",
+			"timeseries.resolution10sTTL": "120h",
+		},
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "require init.provisioning.enabled")
+
+	options.SetValues["init.provisioning.enabled"] = "true"
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+	require.Contains(t, statefulset.Spec.Template.Spec.Containers[0].Args[2], "--max-tsdb-memory=1GiB")
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	command := job.Spec.Template.Spec.Containers[0].Command[2]
+	require.Contains(t, command, "SET CLUSTER SETTING timeseries.storage.resolution_10s.ttl = '120h';")
+	require.NotContains(t, command, "timeseries.storage.resolution_30m.ttl")
+}
+
+func TestHelmSecretsBackend(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]string{
+		"init.provisioning.enabled":           "true",
+		"init.provisioning.users[0].name":     "testUser",
+		"init.provisioning.users[0].password": "AgBy3i4OJSWK+PiTySYZZA9rO43cGDEq",
+		"iap.enabled":                         "true",
+		"iap.clientId":                        "AgAKAoiQm7QDAEoXhyFHL4IPTGB8",
+		"iap.clientSecret":                    "AgBWr1g1rZ8Vd2KkDjFbQTw9TmaA",
+	}
+
+	t.Run("sealed", func(t *testing.T) {
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      map[string]string{"secretsBackend": "sealed"},
+		}
+		for k, v := range values {
+			options.SetValues[k] = v
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/secrets.init.yaml"})
+
+		var sealedSecret unstructured.Unstructured
+		helm.UnmarshalK8SYaml(t, output, &sealedSecret)
+		require.Equal(t, "SealedSecret", sealedSecret.GetKind())
+		require.Equal(t, fmt.Sprintf("%s-cockroachdb-init", releaseName), sealedSecret.GetName())
+		encryptedData, _, err := unstructured.NestedStringMap(sealedSecret.Object, "spec", "encryptedData")
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"testUser-password": "AgBy3i4OJSWK+PiTySYZZA9rO43cGDEq"}, encryptedData)
+	})
+
+	t.Run("external", func(t *testing.T) {
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      map[string]string{"secretsBackend": "external"},
+		}
+		for k, v := range values {
+			options.SetValues[k] = v
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/secret.backendconfig.yaml"})
+		require.ErrorContains(t, err, "externalSecrets.secretStoreRef.name must be set")
+
+		options.SetValues["externalSecrets.secretStoreRef.name"] = "vault"
+		options.SetValues["externalSecrets.secretStoreRef.kind"] = "ClusterSecretStore"
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/secret.backendconfig.yaml"})
+
+		var externalSecret unstructured.Unstructured
+		helm.UnmarshalK8SYaml(t, output, &externalSecret)
+		require.Equal(t, "ExternalSecret", externalSecret.GetKind())
+
+		storeKind, _, err := unstructured.NestedString(externalSecret.Object, "spec", "secretStoreRef", "kind")
+		require.NoError(t, err)
+		require.Equal(t, "ClusterSecretStore", storeKind)
+
+		target, _, err := unstructured.NestedString(externalSecret.Object, "spec", "target", "name")
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%s-cockroachdb.iap", releaseName), target)
+
+		data, _, err := unstructured.NestedSlice(externalSecret.Object, "spec", "data")
+		require.NoError(t, err)
+		require.Len(t, data, 2)
+		require.Equal(t, "client_id", data[0].(map[string]interface{})["secretKey"])
+	})
+}
+
+func TestHelmVolumeExporter(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"volumeExporter.enabled": "true",
+		},
+	}
+
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.ErrorContains(t, err, "volumeExporter.enabled requires conf.log.persistentVolume.enabled")
+
+	options.SetValues["conf.log.enabled"] = "true"
+	options.SetValues["conf.log.persistentVolume.enabled"] = "true"
+	options.SetValues["volumeExporter.prometheusRule.enabled"] = "true"
+	options.SetValues["serviceMonitor.enabled"] = "true"
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	containers := statefulset.Spec.Template.Spec.Containers
+	require.Len(t, containers, 2)
+	exporter := containers[1]
+	require.Equal(t, "volume-exporter", exporter.Name)
+	require.Equal(t, []string{
+		"/volume-exporter",
+		"--listen-address=:9102",
+		"--volume=logsdir=/cockroach/cockroach-logs/",
+	}, exporter.Command)
+	require.Equal(t, []corev1.VolumeMount{
+		{Name: "logsdir", MountPath: "/cockroach/cockroach-logs/", ReadOnly: true},
+	}, exporter.VolumeMounts)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/service.discovery.yaml"})
+
+	var service corev1.Service
+	helm.UnmarshalK8SYaml(t, output, &service)
+	require.Equal(t, "volume-metrics", service.Spec.Ports[len(service.Spec.Ports)-1].Name)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/serviceMonitor.yaml"})
+
+	var serviceMonitor unstructured.Unstructured
+	helm.UnmarshalK8SYaml(t, output, &serviceMonitor)
+	endpoints, _, err := unstructured.NestedSlice(serviceMonitor.Object, "spec", "endpoints")
+	require.NoError(t, err)
+	require.Len(t, endpoints, 2)
+	require.Equal(t, "volume-metrics", endpoints[1].(map[string]interface{})["port"])
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/prometheusrule.volumeUsage.yaml"})
+
+	var rule unstructured.Unstructured
+	helm.UnmarshalK8SYaml(t, output, &rule)
+	require.Equal(t, "PrometheusRule", rule.GetKind())
+	groups, _, err := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	require.NoError(t, err)
+	rules := groups[0].(map[string]interface{})["rules"].([]interface{})
+	require.Len(t, rules, 2)
+	require.Equal(t, "CockroachDBVolumeUsageCritical", rules[0].(map[string]interface{})["alert"])
+	require.Contains(t, rules[0].(map[string]interface{})["expr"], "> 90")
+	require.Equal(t, "CockroachDBVolumeUsageWarning", rules[1].(map[string]interface{})["alert"])
+	require.Contains(t, rules[1].(map[string]interface{})["expr"], "> 80")
+}
+
+func TestHelmTempDir(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		values map[string]string
+		expErr string
+	}{
+		{
+			"Both volumes enabled",
+			map[string]string{
+				"conf.temp-dir.emptyDir.enabled":         "true",
+				"conf.temp-dir.persistentVolume.enabled": "true",
+			},
+			"are mutually exclusive",
+		},
+		{
+			"No max-disk-temp-storage",
+			map[string]string{
+				"conf.temp-dir.persistentVolume.enabled": "true",
+			},
+			"requires conf.max-disk-temp-storage to be set as a size",
+		},
+		{
+			"Percentage max-disk-temp-storage",
+			map[string]string{
+				"conf.temp-dir.persistentVolume.enabled": "true",
+				"conf.max-disk-temp-storage":             "10%",
+			},
+			"requires conf.max-disk-temp-storage to be set as a size",
+		},
+		{
+			"emptyDir without size limit",
+			map[string]string{
+				"conf.temp-dir.emptyDir.enabled": "true",
+				"conf.max-disk-temp-storage":     "8GiB",
+			},
+			"requires conf.temp-dir.emptyDir.sizeLimit",
+		},
+	}
+
+	for _, testCase := range cases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			require.ErrorContains(t, err, testCase.expErr)
+		})
+	}
+
+	t.Run("emptyDir", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"conf.temp-dir.emptyDir.enabled":   "true",
+				"conf.temp-dir.emptyDir.sizeLimit": "10Gi",
+				"conf.max-disk-temp-storage":       "8GiB",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		container := statefulset.Spec.Template.Spec.Containers[0]
+		require.Contains(t, container.Args[2], "--max-disk-temp-storage=8GiB")
+		require.Contains(t, container.Args[2], "--temp-dir=/cockroach/cockroach-temp/")
+		require.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "tempdir", MountPath: "/cockroach/cockroach-temp/"})
+
+		var tempDir *corev1.Volume
+		for i, volume := range statefulset.Spec.Template.Spec.Volumes {
+			if volume.Name == "tempdir" {
+				tempDir = &statefulset.Spec.Template.Spec.Volumes[i]
+			}
+		}
+		require.NotNil(t, tempDir)
+		require.NotNil(t, tempDir.EmptyDir)
+		require.Equal(t, "10Gi", tempDir.EmptyDir.SizeLimit.String())
+	})
+
+	t.Run("persistentVolume", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"conf.temp-dir.persistentVolume.enabled": "true",
+				"conf.temp-dir.persistentVolume.size":    "100Gi",
+				"conf.max-disk-temp-storage":             "80GiB",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		require.Contains(t, statefulset.Spec.Template.Spec.Containers[0].Args[2], "--temp-dir=/cockroach/cockroach-temp/")
+
+		claims := statefulset.Spec.VolumeClaimTemplates
+		claim := claims[len(claims)-1]
+		require.Equal(t, "tempdir", claim.Name)
+		require.Equal(t, "100Gi", claim.Spec.Resources.Requests.Storage().String())
+	})
+}
+
+func TestHelmContainerName(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"statefulset.containerName": "cockroachdb",
+		},
+		SetStrValues: map[string]string{
+			"statefulset.annotations.prometheus\\.io/scrape": "true",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+	var statefulset appsv1.StatefulSet
+	helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+	require.Equal(t, "cockroachdb", statefulset.Spec.Template.Spec.Containers[0].Name)
+	require.Equal(t, map[string]string{
+		"kubectl.kubernetes.io/default-container": "cockroachdb",
+		"prometheus.io/scrape":                    "true",
+	}, statefulset.Spec.Template.Annotations)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+	require.Equal(t, "cluster-init", job.Spec.Template.Annotations["kubectl.kubernetes.io/default-container"])
+
+	options.SetValues["statefulset.containerName"] = "CockroachDB"
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+	require.Error(t, err)
+}
+
+func TestHelmMaintenanceWindow(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"maintenanceWindow.enabled":  "true",
+			"maintenanceWindow.schedule": "30 1 * * 0",
+			"maintenanceWindow.duration": "2h30m",
+		},
+	}
+
+	for _, template := range []string{"templates/cronjob-ca-certSelfSigner.yaml", "templates/cronjob-client-node-certSelfSigner.yaml"} {
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{template})
+
+		var cronjob batchv1.CronJob
+		helm.UnmarshalK8SYaml(t, output, &cronjob)
+
+		require.Equal(t, "30 1 * * 0", cronjob.Spec.Schedule)
+		require.NotNil(t, cronjob.Spec.StartingDeadlineSeconds)
+		require.Equal(t, int64(9000), *cronjob.Spec.StartingDeadlineSeconds)
+
+		args := strings.Join(cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args, " ")
+		require.Contains(t, args, "-cron=30 1 * * 0")
+	}
+
+	options.SetValues["maintenanceWindow.duration"] = "0m"
+	_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/cronjob-ca-certSelfSigner.yaml"})
+	require.ErrorContains(t, err, "maintenanceWindow.duration must be longer than zero")
+}
+
+func TestHelmSelfSignerPlatforms(t *testing.T) {
+	t.Parallel()
+
+	platformTerm := func(os, arch string, expressions ...corev1.NodeSelectorRequirement) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{MatchExpressions: append(expressions,
+			corev1.NodeSelectorRequirement{Key: "kubernetes.io/os", Operator: corev1.NodeSelectorOpIn, Values: []string{os}},
+			corev1.NodeSelectorRequirement{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{arch}},
+		)}
+	}
+
+	t.Run("Default platforms", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-certSelfSigner.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+
+		require.NotNil(t, job.Spec.Template.Spec.Affinity)
+		require.Equal(t, []corev1.NodeSelectorTerm{
+			platformTerm("linux", "amd64"),
+			platformTerm("linux", "arm64"),
+		}, job.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
+	})
+
+	t.Run("Platforms merged with the affinity", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.selfSigner.image.platforms[0]": "linux/amd64",
+				"tls.selfSigner.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[0].matchExpressions[0].key":       "pool",
+				"tls.selfSigner.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[0].matchExpressions[0].operator":  "In",
+				"tls.selfSigner.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[0].matchExpressions[0].values[0]": "system",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-client-node-certSelfSigner.yaml"})
+
+		var cronjob batchv1.CronJob
+		helm.UnmarshalK8SYaml(t, output, &cronjob)
+
+		pool := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"system"}}
+		require.Equal(t, []corev1.NodeSelectorTerm{
+			platformTerm("linux", "amd64", pool),
+		}, cronjob.Spec.JobTemplate.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
+	})
+
+	t.Run("No platforms", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.selfSigner.image.platforms": "null",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-cleaner.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		require.Nil(t, job.Spec.Template.Spec.Affinity)
+	})
+}
+
+func TestHelmSelfSignerSplitCA(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Client CA passed to the self-signer and mounted in the pods", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.certs.selfSigner.splitCA": "true",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-certSelfSigner.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		require.Contains(t, job.Spec.Template.Spec.Containers[0].Args, "--split-ca")
+
+		for _, template := range []string{"templates/cronjob-ca-certSelfSigner.yaml", "templates/cronjob-client-node-certSelfSigner.yaml"} {
+			output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{template})
+
+			var cronjob batchv1.CronJob
+			helm.UnmarshalK8SYaml(t, output, &cronjob)
+			require.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args, "--split-ca")
+		}
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		var sources []corev1.VolumeProjection
+		for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+			if volume.Name == "certs-secret" {
+				sources = volume.Projected.Sources
+			}
+		}
+		require.Len(t, sources, 2)
+		require.Equal(t, fmt.Sprintf("%s-cockroachdb-node-client-secret", releaseName), sources[1].Secret.Name)
+		require.Equal(t, []string{"ca-client.crt", "client.node.crt", "client.node.key"},
+			[]string{sources[1].Secret.Items[0].Path, sources[1].Secret.Items[1].Path, sources[1].Secret.Items[2].Path})
+	})
+
+	t.Run("Single CA by default", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-certSelfSigner.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		require.NotContains(t, job.Spec.Template.Spec.Containers[0].Args, "--split-ca")
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+			if volume.Name == "certs-secret" {
+				require.Len(t, volume.Projected.Sources, 1)
+			}
+		}
+	})
+
+	t.Run("Split CA with a provided CA", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.certs.selfSigner.splitCA":    "true",
+				"tls.certs.selfSigner.caProvided": "true",
+				"tls.certs.selfSigner.caSecret":   "ca-secret",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/serviceaccount-certSelfSigner.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "tls.certs.selfSigner.splitCA can't be used with tls.certs.selfSigner.caProvided")
+	})
+}
+
+func TestHelmUICertificate(t *testing.T) {
+	t.Parallel()
+
+	certsSecretSources := func(t *testing.T, options *helm.Options) *corev1.ProjectedVolumeSource {
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+			if volume.Name == "certs-secret" {
+				return volume.Projected
+			}
+		}
+		t.Fatal("Volume certs-secret not found")
+		return nil
+	}
+
+	t.Run("Issued by cert-manager with the self-signed node certificates", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.certs.ui.secretName":  "db-console-tls",
+				"tls.certs.ui.issuer.name": "letsencrypt",
+				"tls.certs.ui.dnsNames[0]": "cockroachdb.example.com",
+			},
+		}
+
+		projected := certsSecretSources(t, options)
+		require.Len(t, projected.Sources, 2)
+		ui := projected.Sources[1].Secret
+		require.Equal(t, "db-console-tls", ui.Name)
+		require.Equal(t, []string{"ui.crt", "ui.key"}, []string{ui.Items[0].Path, ui.Items[1].Path})
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/certificate.ui.yaml"})
+		require.Contains(t, output, "secretName: db-console-tls")
+		require.Contains(t, output, "- cockroachdb.example.com")
+		require.Contains(t, output, "name: letsencrypt\n    kind: ClusterIssuer")
+	})
+
+	t.Run("Provided with its CA and plain node certificates", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.certs.selfSigner.enabled": "false",
+				"tls.certs.provided":           "true",
+				"tls.certs.ui.secretName":      "db-console-tls",
+				"tls.certs.ui.caKey":           "ca.crt",
+			},
+		}
+
+		projected := certsSecretSources(t, options)
+		require.Equal(t, int32(256), *projected.DefaultMode)
+		require.Len(t, projected.Sources, 2)
+		require.Equal(t, "cockroachdb-node", projected.Sources[0].Secret.Name)
+		require.Empty(t, projected.Sources[0].Secret.Items)
+		ui := projected.Sources[1].Secret
+		require.Equal(t, []string{"ui.crt", "ui.key", "ca-ui.crt"}, []string{ui.Items[0].Path, ui.Items[1].Path, ui.Items[2].Path})
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/certificate.ui.yaml"})
+		require.ErrorContains(t, err, "could not find template templates/certificate.ui.yaml in chart")
+	})
+
+	t.Run("Issuer without DNS names", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.certs.ui.secretName":  "db-console-tls",
+				"tls.certs.ui.issuer.name": "letsencrypt",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		require.ErrorContains(t, err, "tls.certs.ui.issuer requires tls.certs.ui.dnsNames")
+	})
+
+	t.Run("Insecure cluster", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.enabled":             "false",
+				"tls.certs.ui.secretName": "db-console-tls",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		require.ErrorContains(t, err, "tls.certs.ui.secretName requires tls.enabled")
+	})
+}
+
+func TestHelmTLSPerNodeCerts(t *testing.T) {
+	t.Parallel()
+
+	// perNodeValues returns the values of per-node certificates provided in Secrets, with the given ones.
+	perNodeValues := func(values map[string]string) map[string]string {
+		merged := map[string]string{
+			"tls.certs.selfSigner.enabled": "false",
+			"tls.certs.provided":           "true",
+			"tls.certs.perNode.enabled":    "true",
+		}
+		for k, v := range values {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	t.Run("Secrets named after the pattern", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: perNodeValues(map[string]string{
+				"statefulset.ordinals.start": "2",
+			}),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		var projected *corev1.ProjectedVolumeSource
+		for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+			if volume.Name == "certs-secret" {
+				projected = volume.Projected
+			}
+		}
+		require.NotNil(t, projected)
+		require.Equal(t, int32(256), *projected.DefaultMode)
+		require.Len(t, projected.Sources, 3)
+		for i, source := range projected.Sources {
+			ordinal := i + 2
+			require.Equal(t, fmt.Sprintf("cockroachdb-node-%d", ordinal), source.Secret.Name)
+			var paths []string
+			for _, item := range source.Secret.Items {
+				paths = append(paths, item.Path)
+			}
+			require.Equal(t, []string{
+				fmt.Sprintf("node-%d/ca.crt", ordinal),
+				fmt.Sprintf("node-%d/node.crt", ordinal),
+				fmt.Sprintf("node-%d/node.key", ordinal),
+			}, paths)
+		}
+
+		// The nodes only get the certificate of their ordinal, through the copy-certs init container.
+		require.Equal(t, "copy-certs", statefulset.Spec.Template.Spec.InitContainers[0].Name)
+		require.Contains(t, statefulset.Spec.Template.Spec.InitContainers[0].Command[2], "cp -f /certs/node-$ordinal/* /cockroach-certs/")
+		for _, mount := range statefulset.Spec.Template.Spec.Containers[0].VolumeMounts {
+			require.NotEqual(t, "certs-secret", mount.Name)
+		}
+	})
+
+	t.Run("Listed TLS Secrets", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: perNodeValues(map[string]string{
+				"tls.certs.tlsSecret":              "true",
+				"tls.certs.perNode.nodeSecrets[0]": "crdb-a",
+				"tls.certs.perNode.nodeSecrets[1]": "crdb-b",
+				"tls.certs.perNode.nodeSecrets[2]": "crdb-c",
+			}),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+
+		for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+			if volume.Name != "certs-secret" {
+				continue
+			}
+			require.Len(t, volume.Projected.Sources, 3)
+			for i, name := range []string{"crdb-a", "crdb-b", "crdb-c"} {
+				secret := volume.Projected.Sources[i].Secret
+				require.Equal(t, name, secret.Name)
+				require.Equal(t, "tls.crt", secret.Items[1].Key)
+				require.Equal(t, fmt.Sprintf("node-%d/node.crt", i), secret.Items[1].Path)
+			}
+		}
+	})
+
+	testCases := []struct {
+		name   string
+		values map[string]string
+		expErr string
+	}{
+		{
+			"Self-signed certificates",
+			map[string]string{
+				"tls.certs.perNode.enabled": "true",
+			},
+			"tls.certs.perNode requires tls.enabled and tls.certs.provided",
+		},
+		{
+			"Fewer Secrets than replicas",
+			perNodeValues(map[string]string{
+				"tls.certs.perNode.nodeSecrets[0]": "crdb-a",
+				"tls.certs.perNode.nodeSecrets[1]": "crdb-b",
+			}),
+			"tls.certs.perNode.nodeSecrets has 2 Secrets for 3 replicas",
+		},
+		{
+			"Pattern without the ordinal",
+			perNodeValues(map[string]string{
+				"tls.certs.perNode.nodeSecretPattern": "cockroachdb-node",
+			}),
+			"tls.certs.perNode.nodeSecretPattern cockroachdb-node must contain %d once",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			_, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+			require.ErrorContains(subT, err, testCase.expErr)
+		})
+	}
+}
+
+func TestHelmCleaner(t *testing.T) {
+	t.Parallel()
+
+	fullname := fmt.Sprintf("%s-cockroachdb", releaseName)
+
+	t.Run("Secrets only by default", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-cleaner.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		require.Equal(t, []string{"cleanup", "--namespace=" + namespaceName}, job.Spec.Template.Spec.Containers[0].Args)
+		require.Equal(t, fullname+"-self-signer-cleaner", job.Spec.Template.Spec.ServiceAccountName)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/role-cleaner.yaml"})
+
+		var role rbacv1.Role
+		helm.UnmarshalK8SYaml(t, output, &role)
+		require.Equal(t, []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"get", "delete"},
+			ResourceNames: []string{
+				fullname + "-ca-secret",
+				fullname + "-node-secret",
+				fullname + "-client-secret",
+				fullname + "-client-ca-secret",
+				fullname + "-node-client-secret",
+			},
+		}}, role.Rules)
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/clusterrole-cleaner.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "could not find template templates/clusterrole-cleaner.yaml in chart")
+	})
+
+	t.Run("CSRs and completed jobs in dry run", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"statefulset.replicas":                       "2",
+				"statefulset.ordinals.start":                 "3",
+				"tls.certs.selfSigner.cleaner.secrets":       "false",
+				"tls.certs.selfSigner.cleaner.csrs":          "true",
+				"tls.certs.selfSigner.cleaner.completedJobs": "true",
+				"tls.certs.selfSigner.cleaner.dryRun":        "true",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job-cleaner.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		require.Equal(t, []string{
+			"cleanup",
+			"--namespace=" + namespaceName,
+			"--secrets=false",
+			"--csrs",
+			"--start-ordinal=3",
+			"--replicas=2",
+			"--completed-jobs",
+			"--job-selector=app.kubernetes.io/name=cockroachdb,app.kubernetes.io/instance=" + releaseName,
+			"--dry-run",
+		}, job.Spec.Template.Spec.Containers[0].Args)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/role-cleaner.yaml"})
+
+		var role rbacv1.Role
+		helm.UnmarshalK8SYaml(t, output, &role)
+		require.Equal(t, []rbacv1.PolicyRule{{
+			APIGroups: []string{"batch"},
+			Resources: []string{"jobs"},
+			Verbs:     []string{"list", "get", "delete"},
+		}}, role.Rules)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/clusterrole-cleaner.yaml"})
+
+		var clusterRole rbacv1.ClusterRole
+		helm.UnmarshalK8SYaml(t, output, &clusterRole)
+		require.Equal(t, []rbacv1.PolicyRule{{
+			APIGroups: []string{"certificates.k8s.io"},
+			Resources: []string{"certificatesigningrequests"},
+			Verbs:     []string{"get", "delete"},
+			ResourceNames: []string{
+				namespaceName + ".client.root",
+				namespaceName + ".node." + fullname + "-3",
+				namespaceName + ".node." + fullname + "-4",
+			},
+		}}, clusterRole.Rules)
+	})
+
+	t.Run("CSRs without cluster-scoped RBAC", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"rbac.clusterScoped":                "false",
+				"tls.certs.selfSigner.cleaner.csrs": "true",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/job-cleaner.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "tls.certs.selfSigner.cleaner.csrs requires rbac.clusterScoped")
+	})
+
+	t.Run("Nothing to prune", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.certs.selfSigner.cleaner.secrets": "false",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/job-cleaner.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "could not find template templates/job-cleaner.yaml in chart")
+	})
+}
+
+func TestHelmCSRCollector(t *testing.T) {
+	t.Parallel()
+
+	fullname := fmt.Sprintf("%s-cockroachdb", releaseName)
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/cronjob-csrCollector.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "could not find template templates/cronjob-csrCollector.yaml in chart")
+	})
+
+	t.Run("Enabled in dry run", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"tls.certs.selfSigner.csrCollector.enabled":  "true",
+				"tls.certs.selfSigner.csrCollector.schedule": "0 4 * * 0",
+				"tls.certs.selfSigner.csrCollector.ttl":      "72h",
+				"tls.certs.selfSigner.csrCollector.dryRun":   "true",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-csrCollector.yaml"})
+
+		var cronjob batchv1.CronJob
+		helm.UnmarshalK8SYaml(t, output, &cronjob)
+		require.Equal(t, "0 4 * * 0", cronjob.Spec.Schedule)
+		podSpec := cronjob.Spec.JobTemplate.Spec.Template.Spec
+		require.Equal(t, []string{
+			"collect-csrs",
+			"--namespace=" + namespaceName,
+			"--selector=app.kubernetes.io/name=cockroachdb,app.kubernetes.io/instance=" + releaseName,
+			"--ttl=72h",
+			"--dry-run",
+		}, podSpec.Containers[0].Args)
+		require.Equal(t, fullname+"-csr-collector", podSpec.ServiceAccountName)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/clusterrole-csrCollector.yaml"})
+
+		var clusterRole rbacv1.ClusterRole
+		helm.UnmarshalK8SYaml(t, output, &clusterRole)
+		require.Equal(t, []rbacv1.PolicyRule{{
+			APIGroups: []string{"certificates.k8s.io"},
+			Resources: []string{"certificatesigningrequests"},
+			Verbs:     []string{"list", "delete"},
+		}}, clusterRole.Rules)
+	})
+
+	t.Run("Without cluster-scoped RBAC", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"rbac.clusterScoped":                        "false",
+				"tls.certs.selfSigner.csrCollector.enabled": "true",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/cronjob-csrCollector.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "tls.certs.selfSigner.csrCollector requires rbac.clusterScoped")
+	})
+}
+
+func TestHelmDriftDetection(t *testing.T) {
+	t.Parallel()
+
+	fullname := fmt.Sprintf("%s-cockroachdb", releaseName)
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/cronjob-driftDetector.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "could not find template templates/cronjob-driftDetector.yaml in chart")
+	})
+
+	t.Run("Enabled with metrics", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"driftDetection.enabled":        "true",
+				"driftDetection.schedule":       "0 * * * *",
+				"driftDetection.kinds":          "{StatefulSet,Service,PodDisruptionBudget}",
+				"driftDetection.pushgatewayUrl": "http://pushgateway.monitoring:9091",
+				"driftDetection.failOnDrift":    "true",
+			},
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/cronjob-driftDetector.yaml"})
+
+		var cronjob batchv1.CronJob
+		helm.UnmarshalK8SYaml(t, output, &cronjob)
+		require.Equal(t, "0 * * * *", cronjob.Spec.Schedule)
+		podSpec := cronjob.Spec.JobTemplate.Spec.Template.Spec
+		require.Equal(t, []string{
+			"detect-drift",
+			"--namespace=" + namespaceName,
+			"--release=" + releaseName,
+			"--kind=StatefulSet,Service,PodDisruptionBudget",
+			"--event-statefulset=" + fullname,
+			"--pushgateway-url=http://pushgateway.monitoring:9091",
+			"--fail-on-drift",
+		}, podSpec.Containers[0].Args)
+		require.Equal(t, fullname+"-drift-detector", podSpec.ServiceAccountName)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/role-driftDetector.yaml"})
+
+		var role rbacv1.Role
+		helm.UnmarshalK8SYaml(t, output, &role)
+		require.Equal(t, []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list"}},
+			{APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}, Verbs: []string{"get"}},
+			{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"get"}},
+			{APIGroups: []string{"policy"}, Resources: []string{"poddisruptionbudgets"}, Verbs: []string{"get"}},
+			{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}},
+		}, role.Rules)
+	})
+
+	t.Run("Unsupported kind", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"driftDetection.enabled": "true",
+				"driftDetection.kinds":   "{StatefulSet,Secret}",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/role-driftDetector.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "driftDetection.kinds: unsupported kind Secret")
+	})
+}
+
+func TestHelmChangefeedSinks(t *testing.T) {
+	t.Parallel()
+
+	sinkValues := map[string]string{
+		"init.provisioning.enabled":         "true",
+		"changefeed.sinks[0].name":          "kafka",
+		"changefeed.sinks[0].uri":           "kafka://kafka.kafka.svc:9093?tls_enabled=true",
+		"changefeed.sinks[0].secret":        "kafka-sink-tls",
+		"changefeed.sinks[1].name":          "webhook",
+		"changefeed.sinks[1].uri":           "webhook-https://hooks.example.com/crdb",
+		"changefeed.sinks[1].secret":        "webhook-ca",
+		"changefeed.sinks[1].clientCertKey": "",
+		"changefeed.sinks[1].clientKeyKey":  "",
+		"changefeed.sinks[1].caCertKey":     "ca.pem",
+	}
+
+	kafkaItems := []corev1.KeyToPath{
+		{Key: "ca.crt", Path: "ca.crt"},
+		{Key: "tls.crt", Path: "client.crt"},
+		{Key: "tls.key", Path: "client.key"},
+	}
+	webhookItems := []corev1.KeyToPath{
+		{Key: "ca.pem", Path: "ca.crt"},
+	}
+
+	requireSinkVolumes := func(t *testing.T, volumes []corev1.Volume, mounts []corev1.VolumeMount) {
+		secrets := map[string]*corev1.SecretVolumeSource{}
+		for _, volume := range volumes {
+			secrets[volume.Name] = volume.Secret
+		}
+		paths := map[string]string{}
+		for _, mount := range mounts {
+			paths[mount.Name] = mount.MountPath
+		}
+
+		require.Equal(t, "kafka-sink-tls", secrets["changefeed-sink-kafka"].SecretName)
+		require.Equal(t, kafkaItems, secrets["changefeed-sink-kafka"].Items)
+		require.Equal(t, "/cockroach/changefeed-sinks/kafka/", paths["changefeed-sink-kafka"])
+		require.Equal(t, "webhook-ca", secrets["changefeed-sink-webhook"].SecretName)
+		require.Equal(t, webhookItems, secrets["changefeed-sink-webhook"].Items)
+		require.Equal(t, "/cockroach/changefeed-sinks/webhook/", paths["changefeed-sink-webhook"])
+	}
+
+	t.Run("Sinks mounted in the pods and registered by the init job", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      sinkValues,
+		}
+
+		output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+		var statefulset appsv1.StatefulSet
+		helm.UnmarshalK8SYaml(t, output, &statefulset)
+		requireSinkVolumes(t, statefulset.Spec.Template.Spec.Volumes, statefulset.Spec.Template.Spec.Containers[0].VolumeMounts)
+
+		output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+		var job batchv1.Job
+		helm.UnmarshalK8SYaml(t, output, &job)
+		requireSinkVolumes(t, job.Spec.Template.Spec.Volumes, job.Spec.Template.Spec.Containers[0].VolumeMounts)
+
+		script := job.Spec.Template.Spec.Containers[0].Command[2]
+		require.Contains(t, script, "uri='kafka://kafka.kafka.svc:9093?tls_enabled=true';")
+		require.Contains(t, script, `--execute="CREATE EXTERNAL CONNECTION kafka AS '$uri';"`)
+		require.Contains(t, script, `--execute="CREATE EXTERNAL CONNECTION webhook AS '$uri';"`)
+		require.Contains(t, script, "registerChangefeedSinks;")
+	})
+
+	t.Run("Sinks without provisioning", func(t *testing.T) {
+		t.Parallel()
+
+		values := map[string]string{"init.provisioning.enabled": "false"}
+		for key, value := range sinkValues {
+			if key != "init.provisioning.enabled" {
+				values[key] = value
+			}
+		}
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues:      values,
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "changefeed.sinks are registered by the provisioning job and require init.provisioning.enabled")
+	})
+
+	t.Run("Invalid sink name", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"init.provisioning.enabled":  "true",
+				"changefeed.sinks[0].name":   "kafka-sink",
+				"changefeed.sinks[0].uri":    "kafka://kafka:9093",
+				"changefeed.sinks[0].secret": "kafka-sink-tls",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `changefeed.sinks[].name "kafka-sink" must only contain lowercase letters, digits and underscores`)
+	})
+}
+
+func TestHelmProfile(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		values    map[string]string
+		resources string
+		args      []string
+		storeSize string
+	}{
+		{
+			"Large profile matches the defaults",
+			map[string]string{"conf.store.enabled": "true"},
+			"{}",
+			[]string{"--cache=25%", "--max-sql-memory=25%", "--store=path=cockroach-data,size=100Gi"},
+			"100Gi",
+		},
+		{
+			"Small profile",
+			map[string]string{"profile": "small", "conf.store.enabled": "true"},
+			`{"limits":{"memory":"2Gi"},"requests":{"cpu":"500m","memory":"2Gi"}}`,
+			[]string{"--cache=20%", "--max-sql-memory=20%", "--store=path=cockroach-data,size=10Gi"},
+			"10Gi",
+		},
+		{
+			"Medium profile",
+			map[string]string{"profile": "medium", "conf.store.enabled": "true"},
+			`{"limits":{"memory":"8Gi"},"requests":{"cpu":"2","memory":"8Gi"}}`,
+			[]string{"--cache=25%", "--max-sql-memory=25%", "--store=path=cockroach-data,size=50Gi"},
+			"50Gi",
+		},
+		{
+			"Values set explicitly take precedence over the profile",
+			map[string]string{
+				"profile":                            "small",
+				"conf.store.enabled":                 "true",
+				"conf.cache":                         "30%",
+				"statefulset.resources.requests.cpu": "1",
+				"storage.persistentVolume.size":      "20Gi",
+			},
+			`{"requests":{"cpu":"1"}}`,
+			[]string{"--cache=30%", "--max-sql-memory=20%", "--store=path=cockroach-data,size=20Gi"},
+			"20Gi",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+
+			var statefulset appsv1.StatefulSet
+			helm.UnmarshalK8SYaml(subT, output, &statefulset)
+
+			container := statefulset.Spec.Template.Spec.Containers[0]
+			resources, err := json.Marshal(container.Resources)
+			require.NoError(subT, err)
+			require.JSONEq(subT, testCase.resources, string(resources))
+
+			for _, arg := range testCase.args {
+				require.Contains(subT, container.Args[2], arg)
+			}
+
+			require.Equal(subT, testCase.storeSize, statefulset.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests.Storage().String())
+		})
+	}
+
+	t.Run("Small profile with a serviceMonitor", func(t *testing.T) {
+		t.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"profile":                "small",
+				"serviceMonitor.enabled": "true",
+			},
+		}
+
+		_, err := helm.RenderTemplateE(t, options, helmChartPath, releaseName, []string{"templates/statefulset.yaml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the small profile can't be used with serviceMonitor.enabled or conf.log.persistentVolume.enabled")
+	})
+}
+
+func TestHelmPreflight(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		values map[string]string
+		expErr string
+	}{
+		{
+			"Pre-flight Job disabled by default",
+			map[string]string{
+				"conf.join": "{crdb-0.region-a.example.com:26257}",
+			},
+			"could not find template templates/job-preflight.yaml in chart",
+		},
+		{
+			"Pre-flight Job checking the join addresses",
+			map[string]string{
+				"preflight.enabled": "true",
+				"conf.join":         "{crdb-0.region-a.example.com:26257,crdb-0.region-b.example.com}",
+			},
+			"",
+		},
+		{
+			"Pre-flight Job without join addresses",
+			map[string]string{
+				"preflight.enabled": "true",
+			},
+			"preflight.enabled checks the addresses of conf.join and requires conf.join to be set",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/job-preflight.yaml"})
+			if testCase.expErr != "" {
+				require.Error(subT, err)
+				require.Contains(subT, err.Error(), testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var job batchv1.Job
+			helm.UnmarshalK8SYaml(subT, output, &job)
+
+			require.Equal(subT, "pre-install", job.Annotations["helm.sh/hook"])
+			require.Equal(subT, "-5", job.Annotations["helm.sh/hook-weight"])
+
+			container := job.Spec.Template.Spec.Containers[0]
+			require.Equal(subT, "busybox", container.Image)
+			require.Equal(subT, []string{"preflight", "crdb-0.region-a.example.com:26257", "crdb-0.region-b.example.com"},
+				container.Command[3:])
+			require.Contains(subT, container.Command[2], "nc -z -w 5")
+		})
+	}
+}
+
+func TestHelmBackupScheduleEncryption(t *testing.T) {
+	t.Parallel()
+
+	options := &helm.Options{
+		KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+		SetValues: map[string]string{
+			"init.provisioning.enabled":                                             "true",
+			"init.provisioning.databases[0].name":                                   "testDatabase",
+			"init.provisioning.databases[0].backup.into":                            "s3://backups/testDatabase",
+			"init.provisioning.databases[0].backup.options[0]":                      "revision_history",
+			"init.provisioning.databases[0].backup.recurring":                       "@daily",
+			"init.provisioning.databases[0].backup.encryption.kmsUri":               "aws-kms:///key?AUTH=implicit&REGION=us-east-1",
+			"init.provisioning.databases[0].backups[0].name":                        "gcs",
+			"init.provisioning.databases[0].backups[0].into":                        "gs://backups/testDatabase",
+			"init.provisioning.databases[0].backups[0].recurring":                   "@daily",
+			"init.provisioning.databases[0].backups[0].encryption.passphraseSecret": "backup-passphrase",
+		},
+	}
+
+	output := helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/job.init.yaml"})
+
+	var job batchv1.Job
+	helm.UnmarshalK8SYaml(t, output, &job)
+
+	container := job.Spec.Template.Spec.Containers[0]
+	require.Contains(t, container.Command[2], "WITH revision_history,kms = '$testDatabase_scheduled_backup_KMS_URI'")
+	require.Contains(t, container.Command[2], "WITH encryption_passphrase = '$testDatabase_gcs_scheduled_backup_PASSPHRASE'")
+
+	env := map[string]*corev1.EnvVarSource{}
+	for _, envVar := range container.Env {
+		env[envVar.Name] = envVar.ValueFrom
+	}
+	require.Equal(t, &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "helm-basic-cockroachdb-init"},
+		Key:                  "testDatabase-scheduled-backup-kms-uri",
+	}, env["testDatabase_scheduled_backup_KMS_URI"].SecretKeyRef)
+	require.Equal(t, &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "backup-passphrase"},
+		Key:                  "passphrase",
+	}, env["testDatabase_gcs_scheduled_backup_PASSPHRASE"].SecretKeyRef)
+
+	output = helm.RenderTemplate(t, options, helmChartPath, releaseName, []string{"templates/secrets.init.yaml"})
+
+	var secret corev1.Secret
+	helm.UnmarshalK8SYaml(t, output, &secret)
+
+	require.Equal(t, "aws-kms:///key?AUTH=implicit&REGION=us-east-1", secret.StringData["testDatabase-scheduled-backup-kms-uri"])
+}
+
+func TestHelmDevAccess(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		values map[string]string
+		expErr string
+	}{
+		{
+			"Developer access disabled by default",
+			map[string]string{
+				"tls.enabled": "false",
+			},
+			"could not find template templates/deployment.devAccess.yaml in chart",
+		},
+		{
+			"Developer access in an insecure cluster",
+			map[string]string{
+				"devAccess.enabled": "true",
+				"tls.enabled":       "false",
+			},
+			"",
+		},
+		{
+			"Developer access in a secure cluster",
+			map[string]string{
+				"devAccess.enabled": "true",
+			},
+			"devAccess.enabled is meant for insecure development clusters only and requires tls.enabled to be false",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the testCase value will have been updated by the for loop
+		// and will be the next testCase!
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/deployment.devAccess.yaml"})
+			if testCase.expErr != "" {
+				require.Error(subT, err)
+				require.Contains(subT, err.Error(), testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var deployment appsv1.Deployment
+			helm.UnmarshalK8SYaml(subT, output, &deployment)
+
+			require.Equal(subT, "helm-basic-cockroachdb-dev-access", deployment.Name)
+			require.Equal(subT, "true", deployment.Spec.Template.Labels["helm-basic-cockroachdb-client"])
+
+			containers := deployment.Spec.Template.Spec.Containers
+			require.Len(subT, containers, 2)
+			require.Equal(subT, "http", containers[0].Name)
+			require.Equal(subT, []string{"TCP-LISTEN:8080,fork,reuseaddr", "TCP:helm-basic-cockroachdb-public:8080"}, containers[0].Args)
+			require.Equal(subT, "sql", containers[1].Name)
+			require.Equal(subT, []string{"TCP-LISTEN:26257,fork,reuseaddr", "TCP:helm-basic-cockroachdb-public:26257"}, containers[1].Args)
+
+			output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/service.devAccess.yaml"})
+
+			var service corev1.Service
+			helm.UnmarshalK8SYaml(subT, output, &service)
+
+			require.Equal(subT, corev1.ServiceTypeClusterIP, service.Spec.Type)
+			require.Equal(subT, deployment.Spec.Selector.MatchLabels, service.Spec.Selector)
+		})
+	}
+}
+
+func TestHelmCanary(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		values  map[string]string
+		command []string
+		expErr  string
+	}{
+		{
+			"Canary disabled by default",
+			map[string]string{},
+			nil,
+			"could not find template templates/deployment.canary.yaml in chart",
+		},
+		{
+			"Canary in a secure cluster",
+			map[string]string{
+				"canary.enabled": "true",
+			},
+			[]string{
+				"/canary",
+				"--host=helm-basic-cockroachdb-public:26257",
+				"--certs-dir=/cockroach-certs/",
+				"--table=defaultdb.public.helm_canary",
+				"--interval=10s",
+				"--timeout=5s",
+				"--listen-address=:9103",
+			},
+			"",
+		},
+		{
+			"Canary in an insecure cluster",
+			map[string]string{
+				"canary.enabled":  "true",
+				"canary.interval": "1m",
+				"canary.table":    "canary",
+				"tls.enabled":     "false",
+			},
+			[]string{
+				"/canary",
+				"--host=helm-basic-cockroachdb-public:26257",
+				"--insecure",
+				"--table=canary",
+				"--interval=1m",
+				"--timeout=5s",
+				"--listen-address=:9103",
+			},
+			"",
+		},
+		{
+			"Invalid table",
+			map[string]string{
+				"canary.enabled": "true",
+				"canary.table":   "canary; DROP TABLE users",
+			},
+			nil,
+			"canary.table must be a [database.][schema.]table name, got canary; DROP TABLE users",
+		},
+		{
+			"Invalid interval",
+			map[string]string{
+				"canary.enabled":  "true",
+				"canary.interval": "10",
+			},
+			nil,
+			"canary.interval must be a duration, e.g. 10s, got 10",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			subT.Parallel()
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				SetValues:      testCase.values,
+			}
+
+			output, err := helm.RenderTemplateE(subT, options, helmChartPath, releaseName, []string{"templates/deployment.canary.yaml"})
+			if testCase.expErr != "" {
+				require.ErrorContains(subT, err, testCase.expErr)
+				return
+			}
+			require.NoError(subT, err)
+
+			var deployment appsv1.Deployment
+			helm.UnmarshalK8SYaml(subT, output, &deployment)
+
+			require.Equal(subT, "helm-basic-cockroachdb-canary", deployment.Name)
+			require.Equal(subT, "true", deployment.Spec.Template.Labels["helm-basic-cockroachdb-client"])
+
+			containers := deployment.Spec.Template.Spec.Containers
+			require.Len(subT, containers, 1)
+			require.Equal(subT, testCase.command, containers[0].Command)
+			require.Equal(subT, testCase.values["tls.enabled"] != "false", len(deployment.Spec.Template.Spec.InitContainers) == 1)
+
+			output = helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/service.canary.yaml"})
+
+			var service corev1.Service
+			helm.UnmarshalK8SYaml(subT, output, &service)
+			require.Equal(subT, deployment.Spec.Selector.MatchLabels, service.Spec.Selector)
+			require.Equal(subT, "9103", service.Annotations["prometheus.io/port"])
+		})
+	}
+
+	t.Run("ServiceMonitor", func(subT *testing.T) {
+		subT.Parallel()
+
+		options := &helm.Options{
+			KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+			SetValues: map[string]string{
+				"canary.enabled":         "true",
+				"serviceMonitor.enabled": "true",
+			},
+		}
+
+		output := helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{"templates/serviceMonitor.canary.yaml"})
+
+		var monitor monitoring.ServiceMonitor
+		helm.UnmarshalK8SYaml(subT, output, &monitor)
+		require.Equal(subT, "canary", monitor.Spec.Selector.MatchLabels["app.kubernetes.io/component"])
+		require.Equal(subT, "canary-metrics", monitor.Spec.Endpoints[0].Port)
+	})
+}
@@ -0,0 +1,138 @@
+package golden
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// update rewrites the golden files with the rendered chart instead of comparing them,
+// e.g. `go test ./tests/template/golden/... -update-golden`.
+var update = flag.Bool("update-golden", false, "update the golden files with the rendered chart")
+
+var (
+	err           error
+	helmChartPath string
+	releaseName   = "helm-golden"
+	// namespaceName is fixed, so that the rendered chart is the same across runs.
+	namespaceName = "crdb-golden"
+)
+
+func init() {
+	helmChartPath, err = filepath.Abs("../../../cockroachdb")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// TestHelmRenderGolden renders the full chart for each of the canonical values files in testdata
+// and compares the output with its golden file, to catch accidental drift in the rendered templates.
+func TestHelmRenderGolden(t *testing.T) {
+	t.Parallel()
+
+	valuesFiles, err := filepath.Glob(filepath.Join("testdata", "*.values.yaml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, valuesFiles)
+
+	for _, valuesFile := range valuesFiles {
+		// Here, we capture the range variable and force it into the scope of this block. If we don't do this, when the
+		// subtest switches contexts (because of t.Parallel), the valuesFile value will have been updated by the for loop
+		// and will be the next valuesFile!
+		valuesFile := valuesFile
+		name := strings.TrimSuffix(filepath.Base(valuesFile), ".values.yaml")
+
+		t.Run(name, func(subT *testing.T) {
+			subT.Parallel()
+
+			valuesFilePath, err := filepath.Abs(valuesFile)
+			require.NoError(subT, err)
+
+			options := &helm.Options{
+				KubectlOptions: k8s.NewKubectlOptions("", "", namespaceName),
+				ValuesFiles:    []string{valuesFilePath},
+			}
+
+			output := sortDocuments(subT, helm.RenderTemplate(subT, options, helmChartPath, releaseName, []string{}))
+			output = normalizeVersions(subT, output)
+
+			goldenFile := filepath.Join("testdata", name+".golden.yaml")
+			if *update {
+				require.NoError(subT, os.WriteFile(goldenFile, []byte(output), 0644))
+				return
+			}
+
+			expected, err := os.ReadFile(goldenFile)
+			if os.IsNotExist(err) {
+				subT.Fatalf("golden file %s not found, run `make test/template/golden` to create it", goldenFile)
+			}
+			require.NoError(subT, err)
+
+			require.Equal(subT, string(expected), output,
+				"rendered chart differs from %s, run `make test/template/golden` if the change is intended", goldenFile)
+		})
+	}
+}
+
+// normalizeVersions replaces the chart version and the CockroachDB version of Chart.yaml with placeholders, so that
+// the golden files don't need to be updated by each `go run build/build.go bump`.
+func normalizeVersions(t *testing.T, output string) string {
+	content, err := os.ReadFile(filepath.Join(helmChartPath, "Chart.yaml"))
+	require.NoError(t, err)
+
+	var chart struct {
+		Version    string `yaml:"version"`
+		AppVersion string `yaml:"appVersion"`
+	}
+	require.NoError(t, yaml.Unmarshal(content, &chart))
+
+	return strings.NewReplacer(
+		"cockroachdb-"+chart.Version, "cockroachdb-CHART_VERSION",
+		"cockroachdb/cockroach:v"+chart.AppVersion, "cockroachdb/cockroach:vAPP_VERSION",
+	).Replace(output)
+}
+
+// sortDocuments orders the rendered documents by kind, namespace and name, so that the golden files
+// don't depend on the order in which helm sorts the manifests and hooks.
+func sortDocuments(t *testing.T, output string) string {
+	type document struct {
+		key     string
+		content string
+	}
+
+	var documents []document
+	for _, content := range strings.Split(output, "\n---") {
+		content = strings.TrimSpace(strings.TrimPrefix(content, "---"))
+		if content == "" {
+			continue
+		}
+
+		var object metav1.PartialObjectMetadata
+		helm.UnmarshalK8SYaml(t, content, &object)
+		documents = append(documents, document{
+			key:     strings.Join([]string{object.Kind, object.Namespace, object.Name}, "/"),
+			content: content,
+		})
+	}
+
+	sort.SliceStable(documents, func(i, j int) bool {
+		if documents[i].key != documents[j].key {
+			return documents[i].key < documents[j].key
+		}
+		return documents[i].content < documents[j].content
+	})
+
+	var sorted strings.Builder
+	for _, document := range documents {
+		sorted.WriteString("---\n" + document.content + "\n")
+	}
+	return sorted.String()
+}
@@ -2,6 +2,7 @@ package testutil
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
 	"encoding/pem"
@@ -117,6 +118,17 @@ func statefulSetIsReady(ss *appsv1.StatefulSet) bool {
 }
 
 func getDBConn(t *testing.T, crdbCluster CockroachCluster, dbName string) *sql.DB {
+	// Create a new database connection for the update.
+	db, err := openDBConn(crdbCluster, 0, dbName)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// openDBConn opens a database connection to the CRDB pod of the given ordinal.
+func openDBConn(crdbCluster CockroachCluster, ordinal int, dbName string) (*sql.DB, error) {
 	isSecure := crdbCluster.CaSecret != ""
 	sqlPort := int32(26257)
 	conn := &database.DBConnection{
@@ -126,7 +138,7 @@ func getDBConn(t *testing.T, crdbCluster CockroachCluster, dbName string) *sql.D
 		UseSSL: isSecure,
 
 		RestConfig:   crdbCluster.Cfg,
-		ServiceName:  fmt.Sprintf("%s-0.%s", crdbCluster.StatefulSetName, crdbCluster.StatefulSetName),
+		ServiceName:  fmt.Sprintf("%s-%d.%s", crdbCluster.StatefulSetName, ordinal, crdbCluster.StatefulSetName),
 		Namespace:    crdbCluster.Namespace,
 		DatabaseName: dbName,
 
@@ -135,13 +147,7 @@ func getDBConn(t *testing.T, crdbCluster CockroachCluster, dbName string) *sql.D
 		RootCertificateSecretName:   crdbCluster.NodeSecret,
 	}
 
-	// Create a new database connection for the update.
-	db, err := database.NewDbConnection(conn)
-	require.NoError(t, err)
-	t.Cleanup(func() {
-		db.Close()
-	})
-	return db
+	return database.NewDbConnection(conn)
 }
 
 // RequireDatabaseToFunction creates a table and insert two rows.
@@ -220,6 +226,31 @@ func RequireCRDBToFunction(t *testing.T, crdbCluster CockroachCluster, rotate bo
 	t.Log("finished testing database")
 }
 
+// RequireNodesToAdvertiseDNSNames checks that the given number of nodes joined the cluster and are live, advertising
+// the stable DNS names of their Pods in the headless Service rather than Pod IPs.
+func RequireNodesToAdvertiseDNSNames(t *testing.T, crdbCluster CockroachCluster, replicas int) {
+	db := getDBConn(t, crdbCluster, "system")
+
+	rows, err := db.Query("SELECT address FROM crdb_internal.gossip_nodes WHERE is_live ORDER BY node_id")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var addresses []string
+	for rows.Next() {
+		var address string
+		require.NoError(t, rows.Scan(&address))
+		addresses = append(addresses, address)
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, addresses, replicas)
+
+	domain := fmt.Sprintf(".%s.%s.svc.", crdbCluster.StatefulSetName, crdbCluster.Namespace)
+	for _, address := range addresses {
+		require.Contains(t, address, domain)
+		t.Logf("node advertises %s", address)
+	}
+}
+
 func getCount(t *testing.T, rows *sql.Rows) (count int) {
 	for rows.Next() {
 		err := rows.Scan(&count)
@@ -463,3 +494,192 @@ func WaitUntilPodDeleted(
 	}
 	log.Println(message)
 }
+
+// RequireSecretToBeRotatedEventually waits for the certificate of the secret to be replaced by a certificate valid
+// upto a later date than the given one, and returns the rotated secret.
+func RequireSecretToBeRotatedEventually(t *testing.T, crdbCluster CockroachCluster, secretName, validUpto string,
+	timeout time.Duration) *corev1.Secret {
+	kubectlOptions := k8s.NewKubectlOptions("", "", crdbCluster.Namespace)
+
+	var secret *corev1.Secret
+	err := wait.Poll(10*time.Second, timeout, func() (bool, error) {
+		secret = k8s.GetSecret(t, kubectlOptions, secretName)
+		if secret.Annotations["certificate-valid-upto"] == validUpto {
+			t.Logf("Waiting for the certificate of secret %s to be rotated", secretName)
+			return false, nil
+		}
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	previousExpiry, err := time.Parse(time.RFC3339, validUpto)
+	require.NoError(t, err)
+	newExpiry, err := time.Parse(time.RFC3339, secret.Annotations["certificate-valid-upto"])
+	require.NoError(t, err)
+	require.True(t, newExpiry.After(previousExpiry),
+		"certificate of secret %s rotated to expire at %s, before %s", secretName, newExpiry, previousExpiry)
+
+	return secret
+}
+
+// RequireNodesToServeCertificateEventually waits for each CRDB pod to serve the node certificate of the node secret,
+// that is for the pods to be restarted with the node certificate after it is rotated.
+func RequireNodesToServeCertificateEventually(t *testing.T, crdbCluster CockroachCluster, replicas int,
+	timeout time.Duration) {
+	kubectlOptions := k8s.NewKubectlOptions("", "", crdbCluster.Namespace)
+
+	dialer, err := kube.NewPodDialer(crdbCluster.Cfg, crdbCluster.Namespace)
+	require.NoError(t, err)
+
+	err = wait.Poll(10*time.Second, timeout, func() (bool, error) {
+		nodeCert := LoadCertificate(t, k8s.GetSecret(t, kubectlOptions, crdbCluster.NodeSecret), "tls.crt")
+
+		for i := 0; i < replicas; i++ {
+			podName := fmt.Sprintf("%s-%d", crdbCluster.StatefulSetName, i)
+			servedCert, err := servedCertificate(dialer, podName)
+			if err != nil {
+				t.Logf("Waiting for pod %s to serve its certificate: %v", podName, err)
+				return false, nil
+			}
+
+			if !servedCert.Equal(nodeCert) {
+				t.Logf("Waiting for pod %s to serve the node certificate valid upto %s instead of the one valid upto %s",
+					podName, nodeCert.NotAfter.Format(time.RFC3339), servedCert.NotAfter.Format(time.RFC3339))
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	require.NoError(t, err)
+}
+
+// servedCertificate returns the certificate served on the HTTP port of the CRDB pod.
+func servedCertificate(dialer *kube.PodDialer, podName string) (*x509.Certificate, error) {
+	conn, err := dialer.Dial("tcp", fmt.Sprintf("%s:8080", podName))
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificate is only compared to the one of the node secret, hence it doesn't need to be verified.
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	defer tlsConn.Close()
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	return tlsConn.ConnectionState().PeerCertificates[0], nil
+}
+
+// SQLTraffic inserts a row into a table of the CRDB cluster every second in the background. Each insert is sent to
+// the next pod of the cluster and falls back to the other pods, so that the traffic is only interrupted when none of
+// the pods can serve it, e.g. during a rolling restart of the cluster.
+type SQLTraffic struct {
+	crdbCluster CockroachCluster
+	conns       []*sql.DB
+	stop, done  chan struct{}
+
+	inserted      int
+	interruptions []error
+}
+
+const sqlTrafficTable = "test_db.sql_traffic"
+
+// StartSQLTraffic creates the table of the traffic and starts inserting into it.
+func StartSQLTraffic(t *testing.T, crdbCluster CockroachCluster, replicas int) *SQLTraffic {
+	db := getDBConn(t, crdbCluster, "system")
+	if _, err := db.Exec("CREATE DATABASE IF NOT EXISTS test_db"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INT PRIMARY KEY, pod INT)",
+		sqlTrafficTable)); err != nil {
+		t.Fatal(err)
+	}
+
+	traffic := &SQLTraffic{
+		crdbCluster: crdbCluster,
+		conns:       make([]*sql.DB, replicas),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go traffic.run(t)
+
+	return traffic
+}
+
+func (s *SQLTraffic) run(t *testing.T) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for id := 0; ; id++ {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.insert(id); err != nil {
+			t.Logf("SQL traffic interrupted: %v", err)
+			s.interruptions = append(s.interruptions, err)
+			continue
+		}
+		s.inserted++
+	}
+}
+
+// insert sends the insert of the row to the pods in turn until one of them serves it.
+func (s *SQLTraffic) insert(id int) (err error) {
+	for i := range s.conns {
+		ordinal := (id + i) % len(s.conns)
+
+		if s.conns[ordinal] == nil {
+			if s.conns[ordinal], err = openDBConn(s.crdbCluster, ordinal, "system"); err != nil {
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err = s.conns[ordinal].ExecContext(ctx,
+			fmt.Sprintf("UPSERT INTO %s (id, pod) VALUES ($1, $2)", sqlTrafficTable), id, ordinal)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		// The pod may have been restarted with rotated certificates, hence the connection is opened again with the
+		// certificates of the secrets on the next insert.
+		s.conns[ordinal].Close()
+		s.conns[ordinal] = nil
+	}
+
+	return err
+}
+
+// RequireSQLTrafficToBeUninterrupted stops the traffic and checks that none of the inserts was interrupted and that
+// all the inserted rows are found in the table.
+func RequireSQLTrafficToBeUninterrupted(t *testing.T, traffic *SQLTraffic) {
+	close(traffic.stop)
+	<-traffic.done
+
+	for _, conn := range traffic.conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+
+	require.Empty(t, traffic.interruptions, "SQL traffic was interrupted")
+	require.NotZero(t, traffic.inserted, "no row was inserted by the SQL traffic")
+
+	db := getDBConn(t, traffic.crdbCluster, "system")
+	rows, err := db.Query(fmt.Sprintf("SELECT COUNT(*) FROM %s", sqlTrafficTable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	require.Equal(t, traffic.inserted, getCount(t, rows))
+
+	t.Logf("SQL traffic inserted %d rows without interruption", traffic.inserted)
+}